@@ -0,0 +1,115 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Событие пересечения ценового уровня
+type PriceAlert struct {
+	Contract  string  `json:"contract"`
+	Level     float64 `json:"level"`
+	Direction string  `json:"direction"` // "above": best bid rose above the level, "below": best ask fell below it
+	BestBid   float64 `json:"best_bid"`
+	BestAsk   float64 `json:"best_ask"`
+	Time      int64   `json:"time"` // Unix ms
+}
+
+// Алерты на пересечение заданных ценовых уровней по контрактам.
+// Алерт срабатывает один раз при переходе рынка за уровень и снова
+// взводится только после возврата рынка к уровню.
+type priceAlerts struct {
+	levels  map[string]float64
+	state   map[string]string // Last direction per contract: "above", "below" or ""
+	webhook string
+	save    bool // Save the book when an alert fires (done by the saver, see queueAlertSave)
+}
+
+func newPriceAlerts(levels map[string]float64, webhook string, save bool) *priceAlerts {
+	return &priceAlerts{levels: levels, state: make(map[string]string), webhook: webhook, save: save}
+}
+
+// Разбор уровней вида "BTC_USDT=65000,ETH_USDT=3500"
+func ParsePriceLevels(s string) (map[string]float64, error) {
+	return parseContractValues(s, "price level", "PRICE")
+}
+
+// Разбор положительных значений по контрактам вида "CONTRACT=VALUE,..."
+func parseContractValues(s, what, placeholder string) (map[string]float64, error) {
+	values := make(map[string]float64)
+	if strings.TrimSpace(s) == "" {
+		return values, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		contract, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || contract == "" {
+			return nil, fmt.Errorf("invalid %s %q, expected CONTRACT=%s", what, entry, placeholder)
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s for %s: %q", what, contract, value)
+		}
+		values[contract] = parsed
+	}
+	return values, nil
+}
+
+// Проверка ордербука; возвращает сработавший алерт
+func (a *priceAlerts) Check(contract string, orderbook OrderBookResponse) (PriceAlert, bool) {
+	level, ok := a.levels[contract]
+	if !ok {
+		return PriceAlert{}, false
+	}
+
+	bid, ask, hasBid, hasAsk := bestPrices(orderbook)
+	direction := ""
+	switch {
+	case hasBid && bid > level:
+		direction = "above"
+	case hasAsk && ask < level:
+		direction = "below"
+	}
+
+	previous := a.state[contract]
+	a.state[contract] = direction
+	if direction == "" || direction == previous {
+		return PriceAlert{}, false
+	}
+
+	alert := PriceAlert{
+		Contract:  contract,
+		Level:     level,
+		Direction: direction,
+		BestBid:   bid,
+		BestAsk:   ask,
+		Time:      time.Now().UnixMilli(),
+	}
+	warnf("Price alert: %s crossed %s %v (bid %v, ask %v)", contract, direction, level, bid, ask)
+
+	if a.webhook != "" {
+		go postAlert(a.webhook, alert)
+	}
+	return alert, true
+}
+
+// Отправка алерта (PriceAlert, LiquidityAlert) на webhook клиентом без подписи
+func postAlert(url string, alert interface{}) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		errorf("Alert encode error: %v", err)
+		return
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		errorf("Alert webhook error: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		warnf("alert webhook returned status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,173 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePriceLevels(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{"", map[string]float64{}, false},
+		{"BTC_USDT=65000, ETH_USDT=3500.5", map[string]float64{"BTC_USDT": 65000, "ETH_USDT": 3500.5}, false},
+		{"BTC_USDT", nil, true},
+		{"=65000", nil, true},
+		{"BTC_USDT=0", nil, true},
+		{"BTC_USDT=high", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePriceLevels(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("levels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceAlertFiresOncePerCrossing(t *testing.T) {
+	newTestTracker(t, nil)
+	captureLog(t)
+	alerts := newPriceAlerts(map[string]float64{"BTC_USDT": 100}, "", false)
+	steps := []struct {
+		book          OrderBookResponse
+		wantDirection string // "" - no alert
+	}{
+		{testBook(1, levels("101:1"), levels("99:1")), ""},
+		{testBook(1, levels("101:1"), levels("100.5:1")), "above"},
+		// Рынок остается выше уровня: повторного алерта нет
+		{testBook(1, levels("101.5:1"), levels("100.7:1")), ""},
+		{testBook(1, levels("102:1"), levels("101:1")), ""},
+		// Возврат к уровню взводит алерт снова
+		{testBook(1, levels("100.5:1"), levels("99.5:1")), ""},
+		{testBook(1, levels("99.8:1"), levels("99:1")), "below"},
+		{testBook(1, levels("101:1"), levels("100.1:1")), "above"},
+	}
+	for i, step := range steps {
+		alert, fired := alerts.Check("BTC_USDT", step.book)
+		if fired != (step.wantDirection != "") || alert.Direction != step.wantDirection {
+			t.Errorf("step %d: alert %v (%q), want %q", i, fired, alert.Direction, step.wantDirection)
+		}
+	}
+	if _, fired := alerts.Check("ETH_USDT", testBook(1, levels("1:1"), levels("1000:1"))); fired {
+		t.Error("alert fired for a contract without a level")
+	}
+}
+
+// Локальный webhook: адрес для Config.AlertWebhook
+func serveWebhook(t testing.TB, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL + "/hook"
+}
+
+func TestPriceAlertWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []PriceAlert
+	hook := serveWebhook(t, func(w http.ResponseWriter, r *http.Request) {
+		// Ключ API не должен уходить на сторонний адрес
+		if r.Header.Get("KEY") != "" || r.Header.Get("SIGN") != "" {
+			t.Errorf("webhook request carries API credentials: %v", r.Header)
+		}
+		var alert PriceAlert
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &alert); err != nil {
+			t.Errorf("webhook body %q: %v", body, err)
+		}
+		mu.Lock()
+		received = append(received, alert)
+		mu.Unlock()
+	})
+	newTestTracker(t, func(cfg *Config) {
+		cfg.PriceAlerts = map[string]float64{"BTC_USDT": 100}
+		cfg.AlertWebhook = hook
+		cfg.AlertSave = false
+	})
+	apiKeys = apiCredentials{key: "key", secret: "secret"}
+	t.Cleanup(func() { apiKeys = apiCredentials{} })
+	captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	// Несколько обновлений выше уровня дают один алерт
+	for i, bid := range []string{"100.2:1", "100.4:1", "100.6:1"} {
+		id := int64(101 + i)
+		handleWebSocketMessage(updateMessage("BTC_USDT", id, id, nil, levels(bid)), time.Now().UnixNano())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("webhook calls = %d, want 1", len(received))
+	}
+	if got := received[0]; got.Contract != "BTC_USDT" || got.Direction != "above" || got.Level != 100 || got.BestBid != 100.2 {
+		t.Errorf("alert = %+v, want BTC_USDT above 100 with bid 100.2", got)
+	}
+}
+
+func TestPriceAlertSaveQueued(t *testing.T) {
+	tests := []struct {
+		name     string
+		saver    bool
+		paused   bool
+		wantSave bool
+	}{
+		{"saver enabled", true, false, true},
+		{"saver disabled", false, false, false},
+		{"contract paused", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := chdirTemp(t)
+			captureLog(t)
+			newTestTracker(t, func(cfg *Config) {
+				cfg.PriceAlerts = map[string]float64{"BTC_USDT": 100}
+				cfg.SaverEnabled = tt.saver
+			})
+			if tt.paused {
+				pausedContracts.Pause("BTC_USDT")
+			}
+			applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+			handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, nil, levels("100.5:1")), time.Now().UnixNano())
+
+			// Файл не пишется в цикле чтения: сохранение ждет горутину сохранения
+			if _, err := os.Stat(filepath.Join(dir, "orderbooks", "BTC_USDT.txt")); !os.IsNotExist(err) {
+				t.Errorf("book saved inline on the alert: %v", err)
+			}
+			if queued := len(alertSaves) == 1; queued != tt.wantSave {
+				t.Fatalf("alert save queued = %v, want %v", queued, tt.wantSave)
+			}
+			if !tt.wantSave {
+				return
+			}
+			if s := <-alertSaves; s.contract != "BTC_USDT" || levelSpecs(s.orderbook.Bids) != "100.5:1 99:1" {
+				t.Errorf("queued save = %s %s, want the book at the alert", s.contract, levelSpecs(s.orderbook.Bids))
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Лучшие цены bid/ask (уровни могут быть не отсортированы): лучший
+// уровень выбирается точным сравнением цен, затем переводится во float64
+func bestPrices(ob OrderBookResponse) (bid, ask float64, hasBid, hasAsk bool) {
+	bid, hasBid = extremePrice(ob.Bids, 1)
+	ask, hasAsk = extremePrice(ob.Asks, -1)
+	return bid, ask, hasBid, hasAsk
+}
+
+// Наибольшая (sign=1) или наименьшая (sign=-1) разбираемая цена уровней
+func extremePrice(levels []OrderBookItem, sign int) (float64, bool) {
+	best := -1
+	for i, level := range levels {
+		if !validPrice(level.P) {
+			continue
+		}
+		if best < 0 || comparePrices(level.P, levels[best].P)*sign > 0 {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	return levelPrice(levels[best])
+}
+
+// Первый уровень стороны; ok=false, если сторона пуста или цена не разбирается
+func topLevel(levels []OrderBookItem) (price, size float64, ok bool) {
+	if len(levels) == 0 {
+		return 0, 0, false
+	}
+	price, ok = levelPrice(levels[0])
+	if !ok {
+		return 0, 0, false
+	}
+	return price, levels[0].S.InexactFloat64(), true
+}
+
+// Лучший bid. Книга должна быть отсортирована (bids по убыванию цены),
+// как книги из хранилища; ok=false, если сторона пуста.
+func (ob OrderBookResponse) BestBid() (price, size float64, ok bool) {
+	return topLevel(ob.Bids)
+}
+
+// Лучший ask. Книга должна быть отсортирована (asks по возрастанию цены);
+// ok=false, если сторона пуста.
+func (ob OrderBookResponse) BestAsk() (price, size float64, ok bool) {
+	return topLevel(ob.Asks)
+}
+
+// Спред между лучшими ask и bid; ok=false, если одна из сторон пуста
+func (ob OrderBookResponse) Spread() (float64, bool) {
+	bid, _, hasBid := ob.BestBid()
+	ask, _, hasAsk := ob.BestAsk()
+	if !hasBid || !hasAsk {
+		return 0, false
+	}
+	return ask - bid, true
+}
+
+// Середина между лучшими bid и ask; ok=false, если одна из сторон пуста
+func (ob OrderBookResponse) MidPrice() (float64, bool) {
+	bid, _, hasBid := ob.BestBid()
+	ask, _, hasAsk := ob.BestAsk()
+	if !hasBid || !hasAsk {
+		return 0, false
+	}
+	return (bid + ask) / 2, true
+}
+
+// Сторона ордербука
+type Side int
+
+const (
+	Bid Side = iota
+	Ask
+)
+
+// Уровни стороны
+func (ob OrderBookResponse) levels(side Side) []OrderBookItem {
+	if side == Bid {
+		return ob.Bids
+	}
+	return ob.Asks
+}
+
+// Средневзвешенная по объему цена первых depth уровней стороны (всех, если
+// уровней меньше). Книга должна быть отсортирована; ok=false, если depth <= 0
+// или на стороне нет объема.
+func (ob OrderBookResponse) VWAP(side Side, depth int) (float64, bool) {
+	if depth <= 0 {
+		return 0, false
+	}
+	levels := ob.levels(side)
+	if len(levels) > depth {
+		levels = levels[:depth]
+	}
+
+	cost, total := 0.0, 0.0
+	for _, level := range levels {
+		price, ok := levelPrice(level)
+		size := level.S.InexactFloat64()
+		if !ok || size <= 0 {
+			continue
+		}
+		cost += price * size
+		total += size
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return cost / total, true
+}
+
+// Суммарный объем первых depth уровней
+func topSize(levels []OrderBookItem, depth int) float64 {
+	if len(levels) > depth {
+		levels = levels[:depth]
+	}
+	total := decimal.Zero
+	for _, level := range levels {
+		total = total.Add(level.S)
+	}
+	return total.InexactFloat64()
+}
+
+// Дисбаланс объема первых depth уровней, (bids - asks) / (bids + asks), в [-1, 1]:
+// больше нуля - перевес покупателей. Книга должна быть отсортирована;
+// ok=false, если depth <= 0 или обе стороны пусты.
+func (ob OrderBookResponse) Imbalance(depth int) (float64, bool) {
+	if depth <= 0 {
+		return 0, false
+	}
+	bids, asks := topSize(ob.Bids, depth), topSize(ob.Asks, depth)
+	if bids+asks <= 0 {
+		return 0, false
+	}
+	return (bids - asks) / (bids + asks), true
+}
+
+// Объем уровней не дальше bps от mid по сторонам; нули, если mid не определен
+func LiquidityWithinBps(ob OrderBookResponse, bps float64) (bids, asks float64) {
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	mid := (bid + ask) / 2
+	if !hasBid || !hasAsk || mid <= 0 {
+		return 0, 0
+	}
+
+	low, high := mid*(1-bps/10000), mid*(1+bps/10000)
+	bidSize, askSize := decimal.Zero, decimal.Zero
+	for _, level := range ob.Bids {
+		if price, ok := levelPrice(level); ok && price >= low {
+			bidSize = bidSize.Add(level.S)
+		}
+	}
+	for _, level := range ob.Asks {
+		if price, ok := levelPrice(level); ok && price <= high {
+			askSize = askSize.Add(level.S)
+		}
+	}
+	return bidSize.InexactFloat64(), askSize.InexactFloat64()
+}
+
+// Отклонение цены от референсной в базисных пунктах
+func basisBps(price, refPrice float64) float64 {
+	return (price - refPrice) / refPrice * 10000
+}
+
+// Базис mid/bid/ask относительно внешней референсной цены в bps.
+// Значения, которые нельзя вычислить (пустая сторона, refPrice <= 0), равны NaN.
+func Basis(ob OrderBookResponse, refPrice float64) (midBasisBps, bidBasisBps, askBasisBps float64) {
+	midBasisBps, bidBasisBps, askBasisBps = math.NaN(), math.NaN(), math.NaN()
+	if refPrice <= 0 {
+		return
+	}
+
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	if hasBid {
+		bidBasisBps = basisBps(bid, refPrice)
+	}
+	if hasAsk {
+		askBasisBps = basisBps(ask, refPrice)
+	}
+	if hasBid && hasAsk {
+		midBasisBps = basisBps((bid+ask)/2, refPrice)
+	}
+	return
+}
+
+// Сводная статистика спредов по всем контрактам
+type MarketSummary struct {
+	Contracts    int      `json:"contracts"`
+	Included     int      `json:"included"`
+	Excluded     int      `json:"excluded"`   // Crossed, locked or below the minimum spread
+	Incomplete   int      `json:"incomplete"` // Empty or one-sided books
+	AvgSpreadBps *float64 `json:"avg_spread_bps"`
+}
+
+// Спред в bps от mid; ok=false, если одна из сторон пуста
+func spreadBps(ob OrderBookResponse) (float64, bool) {
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	if !hasBid || !hasAsk {
+		return 0, false
+	}
+	mid := (bid + ask) / 2
+	if mid <= 0 {
+		return 0, false
+	}
+	return (ask - bid) / mid * 10000, true
+}
+
+// Сводка по рынку: контракты со спредом ниже minSpreadBps, а также
+// перевернутые/запертые книги (спред <= 0) в среднее не включаются
+func summarizeMarket(books map[string]OrderBookResponse, minSpreadBps float64) MarketSummary {
+	summary := MarketSummary{Contracts: len(books)}
+	total := 0.0
+	for _, ob := range books {
+		spread, ok := spreadBps(ob)
+		if !ok {
+			summary.Incomplete++
+			continue
+		}
+		if spread <= 0 || spread < minSpreadBps {
+			summary.Excluded++
+			continue
+		}
+		summary.Included++
+		total += spread
+	}
+	if summary.Included > 0 {
+		avg := total / float64(summary.Included)
+		summary.AvgSpreadBps = &avg
+	}
+	return summary
+}
+
+// Средневзвешенная цена исполнения объема size по уровням (уже отсортированным от лучшего)
+func fillVWAP(levels []OrderBookItem, size float64) (float64, bool) {
+	remaining, cost := size, 0.0
+	for _, level := range levels {
+		price, ok := levelPrice(level)
+		if !ok {
+			continue
+		}
+		take := math.Min(level.S.InexactFloat64(), remaining)
+		cost += take * price
+		remaining -= take
+		if remaining <= 0 {
+			return cost / size, true
+		}
+	}
+	return 0, false
+}
+
+// Эффективный спред для объема size в bps от mid: разница между VWAP покупки
+// (по asks) и VWAP продажи (по bids). Ошибка, если объема на стороне не хватает.
+func EffectiveSpread(ob OrderBookResponse, size float64) (bps float64, err error) {
+	if size <= 0 {
+		return 0, fmt.Errorf("size must be positive, got %v", size)
+	}
+
+	sorted := sortOrderBook(ob)
+	buyPrice, ok := fillVWAP(sorted.Asks, size)
+	if !ok {
+		return 0, fmt.Errorf("insufficient ask liquidity for size %v", size)
+	}
+	sellPrice, ok := fillVWAP(sorted.Bids, size)
+	if !ok {
+		return 0, fmt.Errorf("insufficient bid liquidity for size %v", size)
+	}
+
+	bid, ask, _, _ := bestPrices(ob)
+	mid := (bid + ask) / 2
+	if mid <= 0 {
+		return 0, fmt.Errorf("invalid mid price %v", mid)
+	}
+	return (buyPrice - sellPrice) / mid * 10000, nil
+}
+
+// Уровни стороны ордербука по имени: "bid"/"bids" или "ask"/"asks"
+func sideLevels(ob OrderBookResponse, side string) ([]OrderBookItem, bool) {
+	switch side {
+	case "bid", "bids":
+		return ob.Bids, true
+	case "ask", "asks":
+		return ob.Asks, true
+	}
+	return nil, false
+}
+
+// Концентрация ликвидности на стороне ордербука: нормированный индекс
+// Херфиндаля по долям объема уровней, (HHI - 1/n) / (1 - 1/n).
+// 0 - объем распределен равномерно, 1 - весь объем на одном уровне.
+// Для пустой стороны или неизвестного side возвращается 0.
+func LiquidityConcentration(ob OrderBookResponse, side string) float64 {
+	levels, ok := sideLevels(ob, side)
+	if !ok {
+		return 0
+	}
+
+	total, n := 0.0, 0
+	for _, level := range levels {
+		if level.S.IsPositive() {
+			total += level.S.InexactFloat64()
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	if n == 1 {
+		return 1
+	}
+
+	hhi := 0.0
+	for _, level := range levels {
+		if level.S.IsPositive() {
+			share := level.S.InexactFloat64() / total
+			hhi += share * share
+		}
+	}
+	floor := 1 / float64(n)
+	return (hhi - floor) / (1 - floor)
+}
+
+// Объем по полосам удаленности от mid в процентах. bands - возрастающие
+// верхние границы полос, например [0.1, 0.5, 1] дает полосы 0-0.1%,
+// 0.1-0.5% и 0.5-1%. Уровни дальше последней границы не учитываются.
+// Для книги без одной из сторон (mid не определен) суммы нулевые.
+func BandedLiquidity(ob OrderBookResponse, bands []float64) (bidBands, askBands []float64) {
+	bidBands = make([]float64, len(bands))
+	askBands = make([]float64, len(bands))
+
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	mid := (bid + ask) / 2
+	if !hasBid || !hasAsk || mid <= 0 {
+		return bidBands, askBands
+	}
+
+	addToBands := func(sums []float64, levels []OrderBookItem, isBid bool) {
+		for _, level := range levels {
+			price, ok := levelPrice(level)
+			if !ok {
+				continue
+			}
+			distance := (price - mid) / mid * 100
+			if isBid {
+				distance = -distance
+			}
+			for i, upper := range bands {
+				if distance <= upper {
+					sums[i] += level.S.InexactFloat64()
+					break
+				}
+			}
+		}
+	}
+	addToBands(bidBands, ob.Bids, true)
+	addToBands(askBands, ob.Asks, false)
+	return bidBands, askBands
+}
+
+// Разбор границ полос в процентах вида "0.1,0.5,1"
+func parseBands(s string) ([]float64, error) {
+	var bands []float64
+	for _, part := range strings.Split(s, ",") {
+		band, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || band <= 0 {
+			return nil, fmt.Errorf("invalid band %q", part)
+		}
+		if len(bands) > 0 && band <= bands[len(bands)-1] {
+			return nil, fmt.Errorf("bands must be increasing, got %v after %v", band, bands[len(bands)-1])
+		}
+		bands = append(bands, band)
+	}
+	return bands, nil
+}
+
+// Цена уровня, на котором накопленный от лучшей цены объем стороны
+// впервые достигает cumSize; reached=false, если объема на стороне не хватает
+func PriceAtDepth(ob OrderBookResponse, side string, cumSize float64) (price float64, reached bool) {
+	sorted := sortOrderBook(ob)
+	levels, ok := sideLevels(sorted, side)
+	if !ok {
+		return 0, false
+	}
+
+	total := 0.0
+	for _, level := range levels {
+		total += level.S.InexactFloat64()
+		if total >= cumSize {
+			return levelPrice(level)
+		}
+	}
+	return 0, false
+}
+
+// Число уровней с каждой стороны, по которым оценивается PriceImpactCoefficient
+const priceImpactLevels = 10
+
+// Коэффициент ценового воздействия в духе лямбды Кайла: на сколько цена
+// уходит от mid на единицу объема, съеденного у вершины книги. Для первых
+// priceImpactLevels уровней каждой стороны берутся точки (накопленный объем
+// до уровня включительно, |цена уровня - mid|); наклон прямой, проведенной
+// по точкам обеих сторон методом наименьших квадратов, и есть коэффициент
+// (свободный член прямой поглощает половину спреда). NaN, если mid не
+// определен или точек меньше двух с разным объемом (тонкая книга).
+func PriceImpactCoefficient(ob OrderBookResponse) float64 {
+	sorted := sortOrderBook(ob)
+	mid, ok := sorted.MidPrice()
+	if !ok || mid <= 0 {
+		return math.NaN()
+	}
+
+	var sizes, distances []float64
+	addPoints := func(levels []OrderBookItem) {
+		if len(levels) > priceImpactLevels {
+			levels = levels[:priceImpactLevels]
+		}
+		cumulative := 0.0
+		for _, level := range levels {
+			price, ok := levelPrice(level)
+			if !ok || !level.S.IsPositive() {
+				continue
+			}
+			cumulative += level.S.InexactFloat64()
+			sizes = append(sizes, cumulative)
+			distances = append(distances, math.Abs(price-mid))
+		}
+	}
+	addPoints(sorted.Bids)
+	addPoints(sorted.Asks)
+
+	n := float64(len(sizes))
+	if n < 2 {
+		return math.NaN()
+	}
+	meanSize, meanDistance := 0.0, 0.0
+	for i := range sizes {
+		meanSize += sizes[i]
+		meanDistance += distances[i]
+	}
+	meanSize /= n
+	meanDistance /= n
+
+	covariance, variance := 0.0, 0.0
+	for i := range sizes {
+		covariance += (sizes[i] - meanSize) * (distances[i] - meanDistance)
+		variance += (sizes[i] - meanSize) * (sizes[i] - meanSize)
+	}
+	if variance == 0 {
+		return math.NaN()
+	}
+	return covariance / variance
+}
@@ -0,0 +1,444 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Сравнение результатов аналитики с точностью до ошибок округления float64
+func near(got, want float64) bool {
+	return math.Abs(got-want) <= 1e-9*math.Max(1, math.Abs(want))
+}
+
+func TestTopOfBookHelpers(t *testing.T) {
+	tests := []struct {
+		name      string
+		book      OrderBookResponse
+		wantBid   float64
+		wantAsk   float64
+		wantMid   float64
+		wantSprd  float64
+		wantBidOK bool
+		wantAskOK bool
+	}{
+		{"two-sided book", testBook(1, levels("101:2", "102:5"), levels("100:3", "99:1")), 100, 101, 100.5, 1, true, true},
+		{"no asks", testBook(1, nil, levels("100:3")), 100, 0, 0, 0, true, false},
+		{"no bids", testBook(1, levels("101:2"), nil), 0, 101, 0, 0, false, true},
+		{"empty book", testBook(1, nil, nil), 0, 0, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bid, _, bidOK := tt.book.BestBid()
+			ask, _, askOK := tt.book.BestAsk()
+			if bidOK != tt.wantBidOK || askOK != tt.wantAskOK || bid != tt.wantBid || ask != tt.wantAsk {
+				t.Errorf("best = %v (%v) / %v (%v), want %v (%v) / %v (%v)",
+					bid, bidOK, ask, askOK, tt.wantBid, tt.wantBidOK, tt.wantAsk, tt.wantAskOK)
+			}
+			twoSided := tt.wantBidOK && tt.wantAskOK
+			spread, ok := tt.book.Spread()
+			if ok != twoSided || spread != tt.wantSprd {
+				t.Errorf("spread = %v (%v), want %v (%v)", spread, ok, tt.wantSprd, twoSided)
+			}
+			mid, ok := tt.book.MidPrice()
+			if ok != twoSided || mid != tt.wantMid {
+				t.Errorf("mid = %v (%v), want %v (%v)", mid, ok, tt.wantMid, twoSided)
+			}
+		})
+	}
+}
+
+func TestBestLevelSize(t *testing.T) {
+	book := testBook(1, levels("101:2.5"), levels("100:0.125"))
+	if _, size, _ := book.BestBid(); size != 0.125 {
+		t.Errorf("best bid size = %v, want 0.125", size)
+	}
+	if _, size, _ := book.BestAsk(); size != 2.5 {
+		t.Errorf("best ask size = %v, want 2.5", size)
+	}
+}
+
+func TestVWAP(t *testing.T) {
+	book := testBook(1, levels("101:1", "102:3", "110:100"), levels("100:2", "99:2"))
+	tests := []struct {
+		name   string
+		side   Side
+		depth  int
+		want   float64
+		wantOK bool
+	}{
+		{"best ask only", Ask, 1, 101, true},
+		{"two ask levels", Ask, 2, 101.75, true},
+		{"depth beyond the book", Bid, 10, 99.5, true},
+		{"zero depth", Ask, 0, 0, false},
+		{"negative depth", Bid, -1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := book.VWAP(tt.side, tt.depth)
+			if ok != tt.wantOK || !near(got, tt.want) {
+				t.Errorf("VWAP = %v (%v), want %v (%v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := testBook(1, nil, levels("100:0")).VWAP(Bid, 5); ok {
+		t.Error("VWAP reported for a side without volume")
+	}
+}
+
+func TestImbalance(t *testing.T) {
+	book := testBook(1, levels("101:1", "102:1"), levels("100:3", "99:1"))
+	tests := []struct {
+		name   string
+		book   OrderBookResponse
+		depth  int
+		want   float64
+		wantOK bool
+	}{
+		{"top level", book, 1, 0.5, true},
+		{"two levels", book, 2, 1.0 / 3, true},
+		{"depth beyond the book", book, 10, 1.0 / 3, true},
+		{"only bids", testBook(1, nil, levels("100:3")), 5, 1, true},
+		{"only asks", testBook(1, levels("101:2"), nil), 5, -1, true},
+		{"zero depth", book, 0, 0, false},
+		{"empty book", testBook(1, nil, nil), 5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.book.Imbalance(tt.depth)
+			if ok != tt.wantOK || !near(got, tt.want) {
+				t.Errorf("imbalance = %v (%v), want %v (%v)", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestEffectiveSpread(t *testing.T) {
+	book := testBook(1, levels("101:1", "102:1"), levels("100:1", "99:1"))
+	tests := []struct {
+		name    string
+		book    OrderBookResponse
+		size    float64
+		want    float64
+		wantErr string
+	}{
+		{"fills at the top", book, 1, 1 / 100.5 * 10000, ""},
+		{"walks two levels", book, 2, (101.5 - 99.5) / 100.5 * 10000, ""},
+		{"partial level", book, 1.5, (304.0/3 - 299.0/3) / 100.5 * 10000, ""},
+		{"unsorted levels", testBook(1, levels("102:1", "101:1"), levels("99:1", "100:1")), 1, 1 / 100.5 * 10000, ""},
+		{"not enough asks", book, 3, 0, "insufficient ask liquidity for size 3"},
+		{"not enough bids", testBook(1, levels("101:5"), levels("100:1")), 2, 0, "insufficient bid liquidity for size 2"},
+		{"zero size", book, 0, 0, "size must be positive, got 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EffectiveSpread(tt.book, tt.size)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !near(got, tt.want) {
+				t.Errorf("effective spread = %v (%v), want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiquidityConcentration(t *testing.T) {
+	book := testBook(1, levels("101:2", "102:2", "103:2"), levels("100:3", "99:1", "98:0"))
+	tests := []struct {
+		name string
+		book OrderBookResponse
+		side string
+		want float64
+	}{
+		{"evenly spread", book, "asks", 0},
+		{"uneven, empty levels ignored", book, "bid", 0.25},
+		{"single level", testBook(1, levels("101:5"), nil), "ask", 1},
+		{"empty side", testBook(1, nil, nil), "bids", 0},
+		{"unknown side", book, "mid", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LiquidityConcentration(tt.book, tt.side); !near(got, tt.want) {
+				t.Errorf("concentration = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Книга с mid 100 и уровнями на расстоянии 0.05%, 0.3-0.4%, 0.8% и 2% от mid
+func bandsBook() OrderBookResponse {
+	return testBook(1,
+		levels("100.05:1", "100.3:2", "100.8:4", "102:8"),
+		levels("99.95:1", "99.6:3", "99.2:5", "98:8"))
+}
+
+func TestBandedLiquidity(t *testing.T) {
+	tests := []struct {
+		name     string
+		book     OrderBookResponse
+		bands    []float64
+		wantBids string
+		wantAsks string
+	}{
+		{"levels beyond the last band skipped", bandsBook(), []float64{0.1, 0.5, 1}, "[1 3 5]", "[1 2 4]"},
+		{"single wide band", bandsBook(), []float64{5}, "[17]", "[15]"},
+		{"one-sided book", testBook(1, nil, levels("99:1")), []float64{0.1, 1}, "[0 0]", "[0 0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bids, asks := BandedLiquidity(tt.book, tt.bands)
+			if got := fmt.Sprint(bids); got != tt.wantBids {
+				t.Errorf("bid bands = %s, want %s", got, tt.wantBids)
+			}
+			if got := fmt.Sprint(asks); got != tt.wantAsks {
+				t.Errorf("ask bands = %s, want %s", got, tt.wantAsks)
+			}
+		})
+	}
+}
+
+func TestParseBands(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"0.1,0.5,1", "[0.1 0.5 1]", false},
+		{" 0.25 , 2 ", "[0.25 2]", false},
+		{"0.5,0.1", "", true},
+		{"0.5,0.5", "", true},
+		{"0,1", "", true},
+		{"-1", "", true},
+		{"x", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			bands, err := parseBands(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && fmt.Sprint(bands) != tt.want {
+				t.Errorf("bands = %v, want %s", bands, tt.want)
+			}
+		})
+	}
+}
+
+func TestBandsEndpoint(t *testing.T) {
+	newTestTracker(t, nil)
+	orderbooks.Set("BTC_USDT", bandsBook())
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBids   string
+	}{
+		{"default bands", "/bands/BTC_USDT", http.StatusOK, "[1 3 5]"},
+		{"custom bands", "/bands/BTC_USDT?bands=0.5,5", http.StatusOK, "[4 13]"},
+		{"invalid bands", "/bands/BTC_USDT?bands=1,0.5", http.StatusBadRequest, ""},
+		{"unknown contract", "/bands/ETH_USDT", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleBands(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp bandsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(resp.Bids); resp.Contract != "BTC_USDT" || got != tt.wantBids {
+				t.Errorf("response = %s, want bids %s", rec.Body, tt.wantBids)
+			}
+		})
+	}
+}
+
+func TestPriceAtDepth(t *testing.T) {
+	// Уровни не отсортированы: PriceAtDepth считает объем от лучшей цены
+	book := testBook(1, levels("102:3", "101:1", "103:5"), levels("99:2", "100:2"))
+	tests := []struct {
+		name        string
+		side        string
+		cumSize     float64
+		want        float64
+		wantReached bool
+	}{
+		{"within the best ask", "ask", 0.5, 101, true},
+		{"exactly the best ask", "asks", 1, 101, true},
+		{"second ask level", "ask", 2, 102, true},
+		{"whole ask side", "ask", 9, 103, true},
+		{"beyond the asks", "ask", 9.5, 0, false},
+		{"second bid level", "bids", 3, 99, true},
+		{"unknown side", "mid", 1, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reached := PriceAtDepth(book, tt.side, tt.cumSize)
+			if reached != tt.wantReached || got != tt.want {
+				t.Errorf("price at depth = %v (%v), want %v (%v)", got, reached, tt.want, tt.wantReached)
+			}
+		})
+	}
+}
+
+// Книга с шагом цены step и объемом size на уровень, n уровней на сторону
+func linearBook(n int, step, size float64) OrderBookResponse {
+	var asks, bids []OrderBookItem
+	for i := 0; i < n; i++ {
+		asks = append(asks, levels(fmt.Sprintf("%g:%g", 101+step*float64(i), size))...)
+		bids = append(bids, levels(fmt.Sprintf("%g:%g", 100-step*float64(i), size))...)
+	}
+	return testBook(1, asks, bids)
+}
+
+func TestPriceImpactCoefficient(t *testing.T) {
+	deep := linearBook(priceImpactLevels, 1, 1)
+	// Уровни глубже priceImpactLevels не учитываются
+	deep.Asks = append(deep.Asks, levels("5000:1")...)
+	tests := []struct {
+		name string
+		book OrderBookResponse
+		want float64
+	}{
+		{"one unit per level", linearBook(5, 1, 1), 1},
+		{"thicker levels", linearBook(5, 1, 2), 0.5},
+		{"finer steps", linearBook(5, 0.5, 1), 0.5},
+		{"levels beyond the window ignored", deep, 1},
+		{"single level per side", linearBook(1, 1, 1), math.NaN()},
+		{"one-sided book", testBook(1, nil, levels("100:1", "99:1")), math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PriceImpactCoefficient(tt.book)
+			if math.IsNaN(tt.want) {
+				if !math.IsNaN(got) {
+					t.Errorf("coefficient = %v, want NaN", got)
+				}
+				return
+			}
+			if !near(got, tt.want) {
+				t.Errorf("coefficient = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBasis(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		book     OrderBookResponse
+		refPrice float64
+		wantMid  float64
+		wantBid  float64
+		wantAsk  float64
+	}{
+		{"two-sided book", testBook(1, levels("101:1"), levels("99:1")), 100, 0, -100, 100},
+		{"premium to the reference", testBook(1, levels("102:1"), levels("101:1")), 100, 150, 100, 200},
+		{"asks only", testBook(1, levels("101:1"), nil), 100, nan, nan, 100},
+		{"non-positive reference", testBook(1, levels("101:1"), levels("99:1")), 0, nan, nan, nan},
+	}
+	same := func(got, want float64) bool {
+		if math.IsNaN(want) {
+			return math.IsNaN(got)
+		}
+		return near(got, want)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mid, bid, ask := Basis(tt.book, tt.refPrice)
+			if !same(mid, tt.wantMid) || !same(bid, tt.wantBid) || !same(ask, tt.wantAsk) {
+				t.Errorf("basis = %v/%v/%v, want %v/%v/%v", mid, bid, ask, tt.wantMid, tt.wantBid, tt.wantAsk)
+			}
+		})
+	}
+}
+
+func TestBasisEndpoint(t *testing.T) {
+	newTestTracker(t, nil)
+	orderbooks.Set("BTC_USDT", testBook(1, levels("101:1"), levels("99:1")))
+	orderbooks.Set("ETH_USDT", testBook(1, levels("101:1"), nil))
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"two-sided book", "/basis/BTC_USDT?ref=100", http.StatusOK,
+			`{"contract":"BTC_USDT","ref_price":100,"mid_basis_bps":0,"bid_basis_bps":-100,"ask_basis_bps":100}`},
+		{"missing side is null", "/basis/ETH_USDT?ref=100", http.StatusOK,
+			`{"contract":"ETH_USDT","ref_price":100,"mid_basis_bps":null,"bid_basis_bps":null,"ask_basis_bps":100}`},
+		{"missing reference", "/basis/BTC_USDT", http.StatusBadRequest, ""},
+		{"negative reference", "/basis/BTC_USDT?ref=-1", http.StatusBadRequest, ""},
+		{"unknown contract", "/basis/SOL_USDT?ref=100", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleBasis(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(rec.Body.String()) != tt.wantBody {
+				t.Errorf("body = %s, want %s", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSummarizeMarket(t *testing.T) {
+	books := map[string]OrderBookResponse{
+		"WIDE_USDT":    testBook(1, levels("100.5:1"), levels("99.5:1")),
+		"TIGHT_USDT":   testBook(1, levels("100.05:1"), levels("99.95:1")),
+		"CROSSED_USDT": testBook(1, levels("99:1"), levels("100:1")),
+		"LOCKED_USDT":  testBook(1, levels("100:1"), levels("100:1")),
+		"ONESIDE_USDT": testBook(1, nil, levels("100:1")),
+		"EMPTY_USDT":   testBook(1, nil, nil),
+	}
+	tests := []struct {
+		name         string
+		minSpreadBps float64
+		wantIncluded int
+		wantExcluded int
+		wantAvg      float64
+	}{
+		{"no minimum", 0, 2, 2, 55},
+		{"tight spread filtered", 50, 1, 3, 100},
+		{"everything filtered", 500, 0, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := summarizeMarket(books, tt.minSpreadBps)
+			if summary.Contracts != 6 || summary.Incomplete != 2 ||
+				summary.Included != tt.wantIncluded || summary.Excluded != tt.wantExcluded {
+				t.Fatalf("summary = %+v, want 6 contracts, %d included, %d excluded, 2 incomplete",
+					summary, tt.wantIncluded, tt.wantExcluded)
+			}
+			if tt.wantIncluded == 0 {
+				if summary.AvgSpreadBps != nil {
+					t.Errorf("average spread = %v, want none", *summary.AvgSpreadBps)
+				}
+				return
+			}
+			if summary.AvgSpreadBps == nil || !near(*summary.AvgSpreadBps, tt.wantAvg) {
+				t.Errorf("average spread = %v, want %v", summary.AvgSpreadBps, tt.wantAvg)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package gateorderbook
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Размер очереди строк журнала изменений
+const changeLogQueue = 4096
+
+// Строка журнала изменений: примененная дельта контракта или загруженный
+// снимок, с которого применяются следующие дельты
+type changeLogEntry struct {
+	Ts       int64           `json:"ts"`                // Local receive time, unix ms
+	TimeMs   int64           `json:"time_ms,omitempty"` // Server time, unix ms
+	Contract string          `json:"contract"`
+	Snapshot bool            `json:"snapshot,omitempty"` // a/b hold the full book with id u
+	Gap      int64           `json:"gap,omitempty"`      // Entries dropped before this line; a snapshot follows
+	U        int64           `json:"U"`
+	End      int64           `json:"u"`
+	Asks     []OrderBookItem `json:"a"` // Size 0 removes the level
+	Bids     []OrderBookItem `json:"b"`
+}
+
+type changeLogLine struct {
+	contract string
+	t        time.Time
+	data     []byte
+}
+
+// Открытый файл журнала контракта: буфер -> сжатие (если включено) -> файл
+type changeLogFile struct {
+	f       *os.File
+	z       compressWriter // nil without compression
+	w       *bufio.Writer
+	size    int64  // Bytes written to the file, compressed if compression is on
+	day     string // UTC day the file was opened, for daily rotation
+	created time.Time
+}
+
+// Журнал изменений по контрактам (<symbol>.ndjson), одна JSON строка на
+// примененное обновление; в формате protobuf - поток сообщений с префиксом
+// длины (<symbol>.changes.pb). Запись идет в отдельной горутине через
+// очередь: обработка WebSocket не ждет диска, при переполненной очереди
+// строки отбрасываются и учитываются в метрике. Вместо первой строки после
+// потерь пишутся отметка разрыва и снимок книги, с которого продолжается
+// воспроизведение. Файл переименовывается в
+// <symbol>.<время открытия>.<расширение> при смене дня (UTC) или, если
+// задан maxBytes, по достижении этого размера. Со сжатием к расширению
+// добавляется .gz или .zst, а размер учитывается по сжатым данным.
+type changeLog struct {
+	dir      string
+	ext      string
+	encode   func(entry changeLogEntry) ([]byte, error)
+	compress compression
+	maxBytes int64
+	lines    chan changeLogLine
+	done     chan struct{}
+	files    map[string]*changeLogFile
+	gaps     map[string]int64 // Dropped entries not yet marked in the file; used by the feed goroutine only
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+// Кодирование строки журнала в JSON
+func encodeChangeLogJSON(entry changeLogEntry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Кодирование строки журнала в protobuf сообщение с префиксом длины
+func encodeChangeLogProtobuf(entry changeLogEntry) ([]byte, error) {
+	return marshalDelimited(changeLogMessage(entry))
+}
+
+func newChangeLog(dir, format string, compress compression, maxBytes int64, flushInterval time.Duration) (*changeLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create change log directory: %v", err)
+	}
+	ext, encode := "ndjson", encodeChangeLogJSON
+	if format == "protobuf" {
+		ext, encode = "changes.pb", encodeChangeLogProtobuf
+	}
+	l := &changeLog{
+		dir:      dir,
+		ext:      ext + compress.ext(),
+		encode:   encode,
+		compress: compress,
+		maxBytes: maxBytes,
+		lines:    make(chan changeLogLine, changeLogQueue),
+		done:     make(chan struct{}),
+		files:    make(map[string]*changeLogFile),
+		gaps:     make(map[string]int64),
+	}
+	go l.run(flushInterval)
+	return l, nil
+}
+
+// Постановка дельты в очередь записи; уровни кодируются сразу, так как
+// обновление ссылается на переиспользуемый буфер декодирования.
+// orderbook - книга после дельты: после потерянных строк вместо дельты
+// пишется она.
+func (l *changeLog) Append(contract string, receivedNs, msgTimeMs int64, update OrderBookUpdate, orderbook OrderBookResponse) {
+	if l.gaps[contract] > 0 {
+		l.AppendSnapshot(contract, orderbook)
+		return
+	}
+	l.enqueue(contract, receivedNs, changeLogEntry{
+		Ts:       receivedNs / int64(time.Millisecond),
+		TimeMs:   msgTimeMs,
+		Contract: contract,
+		U:        update.U,
+		End:      update.End,
+		Asks:     update.Asks,
+		Bids:     update.Bids,
+	})
+}
+
+// Постановка в очередь загруженного снимка (после потерянных строк - вместе
+// с отметкой разрыва)
+func (l *changeLog) AppendSnapshot(contract string, orderbook OrderBookResponse) {
+	if dropped := l.gaps[contract]; dropped > 0 {
+		marker := changeLogEntry{
+			Ts:       orderbook.ReceivedNs / int64(time.Millisecond),
+			Contract: contract,
+			Gap:      dropped,
+		}
+		if !l.enqueue(contract, orderbook.ReceivedNs, marker) {
+			return
+		}
+	}
+	if !l.enqueue(contract, orderbook.ReceivedNs, changeLogEntry{
+		Ts:       orderbook.ReceivedNs / int64(time.Millisecond),
+		TimeMs:   int64(orderbook.Update * 1000),
+		Contract: contract,
+		Snapshot: true,
+		End:      orderbook.ID,
+		Asks:     orderbook.Asks,
+		Bids:     orderbook.Bids,
+	}) {
+		return
+	}
+	if dropped := l.gaps[contract]; dropped > 0 {
+		delete(l.gaps, contract)
+		infof("Change log for %s resumed from a snapshot after %d dropped entries", contract, dropped)
+	}
+}
+
+// Постановка строки в очередь; false, если очередь переполнена и строка отброшена
+func (l *changeLog) enqueue(contract string, receivedNs int64, entry changeLogEntry) bool {
+	// Пустая сторона пишется как [], а не null
+	if entry.Asks == nil {
+		entry.Asks = []OrderBookItem{}
+	}
+	if entry.Bids == nil {
+		entry.Bids = []OrderBookItem{}
+	}
+	data, err := l.encode(entry)
+	if err != nil {
+		errorf("Failed to encode change log entry for %s: %v", contract, err)
+		return true
+	}
+	select {
+	case l.lines <- changeLogLine{contract: contract, t: time.Unix(0, receivedNs), data: data}:
+		return true
+	default:
+	}
+
+	l.mu.Lock()
+	l.dropped++
+	l.mu.Unlock()
+	metrics.Count("changelog.dropped."+contract, 1)
+	if l.gaps[contract] == 0 {
+		warnf("change log queue is full, dropping entries for %s until the writer catches up", contract)
+	}
+	l.gaps[contract]++
+	return false
+}
+
+// Число отброшенных из-за переполнения очереди строк
+func (l *changeLog) Dropped() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped
+}
+
+// Запись строк из очереди и периодический сброс буферов
+func (l *changeLog) run(flushInterval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-l.lines:
+			if !ok {
+				l.closeFiles()
+				return
+			}
+			if err := l.write(line); err != nil {
+				errorf("Error writing change log for %s: %v", line.contract, err)
+			}
+		case <-ticker.C:
+			for contract, cf := range l.files {
+				if err := cf.flush(); err != nil {
+					errorf("Error flushing change log for %s: %v", contract, err)
+				}
+			}
+		}
+	}
+}
+
+// Открытие (дописывание) файла журнала контракта
+func (l *changeLog) open(contract string, t time.Time) (*changeLogFile, error) {
+	filename := filepath.Join(l.dir, fmt.Sprintf("%s.%s", contract, l.ext))
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open change log %s: %v", filename, err)
+	}
+	// Второй писатель (другой экземпляр) не должен дописывать в тот же файл
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat change log %s: %v", filename, err)
+	}
+	// Для уже существующего файла днем открытия считается день его последней записи
+	opened := t
+	if info.Size() > 0 {
+		opened = info.ModTime()
+	}
+	cf := &changeLogFile{
+		f:       f,
+		size:    info.Size(),
+		day:     opened.UTC().Format("2006-01-02"),
+		created: opened,
+	}
+	if cf.z, err = l.compress.writer(fileCounter{cf}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to start compression of change log %s: %v", filename, err)
+	}
+	if cf.z != nil {
+		cf.w = bufio.NewWriterSize(cf.z, 64*1024)
+	} else {
+		cf.w = bufio.NewWriterSize(fileCounter{cf}, 64*1024)
+	}
+	return cf, nil
+}
+
+// Запись в файл журнала с учетом его размера
+type fileCounter struct{ cf *changeLogFile }
+
+func (c fileCounter) Write(p []byte) (int, error) {
+	n, err := c.cf.f.Write(p)
+	c.cf.size += int64(n)
+	return n, err
+}
+
+// Сброс буфера и сжатых данных в файл
+func (cf *changeLogFile) flush() error {
+	if err := cf.w.Flush(); err != nil {
+		return err
+	}
+	if cf.z != nil {
+		return cf.z.Flush()
+	}
+	return nil
+}
+
+// Сброс, завершение сжатого потока и закрытие файла
+func (cf *changeLogFile) close() error {
+	err := cf.w.Flush()
+	if cf.z != nil {
+		if zerr := cf.z.Close(); err == nil {
+			err = zerr
+		}
+	}
+	cf.f.Close()
+	return err
+}
+
+// Закрытие текущего файла контракта и переименование его в архивный
+func (l *changeLog) rotate(contract string, cf *changeLogFile) error {
+	delete(l.files, contract)
+	if err := cf.close(); err != nil {
+		return err
+	}
+	current := filepath.Join(l.dir, fmt.Sprintf("%s.%s", contract, l.ext))
+	stamp := cf.created.UTC().Format("20060102T150405.000")
+	archived := filepath.Join(l.dir, fmt.Sprintf("%s.%s.%s", contract, stamp, l.ext))
+	// Несколько ротаций в одну миллисекунду не должны затирать друг друга
+	for n := 1; ; n++ {
+		if _, err := os.Stat(archived); os.IsNotExist(err) {
+			break
+		}
+		archived = filepath.Join(l.dir, fmt.Sprintf("%s.%s-%d.%s", contract, stamp, n, l.ext))
+	}
+	return os.Rename(current, archived)
+}
+
+func (l *changeLog) write(line changeLogLine) error {
+	cf, ok := l.files[line.contract]
+	if ok {
+		// Данные в буфере еще не записаны в файл; со сжатием они учитываются
+		// несжатыми, и файл ротируется немного раньше
+		written := cf.size + int64(cf.w.Buffered())
+		full := l.maxBytes > 0 && written+int64(len(line.data)) > l.maxBytes && written > 0
+		newDay := l.maxBytes <= 0 && line.t.UTC().Format("2006-01-02") != cf.day
+		if full || newDay {
+			if err := l.rotate(line.contract, cf); err != nil {
+				return fmt.Errorf("failed to rotate: %v", err)
+			}
+			ok = false
+		}
+	}
+	if !ok {
+		var err error
+		if cf, err = l.open(line.contract, line.t); err != nil {
+			return err
+		}
+		l.files[line.contract] = cf
+	}
+	_, err := cf.w.Write(line.data)
+	return err
+}
+
+func (l *changeLog) closeFiles() {
+	for contract, cf := range l.files {
+		if err := cf.close(); err != nil {
+			errorf("Error flushing change log for %s: %v", contract, err)
+		}
+	}
+}
+
+// Запись оставшихся строк и закрытие файлов; Append после Close недопустим
+func (l *changeLog) Close() {
+	close(l.lines)
+	<-l.done
+}
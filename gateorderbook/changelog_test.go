@@ -0,0 +1,128 @@
+package gateorderbook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Строки NDJSON файла
+func readLines(t testing.TB, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestChangeLogAppendsLines(t *testing.T) {
+	tests := []struct {
+		format string
+		file   string
+	}{
+		{"json", "BTC_USDT.ndjson"},
+		{"protobuf", "BTC_USDT.changes.pb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			newTestTracker(t, nil)
+			dir := t.TempDir()
+			l, err := newChangeLog(dir, tt.format, compression{}, 0, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now().UnixNano()
+			book := testBook(100, levels("101:1"), levels("99:1"))
+			book.ReceivedNs = now
+			l.AppendSnapshot("BTC_USDT", book)
+			for id := int64(101); id <= 105; id++ {
+				l.Append("BTC_USDT", now, 0, OrderBookUpdate{Contract: "BTC_USDT", U: id, End: id, Bids: levels("99:2")}, book)
+			}
+			l.Close()
+
+			// Файл воспроизводится в ту же книгу
+			if err := replayChangeLog(context.Background(), filepath.Join(dir, tt.file), false, true); err != nil {
+				t.Fatal(err)
+			}
+			replayed, ok := orderbooks.Get("BTC_USDT")
+			if !ok || replayed.ID != 105 {
+				t.Fatalf("replayed book id = %d, want 105", replayed.ID)
+			}
+			if tt.format == "json" {
+				if lines := readLines(t, filepath.Join(dir, tt.file)); len(lines) != 6 {
+					t.Errorf("lines = %d, want 6", len(lines))
+				}
+			}
+		})
+	}
+}
+
+func TestChangeLogMarksDroppedEntries(t *testing.T) {
+	newTestTracker(t, nil)
+	dir := t.TempDir()
+	// Очередь на две строки без писателя: третья строка отбрасывается
+	l := &changeLog{
+		dir:    dir,
+		ext:    "ndjson",
+		encode: encodeChangeLogJSON,
+		lines:  make(chan changeLogLine, 2),
+		done:   make(chan struct{}),
+		files:  make(map[string]*changeLogFile),
+		gaps:   make(map[string]int64),
+	}
+	now := time.Now().UnixNano()
+	book := testBook(100, levels("101:1"), levels("99:1"))
+	book.ReceivedNs = now
+	l.AppendSnapshot("BTC_USDT", book)
+	l.Append("BTC_USDT", now, 0, OrderBookUpdate{Contract: "BTC_USDT", U: 101, End: 101, Bids: levels("99:2")}, book)
+	l.Append("BTC_USDT", now, 0, OrderBookUpdate{Contract: "BTC_USDT", U: 102, End: 102, Bids: levels("99:3")}, book)
+	if l.Dropped() != 1 {
+		t.Fatalf("dropped = %d, want 1", l.Dropped())
+	}
+
+	go l.run(time.Hour)
+	for len(l.lines) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	after := testBook(103, levels("101:1"), levels("99:4"))
+	after.ReceivedNs = now
+	l.Append("BTC_USDT", now, 0, OrderBookUpdate{Contract: "BTC_USDT", U: 103, End: 103, Bids: levels("99:4")}, after)
+	l.Close()
+
+	path := filepath.Join(dir, "BTC_USDT.ndjson")
+	lines := readLines(t, path)
+	if len(lines) != 4 {
+		t.Fatalf("lines = %d, want snapshot, delta, gap marker, snapshot:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	var marker, resumed changeLogEntry
+	json.Unmarshal([]byte(lines[2]), &marker)
+	json.Unmarshal([]byte(lines[3]), &resumed)
+	if marker.Gap != 1 {
+		t.Errorf("gap marker = %s, want 1 dropped entry", lines[2])
+	}
+	if !resumed.Snapshot || resumed.End != 103 {
+		t.Errorf("line after the marker = %s, want snapshot 103", lines[3])
+	}
+
+	// Воспроизведение продолжается со снимка после отметки
+	captureSnapshotRequests(t)
+	if err := replayChangeLog(context.Background(), path, false, true); err != nil {
+		t.Fatal(err)
+	}
+	replayed, _ := orderbooks.Get("BTC_USDT")
+	if replayed.ID != 103 || levelSpecs(replayed.Bids) != "99:4" {
+		t.Errorf("replayed book = %d %s, want 103 99:4", replayed.ID, levelSpecs(replayed.Bids))
+	}
+}
@@ -0,0 +1,98 @@
+package gateorderbook
+
+import (
+	"hash/crc32"
+	"strings"
+	"sync"
+)
+
+// Число уровней каждой стороны, входящих в контрольную сумму
+const checksumDepth = 25
+
+// Контрольная сумма книги: первые depth уровней сторон попеременно
+// (bid, затем ask) в виде "цена:объем", соединенные через ":", и CRC32
+// (IEEE) этой строки как знаковое 32-битное число. Цены берутся как
+// присланы, объемы - в точном десятичном виде. Книга должна быть отсортирована.
+func OrderBookChecksum(ob OrderBookResponse, depth int) int32 {
+	var sb strings.Builder
+	appendLevel := func(level OrderBookItem) {
+		if sb.Len() > 0 {
+			sb.WriteByte(':')
+		}
+		sb.WriteString(level.P)
+		sb.WriteByte(':')
+		sb.WriteString(level.S.String())
+	}
+	for i := 0; i < depth; i++ {
+		if i < len(ob.Bids) {
+			appendLevel(ob.Bids[i])
+		}
+		if i < len(ob.Asks) {
+			appendLevel(ob.Asks[i])
+		}
+	}
+	return int32(crc32.ChecksumIEEE([]byte(sb.String())))
+}
+
+// Последние вычисленные контрольные суммы по контрактам (отдаются в /stats)
+type checksumRecorder struct {
+	mu      sync.Mutex
+	last    map[string]int32
+	skipped map[string]bool // Contracts whose checksums are not verified, logged once
+}
+
+func newChecksumRecorder() *checksumRecorder {
+	return &checksumRecorder{last: make(map[string]int32), skipped: make(map[string]bool)}
+}
+
+var lastChecksums = newChecksumRecorder()
+
+func (r *checksumRecorder) Record(contract string, checksum int32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.last[contract] = checksum
+}
+
+// Отметка контракта без проверки; true при первой отметке
+func (r *checksumRecorder) Skip(contract string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.skipped[contract] {
+		return false
+	}
+	r.skipped[contract] = true
+	return true
+}
+
+// Копия последних сумм
+func (r *checksumRecorder) Snapshot() map[string]int32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := make(map[string]int32, len(r.last))
+	for contract, checksum := range r.last {
+		last[contract] = checksum
+	}
+	return last
+}
+
+// Сверка книги с контрольной суммой из сообщения; при расхождении книга
+// пересинхронизируется. false, если суммы не совпали.
+// Книга, снимок которой короче checksumDepth уровней, не проверяется:
+// сумма биржи включает уровни, которых в ней нет, и никогда бы не совпала.
+func verifyChecksum(contract string, ob OrderBookResponse, expected int32) bool {
+	if limit := snapshotLimit(contract); limit < checksumDepth {
+		if lastChecksums.Skip(contract) {
+			warnf("not verifying checksums for %s: snapshot depth %d is below the %d checksum levels", contract, limit, checksumDepth)
+		}
+		metrics.Count("orderbook.checksum_skipped."+contract, 1)
+		return true
+	}
+	computed := OrderBookChecksum(ob, checksumDepth)
+	lastChecksums.Record(contract, computed)
+	if computed == expected {
+		return true
+	}
+	warnf("checksum mismatch for %s at update %d: computed %d, expected %d", contract, ob.ID, computed, expected)
+	metrics.Count("orderbook.checksum_mismatches."+contract, 1)
+	return false
+}
@@ -0,0 +1,93 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Книга для проверки контрольной суммы
+func checksumBook() OrderBookResponse {
+	return testBook(100, levels("100.5:3", "101:7"), levels("99.5:10", "99:1.25", "98:4"))
+}
+
+func TestOrderBookChecksum(t *testing.T) {
+	tests := []struct {
+		name  string
+		book  OrderBookResponse
+		depth int
+		want  int32
+	}{
+		// crc32("99.5:10:100.5:3:99:1.25:101:7:98:4")
+		{"interleaved levels", checksumBook(), 25, 1987457921},
+		// crc32("99.5:10:100.5:3")
+		{"depth limits levels", checksumBook(), 1, -1993921327},
+		{"empty book", OrderBookResponse{}, 25, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OrderBookChecksum(tt.book, tt.depth); got != tt.want {
+				t.Errorf("checksum = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	tests := []struct {
+		name       string
+		depth      int
+		expected   int32
+		wantOK     bool
+		wantRecord bool
+	}{
+		{"match", 50, 1987457921, true, true},
+		{"mismatch", 50, 1, false, true},
+		{"exact checksum depth", checksumDepth, 1987457921, true, true},
+		{"snapshot shallower than checksum levels", 20, 1, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.SnapshotDepth = tt.depth })
+			if ok := verifyChecksum("BTC_USDT", checksumBook(), tt.expected); ok != tt.wantOK {
+				t.Errorf("verifyChecksum = %v, want %v", ok, tt.wantOK)
+			}
+			_, recorded := lastChecksums.Snapshot()["BTC_USDT"]
+			if recorded != tt.wantRecord {
+				t.Errorf("checksum recorded = %v, want %v", recorded, tt.wantRecord)
+			}
+		})
+	}
+}
+
+func TestChecksumMismatchResyncs(t *testing.T) {
+	tests := []struct {
+		name       string
+		depth      int
+		checksum   int32
+		wantResync bool
+	}{
+		{"matching checksum", 50, 1987457921, false},
+		{"mismatch", 50, 7, true},
+		{"shallow snapshot never resyncs", 10, 7, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.SnapshotDepth = tt.depth })
+			requested := captureSnapshotRequests(t)
+			book := checksumBook()
+			book.Bids = book.Bids[:2]
+			applySnapshot("BTC_USDT", book)
+
+			checksum := tt.checksum
+			result, _ := json.Marshal(OrderBookUpdate{Contract: "BTC_USDT", U: 101, End: 101,
+				Bids: levels("98:4"), Checksum: &checksum})
+			msg, _ := json.Marshal(WebSocketMessage{Channel: "futures.order_book_update", Event: "update", Result: result})
+			handleWebSocketMessage(msg, time.Now().UnixNano())
+
+			if resynced := len(*requested) > 0; resynced != tt.wantResync {
+				t.Errorf("resynced = %v, want %v", resynced, tt.wantResync)
+			}
+		})
+	}
+}
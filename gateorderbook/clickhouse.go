@@ -0,0 +1,187 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Строка изменения уровня для ClickHouse. Ожидаемая схема таблицы:
+//
+//	CREATE TABLE orderbook_updates (
+//	    received_ns Int64,
+//	    contract    LowCardinality(String),
+//	    update_id   Int64,
+//	    side        Enum8('ask' = 1, 'bid' = 2),
+//	    price       String,
+//	    size        Float64
+//	) ENGINE = MergeTree ORDER BY (contract, received_ns)
+type clickhouseRow struct {
+	ReceivedNs int64           `json:"received_ns"`
+	Contract   string          `json:"contract"`
+	UpdateID   int64           `json:"update_id"`
+	Side       string          `json:"side"`
+	Price      string          `json:"price"`
+	Size       decimal.Decimal `json:"size"`
+}
+
+// Асинхронная пакетная вставка изменений уровней в ClickHouse по HTTP.
+// Неудачные пакеты остаются в буфере и повторяются при следующем сбросе;
+// при переполнении буфера отбрасываются самые старые строки.
+type clickhouseSink struct {
+	endpoint      string
+	table         string
+	client        *http.Client
+	batchSize     int
+	maxBuffered   int
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	rows    []clickhouseRow
+	flushed chan struct{} // Wakes the flusher when a full batch is ready
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newClickhouseSink(endpoint, table string, batchSize int, flushInterval time.Duration) *clickhouseSink {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	s := &clickhouseSink{
+		endpoint:      endpoint,
+		table:         table,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		batchSize:     batchSize,
+		maxBuffered:   batchSize * 100,
+		flushInterval: flushInterval,
+		flushed:       make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Постановка изменений уровней из обновления в очередь на вставку
+func (s *clickhouseSink) Append(contract string, receivedNs int64, update OrderBookUpdate) {
+	s.mu.Lock()
+	for _, side := range []struct {
+		name   string
+		levels []OrderBookItem
+	}{
+		{"ask", update.Asks},
+		{"bid", update.Bids},
+	} {
+		for _, level := range side.levels {
+			s.rows = append(s.rows, clickhouseRow{
+				ReceivedNs: receivedNs,
+				Contract:   contract,
+				UpdateID:   update.End,
+				Side:       side.name,
+				Price:      level.P,
+				Size:       level.S,
+			})
+		}
+	}
+	s.trim()
+	ready := len(s.rows) >= s.batchSize
+	s.mu.Unlock()
+
+	if ready {
+		select {
+		case s.flushed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *clickhouseSink) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.flushed:
+		case <-s.done:
+			if err := s.Flush(); err != nil {
+				errorf("ClickHouse final flush failed: %v", err)
+			}
+			return
+		}
+		if err := s.Flush(); err != nil {
+			warnf("ClickHouse insert failed, will retry: %v", err)
+		}
+	}
+}
+
+// Вставка накопленных строк пакетами по batchSize.
+// Пакет, который не удалось вставить, возвращается в начало буфера.
+func (s *clickhouseSink) Flush() error {
+	for {
+		s.mu.Lock()
+		n := len(s.rows)
+		if n > s.batchSize {
+			n = s.batchSize
+		}
+		batch := append([]clickhouseRow(nil), s.rows[:n]...)
+		s.rows = append(s.rows[:0], s.rows[n:]...)
+		s.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := s.insert(batch); err != nil {
+			s.mu.Lock()
+			s.rows = append(batch, s.rows...)
+			s.trim()
+			s.mu.Unlock()
+			return err
+		}
+		metrics.Count("clickhouse.inserted_rows", int64(len(batch)))
+	}
+}
+
+// Отбрасывание самых старых строк сверх maxBuffered (вызывается под mu)
+func (s *clickhouseSink) trim() {
+	if over := len(s.rows) - s.maxBuffered; over > 0 {
+		s.rows = append(s.rows[:0], s.rows[over:]...)
+		metrics.Count("clickhouse.dropped_rows", int64(over))
+	}
+}
+
+// Вставка пакета через HTTP интерфейс (INSERT ... FORMAT JSONEachRow)
+func (s *clickhouseSink) insert(batch []clickhouseRow) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range batch {
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	query := url.Values{"query": {fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", s.table)}}
+	resp, err := s.client.Post(s.endpoint+"/?"+query.Encode(), "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("ClickHouse returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// Остановка: сброс оставшихся строк
+func (s *clickhouseSink) Close() {
+	close(s.done)
+	<-s.stopped
+}
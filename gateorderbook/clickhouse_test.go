@@ -0,0 +1,128 @@
+package gateorderbook
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Имитация HTTP интерфейса ClickHouse: запоминает вставленные пакеты,
+// первые fail запросов завершаются ошибкой
+type clickhouseMock struct {
+	mu      sync.Mutex
+	fail    int
+	queries []string
+	batches [][]clickhouseRow
+}
+
+func (m *clickhouseMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queries = append(m.queries, r.URL.Query().Get("query"))
+	if m.fail > 0 {
+		m.fail--
+		http.Error(w, "Code: 241. DB::Exception: Memory limit exceeded", http.StatusInternalServerError)
+		return
+	}
+	var batch []clickhouseRow
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var row clickhouseRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batch = append(batch, row)
+	}
+	m.batches = append(m.batches, batch)
+}
+
+// Размеры вставленных пакетов и цены строк в порядке вставки
+func (m *clickhouseMock) inserted() (sizes []int, prices string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var all []string
+	for _, batch := range m.batches {
+		sizes = append(sizes, len(batch))
+		for _, row := range batch {
+			all = append(all, row.Side+":"+row.Price)
+		}
+	}
+	return sizes, strings.Join(all, " ")
+}
+
+func newClickhouseMock(t *testing.T, fail int) (*clickhouseMock, string) {
+	mock := &clickhouseMock{fail: fail}
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	return mock, server.URL
+}
+
+func TestClickhouseBatchedInserts(t *testing.T) {
+	newTestTracker(t, nil)
+	mock, endpoint := newClickhouseMock(t, 0)
+	sink := newClickhouseSink(endpoint, "orderbook_updates", 2, time.Hour)
+	sink.Append("BTC_USDT", 1700000000000000001, OrderBookUpdate{End: 101, Asks: levels("101:1", "102:0"), Bids: levels("99:2.5")})
+	sink.Close()
+
+	sizes, prices := mock.inserted()
+	if len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 1 {
+		t.Errorf("batch sizes = %v, want [2 1]", sizes)
+	}
+	if want := "ask:101 ask:102 bid:99"; prices != want {
+		t.Errorf("rows = %s, want %s", prices, want)
+	}
+	if mock.queries[0] != "INSERT INTO orderbook_updates FORMAT JSONEachRow" {
+		t.Errorf("query = %q", mock.queries[0])
+	}
+	row := mock.batches[1][0]
+	if row.ReceivedNs != 1700000000000000001 || row.Contract != "BTC_USDT" || row.UpdateID != 101 || row.Size.String() != "2.5" {
+		t.Errorf("row = %+v", row)
+	}
+}
+
+func TestClickhouseRetriesFailedBatch(t *testing.T) {
+	newTestTracker(t, nil)
+	mock, endpoint := newClickhouseMock(t, 1)
+	sink := newClickhouseSink(endpoint, "orderbook_updates", 10, time.Hour)
+	defer sink.Close()
+	sink.Append("BTC_USDT", 1, OrderBookUpdate{End: 101, Asks: levels("101:1")})
+
+	err := sink.Flush()
+	if err == nil || !strings.Contains(err.Error(), "ClickHouse returned status 500: Code: 241") {
+		t.Fatalf("first flush error = %v, want the server error", err)
+	}
+	// Пакет остался в буфере и вставляется вместе с новыми строками
+	sink.Append("BTC_USDT", 2, OrderBookUpdate{End: 102, Bids: levels("99:1")})
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if sizes, prices := mock.inserted(); len(sizes) != 1 || prices != "ask:101 bid:99" {
+		t.Errorf("inserted %v: %s, want one batch ask:101 bid:99", sizes, prices)
+	}
+}
+
+func TestClickhouseBufferDropsOldestRows(t *testing.T) {
+	newTestTracker(t, nil)
+	mock, endpoint := newClickhouseMock(t, 1)
+	sink := newClickhouseSink(endpoint, "orderbook_updates", 10, time.Hour)
+	defer sink.Close()
+	sink.mu.Lock()
+	sink.maxBuffered = 2
+	sink.mu.Unlock()
+	sink.Append("BTC_USDT", 1, OrderBookUpdate{End: 101, Asks: levels("101:1", "102:1", "103:1")})
+	if err := sink.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the mock failure")
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, prices := mock.inserted(); prices != "ask:102 ask:103" {
+		t.Errorf("rows = %s, want the two newest", prices)
+	}
+}
@@ -0,0 +1,95 @@
+package gateorderbook
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Сжатие файлов журнала изменений и ряда лучших цен
+type compression struct {
+	codec string // "", "gzip" or "zstd"
+	level int    // 0 uses the codec default
+}
+
+// Допустимые уровни сжатия по кодекам
+var compressionLevels = map[string][2]int{
+	"gzip": {gzip.BestSpeed, gzip.BestCompression},
+	"zstd": {1, 22},
+}
+
+// Расширения сжатых файлов
+var compressionExts = map[string]string{"gzip": ".gz", "zstd": ".zst"}
+
+// Проверка кодека и уровня сжатия
+func validateCompression(c compression) error {
+	if c.codec == "" {
+		if c.level != 0 {
+			return fmt.Errorf("compression level is set without a codec")
+		}
+		return nil
+	}
+	levels, ok := compressionLevels[c.codec]
+	if !ok {
+		return fmt.Errorf("unsupported compression %q, allowed: gzip, zstd", c.codec)
+	}
+	if c.level != 0 && (c.level < levels[0] || c.level > levels[1]) {
+		return fmt.Errorf("%s compression level must be from %d to %d, got %d", c.codec, levels[0], levels[1], c.level)
+	}
+	return nil
+}
+
+// Расширение, добавляемое к имени файла (пустое без сжатия)
+func (c compression) ext() string {
+	return compressionExts[c.codec]
+}
+
+// Сжимающий писатель: Flush дописывает в файл все принятые данные,
+// Close завершает поток (gzip member, zstd frame)
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Сжимающий писатель поверх w; nil без сжатия. Дописывание в существующий
+// файл начинает новый поток: склеенные потоки gzip и zstd читаются как один.
+func (c compression) writer(w io.Writer) (compressWriter, error) {
+	switch c.codec {
+	case "gzip":
+		level := gzip.DefaultCompression
+		if c.level != 0 {
+			level = c.level
+		}
+		return gzip.NewWriterLevel(w, level)
+	case "zstd":
+		level := zstd.SpeedDefault
+		if c.level != 0 {
+			level = zstd.EncoderLevelFromZstd(c.level)
+		}
+		// Без параллельного кодирования: у каждого файла свой писатель
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+	}
+	return nil, nil
+}
+
+// Чтение файла с распаковкой по расширению (.gz, .zst); name - имя без него
+func decompressedReader(path string, r io.Reader) (io.ReadCloser, string, error) {
+	switch {
+	case strings.HasSuffix(path, compressionExts["gzip"]):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, "", err
+		}
+		return zr, strings.TrimSuffix(path, compressionExts["gzip"]), nil
+	case strings.HasSuffix(path, compressionExts["zstd"]):
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, "", err
+		}
+		return zr.IOReadCloser(), strings.TrimSuffix(path, compressionExts["zstd"]), nil
+	}
+	return io.NopCloser(r), path, nil
+}
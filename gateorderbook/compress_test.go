@@ -0,0 +1,152 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Распакованное содержимое файла
+func readDecompressed(t testing.TB, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, _, err := decompressedReader(path, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decompressing %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		c       compression
+		wantErr string
+	}{
+		{compression{}, ""},
+		{compression{codec: "gzip"}, ""},
+		{compression{codec: "gzip", level: 9}, ""},
+		{compression{codec: "zstd", level: 22}, ""},
+		{compression{codec: "zstd", level: 23}, "zstd compression level must be from 1 to 22, got 23"},
+		{compression{codec: "gzip", level: -1}, "gzip compression level must be from 1 to 9, got -1"},
+		{compression{codec: "lz4"}, `unsupported compression "lz4"`},
+		{compression{level: 3}, "compression level is set without a codec"},
+	}
+	for _, tt := range tests {
+		err := validateCompression(tt.c)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%+v: unexpected error %v", tt.c, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v: error = %v, want %q", tt.c, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCompressedChangeLog(t *testing.T) {
+	tests := []struct {
+		compress compression
+		file     string
+		magic    []byte
+	}{
+		{compression{codec: "zstd", level: 19}, "BTC_USDT.ndjson.zst", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+		{compression{codec: "gzip"}, "BTC_USDT.ndjson.gz", []byte{0x1f, 0x8b}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.compress.codec, func(t *testing.T) {
+			newTestTracker(t, nil)
+			plainDir, dir := t.TempDir(), t.TempDir()
+			now := time.Now().UnixNano()
+			book := testBook(100, levels("101:1"), levels("99:1"))
+			book.ReceivedNs = now
+			// Два запуска пишут в один файл: второй дописывает новый сжатый поток
+			for session := 0; session < 2; session++ {
+				plain, err := newChangeLog(plainDir, "json", compression{}, 0, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				compressed, err := newChangeLog(dir, "json", tt.compress, 0, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, l := range []*changeLog{plain, compressed} {
+					l.AppendSnapshot("BTC_USDT", book)
+					for id := int64(101); id <= 105; id++ {
+						l.Append("BTC_USDT", now, 0, OrderBookUpdate{Contract: "BTC_USDT", U: id, End: id, Bids: levels("99:2")}, book)
+					}
+					l.Close()
+				}
+			}
+
+			path := filepath.Join(dir, tt.file)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(data, tt.magic) {
+				t.Errorf("file starts with % x, want %s magic % x", data[:4], tt.compress.codec, tt.magic)
+			}
+			want, err := os.ReadFile(filepath.Join(plainDir, "BTC_USDT.ndjson"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readDecompressed(t, path); got != string(want) {
+				t.Errorf("decompressed change log:\n%s\nwant:\n%s", got, want)
+			}
+
+			if err := replayChangeLog(context.Background(), path, false, true); err != nil {
+				t.Fatal(err)
+			}
+			if replayed, ok := orderbooks.Get("BTC_USDT"); !ok || replayed.ID != 105 {
+				t.Errorf("replayed book id = %d, want 105", replayed.ID)
+			}
+		})
+	}
+}
+
+func TestCompressedSeries(t *testing.T) {
+	dir := t.TempDir()
+	w := newSeriesWriter(dir, 0, seriesFlushPolicy{BufferSize: 4096}, compression{codec: "zstd", level: 3})
+	ts := time.UnixMilli(1700000000000)
+	book := testBook(1, levels("101:1"), levels("99:1"))
+	var want strings.Builder
+	want.WriteString(seriesHeader)
+	for i := 0; i < 100; i++ {
+		row := formatSeriesRow(ts.Add(time.Duration(i)*time.Millisecond), book)
+		want.WriteString(row)
+		if err := w.Append("BTC_USDT", ts.Add(time.Duration(i)*time.Millisecond), book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Flush доводит сжатые строки до файла еще до его закрытия
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "BTC_USDT.tob.csv.zst")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || len(data) >= want.Len() {
+		t.Errorf("compressed size = %d, want between 1 and %d", len(data), want.Len())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDecompressed(t, path); got != want.String() {
+		t.Errorf("decompressed series:\n%s\nwant:\n%s", got, want.String())
+	}
+}
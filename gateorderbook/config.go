@@ -0,0 +1,115 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Настройки из файла конфигурации (JSON или YAML); пустые поля не меняют Config
+type FileConfig struct {
+	Contracts    []string          `json:"contracts" yaml:"contracts"`
+	Settle       string            `json:"settle" yaml:"settle"`
+	Depth        int               `json:"depth" yaml:"depth"`
+	Interval     string            `json:"interval" yaml:"interval"`           // Update interval: 20ms or 100ms
+	SaveInterval string            `json:"save_interval" yaml:"save_interval"` // Go duration, e.g. 500ms
+	Format       string            `json:"format" yaml:"format"`               // Saved file format: text, json, map or protobuf
+	DumpGroupBy  string            `json:"dump_group_by" yaml:"dump_group_by"` // Dump grouping: base or tag
+	DumpGroups   map[string]string `json:"dump_groups" yaml:"dump_groups"`     // Contract -> group for dump_group_by: tag
+	LogLevel     string            `json:"log_level" yaml:"log_level"`         // debug, info, warn or error
+}
+
+// Чтение файла конфигурации: .yaml/.yml разбирается как YAML, остальное как JSON.
+// Неизвестные поля считаются ошибкой.
+func ReadConfigFile(path string) (FileConfig, error) {
+	var fc FileConfig
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fc, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&fc)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fc)
+	}
+	if err != nil {
+		return fc, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return fc, nil
+}
+
+// Перенос заданных в файле настроек в cfg
+func (fc FileConfig) Apply(cfg *Config) error {
+	if len(fc.Contracts) > 0 {
+		cfg.Contracts = fc.Contracts
+	}
+	if fc.Settle != "" {
+		cfg.Settle = fc.Settle
+	}
+	if fc.Depth != 0 {
+		cfg.SnapshotDepth = fc.Depth
+	}
+	if fc.Interval != "" {
+		cfg.UpdateInterval = fc.Interval
+	}
+	if fc.SaveInterval != "" {
+		interval, err := time.ParseDuration(fc.SaveInterval)
+		if err != nil {
+			return fmt.Errorf("invalid save_interval: %v", err)
+		}
+		cfg.SaveInterval = interval
+	}
+	if fc.Format != "" {
+		cfg.OutputFormat = fc.Format
+	}
+	if fc.DumpGroupBy != "" {
+		cfg.DumpGroupBy = fc.DumpGroupBy
+	}
+	if len(fc.DumpGroups) > 0 {
+		cfg.DumpGroups = fc.DumpGroups
+	}
+	if fc.LogLevel != "" {
+		level, err := ParseLogLevel(fc.LogLevel)
+		if err != nil {
+			return fmt.Errorf("invalid log_level: %v", err)
+		}
+		cfg.LogLevel = level
+	}
+	return nil
+}
+
+// Имя контракта: базовая и котируемая валюты через подчеркивание, например BTC_USDT
+var contractPattern = regexp.MustCompile(`^[A-Z0-9]+_[A-Z0-9]+$`)
+
+// Проверка имен контрактов
+func validateContracts(contracts []string) error {
+	for _, contract := range contracts {
+		if !contractPattern.MatchString(contract) {
+			return fmt.Errorf("malformed contract %q, expected a name like BTC_USDT", contract)
+		}
+	}
+	return nil
+}
+
+// Валюта расчетов: usdt, btc и т.п.
+var settlePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+func validateSettle(settle string) error {
+	if !settlePattern.MatchString(settle) {
+		return fmt.Errorf("malformed settle currency %q, expected a lowercase name like usdt", settle)
+	}
+	return nil
+}
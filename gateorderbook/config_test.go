@@ -0,0 +1,120 @@
+package gateorderbook
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	want := FileConfig{
+		Contracts:    []string{"BTC_USDT", "ETH_USDT"},
+		Settle:       "usdt",
+		Depth:        50,
+		Interval:     "20ms",
+		SaveInterval: "2s",
+	}
+	tests := []struct {
+		name     string
+		file     string
+		contents string
+		wantErr  string
+	}{
+		{"json", "config.json", `{"contracts":["BTC_USDT","ETH_USDT"],"settle":"usdt","depth":50,"interval":"20ms","save_interval":"2s"}`, ""},
+		{"yaml", "config.yaml", "contracts: [BTC_USDT, ETH_USDT]\nsettle: usdt\ndepth: 50\ninterval: 20ms\nsave_interval: 2s\n", ""},
+		{"yml", "config.yml", "contracts:\n  - BTC_USDT\n  - ETH_USDT\nsettle: usdt\ndepth: 50\ninterval: 20ms\nsave_interval: 2s\n", ""},
+		{"unknown json field", "config.json", `{"contract":["BTC_USDT"]}`, "unknown field"},
+		{"unknown yaml field", "config.yaml", "contract: [BTC_USDT]\n", "not found"},
+		{"malformed json", "config.json", `{"contracts":`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadConfigFile(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("config = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	if _, err := ReadConfigFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing config file was accepted")
+	}
+}
+
+func TestFileConfigApply(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := (FileConfig{}).Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf("empty config file changed the defaults: %+v", cfg)
+	}
+
+	fc := FileConfig{Contracts: []string{"SOL_USDT"}, Depth: 20, SaveInterval: "250ms", Format: "json"}
+	if err := fc.Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg.Contracts, []string{"SOL_USDT"}) || cfg.SnapshotDepth != 20 ||
+		cfg.SaveInterval != 250*time.Millisecond || cfg.OutputFormat != "json" {
+		t.Errorf("config after apply = %+v", cfg)
+	}
+	// Незаданные в файле поля сохраняют значения по умолчанию
+	if cfg.Settle != DefaultConfig().Settle || cfg.UpdateInterval != DefaultConfig().UpdateInterval {
+		t.Errorf("settle %q and interval %q were overwritten", cfg.Settle, cfg.UpdateInterval)
+	}
+
+	if err := (FileConfig{SaveInterval: "soon"}).Apply(&cfg); err == nil {
+		t.Error("invalid save_interval was accepted")
+	}
+
+	if err := (FileConfig{LogLevel: "debug"}).Apply(&cfg); err != nil || cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("log level after apply = %s (%v), want DEBUG", cfg.LogLevel, err)
+	}
+	if err := (FileConfig{LogLevel: "loud"}).Apply(&cfg); err == nil {
+		t.Error("invalid log_level was accepted")
+	}
+}
+
+func TestValidateContracts(t *testing.T) {
+	tests := []struct {
+		contract string
+		wantErr  bool
+	}{
+		{"BTC_USDT", false},
+		{"1000PEPE_USDT", false},
+		{"btc_usdt", true},
+		{"BTCUSDT", true},
+		{"BTC_USDT_", true},
+		{"BTC-USDT", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		if err := validateContracts([]string{"ETH_USDT", tt.contract}); (err != nil) != tt.wantErr {
+			t.Errorf("validateContracts(%q) = %v, want error %v", tt.contract, err, tt.wantErr)
+		}
+	}
+
+	// Неверное имя контракта отклоняется до запуска трекера
+	cfg := DefaultConfig()
+	cfg.Contracts = []string{"BTC_USDT", "eth-usdt"}
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), `"eth-usdt"`) {
+		t.Errorf("New with a malformed contract = %v", err)
+	}
+}
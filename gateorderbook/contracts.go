@@ -0,0 +1,63 @@
+package gateorderbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+)
+
+// Метаданные фьючерсного контракта (только используемые поля)
+type ContractInfo struct {
+	Name            string `json:"name"`
+	OrderPriceRound string `json:"order_price_round"` // Tick size
+}
+
+// Размер тика цены по контрактам
+var tickSizes = make(map[string]float64)
+
+// Получение метаданных контракта
+func getContractInfo(ctx context.Context, settle, contract string) (ContractInfo, error) {
+	host := "https://" + apiHost
+	prefix := "/api/v4"
+	endpoint := fmt.Sprintf("%s%s/futures/%s/contracts/%s", host, prefix, settle, contract)
+
+	resp, err := httpGetRateLimited(ctx, endpoint)
+	if err != nil {
+		return ContractInfo{}, fmt.Errorf("HTTP request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return ContractInfo{}, fmt.Errorf("Response read error: %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return ContractInfo{}, &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var info ContractInfo
+	err = json.Unmarshal(body, &info)
+	if err != nil {
+		return ContractInfo{}, fmt.Errorf("JSON parse error: %v", err)
+	}
+
+	return info, nil
+}
+
+// Размер тика из метаданных контракта
+func (info ContractInfo) TickSize() (float64, error) {
+	tick, err := strconv.ParseFloat(info.OrderPriceRound, 64)
+	if err != nil || tick <= 0 {
+		return 0, fmt.Errorf("invalid tick size %q for %s", info.OrderPriceRound, info.Name)
+	}
+	return tick, nil
+}
+
+// Цена в целых тиках
+func priceToTicks(price, tickSize float64) int64 {
+	return int64(math.Round(price / tickSize))
+}
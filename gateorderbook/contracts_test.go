@@ -0,0 +1,84 @@
+package gateorderbook
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestTickSize(t *testing.T) {
+	tests := []struct {
+		round   string
+		want    float64
+		wantErr bool
+	}{
+		{"0.1", 0.1, false},
+		{"0.000001", 0.000001, false},
+		{"5", 5, false},
+		{"0", 0, true},
+		{"-0.1", 0, true},
+		{"", 0, true},
+		{"tick", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.round, func(t *testing.T) {
+			got, err := ContractInfo{Name: "BTC_USDT", OrderPriceRound: tt.round}.TickSize()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("tick size = %v (%v), want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPriceToTicks(t *testing.T) {
+	tests := []struct {
+		price, tick float64
+		want        int64
+	}{
+		{65000.1, 0.1, 650001},
+		{0.000123, 0.000001, 123},
+		// 1.15/0.05 во float64 чуть меньше 23: округление, а не отбрасывание
+		{1.15, 0.05, 23},
+		{100, 0.5, 200},
+	}
+	for _, tt := range tests {
+		if got := priceToTicks(tt.price, tt.tick); got != tt.want {
+			t.Errorf("priceToTicks(%v, %v) = %d, want %d", tt.price, tt.tick, got, tt.want)
+		}
+	}
+}
+
+func TestGetContractInfo(t *testing.T) {
+	newTestTracker(t, nil)
+	var path string
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"name":"BTC_USDT","order_price_round":"0.1","quanto_multiplier":"0.0001"}`))
+	})
+	info, err := getContractInfo(context.Background(), "usdt", "BTC_USDT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v4/futures/usdt/contracts/BTC_USDT" {
+		t.Errorf("request path = %s", path)
+	}
+	if tick, err := info.TickSize(); err != nil || tick != 0.1 {
+		t.Errorf("tick size = %v (%v), want 0.1", tick, err)
+	}
+}
+
+func TestFormatOrderBookInTicks(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.PricesAsTicks = true })
+	tickSizes["BTC_USDT"] = 0.5
+	t.Cleanup(func() { delete(tickSizes, "BTC_USDT") })
+
+	book := testBook(1, levels("101:1"), levels("99.5:2"))
+	want := "ASK 101.00000000 | 1.00000000 | 202\n------------------------\nBID 99.50000000 | 2.00000000 | 199\n"
+	if got := formatOrderBook("BTC_USDT", book); got != want {
+		t.Errorf("formatted book:\n%s\nwant:\n%s", got, want)
+	}
+	// Контракт без известного тика выводится без колонки тиков
+	if got := formatOrderBook("ETH_USDT", book); got != "ASK 101.00000000 | 1.00000000\n------------------------\nBID 99.50000000 | 2.00000000\n" {
+		t.Errorf("formatted book without a tick size:\n%s", got)
+	}
+}
@@ -0,0 +1,111 @@
+package gateorderbook
+
+import (
+	"sync"
+)
+
+// Сравнение лучших цен отсортированной книги: >0, если bid выше ask,
+// 0, если равны; ok=false, если одна из сторон пуста
+func (ob OrderBookResponse) compareTop() (int, bool) {
+	if len(ob.Bids) == 0 || len(ob.Asks) == 0 {
+		return 0, false
+	}
+	return comparePrices(ob.Bids[0].P, ob.Asks[0].P), true
+}
+
+// Лучший bid выше лучшего ask - книга разошлась с биржей (например, после разрыва
+// последовательности). Требуется отсортированная книга.
+func (ob OrderBookResponse) IsCrossed() bool {
+	c, ok := ob.compareTop()
+	return ok && c > 0
+}
+
+// Лучший bid равен лучшему ask (нулевой спред). Требуется отсортированная книга.
+func (ob OrderBookResponse) IsLocked() bool {
+	c, ok := ob.compareTop()
+	return ok && c == 0
+}
+
+// Учет пересеченных и запертых (bid == ask) книг: предупреждение и счетчик
+// при переходе книги в такое состояние, а не на каждом обновлении
+type crossedBookDetector struct {
+	mu           sync.Mutex
+	crossed      map[string]bool
+	counts       map[string]int64
+	locked       map[string]bool
+	lockedCounts map[string]int64
+}
+
+func newCrossedBookDetector() *crossedBookDetector {
+	return &crossedBookDetector{
+		crossed:      make(map[string]bool),
+		counts:       make(map[string]int64),
+		locked:       make(map[string]bool),
+		lockedCounts: make(map[string]int64),
+	}
+}
+
+var crossedBooks = newCrossedBookDetector()
+
+// Пересинхронизация пересеченной книги по REST снимку
+var resyncCrossed bool
+
+// Проверка книги после обновления; true, если книга только что стала пересеченной
+// (запертая книга только учитывается)
+func (d *crossedBookDetector) Check(contract string, ob OrderBookResponse) bool {
+	crossed := ob.IsCrossed()
+	locked := ob.IsLocked()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wasLocked := d.locked[contract]
+	d.locked[contract] = locked
+	if locked && !wasLocked {
+		d.lockedCounts[contract]++
+		warnf("locked book for %s: best bid equals best ask %s", contract, ob.Bids[0].P)
+		metrics.Count("orderbook.locked."+contract, 1)
+	}
+
+	was := d.crossed[contract]
+	d.crossed[contract] = crossed
+	if !crossed || was {
+		return false
+	}
+	d.counts[contract]++
+	bid, _, _ := ob.BestBid()
+	ask, _, _ := ob.BestAsk()
+	warnf("crossed book for %s: best bid %g above best ask %g", contract, bid, ask)
+	metrics.Count("orderbook.crossed."+contract, 1)
+	return true
+}
+
+// Сброс состояния контракта (книга заменена снимком)
+func (d *crossedBookDetector) Reset(contract string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.crossed, contract)
+	delete(d.locked, contract)
+}
+
+// Сколько раз книги контрактов становились пересеченными
+func (d *crossedBookDetector) Counts() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return copyCounts(d.counts)
+}
+
+// Сколько раз книги контрактов становились запертыми
+func (d *crossedBookDetector) LockedCounts() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return copyCounts(d.lockedCounts)
+}
+
+func copyCounts(src map[string]int64) map[string]int64 {
+	counts := make(map[string]int64, len(src))
+	for contract, n := range src {
+		counts[contract] = n
+	}
+	return counts
+}
@@ -0,0 +1,84 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCrossedAndLockedBooks(t *testing.T) {
+	tests := []struct {
+		name        string
+		book        OrderBookResponse
+		wantCrossed bool
+		wantLocked  bool
+	}{
+		{"normal", testBook(1, levels("101:1"), levels("99:1")), false, false},
+		{"crossed", testBook(1, levels("101:1"), levels("101.5:1")), true, false},
+		{"locked", testBook(1, levels("101:1"), levels("101:1")), false, true},
+		{"locked with trailing zero", testBook(1, levels("1.5:1"), levels("1.50:1")), false, true},
+		{"one side empty", testBook(1, nil, levels("99:1")), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.book.IsCrossed(); got != tt.wantCrossed {
+				t.Errorf("IsCrossed = %v, want %v", got, tt.wantCrossed)
+			}
+			if got := tt.book.IsLocked(); got != tt.wantLocked {
+				t.Errorf("IsLocked = %v, want %v", got, tt.wantLocked)
+			}
+		})
+	}
+}
+
+func TestCrossedBookDetectorCountsTransitions(t *testing.T) {
+	newTestTracker(t, nil)
+	normal := testBook(1, levels("101:1"), levels("99:1"))
+	locked := testBook(1, levels("101:1"), levels("101:1"))
+	crossed := testBook(1, levels("101:1"), levels("102:1"))
+
+	d := newCrossedBookDetector()
+	steps := []struct {
+		book       OrderBookResponse
+		wantResync bool
+	}{
+		{locked, false},
+		{locked, false},
+		{normal, false},
+		{locked, false},
+		{crossed, true},
+		{crossed, false},
+	}
+	for i, step := range steps {
+		if got := d.Check("BTC_USDT", step.book); got != step.wantResync {
+			t.Errorf("step %d: Check = %v, want %v", i, got, step.wantResync)
+		}
+	}
+	if got := d.LockedCounts()["BTC_USDT"]; got != 2 {
+		t.Errorf("locked count = %d, want 2", got)
+	}
+	if got := d.Counts()["BTC_USDT"]; got != 1 {
+		t.Errorf("crossed count = %d, want 1", got)
+	}
+}
+
+func TestStatsReportsLockedBooks(t *testing.T) {
+	newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, nil, levels("101:2")), time.Now().UnixNano())
+	if book, _ := orderbooks.Get("BTC_USDT"); book.ID != 101 {
+		t.Fatalf("locked book not kept: id %d", book.ID)
+	}
+
+	rec := httptest.NewRecorder()
+	handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats statsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Locked["BTC_USDT"] != 1 || stats.Crossed["BTC_USDT"] != 0 {
+		t.Errorf("stats locked = %v, crossed = %v, want 1 locked", stats.Locked, stats.Crossed)
+	}
+}
@@ -0,0 +1,105 @@
+package gateorderbook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Закешированный результат DNS запроса
+type dnsEntry struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+// Кеш DNS с TTL: при временной ошибке резолва используется последний удачный адрес
+type dnsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	lookup  func(ctx context.Context, host string) ([]net.IPAddr, error)
+	dialer  *net.Dialer
+	entries map[string]dnsEntry
+}
+
+// Подключение без кеша DNS, как у транспорта по умолчанию
+var directDialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+
+// Подключение REST и WebSocket клиентов через новый кеш DNS; ttl 0 возвращает
+// прямое подключение, чтобы не остался кеш прошлого New
+func applyDNSCache(ttl time.Duration) {
+	if ttl <= 0 {
+		httpTransport.DialContext = directDialContext
+		wsDialer.NetDialContext = nil
+	} else {
+		cache := newDNSCache(ttl)
+		httpTransport.DialContext = cache.DialContext
+		wsDialer.NetDialContext = cache.DialContext
+	}
+	// Соединения, открытые прежним способом, не переиспользуются
+	httpTransport.CloseIdleConnections()
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:     ttl,
+		lookup:  net.DefaultResolver.LookupIPAddr,
+		dialer:  &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		entries: make(map[string]dnsEntry),
+	}
+}
+
+// Резолв хоста с использованием кеша
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+
+	c.mu.Lock()
+	entry, cached := c.entries[host]
+	c.mu.Unlock()
+	if cached && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookup(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("no addresses for %s", host)
+	}
+	if err != nil {
+		if cached {
+			warnf("DNS lookup for %s failed (%v), using cached address %s", host, err, entry.addrs[0].IP)
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// Установка соединения через закешированные адреса
+func (c *dnsCache) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := c.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := c.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
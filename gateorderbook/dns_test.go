@@ -0,0 +1,91 @@
+package gateorderbook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Подменный резолвер: адрес loopback или ошибка, если fail
+type fakeResolver struct {
+	lookups int
+	fail    bool
+}
+
+func (r *fakeResolver) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	r.lookups++
+	if r.fail {
+		return nil, &net.DNSError{Err: "temporary failure", Name: host, IsTemporary: true}
+	}
+	return []net.IPAddr{{IP: net.IPv4(127, 0, 0, 1)}}, nil
+}
+
+func TestDNSCacheResolve(t *testing.T) {
+	newTestTracker(t, nil)
+	logs := captureLog(t)
+	resolver := &fakeResolver{}
+	cache := newDNSCache(time.Hour)
+	cache.lookup = resolver.lookup
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.resolve(ctx, "api.gateio.ws"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if resolver.lookups != 1 {
+		t.Errorf("lookups = %d, want 1 while the entry is fresh", resolver.lookups)
+	}
+
+	// Запись устарела, а резолвер недоступен: используется последний адрес
+	cache.entries["api.gateio.ws"] = dnsEntry{addrs: cache.entries["api.gateio.ws"].addrs, expires: time.Now().Add(-time.Second)}
+	resolver.fail = true
+	addrs, err := cache.resolve(ctx, "api.gateio.ws")
+	if err != nil || len(addrs) != 1 || !addrs[0].IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("stale lookup = %v (%v), want the cached address", addrs, err)
+	}
+	if !strings.Contains(logs.String(), "Warning: DNS lookup for api.gateio.ws failed") {
+		t.Errorf("log = %q, want a cached address warning", logs)
+	}
+
+	// Без закешированного адреса ошибка возвращается
+	var dnsErr *net.DNSError
+	if _, err := cache.resolve(ctx, "fx-ws.gateio.ws"); !errors.As(err, &dnsErr) {
+		t.Errorf("uncached lookup error = %v, want the DNS error", err)
+	}
+
+	// IP адрес не резолвится
+	lookups := resolver.lookups
+	if addrs, err := cache.resolve(ctx, "10.0.0.1"); err != nil || len(addrs) != 1 || resolver.lookups != lookups {
+		t.Errorf("IP literal = %v (%v), lookups %d -> %d", addrs, err, lookups, resolver.lookups)
+	}
+}
+
+func TestDNSCacheDial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	resolver := &fakeResolver{}
+	cache := newDNSCache(time.Hour)
+	cache.lookup = resolver.lookup
+	conn, err := cache.DialContext(context.Background(), "tcp", net.JoinHostPort("api.gateio.ws", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if resolver.lookups != 1 || conn.RemoteAddr().String() != listener.Addr().String() {
+		t.Errorf("dialed %s after %d lookups, want %s", conn.RemoteAddr(), resolver.lookups, listener.Addr())
+	}
+}
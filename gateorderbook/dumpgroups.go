@@ -0,0 +1,66 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Группировка книг в выгрузке (DumpAll, /dump, DumpOnExit): "" - плоско
+// {contract: book}, "base" - по базовой валюте (BTC для BTC_USDT),
+// "tag" - по группам из dumpGroups
+var dumpGroupBy string
+
+// Группы контрактов для dumpGroupBy = "tag"
+var dumpGroups map[string]string
+
+// Группа контрактов без тега
+const ungroupedContracts = "other"
+
+// Проверка способа группировки и тегов
+func validateDumpGrouping(groupBy string, groups map[string]string) error {
+	switch groupBy {
+	case "", "base":
+	case "tag":
+		if len(groups) == 0 {
+			return fmt.Errorf("dump grouping by tag needs contract groups")
+		}
+	default:
+		return fmt.Errorf("unknown dump grouping %q, expected base or tag", groupBy)
+	}
+	for contract, group := range groups {
+		if group == "" {
+			return fmt.Errorf("empty dump group for %s", contract)
+		}
+	}
+	return nil
+}
+
+// Группа контракта в выгрузке
+func dumpGroup(contract string) string {
+	switch dumpGroupBy {
+	case "base":
+		base, _, _ := strings.Cut(contract, "_")
+		return base
+	case "tag":
+		if group, ok := dumpGroups[contract]; ok {
+			return group
+		}
+	}
+	return ungroupedContracts
+}
+
+// Разбор групп вида "BTC_USDT=majors,ETH_USDT=majors,PEPE_USDT=memes"
+func ParseContractGroups(s string) (map[string]string, error) {
+	groups := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return groups, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		contract, group, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || contract == "" || group == "" {
+			return nil, fmt.Errorf("invalid contract group %q, expected CONTRACT=GROUP", entry)
+		}
+		groups[contract] = group
+	}
+	return groups, nil
+}
@@ -0,0 +1,138 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Контракты выгрузки по группам
+func dumpLayout(t *testing.T, data []byte) (flat []string, groups map[string][]string) {
+	t.Helper()
+	var dump OrderBookDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	for contract := range dump.Orderbooks {
+		flat = append(flat, contract)
+	}
+	sort.Strings(flat)
+	if dump.Groups != nil {
+		groups = make(map[string][]string)
+		for group, books := range dump.Groups {
+			for contract, book := range books {
+				if book.ID == 0 {
+					t.Errorf("book %s in group %s has no id", contract, group)
+				}
+				groups[group] = append(groups[group], contract)
+			}
+			sort.Strings(groups[group])
+		}
+	}
+	return flat, groups
+}
+
+func TestDumpAllGroupsContracts(t *testing.T) {
+	contracts := []string{"BTC_USDT", "ETH_USDT", "BTC_USD", "PEPE_USDT"}
+	tests := []struct {
+		name       string
+		groupBy    string
+		groups     map[string]string
+		wantFlat   []string
+		wantGroups map[string][]string
+	}{
+		{"flat", "", nil, []string{"BTC_USD", "BTC_USDT", "ETH_USDT", "PEPE_USDT"}, nil},
+		{"by base asset", "base", nil, nil, map[string][]string{
+			"BTC":  {"BTC_USD", "BTC_USDT"},
+			"ETH":  {"ETH_USDT"},
+			"PEPE": {"PEPE_USDT"},
+		}},
+		{"by tag", "tag", map[string]string{"BTC_USDT": "majors", "ETH_USDT": "majors", "PEPE_USDT": "memes"}, nil, map[string][]string{
+			"majors": {"BTC_USDT", "ETH_USDT"},
+			"memes":  {"PEPE_USDT"},
+			"other":  {"BTC_USD"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) {
+				cfg.DumpGroupBy = tt.groupBy
+				cfg.DumpGroups = tt.groups
+			})
+			for i, contract := range contracts {
+				orderbooks.Set(contract, testBook(int64(100+i), levels("101:1"), levels("99:1")))
+			}
+
+			data, err := DumpAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			flat, groups := dumpLayout(t, data)
+			if !reflect.DeepEqual(flat, tt.wantFlat) || !reflect.DeepEqual(groups, tt.wantGroups) {
+				t.Errorf("dump = %v %v, want %v %v", flat, groups, tt.wantFlat, tt.wantGroups)
+			}
+
+			// /dump и файл выгрузки используют ту же группировку
+			rec := httptest.NewRecorder()
+			handleDump(rec, httptest.NewRequest(http.MethodGet, "/dump", nil))
+			if flat, groups := dumpLayout(t, rec.Body.Bytes()); !reflect.DeepEqual(flat, tt.wantFlat) || !reflect.DeepEqual(groups, tt.wantGroups) {
+				t.Errorf("/dump = %v %v, want %v %v", flat, groups, tt.wantFlat, tt.wantGroups)
+			}
+			path := filepath.Join(t.TempDir(), "dump.json")
+			if err := writeDumpFile(path); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if flat, groups := dumpLayout(t, file); !reflect.DeepEqual(flat, tt.wantFlat) || !reflect.DeepEqual(groups, tt.wantGroups) {
+				t.Errorf("dump file = %v %v, want %v %v", flat, groups, tt.wantFlat, tt.wantGroups)
+			}
+		})
+	}
+}
+
+func TestParseContractGroups(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"BTC_USDT=majors, ETH_USDT=majors", map[string]string{"BTC_USDT": "majors", "ETH_USDT": "majors"}, false},
+		{"BTC_USDT", nil, true},
+		{"BTC_USDT=", nil, true},
+		{"=majors", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseContractGroups(tt.in)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("ParseContractGroups(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestConfigFileSetsDumpGrouping(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "dump_group_by: tag\ndump_groups:\n  BTC_USDT: majors\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fc, err := ReadConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	if err := fc.Apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DumpGroupBy != "tag" || cfg.DumpGroups["BTC_USDT"] != "majors" {
+		t.Errorf("config = %q %v, want tag with BTC_USDT in majors", cfg.DumpGroupBy, cfg.DumpGroups)
+	}
+}
@@ -0,0 +1,85 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Экспоненциальное скользящее среднее mid цены по контрактам
+type midEMA struct {
+	mu     sync.Mutex
+	alpha  float64
+	values map[string]float64
+}
+
+func newMidEMA(alpha float64) *midEMA {
+	return &midEMA{
+		alpha:  alpha,
+		values: make(map[string]float64),
+	}
+}
+
+var midEMAs *midEMA
+
+// Сглаживающий коэффициент EMA: alpha из (0, 1] или период N (alpha = 2/(N+1))
+func emaAlpha(alpha float64, period int) (float64, error) {
+	if alpha != 0 && period != 0 {
+		return 0, fmt.Errorf("set either an EMA alpha or a period, not both")
+	}
+	if period != 0 {
+		if period < 1 {
+			return 0, fmt.Errorf("EMA period %d must be at least 1", period)
+		}
+		return 2 / float64(period+1), nil
+	}
+	if alpha <= 0 || alpha > 1 {
+		return 0, fmt.Errorf("EMA alpha %g out of range (0, 1]", alpha)
+	}
+	return alpha, nil
+}
+
+// Учет mid цены книги; первое значение контракта становится начальным EMA.
+// Книги без одной из сторон пропускаются (ok=false).
+func (e *midEMA) Update(contract string, ob OrderBookResponse) (float64, bool) {
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	if !hasBid || !hasAsk {
+		return 0, false
+	}
+	mid := (bid + ask) / 2
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ema, ok := e.values[contract]
+	if !ok {
+		ema = mid
+	} else {
+		ema += e.alpha * (mid - ema)
+	}
+	e.values[contract] = ema
+	metrics.Gauge("orderbook.mid_ema."+contract, ema)
+	return ema, true
+}
+
+// Текущие EMA mid цены по всем контрактам
+func (e *midEMA) Values() map[string]float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	values := make(map[string]float64, len(e.values))
+	for contract, ema := range e.values {
+		values[contract] = ema
+	}
+	return values
+}
+
+// EMA mid цены контракта; ok=false, если сглаживание выключено или данных нет
+func MidEMA(contract string) (float64, bool) {
+	if midEMAs == nil {
+		return 0, false
+	}
+	midEMAs.mu.Lock()
+	defer midEMAs.mu.Unlock()
+	ema, ok := midEMAs.values[contract]
+	return ema, ok
+}
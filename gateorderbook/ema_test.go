@@ -0,0 +1,85 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEMAAlpha(t *testing.T) {
+	tests := []struct {
+		name    string
+		alpha   float64
+		period  int
+		want    float64
+		wantErr bool
+	}{
+		{"alpha", 0.25, 0, 0.25, false},
+		{"alpha of one", 1, 0, 1, false},
+		{"period", 0, 9, 0.2, false},
+		{"period of one", 0, 1, 1, false},
+		{"both set", 0.25, 9, 0, true},
+		{"alpha above one", 1.5, 0, 0, true},
+		{"negative alpha", -0.1, 0, 0, true},
+		{"negative period", 0, -3, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := emaAlpha(tt.alpha, tt.period)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("alpha = %v (%v), want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMidEMAFollowsUpdates(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.MidEMAAlpha = 0.5 })
+	if _, ok := MidEMA("BTC_USDT"); ok {
+		t.Fatal("EMA before any book")
+	}
+	// Mid 100 (снимок - начальное значение), затем 110, 90, 100
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	steps := []struct {
+		asks, bids []OrderBookItem
+		want       float64
+	}{
+		{levels("101:0", "111:1"), levels("99:0", "109:1"), 105},
+		{levels("111:0", "91:1"), levels("109:0", "89:1"), 97.5},
+		// Книга без bids не меняет EMA
+		{nil, levels("89:0"), 97.5},
+		{levels("91:0", "101:1"), levels("99:1"), 98.75},
+	}
+	for i, step := range steps {
+		id := int64(101 + i)
+		handleWebSocketMessage(updateMessage("BTC_USDT", id, id, step.asks, step.bids), time.Now().UnixNano())
+		if got, ok := MidEMA("BTC_USDT"); !ok || !near(got, step.want) {
+			t.Errorf("update %d: EMA = %v (%v), want %v", id, got, ok, step.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handleEMA(rec, httptest.NewRequest(http.MethodGet, "/ema", nil))
+	var values map[string]float64
+	if err := json.Unmarshal(rec.Body.Bytes(), &values); err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || !near(values["BTC_USDT"], 98.75) {
+		t.Errorf("/ema = %v, want BTC_USDT 98.75", values)
+	}
+}
+
+func TestMidEMADisabled(t *testing.T) {
+	newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	if _, ok := MidEMA("BTC_USDT"); ok {
+		t.Error("EMA reported while disabled")
+	}
+	rec := httptest.NewRecorder()
+	handleEMA(rec, httptest.NewRequest(http.MethodGet, "/ema", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 while disabled", rec.Code)
+	}
+}
@@ -0,0 +1,64 @@
+package gateorderbook
+
+import "sync"
+
+// Размер очереди событий обновления книг по умолчанию
+const defaultEventBuffer = 1024
+
+// Изменение ордербука: применено обновление или загружен снимок.
+// Слайсы уровней Book не изменяются после публикации, их можно хранить.
+type BookEvent struct {
+	Contract string
+	Book     OrderBookResponse
+	Snapshot bool // Book was replaced by a REST snapshot (initial load or resync)
+}
+
+// Очередь событий для встраивающего кода. Публикация не блокирует обработку
+// WebSocket: если читатель не успевает и очередь заполнена, отбрасывается
+// самое старое событие - последнее состояние книги всегда доходит.
+type eventQueue struct {
+	events chan BookEvent
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+func newEventQueue(size int) *eventQueue {
+	return &eventQueue{events: make(chan BookEvent, size)}
+}
+
+// Публикация события с вытеснением самого старого при заполненной очереди
+func (q *eventQueue) Publish(event BookEvent) {
+	for {
+		select {
+		case q.events <- event:
+			return
+		default:
+		}
+		select {
+		case <-q.events:
+			q.mu.Lock()
+			q.dropped++
+			q.mu.Unlock()
+			metrics.Count("orderbook.events_dropped", 1)
+		default:
+		}
+	}
+}
+
+// Число вытесненных событий
+func (q *eventQueue) Dropped() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// События обновления книг (nil - никто не подписан)
+var bookEvents *eventQueue
+
+// Публикация изменения книги, если есть подписчик
+func publishBookEvent(contract string, book OrderBookResponse, snapshot bool) {
+	if bookEvents != nil {
+		bookEvents.Publish(BookEvent{Contract: contract, Book: book, Snapshot: snapshot})
+	}
+}
@@ -0,0 +1,60 @@
+package gateorderbook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdatesPublishesAppliedChanges(t *testing.T) {
+	tracker := newTestTracker(t, func(cfg *Config) { cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"} })
+	events := tracker.Updates()
+	t.Cleanup(func() { bookEvents = nil })
+	if tracker.Updates() != events {
+		t.Error("second Updates call returned another channel")
+	}
+
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	applySnapshot("ETH_USDT", testBook(500, levels("2001:1"), levels("1999:1")))
+	handleWebSocketMessage(updateMessage("ETH_USDT", 501, 501, nil, levels("2000:4")), time.Now().UnixNano())
+
+	want := []struct {
+		contract string
+		id       int64
+		bids     string
+		snapshot bool
+	}{
+		{"BTC_USDT", 100, "99:1", true},
+		{"ETH_USDT", 500, "1999:1", true},
+		{"ETH_USDT", 501, "2000:4 1999:1", false},
+	}
+	for _, w := range want {
+		select {
+		case event := <-events:
+			if event.Contract != w.contract || event.Book.ID != w.id || levelSpecs(event.Book.Bids) != w.bids || event.Snapshot != w.snapshot {
+				t.Errorf("event = %s %d %s (snapshot %v), want %s %d %s (snapshot %v)",
+					event.Contract, event.Book.ID, levelSpecs(event.Book.Bids), event.Snapshot, w.contract, w.id, w.bids, w.snapshot)
+			}
+		default:
+			t.Fatalf("no event for %s %d", w.contract, w.id)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("%d unexpected events left", len(events))
+	}
+}
+
+func TestEventQueueDropsOldest(t *testing.T) {
+	q := newEventQueue(2)
+	// Никто не читает: публикация не блокируется, вытесняются старые события
+	for id := int64(1); id <= 5; id++ {
+		q.Publish(BookEvent{Contract: "BTC_USDT", Book: OrderBookResponse{ID: id}})
+	}
+	if q.Dropped() != 3 {
+		t.Errorf("dropped = %d, want 3", q.Dropped())
+	}
+	for _, want := range []int64{4, 5} {
+		if event := <-q.events; event.Book.ID != want {
+			t.Errorf("event id = %d, want %d", event.Book.ID, want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package gateorderbook
+
+import "os"
+
+// flock недоступен - файлы не блокируются
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package gateorderbook
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Эксклюзивная advisory блокировка файла (flock) без ожидания.
+// Блокировка снимается при закрытии файла.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return fmt.Errorf("%s is locked by another writer", f.Name())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %v", f.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package gateorderbook
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangeLogLocksFile(t *testing.T) {
+	dir := t.TempDir()
+	first, err := newChangeLog(dir, "json", compression{}, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := newChangeLog(dir, "json", compression{}, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	cf, err := first.open("BTC_USDT", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cf.f.Close()
+	if _, err := second.open("BTC_USDT", time.Now()); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("second writer opened a locked change log: %v", err)
+	}
+}
+
+func TestSeriesLocksFile(t *testing.T) {
+	dir := t.TempDir()
+	first := newSeriesWriter(dir, 0, seriesFlushPolicy{}, compression{})
+	if err := first.Open([]string{"BTC_USDT"}); err != nil {
+		t.Fatal(err)
+	}
+	second := newSeriesWriter(dir, 0, seriesFlushPolicy{}, compression{})
+	defer second.Close()
+	// Другие контракты не заняты
+	if err := second.Open([]string{"ETH_USDT"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Open([]string{"BTC_USDT"}); err == nil || !strings.Contains(err.Error(), "BTC_USDT.tob.csv is locked by another writer") {
+		t.Errorf("second writer opened a locked series file: %v", err)
+	}
+
+	// Закрытие первого писателя снимает блокировку
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Open([]string{"BTC_USDT"}); err != nil {
+		t.Errorf("series file still locked after close: %v", err)
+	}
+}
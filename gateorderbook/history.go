@@ -0,0 +1,55 @@
+package gateorderbook
+
+import "time"
+
+// Состояние ордербука на момент t по истории снимков: последний снимок
+// со временем не позже t (история может быть не отсортирована)
+func BookAsOf(history []OrderBookResponse, t time.Time) (OrderBookResponse, bool) {
+	best := -1
+	var bestTime time.Time
+	for i, ob := range history {
+		obTime := orderBookTime(ob)
+		if obTime.After(t) {
+			continue
+		}
+		if best < 0 || obTime.After(bestTime) {
+			best, bestTime = i, obTime
+		}
+	}
+	if best < 0 {
+		return OrderBookResponse{}, false
+	}
+	return cloneOrderBook(history[best]), true
+}
+
+// Дельта ордербука с временем получения
+type BookDelta struct {
+	Time   time.Time
+	Update OrderBookUpdate
+}
+
+// Восстановление ордербука на момент t по контрольным снимкам и дельтам:
+// к ближайшему снимку не позже t применяются дельты, следующие за ним
+// (u > id) и полученные не позже t. Дельты должны идти по порядку.
+func BookAsOfDeltas(checkpoints []OrderBookResponse, deltas []BookDelta, t time.Time) (OrderBookResponse, bool) {
+	book, ok := BookAsOf(checkpoints, t)
+	if !ok {
+		return OrderBookResponse{}, false
+	}
+	book = sortOrderBook(book)
+	for _, delta := range deltas {
+		if delta.Time.After(t) {
+			break
+		}
+		if delta.Update.End != 0 && delta.Update.End <= book.ID {
+			continue
+		}
+		book.Asks = UpdateOrders(book.Asks, delta.Update.Asks, false)
+		book.Bids = UpdateOrders(book.Bids, delta.Update.Bids, true)
+		book.Update = float64(delta.Time.UnixNano()) / 1e9
+		if delta.Update.End != 0 {
+			book.ID = delta.Update.End
+		}
+	}
+	return book, true
+}
@@ -0,0 +1,89 @@
+package gateorderbook
+
+import (
+	"testing"
+	"time"
+)
+
+// Снимок id со временем обновления sec
+func historyBook(id int64, sec float64, asks, bids []OrderBookItem) OrderBookResponse {
+	return OrderBookResponse{ID: id, Current: sec, Update: sec, Asks: asks, Bids: bids}
+}
+
+func TestBookAsOf(t *testing.T) {
+	// История не отсортирована
+	history := []OrderBookResponse{
+		historyBook(3, 1700000030, levels("103:1"), levels("97:1")),
+		historyBook(1, 1700000010, levels("101:1"), levels("99:1")),
+		historyBook(2, 1700000020.5, levels("102:1"), levels("98:1")),
+	}
+	tests := []struct {
+		name   string
+		at     time.Time
+		wantID int64 // 0 - no book
+	}{
+		{"before history", time.Unix(1700000009, 0), 0},
+		{"exactly at a snapshot", time.Unix(1700000010, 0), 1},
+		{"between snapshots", time.Unix(1700000020, 0), 1},
+		{"sub-second snapshot time", time.Unix(1700000020, 500000000), 2},
+		{"after history", time.Unix(1700000100, 0), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, ok := BookAsOf(history, tt.at)
+			if ok != (tt.wantID != 0) || book.ID != tt.wantID {
+				t.Errorf("book = %d (%v), want %d", book.ID, ok, tt.wantID)
+			}
+		})
+	}
+
+	// Возвращается копия: изменения не затрагивают историю
+	book, _ := BookAsOf(history, time.Unix(1700000100, 0))
+	book.Asks[0].P = "999"
+	if history[0].Asks[0].P != "103" {
+		t.Error("BookAsOf returned levels shared with the history")
+	}
+}
+
+func TestBookAsOfDeltas(t *testing.T) {
+	checkpoints := []OrderBookResponse{
+		historyBook(100, 1700000000, levels("101:1", "102:2"), levels("99:1")),
+		historyBook(200, 1700000060, levels("110:1"), levels("108:1")),
+	}
+	at := func(sec int64) time.Time { return time.Unix(sec, 0) }
+	deltas := []BookDelta{
+		{at(1700000005), OrderBookUpdate{End: 99, Asks: levels("101:9")}}, // Older than the checkpoint
+		{at(1700000010), OrderBookUpdate{U: 101, End: 101, Asks: levels("101:0")}},
+		{at(1700000020), OrderBookUpdate{U: 102, End: 102, Bids: levels("99.5:3")}},
+		{at(1700000070), OrderBookUpdate{U: 201, End: 201, Asks: levels("109:4")}},
+	}
+	tests := []struct {
+		name               string
+		at                 time.Time
+		wantID             int64
+		wantAsks, wantBids string
+	}{
+		{"before the first checkpoint", at(1699999999), 0, "", ""},
+		{"checkpoint only", at(1700000009), 100, "101:1 102:2", "99:1"},
+		{"one delta applied", at(1700000015), 101, "102:2", "99:1"},
+		{"two deltas applied", at(1700000059), 102, "102:2", "99.5:3 99:1"},
+		{"next checkpoint", at(1700000065), 200, "110:1", "108:1"},
+		{"delta after the next checkpoint", at(1700000100), 201, "109:4 110:1", "108:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, ok := BookAsOfDeltas(checkpoints, deltas, tt.at)
+			if ok != (tt.wantID != 0) || book.ID != tt.wantID {
+				t.Fatalf("book = %d (%v), want %d", book.ID, ok, tt.wantID)
+			}
+			if levelSpecs(book.Asks) != tt.wantAsks || levelSpecs(book.Bids) != tt.wantBids {
+				t.Errorf("book = %s / %s, want %s / %s", levelSpecs(book.Asks), levelSpecs(book.Bids), tt.wantAsks, tt.wantBids)
+			}
+		})
+	}
+
+	// Контрольные снимки не изменяются применением дельт
+	if got := levelSpecs(checkpoints[0].Asks); got != "101:1 102:2" {
+		t.Errorf("checkpoint asks = %s after reconstruction", got)
+	}
+}
@@ -0,0 +1,560 @@
+package gateorderbook
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Запись JSON ответа
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		errorf("HTTP response encode error: %v", err)
+	}
+}
+
+// Обработчик статистики интервалов между обновлениями
+func handleIntervals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, updateIntervals.Stats())
+}
+
+// Ответ с базисом относительно референсной цены (null, если не вычисляется)
+type basisResponse struct {
+	Contract    string   `json:"contract"`
+	RefPrice    float64  `json:"ref_price"`
+	MidBasisBps *float64 `json:"mid_basis_bps"`
+	BidBasisBps *float64 `json:"bid_basis_bps"`
+	AskBasisBps *float64 `json:"ask_basis_bps"`
+}
+
+func nullableFloat(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// Обработчик базиса: GET /basis/{contract}?ref=<price>
+func handleBasis(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contract := strings.TrimPrefix(r.URL.Path, "/basis/")
+	refPrice, err := strconv.ParseFloat(r.URL.Query().Get("ref"), 64)
+	if err != nil || refPrice <= 0 {
+		http.Error(w, "query parameter ref must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	orderbook, ok := orderbooks.Get(contract)
+	if !ok {
+		http.Error(w, "unknown contract", http.StatusNotFound)
+		return
+	}
+
+	mid, bid, ask := Basis(orderbook, refPrice)
+	writeJSON(w, http.StatusOK, basisResponse{
+		Contract:    contract,
+		RefPrice:    refPrice,
+		MidBasisBps: nullableFloat(mid),
+		BidBasisBps: nullableFloat(bid),
+		AskBasisBps: nullableFloat(ask),
+	})
+}
+
+// Ответ /bands
+type bandsResponse struct {
+	Contract string    `json:"contract"`
+	Bands    []float64 `json:"bands_pct"`
+	Bids     []float64 `json:"bids"`
+	Asks     []float64 `json:"asks"`
+}
+
+// Обработчик объема по полосам от mid: GET /bands/{contract}?bands=0.1,0.5,1
+func handleBands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spec := r.URL.Query().Get("bands")
+	if spec == "" {
+		spec = "0.1,0.5,1"
+	}
+	bands, err := parseBands(spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contract := strings.TrimPrefix(r.URL.Path, "/bands/")
+	orderbook, ok := orderbooks.Get(contract)
+	if !ok {
+		http.Error(w, "unknown contract", http.StatusNotFound)
+		return
+	}
+
+	bids, asks := BandedLiquidity(orderbook, bands)
+	writeJSON(w, http.StatusOK, bandsResponse{Contract: contract, Bands: bands, Bids: bids, Asks: asks})
+}
+
+// Обработчик выгрузки всех ордербуков: GET /dump
+func handleDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := DumpAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Минимальный спред (bps) для включения контракта в сводку по рынку
+var summaryMinSpreadBps = 0.0
+
+// Обработчик сводки по рынку: GET /summary
+func handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, summarizeMarket(orderbooks.Snapshot(), summaryMinSpreadBps))
+}
+
+// Максимальная глубина ответа GET /orderbook/{contract}
+const maxResponseDepth = 1000
+
+// Разбор необязательного параметра цены
+func parsePriceParam(r *http.Request, name string, fallback float64) (float64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil || price < 0 || math.IsNaN(price) {
+		return 0, fmt.Errorf("query parameter %s must be a non-negative number", name)
+	}
+	return price, nil
+}
+
+// Обработчик ордербука: GET /orderbook/{contract}?depth=&min_price=&max_price=
+func handleOrderBook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	depth := maxResponseDepth
+	if value := r.URL.Query().Get("depth"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "query parameter depth must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		if parsed < depth {
+			depth = parsed
+		}
+	}
+	minPrice, err := parsePriceParam(r, "min_price", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxPrice, err := parsePriceParam(r, "max_price", math.Inf(1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if minPrice > maxPrice {
+		http.Error(w, "min_price must not exceed max_price", http.StatusBadRequest)
+		return
+	}
+
+	contract := strings.TrimPrefix(r.URL.Path, "/orderbook/")
+	orderbook, ok := orderbooks.Get(contract)
+	if !ok {
+		// Отслеживаемый контракт без книги (ждет снимка) отличается от неизвестного
+		if _, tracked := contractSettles[contract]; tracked {
+			http.Error(w, "orderbook is not loaded yet", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unknown contract", http.StatusNotFound)
+		return
+	}
+
+	filtered := filterOrderBook(orderbook, minPrice, maxPrice)
+	writeJSON(w, http.StatusOK, truncateOrderBook(filtered, depth))
+}
+
+// Элемент ответа /orderbooks
+type contractListing struct {
+	Contract string  `json:"contract"`
+	Settle   string  `json:"settle"`
+	Ready    bool    `json:"ready"` // The book is loaded and can be fetched from /orderbook/{contract}
+	ID       int64   `json:"id,omitempty"`
+	Update   float64 `json:"update,omitempty"`
+}
+
+// Обработчик списка отслеживаемых контрактов: GET /orderbooks
+func handleOrderBooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	books := orderbooks.Snapshot()
+	listing := make([]contractListing, 0, len(contractSettles))
+	for contract, settle := range contractSettles {
+		entry := contractListing{Contract: contract, Settle: settle}
+		if orderbook, ok := books[contract]; ok {
+			entry.Ready, entry.ID, entry.Update = true, orderbook.ID, orderbook.Update
+		}
+		listing = append(listing, entry)
+	}
+	sort.Slice(listing, func(i, j int) bool { return listing[i].Contract < listing[j].Contract })
+	writeJSON(w, http.StatusOK, listing)
+}
+
+// Обработчик возраста книг: GET /staleness
+func handleStaleness(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if staleBooks == nil {
+		http.Error(w, "stale book detection is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, staleBooks.Ages())
+}
+
+// Обработчик статистики восстановления глубины: GET /resilience
+func handleResilience(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if bookResilience == nil {
+		http.Error(w, "resilience tracking is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, bookResilience.Stats())
+}
+
+// Обработчик счетчиков отброшенных строк ряда лучших цен: GET /series/dropped
+func handleSeriesDropped(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if topOfBookSeries == nil {
+		http.Error(w, "top-of-book series is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, topOfBookSeries.Dropped())
+}
+
+// Обработчик накопленной дельты объема: GET /delta
+func handleDelta(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cumulativeDeltas == nil {
+		http.Error(w, "trades tracking is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, cumulativeDeltas.Totals())
+}
+
+// Ответ /volatility
+type volatilityResponse struct {
+	Contract   string   `json:"contract"`
+	Window     string   `json:"window"`
+	Volatility *float64 `json:"volatility"` // Null when the window has too few observations
+	Annualized bool     `json:"annualized"`
+}
+
+// Обработчик реализованной волатильности mid цены:
+// GET /volatility/{contract}?window=5m&annualize=true
+func handleVolatility(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := 5 * time.Minute
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "query parameter window must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+	annualize := r.URL.Query().Get("annualize") == "true"
+
+	contract := strings.TrimPrefix(r.URL.Path, "/volatility/")
+	if _, ok := orderbooks.Get(contract); !ok {
+		http.Error(w, "unknown contract", http.StatusNotFound)
+		return
+	}
+
+	vol := RealizedVolatility(contract, window)
+	if annualize {
+		vol = AnnualizedVolatility(contract, window)
+	}
+	writeJSON(w, http.StatusOK, volatilityResponse{
+		Contract:   contract,
+		Window:     window.String(),
+		Volatility: nullableFloat(vol),
+		Annualized: annualize,
+	})
+}
+
+// Обработчик EMA mid цены: GET /ema
+func handleEMA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if midEMAs == nil {
+		http.Error(w, "mid-price EMA is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, midEMAs.Values())
+}
+
+// Обработчики паузы и возобновления контракта:
+// POST /pause/{contract} и POST /resume/{contract}
+func handlePause(w http.ResponseWriter, r *http.Request) {
+	handlePauseToggle(w, r, "/pause/", true)
+}
+
+func handleResume(w http.ResponseWriter, r *http.Request) {
+	handlePauseToggle(w, r, "/resume/", false)
+}
+
+func handlePauseToggle(w http.ResponseWriter, r *http.Request, prefix string, pause bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	contract := strings.TrimPrefix(r.URL.Path, prefix)
+	if _, ok := orderbooks.Get(contract); !ok {
+		http.Error(w, "unknown contract", http.StatusNotFound)
+		return
+	}
+
+	if pause {
+		if pausedContracts.Pause(contract) {
+			infof("Paused saving and streaming for %s", contract)
+		}
+	} else if pausedContracts.Resume(contract) {
+		// Подписчики пропустили дельты за время паузы - начинаем со снимка
+		if tcpStream != nil {
+			tcpStream.Resync(contract)
+		}
+		infof("Resumed saving and streaming for %s", contract)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"contract": contract,
+		"paused":   pause,
+	})
+}
+
+// Ответ /stats
+type statsResponse struct {
+	Saves     map[string]SaveStats `json:"saves"`
+	Crossed   map[string]int64     `json:"crossed"`   // Times each book became crossed
+	Locked    map[string]int64     `json:"locked"`    // Times each book became locked (best bid == best ask)
+	Resyncs   map[string]int64     `json:"resyncs"`   // Resyncs of each book since start
+	Checksums map[string]int32     `json:"checksums"` // Last checksum computed for each verified book
+}
+
+// Обработчик статистики трекера: GET /stats
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, statsResponse{
+		Saves:     saveSizes.Stats(),
+		Crossed:   crossedBooks.Counts(),
+		Locked:    crossedBooks.LockedCounts(),
+		Resyncs:   resyncCounts.Counts(),
+		Checksums: lastChecksums.Snapshot(),
+	})
+}
+
+// Уровень логирования в запросе и ответе /loglevel
+type logLevelBody struct {
+	Level string `json:"level"`
+}
+
+// Обработчик уровня логирования: GET /loglevel, POST /loglevel {"level":"debug"}
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var body logLevelBody
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		level, err := ParseLogLevel(body.Level)
+		if err != nil {
+			http.Error(w, "unknown level, expected debug, info, warn or error", http.StatusBadRequest)
+			return
+		}
+		LogLevel.Set(level)
+		log.Printf("Log level set to %s (HTTP)", level)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, logLevelBody{Level: LogLevel.Level().String()})
+}
+
+// Маршруты встроенного HTTP сервера
+func newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/intervals", handleIntervals)
+	mux.HandleFunc("/basis/", handleBasis)
+	mux.HandleFunc("/dump", handleDump)
+	mux.HandleFunc("/bands/", handleBands)
+	mux.HandleFunc("/summary", handleSummary)
+	mux.HandleFunc("/orderbook/", handleOrderBook)
+	mux.HandleFunc("/orderbooks", handleOrderBooks)
+	mux.HandleFunc("/staleness", handleStaleness)
+	if promMetrics != nil {
+		mux.Handle("/metrics", promMetrics.Handler())
+	}
+	mux.HandleFunc("/resilience", handleResilience)
+	mux.HandleFunc("/series/dropped", handleSeriesDropped)
+	mux.HandleFunc("/loglevel", handleLogLevel)
+	mux.HandleFunc("/delta", handleDelta)
+	mux.HandleFunc("/ema", handleEMA)
+	mux.HandleFunc("/volatility/", handleVolatility)
+	mux.HandleFunc("/stats", handleStats)
+	mux.HandleFunc("/pause/", handlePause)
+	mux.HandleFunc("/resume/", handleResume)
+	return mux
+}
+
+// Настройки TLS встроенного HTTP сервера
+type HTTPTLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string // If set, clients must present a certificate signed by this CA
+}
+
+// Конфигурация TLS с опциональной проверкой клиентских сертификатов
+func newServerTLSConfig(opts HTTPTLSOptions) (*tls.Config, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, fmt.Errorf("both TLS certificate and key are required")
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if opts.ClientCAFile != "" {
+		caPEM, err := ioutil.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", opts.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Ограничения HTTP сервера: чтение заголовков запроса и ожидание
+// незавершенных запросов при остановке
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpShutdownTimeout   = 5 * time.Second
+)
+
+// Запуск встроенного HTTP сервера (HTTPS, если заданы сертификат и ключ).
+// Ошибка открытия адреса возвращается сразу; сервер останавливается с ctx.
+func startHTTPServer(ctx context.Context, addr string, tlsOpts HTTPTLSOptions) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newHTTPHandler(),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+
+	useTLS := tlsOpts.CertFile != "" || tlsOpts.KeyFile != "" || tlsOpts.ClientCAFile != ""
+	if useTLS {
+		config, err := newServerTLSConfig(tlsOpts)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = config
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var err error
+		if useTLS {
+			infof("HTTPS server listening on %s (client certificates required: %t)", listener.Addr(), tlsOpts.ClientCAFile != "")
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			infof("HTTP server listening on %s", listener.Addr())
+			err = server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errorf("HTTP server error: %v", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			errorf("HTTP server shutdown error: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,340 @@
+package gateorderbook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Свободный локальный адрес
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer probe.Close()
+	return probe.Addr().String()
+}
+
+func TestHTTPServerReportsListenError(t *testing.T) {
+	newTestTracker(t, nil)
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startHTTPServer(ctx, busy.Addr().String(), HTTPTLSOptions{}); err == nil {
+		t.Error("startHTTPServer on a busy address returned nil")
+	}
+}
+
+func TestHTTPServerStopsOnCancel(t *testing.T) {
+	newTestTracker(t, nil)
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startHTTPServer(ctx, addr, HTTPTLSOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Адрес открыт до возврата: запрос проходит сразу
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + addr + "/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/stats status = %d", resp.StatusCode)
+	}
+
+	cancel()
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if i > 100 {
+			t.Fatal("HTTP server still accepting after cancel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOrderBookRangeQueries(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"} })
+	orderbooks.Set("BTC_USDT", testBook(100, levels("101:1", "102:2", "105:3"), levels("99:1", "98:2", "95:3")))
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantAsks   string
+		wantBids   string
+	}{
+		{"whole book", "/orderbook/BTC_USDT", http.StatusOK, "101:1 102:2 105:3", "99:1 98:2 95:3"},
+		{"price range", "/orderbook/BTC_USDT?min_price=98&max_price=102", http.StatusOK, "101:1 102:2", "99:1 98:2"},
+		{"range above mid", "/orderbook/BTC_USDT?min_price=100", http.StatusOK, "101:1 102:2 105:3", ""},
+		{"depth", "/orderbook/BTC_USDT?depth=1", http.StatusOK, "101:1", "99:1"},
+		{"depth within range", "/orderbook/BTC_USDT?depth=1&max_price=98.5", http.StatusOK, "", "98:2"},
+		{"inverted range", "/orderbook/BTC_USDT?min_price=102&max_price=101", http.StatusBadRequest, "", ""},
+		{"negative price", "/orderbook/BTC_USDT?min_price=-1", http.StatusBadRequest, "", ""},
+		{"invalid depth", "/orderbook/BTC_USDT?depth=0", http.StatusBadRequest, "", ""},
+		{"tracked, not loaded", "/orderbook/ETH_USDT", http.StatusNotFound, "", ""},
+		{"unknown contract", "/orderbook/SOL_USDT", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleOrderBook(rec, httptest.NewRequest(http.MethodGet, tt.query, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var book OrderBookResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &book); err != nil {
+				t.Fatal(err)
+			}
+			if levelSpecs(book.Asks) != tt.wantAsks || levelSpecs(book.Bids) != tt.wantBids {
+				t.Errorf("book = %s / %s, want %s / %s", levelSpecs(book.Asks), levelSpecs(book.Bids), tt.wantAsks, tt.wantBids)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handleOrderBook(rec, httptest.NewRequest(http.MethodGet, "/orderbook/ETH_USDT", nil))
+	if body := strings.TrimSpace(rec.Body.String()); body != "orderbook is not loaded yet" {
+		t.Errorf("tracked contract without a book = %q, want not loaded yet", body)
+	}
+}
+
+func TestOrderBooksListing(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.Contracts = []string{"ETH_USDT", "btc:BTC_USD", "BTC_USDT"} })
+	book := testBook(100, levels("101:1"), levels("99:1"))
+	book.Update = 1700000000.5
+	orderbooks.Set("BTC_USDT", book)
+
+	rec := httptest.NewRecorder()
+	newHTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orderbooks", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	want := `[{"contract":"BTC_USD","settle":"btc","ready":false},` +
+		`{"contract":"BTC_USDT","settle":"usdt","ready":true,"id":100,"update":1700000000.5},` +
+		`{"contract":"ETH_USDT","settle":"usdt","ready":false}]`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("listing = %s, want %s", got, want)
+	}
+
+	for _, target := range []string{"/orderbooks", "/orderbook/BTC_USDT"} {
+		rec := httptest.NewRecorder()
+		newHTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("POST %s status = %d, want 405", target, rec.Code)
+		}
+	}
+}
+
+func TestOrderBookHandlerDuringUpdates(t *testing.T) {
+	newTestTracker(t, nil)
+	captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	handler := newHTTPHandler()
+
+	// Обработчик читает книгу, пока обновления меняют ее; проверяется под -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for id := int64(101); id <= 300; id++ {
+			size := strconv.FormatInt(id, 10)
+			handleWebSocketMessage(updateMessage("BTC_USDT", id, id, levels("101:"+size), levels("99:"+size)), time.Now().UnixNano())
+		}
+	}()
+	for polling := true; polling; {
+		select {
+		case <-done:
+			polling = false
+		default:
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orderbook/BTC_USDT", nil))
+		var book OrderBookResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &book); err != nil {
+			t.Fatalf("status %d: %v", rec.Code, err)
+		}
+		// Обе стороны всегда из одного обновления
+		if len(book.Asks) != 1 || len(book.Bids) != 1 || !book.Asks[0].S.Equal(book.Bids[0].S) {
+			t.Fatalf("torn book %d: %s / %s", book.ID, levelSpecs(book.Asks), levelSpecs(book.Bids))
+		}
+	}
+}
+
+// Тестовый сертификат, подписанный parent (самоподписанный, если parent nil)
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+	tls  tls.Certificate
+}
+
+func issueCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		tls:  tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+	}
+}
+
+// Запись сертификата и ключа в PEM файлы
+func writeCertFiles(t *testing.T, dir, name string, c *testCert) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, c.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHTTPServerClientCertificates(t *testing.T) {
+	newTestTracker(t, nil)
+	dir := t.TempDir()
+	ca := issueCert(t, "tracker CA", nil, true)
+	server := issueCert(t, "tracker", ca, false)
+	client := issueCert(t, "client", ca, false)
+	rogue := issueCert(t, "rogue", issueCert(t, "other CA", nil, true), false)
+
+	certFile, keyFile := writeCertFiles(t, dir, "server", server)
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := freeAddr(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startHTTPServer(ctx, addr, HTTPTLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	tests := []struct {
+		name   string
+		certs  []tls.Certificate
+		wantOK bool
+	}{
+		{"no client certificate", nil, false},
+		{"certificate from another CA", []tls.Certificate{rogue.tls}, false},
+		{"certificate signed by the client CA", []tls.Certificate{client.tls}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpClient := &http.Client{
+				Timeout: 5 * time.Second,
+				Transport: &http.Transport{TLSClientConfig: &tls.Config{
+					RootCAs:      roots,
+					Certificates: tt.certs,
+				}},
+			}
+			resp, err := httpClient.Get("https://" + addr + "/stats")
+			if !tt.wantOK {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("status = %d, want the handshake rejected", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status = %d, want 200", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestServerTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertFiles(t, dir, "server", issueCert(t, "tracker", nil, false))
+	emptyCA := filepath.Join(dir, "empty.crt")
+	if err := os.WriteFile(emptyCA, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts HTTPTLSOptions
+		want string
+	}{
+		{"key missing", HTTPTLSOptions{CertFile: certFile}, "both TLS certificate and key are required"},
+		{"bad key pair", HTTPTLSOptions{CertFile: certFile, KeyFile: certFile}, "failed to load TLS key pair"},
+		{"CA without certificates", HTTPTLSOptions{CertFile: certFile, KeyFile: keyFile, ClientCAFile: emptyCA}, "no certificates found in client CA file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newServerTLSConfig(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
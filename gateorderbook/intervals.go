@@ -0,0 +1,100 @@
+package gateorderbook
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Статистика интервалов между обновлениями контракта
+type IntervalStats struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// Скользящее окно интервалов между последовательными обновлениями по контрактам
+type intervalRecorder struct {
+	mu      sync.Mutex
+	window  int
+	last    map[string]time.Time
+	samples map[string][]time.Duration
+	next    map[string]int
+}
+
+func newIntervalRecorder(window int) *intervalRecorder {
+	if window <= 0 {
+		window = 1
+	}
+	return &intervalRecorder{
+		window:  window,
+		last:    make(map[string]time.Time),
+		samples: make(map[string][]time.Duration),
+		next:    make(map[string]int),
+	}
+}
+
+// Регистрация обновления контракта в момент t, возвращает интервал с предыдущего
+func (r *intervalRecorder) Record(contract string, t time.Time) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, ok := r.last[contract]
+	r.last[contract] = t
+	if !ok || t.Before(prev) {
+		return 0, false
+	}
+
+	interval := t.Sub(prev)
+	samples := r.samples[contract]
+	if len(samples) < r.window {
+		r.samples[contract] = append(samples, interval)
+		return interval, true
+	}
+	// Окно заполнено - перезаписываем самый старый интервал
+	i := r.next[contract]
+	samples[i] = interval
+	r.next[contract] = (i + 1) % r.window
+	return interval, true
+}
+
+// Перцентили интервалов по всем контрактам
+func (r *intervalRecorder) Stats() map[string]IntervalStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]IntervalStats, len(r.samples))
+	for contract, samples := range r.samples {
+		sorted := append([]time.Duration(nil), samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		stats[contract] = IntervalStats{
+			Count: len(sorted),
+			P50:   durationMs(percentile(sorted, 0.50)),
+			P90:   durationMs(percentile(sorted, 0.90)),
+			P99:   durationMs(percentile(sorted, 0.99)),
+			Max:   durationMs(percentile(sorted, 1)),
+		}
+	}
+	return stats
+}
+
+// Перцентиль по отсортированной выборке (nearest-rank)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
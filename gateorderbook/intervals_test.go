@@ -0,0 +1,86 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Регистрация обновлений с заданными интервалами в миллисекундах
+func recordIntervals(r *intervalRecorder, contract string, intervalsMs ...int) {
+	at := time.Unix(1700000000, 0)
+	r.Record(contract, at)
+	for _, ms := range intervalsMs {
+		at = at.Add(time.Duration(ms) * time.Millisecond)
+		r.Record(contract, at)
+	}
+}
+
+func TestIntervalRecorderStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    int
+		intervals []int
+		want      IntervalStats
+	}{
+		{"percentiles", 100, []int{30, 10, 20, 40, 50, 100, 60, 70, 90, 80}, IntervalStats{Count: 10, P50: 50, P90: 90, P99: 100, Max: 100}},
+		{"single interval", 100, []int{15}, IntervalStats{Count: 1, P50: 15, P90: 15, P99: 15, Max: 15}},
+		{"window keeps the latest intervals", 3, []int{10, 20, 30, 40}, IntervalStats{Count: 3, P50: 30, P90: 40, P99: 40, Max: 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newIntervalRecorder(tt.window)
+			recordIntervals(r, "BTC_USDT", tt.intervals...)
+			if got := r.Stats()["BTC_USDT"]; got != tt.want {
+				t.Errorf("stats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntervalRecorderRecord(t *testing.T) {
+	r := newIntervalRecorder(10)
+	at := time.Unix(1700000000, 0)
+	if _, ok := r.Record("BTC_USDT", at); ok {
+		t.Error("interval reported for the first update")
+	}
+	if interval, ok := r.Record("BTC_USDT", at.Add(25*time.Millisecond)); !ok || interval != 25*time.Millisecond {
+		t.Errorf("interval = %s (%v), want 25ms", interval, ok)
+	}
+	// Часы пошли назад: интервал не учитывается, отсчет идет от нового времени
+	if _, ok := r.Record("BTC_USDT", at); ok {
+		t.Error("negative interval recorded")
+	}
+	if interval, _ := r.Record("BTC_USDT", at.Add(5*time.Millisecond)); interval != 5*time.Millisecond {
+		t.Errorf("interval after the clock step = %s, want 5ms", interval)
+	}
+	// Контракты учитываются отдельно
+	if _, ok := r.Record("ETH_USDT", at.Add(time.Second)); ok {
+		t.Error("interval reported for the first update of another contract")
+	}
+	if stats := r.Stats(); len(stats) != 1 || stats["BTC_USDT"].Count != 2 {
+		t.Errorf("stats = %+v, want 2 intervals for BTC_USDT only", stats)
+	}
+}
+
+func TestIntervalsEndpoint(t *testing.T) {
+	newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	start := time.Unix(1700000000, 0)
+	for i, offset := range []time.Duration{0, 20 * time.Millisecond, 120 * time.Millisecond} {
+		id := int64(101 + i)
+		handleWebSocketMessage(updateMessage("BTC_USDT", id, id, nil, levels("99:2")), start.Add(offset).UnixNano())
+	}
+
+	rec := httptest.NewRecorder()
+	handleIntervals(rec, httptest.NewRequest(http.MethodGet, "/intervals", nil))
+	var stats map[string]IntervalStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if got := stats["BTC_USDT"]; got.Count != 2 || got.Max != 100 || got.P50 != 20 {
+		t.Errorf("stats = %+v, want 2 intervals of 20ms and 100ms", got)
+	}
+}
@@ -0,0 +1,96 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"time"
+)
+
+// Событие перехода глубины у mid через порог
+type LiquidityAlert struct {
+	Contract  string  `json:"contract"`
+	Threshold float64 `json:"threshold"`
+	BandBps   float64 `json:"band_bps"`
+	Direction string  `json:"direction"` // "below": depth fell under the threshold, "above": it recovered past threshold*(1+hysteresis)
+	Depth     float64 `json:"depth"`     // Bid plus ask size within the band
+	Time      int64   `json:"time"`      // Unix ms
+}
+
+// Алерты на глубину в полосе bandBps от mid по контрактам. Глубина ниже
+// порога переводит контракт в состояние "below", а обратно в "above" он
+// возвращается только при глубине выше порога на hysteresis (доля), чтобы
+// колебания около порога не давали серию алертов.
+type liquidityAlerts struct {
+	thresholds map[string]float64
+	bandBps    float64
+	hysteresis float64
+	state      map[string]string // "above", "below" or "" before the first two-sided book
+	webhook    string
+}
+
+func newLiquidityAlerts(thresholds map[string]float64, bandBps, hysteresis float64, webhook string) *liquidityAlerts {
+	return &liquidityAlerts{
+		thresholds: thresholds,
+		bandBps:    bandBps,
+		hysteresis: hysteresis,
+		state:      make(map[string]string),
+		webhook:    webhook,
+	}
+}
+
+// Разбор порогов глубины вида "BTC_USDT=50000,ETH_USDT=20000"
+func ParseLiquidityThresholds(s string) (map[string]float64, error) {
+	return parseContractValues(s, "liquidity threshold", "SIZE")
+}
+
+// Проверка настроек алертов на глубину
+func validateLiquidityAlerts(bandBps, hysteresis float64) error {
+	if bandBps <= 0 {
+		return fmt.Errorf("liquidity alert band must be positive, got %v bps", bandBps)
+	}
+	if hysteresis < 0 {
+		return fmt.Errorf("liquidity alert hysteresis must not be negative, got %v", hysteresis)
+	}
+	return nil
+}
+
+// Проверка ордербука; возвращает алерт, если глубина перешла через порог.
+// Первый двусторонний снимок с глубиной ниже порога тоже дает алерт.
+func (a *liquidityAlerts) Check(contract string, orderbook OrderBookResponse) (LiquidityAlert, bool) {
+	threshold, ok := a.thresholds[contract]
+	if !ok {
+		return LiquidityAlert{}, false
+	}
+	if _, ok := orderbook.MidPrice(); !ok {
+		return LiquidityAlert{}, false
+	}
+
+	bids, asks := LiquidityWithinBps(orderbook, a.bandBps)
+	depth := bids + asks
+	previous := a.state[contract]
+	direction := previous
+	switch {
+	case depth < threshold:
+		direction = "below"
+	case depth > threshold*(1+a.hysteresis) || previous == "":
+		direction = "above"
+	}
+	a.state[contract] = direction
+	if direction == previous || (previous == "" && direction == "above") {
+		return LiquidityAlert{}, false
+	}
+
+	alert := LiquidityAlert{
+		Contract:  contract,
+		Threshold: threshold,
+		BandBps:   a.bandBps,
+		Direction: direction,
+		Depth:     depth,
+		Time:      time.Now().UnixMilli(),
+	}
+	warnf("Liquidity alert: %s depth within %v bps is %s %v (%v)", contract, a.bandBps, direction, threshold, depth)
+	metrics.Count("orderbook.liquidity_alerts."+contract, 1)
+	if a.webhook != "" {
+		go postAlert(a.webhook, alert)
+	}
+	return alert, true
+}
@@ -0,0 +1,123 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Книга с mid 100: объем bid у 99.5 и ask у 100.5 плюс далекий уровень вне полосы
+func depthBook(bid, ask string) OrderBookResponse {
+	return testBook(1, levels("100.5:"+ask, "120:1000"), levels("99.5:"+bid, "80:1000"))
+}
+
+func TestLiquidityAlertHysteresis(t *testing.T) {
+	newTestTracker(t, nil)
+	captureLog(t)
+	alerts := newLiquidityAlerts(map[string]float64{"BTC_USDT": 10}, 100, 0.2, "")
+	steps := []struct {
+		bid, ask      string
+		wantDirection string // "" - no alert
+	}{
+		{"10", "10", ""},        // Первая книга выше порога
+		{"4", "4", "below"},     // 8 < 10
+		{"2", "3", ""},          // По-прежнему ниже
+		{"5", "6", ""},          // 11 выше порога, но в пределах гистерезиса 20%
+		{"4", "5", ""},          // 9, все еще ниже
+		{"6", "7", "above"},     // 13 > 12
+		{"8", "7", ""},          // По-прежнему выше
+		{"5", "5", ""},          // Ровно на пороге - не ниже
+		{"4.5", "4.5", "below"}, // Снова 9 < 10
+	}
+	for i, step := range steps {
+		alert, fired := alerts.Check("BTC_USDT", depthBook(step.bid, step.ask))
+		if fired != (step.wantDirection != "") || alert.Direction != step.wantDirection {
+			t.Errorf("step %d: alert %v (%q), want %q", i, fired, alert.Direction, step.wantDirection)
+		}
+	}
+
+	// Первая же книга ниже порога дает алерт
+	alerts = newLiquidityAlerts(map[string]float64{"BTC_USDT": 10}, 100, 0.2, "")
+	if alert, fired := alerts.Check("BTC_USDT", depthBook("1", "1")); !fired || alert.Direction != "below" || alert.Depth != 2 {
+		t.Errorf("first book below the threshold: alert %v %+v", fired, alert)
+	}
+	if _, fired := alerts.Check("ETH_USDT", depthBook("1", "1")); fired {
+		t.Error("alert fired for a contract without a threshold")
+	}
+	if _, fired := alerts.Check("BTC_USDT", testBook(1, nil, levels("99.5:100"))); fired {
+		t.Error("alert fired for a one-sided book")
+	}
+}
+
+func TestLiquidityAlertOncePerTransition(t *testing.T) {
+	var mu sync.Mutex
+	var received []LiquidityAlert
+	hook := serveWebhook(t, func(w http.ResponseWriter, r *http.Request) {
+		var alert LiquidityAlert
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &alert); err != nil {
+			t.Errorf("webhook body %q: %v", body, err)
+		}
+		mu.Lock()
+		received = append(received, alert)
+		mu.Unlock()
+	})
+	newTestTracker(t, func(cfg *Config) {
+		cfg.LiquidityAlerts = map[string]float64{"BTC_USDT": 10}
+		cfg.LiquidityBandBps = 100
+		cfg.LiquidityHyst = 0.2
+		cfg.AlertWebhook = hook
+	})
+	logs := captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("100.5:10", "120:1000"), levels("99.5:10")))
+
+	// Глубина 20, затем 6, 9, 11 и 13
+	updates := [][]OrderBookItem{levels("100.5:3"), nil, levels("100.5:6"), levels("100.5:8"), levels("100.5:10")}
+	bids := [][]OrderBookItem{levels("99.5:3"), levels("99.5:3"), nil, nil, nil}
+	for i := range updates {
+		id := int64(101 + i)
+		handleWebSocketMessage(updateMessage("BTC_USDT", id, id, updates[i], bids[i]), time.Now().UnixNano())
+	}
+
+	if got := strings.Count(logs.String(), "Liquidity alert:"); got != 2 {
+		t.Errorf("log has %d alerts, want 2: %q", got, logs)
+	}
+	for _, want := range []string{
+		"Warning: Liquidity alert: BTC_USDT depth within 100 bps is below 10 (6)",
+		"Warning: Liquidity alert: BTC_USDT depth within 100 bps is above 10 (13)",
+	} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log = %q, want %q", logs, want)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("webhook calls = %d, want 2", len(received))
+	}
+	// Вебхуки отправляются параллельно, порядок не гарантирован
+	sort.Slice(received, func(i, j int) bool { return received[i].Depth < received[j].Depth })
+	if got := received[0]; got.Direction != "below" || got.Depth != 6 || got.Threshold != 10 || got.BandBps != 100 {
+		t.Errorf("first alert = %+v, want below 10 at depth 6", got)
+	}
+	if got := received[1]; got.Direction != "above" || got.Depth != 13 {
+		t.Errorf("second alert = %+v, want above 10 at depth 13", got)
+	}
+}
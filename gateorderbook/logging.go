@@ -0,0 +1,61 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"log"
+	"log/slog"
+)
+
+// Текущий уровень логирования (по умолчанию info)
+var LogLevel = new(slog.LevelVar)
+
+// Разбор уровня логирования: debug, info, warn, error
+func ParseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(s))
+	return level, err
+}
+
+// Отладочное сообщение, выводится только на уровне debug
+func debugf(format string, args ...interface{}) {
+	if LogLevel.Level() <= slog.LevelDebug {
+		log.Printf("DEBUG "+format, args...)
+	}
+}
+
+// Обычное сообщение, выводится на уровнях debug и info
+func infof(format string, args ...interface{}) {
+	if LogLevel.Level() <= slog.LevelInfo {
+		log.Printf(format, args...)
+	}
+}
+
+// Предупреждение, выводится на уровнях до warn включительно
+func warnf(format string, args ...interface{}) {
+	if LogLevel.Level() <= slog.LevelWarn {
+		log.Printf("Warning: "+format, args...)
+	}
+}
+
+// Сообщение об ошибке, выводится на любом уровне до error включительно
+func errorf(format string, args ...interface{}) {
+	if LogLevel.Level() <= slog.LevelError {
+		log.Printf("ERROR "+format, args...)
+	}
+}
+
+// JSON сообщения для лога со скрытыми полями авторизации
+func redactedJSON(msg map[string]interface{}) string {
+	redacted := make(map[string]interface{}, len(msg))
+	for key, value := range msg {
+		if key == "auth" {
+			value = "[REDACTED]"
+		}
+		redacted[key] = value
+	}
+	data, err := json.Marshal(redacted)
+	if err != nil {
+		return "<unencodable message>"
+	}
+	return string(data)
+}
@@ -0,0 +1,75 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// Перехват стандартного лога на время теста (без даты и времени)
+func captureLog(t testing.TB) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prevOutput, prevFlags, prevLevel := log.Writer(), log.Flags(), LogLevel.Level()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(prevOutput)
+		log.SetFlags(prevFlags)
+		LogLevel.Set(prevLevel)
+	})
+	return &buf
+}
+
+func TestLogLevelFiltersMessages(t *testing.T) {
+	tests := []struct {
+		level string
+		want  []string
+	}{
+		{"debug", []string{"DEBUG d", "i", "Warning: w", "ERROR e"}},
+		{"info", []string{"i", "Warning: w", "ERROR e"}},
+		{"warn", []string{"Warning: w", "ERROR e"}},
+		{"error", []string{"ERROR e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			buf := captureLog(t)
+			level, err := ParseLogLevel(tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			LogLevel.Set(level)
+			debugf("d")
+			infof("i")
+			warnf("w")
+			errorf("e")
+
+			got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("logged %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLogLevel(tt.in)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("ParseLogLevel(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Приемник метрик (StatsD и другие экспортеры)
+type metricsSink interface {
+	Count(name string, value int64)
+	Gauge(name string, value float64)
+	Timing(name string, value time.Duration)
+}
+
+// Приемник метрик по умолчанию, ничего не отправляет
+type nopMetrics struct{}
+
+func (nopMetrics) Count(string, int64)          {}
+func (nopMetrics) Gauge(string, float64)        {}
+func (nopMetrics) Timing(string, time.Duration) {}
+
+// Текущий приемник метрик
+var metrics metricsSink = nopMetrics{}
+
+// Отправка метрик в StatsD по UDP
+type statsdSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+func newStatsdSink(addr, prefix string) (*statsdSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("StatsD dial error: %v", err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &statsdSink{conn: conn, prefix: prefix}, nil
+}
+
+func (s *statsdSink) send(line string) {
+	// UDP доставка не гарантируется, ошибки только логируем
+	_, err := s.conn.Write([]byte(s.prefix + line))
+	if err != nil {
+		errorf("StatsD write error: %v", err)
+	}
+}
+
+func (s *statsdSink) Count(name string, value int64) {
+	s.send(fmt.Sprintf("%s:%d|c", name, value))
+}
+
+func (s *statsdSink) Gauge(name string, value float64) {
+	s.send(fmt.Sprintf("%s:%g|g", name, value))
+}
+
+func (s *statsdSink) Timing(name string, value time.Duration) {
+	s.send(fmt.Sprintf("%s:%d|ms", name, value.Milliseconds()))
+}
@@ -0,0 +1,77 @@
+package gateorderbook
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// UDP приемник StatsD пакетов
+func listenStatsd(t testing.TB) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Следующий StatsD пакет
+func readPacket(t testing.TB, conn net.PacketConn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1500)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read StatsD packet: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestStatsdSinkFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		send   func(s *statsdSink)
+		want   string
+	}{
+		{"counter", "gateio", func(s *statsdSink) { s.Count("orderbook.updates.BTC_USDT", 3) }, "gateio.orderbook.updates.BTC_USDT:3|c"},
+		{"gauge", "gateio.", func(s *statsdSink) { s.Gauge("orderbook.spread_bps.BTC_USDT", 1.25) }, "gateio.orderbook.spread_bps.BTC_USDT:1.25|g"},
+		{"timing", "", func(s *statsdSink) { s.Timing("orderbook.update_interval.BTC_USDT", 1500*time.Microsecond) }, "orderbook.update_interval.BTC_USDT:1|ms"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := listenStatsd(t)
+			sink, err := newStatsdSink(server.LocalAddr().String(), tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sink.conn.Close()
+			tt.send(sink)
+			if got := readPacket(t, server); got != tt.want {
+				t.Errorf("packet = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatsdReceivesUpdateMetrics(t *testing.T) {
+	server := listenStatsd(t)
+	newTestTracker(t, func(cfg *Config) { cfg.StatsdAddr = server.LocalAddr().String() })
+	sink := metrics.(*statsdSink)
+	t.Cleanup(func() {
+		metrics = nopMetrics{}
+		sink.conn.Close()
+	})
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, nil, levels("99:2")), time.Now().UnixNano())
+
+	for i := 0; i < 20; i++ {
+		if packet := readPacket(t, server); strings.HasPrefix(packet, "gateio.orderbook.updates.BTC_USDT:1|c") {
+			return
+		}
+	}
+	t.Error("update counter not sent to StatsD")
+}
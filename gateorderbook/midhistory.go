@@ -0,0 +1,169 @@
+package gateorderbook
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Наблюдение mid цены
+type midPoint struct {
+	t   time.Time
+	mid float64
+}
+
+// История mid цен по контрактам за последние retention
+type midHistory struct {
+	mu        sync.Mutex
+	retention time.Duration
+	now       func() time.Time
+	points    map[string][]midPoint
+}
+
+func newMidHistory(retention time.Duration) *midHistory {
+	return &midHistory{
+		retention: retention,
+		now:       time.Now,
+		points:    make(map[string][]midPoint),
+	}
+}
+
+var midPrices = newMidHistory(time.Hour)
+
+// Запись mid цены книги в момент t; книги без одной из сторон пропускаются
+func (h *midHistory) Record(contract string, t time.Time, ob OrderBookResponse) {
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	if !hasBid || !hasAsk {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	points := append(h.points[contract], midPoint{t: t, mid: (bid + ask) / 2})
+	// Оставляем одну точку до границы окна - ее mid действует на начало окна
+	cutoff := t.Add(-h.retention)
+	drop := 0
+	for drop+1 < len(points) && !points[drop+1].t.After(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		points = append(points[:0], points[drop:]...)
+	}
+	h.points[contract] = points
+}
+
+// TWAP mid цены за последние window: каждое значение взвешивается временем,
+// пока оно действовало. NaN, если в окне нет данных.
+func (h *midHistory) TWAPMid(contract string, window time.Duration) float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	end := h.now()
+	start := end.Add(-window)
+	points := h.points[contract]
+
+	var total time.Duration
+	var sum float64
+	last := math.NaN()
+	for i, p := range points {
+		from := p.t
+		if from.Before(start) {
+			from = start
+		}
+		to := end
+		if i+1 < len(points) && points[i+1].t.Before(end) {
+			to = points[i+1].t
+		}
+		if !to.After(from) {
+			if !p.t.Before(start) && !p.t.After(end) {
+				last = p.mid
+			}
+			continue
+		}
+		held := to.Sub(from)
+		sum += p.mid * float64(held)
+		total += held
+		last = p.mid
+	}
+
+	if total == 0 {
+		// Все наблюдения пришлись на один момент
+		return last
+	}
+	return sum / float64(total)
+}
+
+// TWAP mid цены контракта за последние window
+func TWAPMid(contract string, window time.Duration) float64 {
+	return midPrices.TWAPMid(contract, window)
+}
+
+// Длительность года для перевода волатильности в годовую (рынок работает круглосуточно)
+const volatilityYear = 365 * 24 * time.Hour
+
+// Выборочное стандартное отклонение лог-доходностей mid между соседними
+// наблюдениями за последние window и средний интервал между ними.
+// NaN, если в окне меньше трех наблюдений.
+func (h *midHistory) logReturnStdDev(contract string, window time.Duration) (float64, time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	start := h.now().Add(-window)
+	var returns []float64
+	var first, last time.Time
+	prev := math.NaN()
+	for _, p := range h.points[contract] {
+		if p.t.Before(start) || p.mid <= 0 {
+			continue
+		}
+		if math.IsNaN(prev) {
+			first = p.t
+		} else {
+			returns = append(returns, math.Log(p.mid/prev))
+		}
+		prev, last = p.mid, p.t
+	}
+	if len(returns) < 2 {
+		return math.NaN(), 0
+	}
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+	return math.Sqrt(variance), last.Sub(first) / time.Duration(len(returns))
+}
+
+// Реализованная волатильность: стандартное отклонение лог-доходностей mid
+// между наблюдениями за последние window. NaN, если данных недостаточно.
+func (h *midHistory) RealizedVolatility(contract string, window time.Duration) float64 {
+	vol, _ := h.logReturnStdDev(contract, window)
+	return vol
+}
+
+// Реализованная волатильность в годовом выражении: масштабируется на корень
+// из числа средних интервалов между наблюдениями в году
+func (h *midHistory) AnnualizedVolatility(contract string, window time.Duration) float64 {
+	vol, interval := h.logReturnStdDev(contract, window)
+	if math.IsNaN(vol) || interval <= 0 {
+		return math.NaN()
+	}
+	return vol * math.Sqrt(float64(volatilityYear)/float64(interval))
+}
+
+// Реализованная волатильность mid цены контракта за последние window
+func RealizedVolatility(contract string, window time.Duration) float64 {
+	return midPrices.RealizedVolatility(contract, window)
+}
+
+// Годовая реализованная волатильность mid цены контракта за последние window
+func AnnualizedVolatility(contract string, window time.Duration) float64 {
+	return midPrices.AnnualizedVolatility(contract, window)
+}
@@ -0,0 +1,176 @@
+package gateorderbook
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Книга с mid ценой mid (спред 2)
+func midBook(mid float64) OrderBookResponse {
+	return testBook(1, levels(strconv.FormatFloat(mid+1, 'f', -1, 64)+":1"), levels(strconv.FormatFloat(mid-1, 'f', -1, 64)+":1"))
+}
+
+// История с mid ценами в моменты start+offset и часами на now
+func recordMids(retention time.Duration, start, now time.Time, mids map[time.Duration]float64) *midHistory {
+	h := newMidHistory(retention)
+	h.now = func() time.Time { return now }
+	offsets := make([]time.Duration, 0, len(mids))
+	for offset := range mids {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	for _, offset := range offsets {
+		h.Record("BTC_USDT", start.Add(offset), midBook(mids[offset]))
+	}
+	return h
+}
+
+func TestTWAPMid(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	now := start.Add(60 * time.Second)
+	// 100 действует 10s, 110 - 30s, 105 - последние 20s
+	h := recordMids(time.Hour, start, now, map[time.Duration]float64{
+		0:                100,
+		10 * time.Second: 110,
+		40 * time.Second: 105,
+	})
+	tests := []struct {
+		name     string
+		contract string
+		window   time.Duration
+		want     float64
+	}{
+		{"whole history", "BTC_USDT", time.Minute, 6400.0 / 60},
+		{"window starts mid-observation", "BTC_USDT", 50 * time.Second, 5400.0 / 50},
+		{"last observation only", "BTC_USDT", 20 * time.Second, 105},
+		{"window longer than history", "BTC_USDT", 2 * time.Minute, 6400.0 / 60},
+		{"no data", "ETH_USDT", time.Minute, math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.TWAPMid(tt.contract, tt.window)
+			if math.IsNaN(tt.want) {
+				if !math.IsNaN(got) {
+					t.Errorf("TWAP = %v, want NaN", got)
+				}
+				return
+			}
+			if !near(got, tt.want) {
+				t.Errorf("TWAP = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Единственное наблюдение в момент now
+	single := recordMids(time.Hour, now, now, map[time.Duration]float64{0: 100})
+	if got := single.TWAPMid("BTC_USDT", time.Minute); got != 100 {
+		t.Errorf("TWAP of a single observation = %v, want 100", got)
+	}
+	// Книга без одной из сторон не записывается
+	single.Record("BTC_USDT", now, testBook(1, nil, levels("99:1")))
+	if got := len(single.points["BTC_USDT"]); got != 1 {
+		t.Errorf("points = %d, want one-sided book skipped", got)
+	}
+}
+
+func TestMidHistoryRetention(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	h := recordMids(30*time.Second, start, start.Add(60*time.Second), map[time.Duration]float64{
+		0:                100,
+		10 * time.Second: 110,
+		20 * time.Second: 120,
+		60 * time.Second: 105,
+	})
+	// Остается одна точка до границы окна (20s): ее mid действует на начало окна
+	points := h.points["BTC_USDT"]
+	if len(points) != 2 || points[0].mid != 120 || points[1].mid != 105 {
+		t.Errorf("points = %+v, want 120 at the window start and 105", points)
+	}
+	if got, want := h.TWAPMid("BTC_USDT", 30*time.Second), 120.0; got != want {
+		t.Errorf("TWAP = %v, want %v", got, want)
+	}
+}
+
+func TestRealizedVolatility(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	now := start.Add(30 * time.Second)
+	// Лог-доходности ln(1.1), ln(0.9), ln(1.1) через каждые 10s
+	h := recordMids(time.Hour, start, now, map[time.Duration]float64{
+		0:                100,
+		10 * time.Second: 110,
+		20 * time.Second: 99,
+		30 * time.Second: 108.9,
+	})
+	tests := []struct {
+		name       string
+		window     time.Duration
+		want       float64
+		annualized float64
+	}{
+		{"whole path", time.Minute, 0.11585728004354243, 205.74374083249128},
+		{"window drops the first mid", 25 * time.Second, 0.14189560954670769, 0.14189560954670769 * math.Sqrt(365*24*360)},
+		// Две доходности нужны для выборочного отклонения
+		{"two observations", 15 * time.Second, math.NaN(), math.NaN()},
+		{"no observations", 0, math.NaN(), math.NaN()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, check := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"volatility", h.RealizedVolatility("BTC_USDT", tt.window), tt.want},
+				{"annualized volatility", h.AnnualizedVolatility("BTC_USDT", tt.window), tt.annualized},
+			} {
+				if math.IsNaN(check.want) != math.IsNaN(check.got) || math.Abs(check.got-check.want) > 1e-9*math.Max(1, check.want) {
+					t.Errorf("%s = %v, want %v", check.name, check.got, check.want)
+				}
+			}
+		})
+	}
+	if vol := h.RealizedVolatility("ETH_USDT", time.Hour); !math.IsNaN(vol) {
+		t.Errorf("volatility of a contract without history = %v, want NaN", vol)
+	}
+}
+
+func TestVolatilityEndpoint(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"} })
+	start := time.Unix(1700000000, 0)
+	midPrices = recordMids(time.Hour, start, start.Add(30*time.Second), map[time.Duration]float64{
+		0:                100,
+		10 * time.Second: 110,
+		20 * time.Second: 99,
+		30 * time.Second: 108.9,
+	})
+	orderbooks.Set("BTC_USDT", midBook(108.9))
+	orderbooks.Set("ETH_USDT", midBook(2000))
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		want       string
+	}{
+		{"/volatility/BTC_USDT?window=1m", http.StatusOK, `{"contract":"BTC_USDT","window":"1m0s","volatility":0.11585728004354243,"annualized":false}`},
+		{"/volatility/BTC_USDT?window=1m&annualize=true", http.StatusOK, `{"contract":"BTC_USDT","window":"1m0s","volatility":205.74374083249128,"annualized":true}`},
+		{"/volatility/ETH_USDT", http.StatusOK, `{"contract":"ETH_USDT","window":"5m0s","volatility":null,"annualized":false}`},
+		{"/volatility/BTC_USDT?window=-1m", http.StatusBadRequest, ""},
+		{"/volatility/SOL_USDT", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handleVolatility(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", tt.target, rec.Code, tt.wantStatus, rec.Body)
+			continue
+		}
+		if tt.want != "" && strings.TrimSpace(rec.Body.String()) != tt.want {
+			t.Errorf("%s: body = %s, want %s", tt.target, rec.Body, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package gateorderbook
+
+import (
+	"sync"
+	"time"
+)
+
+// Отслеживание ордербуков, у которых долго отсутствует одна из сторон
+type oneSidedMonitor struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	now       func() time.Time
+	since     map[string]time.Time // When the side went missing
+	alerted   map[string]bool
+}
+
+func newOneSidedMonitor(threshold time.Duration) *oneSidedMonitor {
+	return &oneSidedMonitor{
+		threshold: threshold,
+		now:       time.Now,
+		since:     make(map[string]time.Time),
+		alerted:   make(map[string]bool),
+	}
+}
+
+// Отсутствующая сторона ордербука: "bids", "asks", "both" или ""
+func missingSide(orderbook OrderBookResponse) string {
+	switch {
+	case len(orderbook.Bids) == 0 && len(orderbook.Asks) == 0:
+		return "both"
+	case len(orderbook.Bids) == 0:
+		return "bids"
+	case len(orderbook.Asks) == 0:
+		return "asks"
+	}
+	return ""
+}
+
+// Проверка ордербука; возвращает true, если сработал алерт.
+// Кратковременное отсутствие стороны (меньше порога) алерт не вызывает.
+func (m *oneSidedMonitor) Check(contract string, orderbook OrderBookResponse) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	side := missingSide(orderbook)
+	if side == "" {
+		if m.alerted[contract] {
+			infof("Orderbook for %s has both sides again", contract)
+		}
+		delete(m.since, contract)
+		delete(m.alerted, contract)
+		return false
+	}
+
+	now := m.now()
+	since, ok := m.since[contract]
+	if !ok {
+		m.since[contract] = now
+		return false
+	}
+	if m.alerted[contract] || now.Sub(since) < m.threshold {
+		return false
+	}
+
+	m.alerted[contract] = true
+	warnf("Alert: orderbook for %s has had no %s for %s", contract, side, now.Sub(since).Round(time.Second))
+	metrics.Count("orderbook.one_sided_alerts."+contract, 1)
+	return true
+}
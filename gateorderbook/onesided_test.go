@@ -0,0 +1,68 @@
+package gateorderbook
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMissingSide(t *testing.T) {
+	tests := []struct {
+		name string
+		book OrderBookResponse
+		want string
+	}{
+		{"two-sided", testBook(1, levels("101:1"), levels("99:1")), ""},
+		{"no bids", testBook(1, levels("101:1"), nil), "bids"},
+		{"no asks", testBook(1, nil, levels("99:1")), "asks"},
+		{"empty", testBook(1, nil, nil), "both"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingSide(tt.book); got != tt.want {
+				t.Errorf("missing side = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOneSidedMonitorAlertsOnSustainedGap(t *testing.T) {
+	newTestTracker(t, nil)
+	logs := captureLog(t)
+	start := time.Unix(1700000000, 0)
+	now := start
+	monitor := newOneSidedMonitor(30 * time.Second)
+	monitor.now = func() time.Time { return now }
+
+	oneSided := testBook(1, levels("101:1"), nil)
+	twoSided := testBook(1, levels("101:1"), levels("99:1"))
+	steps := []struct {
+		after     time.Duration
+		book      OrderBookResponse
+		wantAlert bool
+	}{
+		{0, oneSided, false},
+		{10 * time.Second, oneSided, false},
+		// Кратковременное восстановление сбрасывает отсчет
+		{15 * time.Second, twoSided, false},
+		{20 * time.Second, oneSided, false},
+		{45 * time.Second, oneSided, false},
+		{50 * time.Second, oneSided, true},
+		{60 * time.Second, oneSided, false},
+		{70 * time.Second, twoSided, false},
+	}
+	for _, step := range steps {
+		now = start.Add(step.after)
+		if alert := monitor.Check("BTC_USDT", step.book); alert != step.wantAlert {
+			t.Errorf("alert at +%s = %v, want %v", step.after, alert, step.wantAlert)
+		}
+	}
+
+	out := logs.String()
+	if want := "Warning: Alert: orderbook for BTC_USDT has had no bids for 30s"; !strings.Contains(out, want) {
+		t.Errorf("log = %q, want %q", out, want)
+	}
+	if !strings.Contains(out, "Orderbook for BTC_USDT has both sides again") {
+		t.Errorf("log = %q, want the recovery message", out)
+	}
+}
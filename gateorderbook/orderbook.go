@@ -0,0 +1,1606 @@
+package gateorderbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+)
+
+// Структуры для REST API
+type OrderBookItem struct {
+	P string          `json:"p"` // Price
+	S decimal.Decimal `json:"s"` // Size, exact as sent (JSON number or string)
+}
+
+type OrderBookResponse struct {
+	ID         int64           `json:"id"`                    // Orderbook ID: snapshot id, then the last applied update id (u)
+	Current    float64         `json:"current"`               // Data generation time
+	Update     float64         `json:"update"`                // Last update time
+	ReceivedNs int64           `json:"received_ns,omitempty"` // Local receive time of the last applied frame, unix ns
+	Asks       []OrderBookItem `json:"asks"`                  // Ask orders
+	Bids       []OrderBookItem `json:"bids"`                  // Bid orders
+}
+
+// Структура для WebSocket сообщений
+type WebSocketMessage struct {
+	ID      int64           `json:"id"`      // Request id echoed back in acks
+	Time    int64           `json:"time"`    // Unix seconds
+	TimeMs  int64           `json:"time_ms"` // Unix ms
+	Channel string          `json:"channel"`
+	Event   string          `json:"event"`
+	Error   *WebSocketError `json:"error"`
+	Result  json.RawMessage `json:"result"` // Changed to RawMessage for flexible parsing
+}
+
+// Ошибка в ответе WebSocket сервера
+type WebSocketError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Структура для обновления ордербука
+type OrderBookUpdate struct {
+	Contract string          `json:"s"`                  // Contract name in update messages
+	U        int64           `json:"U"`                  // First update id in this message
+	End      int64           `json:"u"`                  // Last update id in this message
+	Asks     []OrderBookItem `json:"a"`                  // Ask orders
+	Bids     []OrderBookItem `json:"b"`                  // Bid orders
+	Checksum *int32          `json:"checksum,omitempty"` // Book checksum after this update, if the server sends one
+}
+
+// Структура для подтверждения подписки
+type SubscriptionResponse struct {
+	Status string `json:"status"`
+}
+
+// Объемы в JSON выводятся числами, как их присылает Gate.io
+func init() {
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
+// Глобальное хранилище ордербуков
+var orderbooks = newOrderBookStore(0)
+
+// Копия ордербука, не разделяющая слайсы с оригиналом
+func cloneOrderBook(orderbook OrderBookResponse) OrderBookResponse {
+	clone := orderbook
+	clone.Asks = append([]OrderBookItem(nil), orderbook.Asks...)
+	clone.Bids = append([]OrderBookItem(nil), orderbook.Bids...)
+	return clone
+}
+
+// Снимок всех отслеживаемых ордербуков: плоский или, при заданной
+// группировке (Config.DumpGroupBy), по группам
+type OrderBookDump struct {
+	Time       int64                                   `json:"time"` // Dump time, unix ms
+	Orderbooks map[string]OrderBookResponse            `json:"orderbooks,omitempty"`
+	Groups     map[string]map[string]OrderBookResponse `json:"groups,omitempty"` // group -> contract -> book
+}
+
+// Выгрузка всех текущих ордербуков в один JSON документ
+func DumpAll() ([]byte, error) {
+	books := orderbooks.Snapshot()
+	dump := OrderBookDump{Time: time.Now().UnixMilli()}
+	if dumpGroupBy == "" {
+		dump.Orderbooks = make(map[string]OrderBookResponse, len(books))
+		for contract, orderbook := range books {
+			dump.Orderbooks[contract] = cloneOrderBook(orderbook)
+		}
+		return json.Marshal(dump)
+	}
+
+	dump.Groups = make(map[string]map[string]OrderBookResponse)
+	for contract, orderbook := range books {
+		group := dumpGroup(contract)
+		if dump.Groups[group] == nil {
+			dump.Groups[group] = make(map[string]OrderBookResponse)
+		}
+		dump.Groups[group][contract] = cloneOrderBook(orderbook)
+	}
+	return json.Marshal(dump)
+}
+
+// Запись выгрузки всех ордербуков в файл (через временный файл и rename)
+func writeDumpFile(filename string) error {
+	data, err := DumpAll()
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		return fmt.Errorf("failed to rename %s: %v", tmp, err)
+	}
+	return nil
+}
+
+// Дополнительные глубины, с которыми сохраняется ордербук (<symbol>.<depth>.txt)
+var outputDepths []int
+
+// Формат сохраняемых файлов: text (<symbol>.txt), json или map (<symbol>.json),
+// protobuf (<symbol>.pb, схема в proto/orderbook.proto)
+var outputFormat = "text"
+
+// Фабрика приемников вывода сохранений; вызывается на каждое сохранение
+// с именем книги (<symbol> или <symbol>.<depth>), приемник закрывается
+// после записи. При Config.MaxCPU > 1 вызывается одновременно для разных
+// книг. nil - запись в файлы ./orderbooks
+type WriterFactory func(contract string) (io.WriteCloser, error)
+
+// Приемник вывода сохранений (nil - файлы)
+var outputWriter WriterFactory
+
+// Запись отформатированной книги в приемник outputWriter
+func writeOutput(name, formatted string) error {
+	w, err := outputWriter(name)
+	if err != nil {
+		return fmt.Errorf("failed to open writer for %s: %v", name, err)
+	}
+	if _, err := io.WriteString(w, formatted); err != nil {
+		w.Close()
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to close writer for %s: %v", name, err)
+	}
+	return nil
+}
+
+// Проверка формата сохраняемых файлов
+func validateOutputFormat(format string) error {
+	switch format {
+	case "text", "json", "map", "protobuf":
+		return nil
+	}
+	return fmt.Errorf("unsupported output format %q, allowed: text, json, map, protobuf", format)
+}
+
+// Id последнего примененного обновления по контрактам
+var lastUpdateIDs = make(map[string]int64)
+
+// Интервал обновлений ордербука в подписке
+var updateInterval = "100ms"
+
+// Отправленные подписки и их подтверждения
+var subscriptions = newSubscriptionTracker()
+
+// Восстановление глубины после истощения у лучшей цены (nil - отключено)
+var bookResilience *resilienceTracker
+
+// Вывод цен в текстовом формате также в целых тиках
+var pricesAsTicks bool
+
+// Ряд лучших цен по обновлениям (nil - отключено)
+var topOfBookSeries *seriesWriter
+
+// Алерты на пересечение ценовых уровней (nil - отключено)
+var crossingAlerts *priceAlerts
+
+// Алерты на глубину у mid (nil - отключено)
+var depthAlerts *liquidityAlerts
+
+// Накопленная дельта объема по сделкам (nil - сделки не отслеживаются)
+var cumulativeDeltas *cumulativeDelta
+
+// Вставка изменений уровней в ClickHouse (nil - отключена)
+var clickhouseUpdates *clickhouseSink
+
+// Журнал примененных дельт в NDJSON (nil - отключен)
+var changeLogs *changeLog
+
+// Дневные сводки по контрактам (nil - отключены)
+var dailyRollups *dailyRollup
+
+// TCP поток обновлений (nil - отключено)
+var tcpStream *tcpHub
+
+// Сохранение ордербуков в файлы (можно отключить, оставив только HTTP API)
+var saverEnabled = true
+
+// Максимальный случайный сдвиг запуска периодического сохранения
+var saveJitter time.Duration
+
+// Период сохранения ордербуков
+var saveInterval = 50 * time.Millisecond
+
+// Сводный CSV спредов по сохранениям (nil - отключено)
+var spreadMetrics *spreadLog
+
+// Алерты на ордербуки без одной из сторон (nil - отключено)
+var oneSidedAlerts *oneSidedMonitor
+
+// Интервалы между обновлениями ордербуков по контрактам
+var updateIntervals = newIntervalRecorder(1000)
+
+// Допустимые значения limit для REST снимка Gate.io
+const (
+	minSnapshotLimit = 1
+	maxSnapshotLimit = 300
+)
+
+// Глубина REST снимка по умолчанию и переопределения для отдельных контрактов
+var (
+	snapshotDepth  = 50
+	contractDepths = make(map[string]int)
+)
+
+// Проверка значения limit для REST снимка
+func validateSnapshotLimit(limit int) error {
+	if limit < minSnapshotLimit || limit > maxSnapshotLimit {
+		return fmt.Errorf("snapshot limit %d out of range [%d, %d]", limit, minSnapshotLimit, maxSnapshotLimit)
+	}
+	return nil
+}
+
+// Разбор списка глубин вида "BTC_USDT=100,ETH_USDT=20"
+func ParseContractDepths(s string) (map[string]int, error) {
+	depths := make(map[string]int)
+	if strings.TrimSpace(s) == "" {
+		return depths, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		contract, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || contract == "" {
+			return nil, fmt.Errorf("invalid contract depth %q, expected CONTRACT=LIMIT", entry)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid depth for %s: %v", contract, err)
+		}
+		if err := validateSnapshotLimit(limit); err != nil {
+			return nil, fmt.Errorf("contract %s: %v", contract, err)
+		}
+		depths[contract] = limit
+	}
+	return depths, nil
+}
+
+// Глубина REST снимка для контракта с учетом переопределений
+func snapshotLimit(contract string) int {
+	if limit, ok := contractDepths[contract]; ok {
+		return limit
+	}
+	return snapshotDepth
+}
+
+// Значение User-Agent исходящих HTTP запросов
+const userAgent = "gateio-perpetual-futures-orderbooks-golang/1.0.0"
+
+// Таймаут HTTP запроса по умолчанию (включая чтение ответа)
+const defaultHTTPTimeout = 10 * time.Second
+
+// Хост REST API Gate.io
+const apiHost = "api.gateio.ws"
+
+// HTTP транспорт и клиент для REST запросов. Все запросы к API идут через
+// один клиент, чтобы соединения переиспользовались; при заданном API ключе
+// запросы к apiHost подписываются. Webhook алертов отправляются отдельным
+// клиентом без подписи.
+var (
+	httpTransport = newHTTPTransport()
+	httpClient    = &http.Client{
+		Transport: userAgentTransport{base: signingTransport{base: httpTransport, host: apiHost}},
+		Timeout:   defaultHTTPTimeout,
+	}
+	webhookClient = &http.Client{
+		Transport: userAgentTransport{base: newHTTPTransport()},
+		Timeout:   defaultHTTPTimeout,
+	}
+)
+
+// Транспорт с пулом keep-alive соединений: все REST запросы идут на один хост
+func newHTTPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 16
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+// Добавление User-Agent к запросам, где он не задан
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", userAgent)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// GET запрос, отменяемый через ctx
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return httpClient.Do(req)
+}
+
+// Dialer для WebSocket соединений
+var wsDialer = *websocket.DefaultDialer
+
+// Адрес REST снимка ордербука для валюты расчетов settle
+func orderBookEndpoint(settle, contract string, limit int) string {
+	host := "https://" + apiHost
+	prefix := "/api/v4"
+	return fmt.Sprintf("%s%s/futures/%s/order_book?contract=%s&limit=%d", host, prefix, settle, contract, limit)
+}
+
+// Получение REST снимка ордербука; запрос прерывается по таймауту
+// клиента или отмене ctx, при ответе 429 повторяется после паузы
+func GetOrderBookSnapshot(ctx context.Context, settle, contract string, limit int) (OrderBookResponse, error) {
+	endpoint := orderBookEndpoint(settle, contract, limit)
+
+	resp, err := httpGetRateLimited(ctx, endpoint)
+	if err != nil {
+		return OrderBookResponse{}, fmt.Errorf("HTTP request error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return OrderBookResponse{}, fmt.Errorf("Response read error: %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return OrderBookResponse{}, &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	orderbook, err := decodeOrderBookSnapshot(body, limit)
+	if err != nil {
+		return OrderBookResponse{}, fmt.Errorf("JSON parse error: %v", err)
+	}
+
+	return orderbook, nil
+}
+
+// Разбор REST снимка; стороны заранее выделяются на limit уровней,
+// чтобы декодер не наращивал их по мере чтения
+func decodeOrderBookSnapshot(body []byte, limit int) (OrderBookResponse, error) {
+	orderbook := OrderBookResponse{
+		Asks: make([]OrderBookItem, 0, limit),
+		Bids: make([]OrderBookItem, 0, limit),
+	}
+	err := json.Unmarshal(body, &orderbook)
+	return orderbook, err
+}
+
+// Время последнего обновления ордербука
+func orderBookTime(orderbook OrderBookResponse) time.Time {
+	ts := orderbook.Update
+	if ts == 0 {
+		ts = orderbook.Current
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9)).UTC()
+}
+
+// Форматирование ордербука в текстовый формат
+func formatOrderBook(symbol string, orderbook OrderBookResponse) string {
+	var sb strings.Builder
+
+	// Пустой ордербук (например, новый листинг) помечаем явно
+	if len(orderbook.Asks) == 0 && len(orderbook.Bids) == 0 {
+		sb.WriteString(fmt.Sprintf("EMPTY BOOK %s %s\n", symbol, orderBookTime(orderbook).Format(time.RFC3339Nano)))
+		return sb.String()
+	}
+
+	// При выводе в тиках добавляем цену в тиках третьей колонкой
+	tickSize, withTicks := tickSizes[symbol]
+	withTicks = withTicks && pricesAsTicks
+
+	// Форматируем asks (в обратном порядке)
+	for i := len(orderbook.Asks) - 1; i >= 0; i-- {
+		ask := orderbook.Asks[i]
+		price, _ := decimal.NewFromString(ask.P)
+		if withTicks {
+			sb.WriteString(fmt.Sprintf("ASK %s | %s | %d\n", formatDecimal(price), formatDecimal(ask.S), priceToTicks(price.InexactFloat64(), tickSize)))
+		} else {
+			sb.WriteString(fmt.Sprintf("ASK %s | %s\n", formatDecimal(price), formatDecimal(ask.S)))
+		}
+	}
+
+	// Разделительная линия
+	sb.WriteString("------------------------\n")
+
+	// Форматируем bids
+	for _, bid := range orderbook.Bids {
+		price, _ := decimal.NewFromString(bid.P)
+		if withTicks {
+			sb.WriteString(fmt.Sprintf("BID %s | %s | %d\n", formatDecimal(price), formatDecimal(bid.S), priceToTicks(price.InexactFloat64(), tickSize)))
+		} else {
+			sb.WriteString(fmt.Sprintf("BID %s | %s\n", formatDecimal(price), formatDecimal(bid.S)))
+		}
+	}
+
+	return sb.String()
+}
+
+// Десятичное число не менее чем с 8 знаками после точки; значения
+// с большей точностью выводятся полностью, без округления
+func formatDecimal(d decimal.Decimal) string {
+	places := int32(8)
+	if -d.Exponent() > places {
+		places = -d.Exponent()
+	}
+	return d.StringFixed(places)
+}
+
+// Уровни книги в виде отображений цена -> объем по сторонам.
+// Порядок уровней при этом теряется: лучшую цену нужно искать по ключам,
+// а уровни с повторяющейся ценой схлопываются в последний из них.
+func (ob OrderBookResponse) AsMaps() (bids, asks map[string]decimal.Decimal) {
+	bids = make(map[string]decimal.Decimal, len(ob.Bids))
+	for _, level := range ob.Bids {
+		bids[level.P] = level.S
+	}
+	asks = make(map[string]decimal.Decimal, len(ob.Asks))
+	for _, level := range ob.Asks {
+		asks[level.P] = level.S
+	}
+	return bids, asks
+}
+
+// Ордербук в формате map: стороны как отображения цена -> объем
+type orderBookMaps struct {
+	Contract string                     `json:"contract"`
+	ID       int64                      `json:"id"`
+	Update   float64                    `json:"update"`
+	Bids     map[string]decimal.Decimal `json:"bids"`
+	Asks     map[string]decimal.Decimal `json:"asks"`
+}
+
+// Форматирование ордербука в JSON формата map (ключи выводятся по строковому порядку, не по цене)
+func formatOrderBookMap(symbol string, orderbook OrderBookResponse) string {
+	bids, asks := orderbook.AsMaps()
+	data, err := json.Marshal(orderBookMaps{
+		Contract: symbol,
+		ID:       orderbook.ID,
+		Update:   orderbook.Update,
+		Bids:     bids,
+		Asks:     asks,
+	})
+	if err != nil {
+		errorf("Failed to encode orderbook for %s: %v", symbol, err)
+		return ""
+	}
+	return string(data) + "\n"
+}
+
+// Форматирование ордербука в JSON: OrderBookResponse с отсортированными уровнями,
+// читается обратно через json.Unmarshal
+func formatOrderBookJSON(symbol string, orderbook OrderBookResponse) string {
+	data, err := json.Marshal(sortOrderBook(orderbook))
+	if err != nil {
+		errorf("Failed to encode orderbook for %s: %v", symbol, err)
+		return ""
+	}
+	return string(data) + "\n"
+}
+
+// Сохранение ордербука в файл
+func saveOrderBook(symbol string, orderbook OrderBookResponse) error {
+	// Проверяем, что символ не пустой
+	if symbol == "" {
+		return fmt.Errorf("empty symbol provided")
+	}
+
+	// Форматируем ордербук в текстовый вид или в JSON
+	format, ext := formatOrderBook, "txt"
+	switch outputFormat {
+	case "json":
+		format, ext = formatOrderBookJSON, "json"
+	case "map":
+		format, ext = formatOrderBookMap, "json"
+	case "protobuf":
+		format, ext = formatOrderBookProtobuf, "pb"
+	}
+	formattedOrderbook := format(symbol, orderbook)
+
+	// Пользовательский приемник вместо файлов
+	if outputWriter != nil {
+		if err := writeOutput(symbol, formattedOrderbook); err != nil {
+			return err
+		}
+		written := int64(len(formattedOrderbook))
+		for _, depth := range outputDepths {
+			formatted := format(symbol, truncateOrderBook(orderbook, depth))
+			if err := writeOutput(fmt.Sprintf("%s.%d", symbol, depth), formatted); err != nil {
+				return err
+			}
+			written += int64(len(formatted))
+		}
+		saveSizes.Record(symbol, written)
+		debugf("Orderbook for %s written to custom writer", symbol)
+		return nil
+	}
+
+	// Создаем директорию если её нет
+	orderbookDir := "./orderbooks"
+	err := os.MkdirAll(orderbookDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create orderbooks directory: %v", err)
+	}
+
+	filename := filepath.Join(orderbookDir, fmt.Sprintf("%s.%s", symbol, ext))
+	err = ioutil.WriteFile(filename, []byte(formattedOrderbook), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %v", filename, err)
+	}
+	written := int64(len(formattedOrderbook))
+
+	// Дополнительные срезы ордербука фиксированной глубины из того же снимка
+	for _, depth := range outputDepths {
+		depthFilename := filepath.Join(orderbookDir, fmt.Sprintf("%s.%d.%s", symbol, depth, ext))
+		formatted := format(symbol, truncateOrderBook(orderbook, depth))
+		err = ioutil.WriteFile(depthFilename, []byte(formatted), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write file %s: %v", depthFilename, err)
+		}
+		written += int64(len(formatted))
+	}
+
+	saveSizes.Record(symbol, written)
+	infof("Orderbook saved to %s", filename)
+	return nil
+}
+
+// Сортировка уровней: asks по возрастанию цены, bids по убыванию
+func sortOrderBook(orderbook OrderBookResponse) OrderBookResponse {
+	sorted := cloneOrderBook(orderbook)
+	sort.SliceStable(sorted.Asks, func(i, j int) bool {
+		return comparePrices(sorted.Asks[i].P, sorted.Asks[j].P) < 0
+	})
+	sort.SliceStable(sorted.Bids, func(i, j int) bool {
+		return comparePrices(sorted.Bids[i].P, sorted.Bids[j].P) > 0
+	})
+	return sorted
+}
+
+// Лучшие depth уровней с каждой стороны
+func truncateOrderBook(orderbook OrderBookResponse, depth int) OrderBookResponse {
+	truncated := sortOrderBook(orderbook)
+	if len(truncated.Asks) > depth {
+		truncated.Asks = truncated.Asks[:depth]
+	}
+	if len(truncated.Bids) > depth {
+		truncated.Bids = truncated.Bids[:depth]
+	}
+	return truncated
+}
+
+// Уровни с ценой в диапазоне [minPrice, maxPrice]
+func filterLevels(levels []OrderBookItem, minPrice, maxPrice float64) []OrderBookItem {
+	filtered := make([]OrderBookItem, 0, len(levels))
+	for _, level := range levels {
+		price, ok := levelPrice(level)
+		if ok && price >= minPrice && price <= maxPrice {
+			filtered = append(filtered, level)
+		}
+	}
+	return filtered
+}
+
+// Ордербук только с уровнями в диапазоне цен [minPrice, maxPrice]
+func filterOrderBook(orderbook OrderBookResponse, minPrice, maxPrice float64) OrderBookResponse {
+	filtered := orderbook
+	filtered.Asks = filterLevels(orderbook.Asks, minPrice, maxPrice)
+	filtered.Bids = filterLevels(orderbook.Bids, minPrice, maxPrice)
+	return filtered
+}
+
+// Разбор списка глубин вывода вида "5,50"
+func ParseOutputDepths(s string) ([]int, error) {
+	var depths []int
+	if strings.TrimSpace(s) == "" {
+		return depths, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		depth, err := strconv.Atoi(strings.TrimSpace(entry))
+		if err != nil || depth <= 0 {
+			return nil, fmt.Errorf("invalid output depth %q", entry)
+		}
+		depths = append(depths, depth)
+	}
+	return depths, nil
+}
+
+// Обновление стороны ордербука с сохранением сортировки: asks по
+// возрастанию цены, bids по убыванию. Уровни ищутся бинарным поиском
+// с точным сравнением цен ("1.50" и "1.5" - один уровень).
+// existing не изменяется - результат всегда новый слайс.
+func UpdateOrders(existing []OrderBookItem, updates []OrderBookItem, isBid bool) []OrderBookItem {
+	result := make([]OrderBookItem, len(existing), len(existing)+len(updates))
+	copy(result, existing)
+
+	for _, update := range updates {
+		if !validPrice(update.P) {
+			warnf("skipping level with invalid price %q", update.P)
+			continue
+		}
+
+		// Первая позиция, где уровень должен стоять не раньше update
+		i := sort.Search(len(result), func(i int) bool {
+			c := comparePrices(result[i].P, update.P)
+			if isBid {
+				return c <= 0
+			}
+			return c >= 0
+		})
+		found := i < len(result) && comparePrices(result[i].P, update.P) == 0
+
+		switch {
+		case update.S.IsZero() && found:
+			// Если размер 0, удаляем уровень
+			result = append(result[:i], result[i+1:]...)
+		case update.S.IsZero():
+		case found:
+			result[i].S = update.S
+		default:
+			// Вставляем новый уровень на его место
+			result = append(result, OrderBookItem{})
+			copy(result[i+1:], result[i:])
+			result[i] = update
+		}
+	}
+
+	return result
+}
+
+// Изменения уровней, переводящие existing в target (удаления с размером 0)
+func diffLevels(existing, target []OrderBookItem) []OrderBookItem {
+	existingMap := make(map[string]decimal.Decimal, len(existing))
+	for _, order := range existing {
+		existingMap[order.P] = order.S
+	}
+
+	var changes []OrderBookItem
+	targetMap := make(map[string]bool, len(target))
+	for _, order := range target {
+		targetMap[order.P] = true
+		if size, ok := existingMap[order.P]; !ok || !size.Equal(order.S) {
+			changes = append(changes, order)
+		}
+	}
+	for _, order := range existing {
+		if !targetMap[order.P] {
+			changes = append(changes, OrderBookItem{P: order.P})
+		}
+	}
+	return changes
+}
+
+// Минимальное обновление, которое при применении к old дает new
+func DiffBooks(old, new OrderBookResponse) OrderBookUpdate {
+	return OrderBookUpdate{
+		Asks: diffLevels(old.Asks, new.Asks),
+		Bids: diffLevels(old.Bids, new.Bids),
+	}
+}
+
+// Переиспользуемые структуры декодирования WebSocket сообщения. Слайсы
+// уровней и Result живут только до конца handleWebSocketMessage:
+// все, что сохраняется дольше, должно быть скопировано.
+type wsDecodeBuffers struct {
+	msg    WebSocketMessage
+	update OrderBookUpdate
+}
+
+var wsDecodePool = sync.Pool{
+	New: func() interface{} { return new(wsDecodeBuffers) },
+}
+
+// Сброс полей с сохранением емкости слайсов. Уровни обнуляются целиком:
+// декодер заполняет элементы поверх старых, и поле, отсутствующее
+// в сообщении, иначе осталось бы от предыдущего кадра.
+func (b *wsDecodeBuffers) reset() {
+	asks, bids := b.update.Asks[:cap(b.update.Asks)], b.update.Bids[:cap(b.update.Bids)]
+	clear(asks)
+	clear(bids)
+	b.msg = WebSocketMessage{Result: b.msg.Result[:0]}
+	b.update = OrderBookUpdate{Asks: asks[:0], Bids: bids[:0]}
+}
+
+// Сколько байт сообщения выводится в лог при панике обработчика
+const panicMessagePreview = 512
+
+// Обработка сообщения с перехватом паники: ошибка в разборе одного
+// сообщения не должна останавливать цикл чтения и весь процесс
+func handleWebSocketMessageSafely(msg []byte, receivedNs int64) {
+	defer func() {
+		if r := recover(); r != nil {
+			preview := msg
+			if len(preview) > panicMessagePreview {
+				preview = preview[:panicMessagePreview]
+			}
+			errorf("Panic while handling WebSocket message: %v\nmessage (%d bytes): %s\n%s", r, len(msg), preview, debug.Stack())
+			metrics.Count("websocket.handler_panics", 1)
+		}
+	}()
+	handleWebSocketMessage(msg, receivedNs)
+}
+
+// Обработка WebSocket сообщений
+func handleWebSocketMessage(msg []byte, receivedNs int64) {
+	buf := wsDecodePool.Get().(*wsDecodeBuffers)
+	defer wsDecodePool.Put(buf)
+	buf.reset()
+
+	wsMsg := &buf.msg
+	err := json.Unmarshal(msg, wsMsg)
+	if err != nil {
+		errorf("WebSocket message parse error: %v", err)
+		metrics.Count("websocket.parse_errors", 1)
+		return
+	}
+	// Время кадров поддерживает поправку к часам для подписок
+	if subscribeTimeSource == "server" {
+		if msgTimeMs := messageTimeMs(*wsMsg); msgTimeMs > 0 {
+			serverTime.Observe(msgTimeMs, receivedNs)
+		}
+	}
+
+	if wsMsg.Channel == "futures.trades" {
+		handleTradesMessage(*wsMsg)
+		return
+	}
+
+	// Проверяем, что это сообщение с обновлением ордербука
+	if wsMsg.Channel == "futures.order_book_update" {
+		if wsMsg.Event == "subscribe" {
+			debugf("Subscribe ack id=%d: %s", wsMsg.ID, string(msg))
+
+			// Подписка отклонена (например, интервал недоступен) - пробуем более редкий интервал
+			if wsMsg.Error != nil {
+				subscriptions.Rejected(wsMsg.ID, fmt.Sprintf("code %d: %s", wsMsg.Error.Code, wsMsg.Error.Message))
+				return
+			}
+			if sub, ok := subscriptions.Acked(wsMsg.ID); ok {
+				infof("Subscription to %s confirmed with interval %s", sub.Contract, sub.Interval)
+			} else {
+				debugf("Ignoring duplicate or unknown subscribe ack id=%d", wsMsg.ID)
+			}
+
+			// Обрабатываем подтверждение подписки
+			var subResp SubscriptionResponse
+			err = json.Unmarshal(wsMsg.Result, &subResp)
+			if err != nil {
+				errorf("Subscription response parse error: %v", err)
+			} else {
+				infof("Subscription status: %s", subResp.Status)
+			}
+			return
+		}
+
+		if wsMsg.Event == "update" {
+			// Обрабатываем обновление ордербука
+			update := &buf.update
+			err = json.Unmarshal(wsMsg.Result, update)
+			if err != nil {
+				errorf("Update message parse error: %v", err)
+				metrics.Count("websocket.parse_errors", 1)
+				return
+			}
+
+			contract := update.Contract
+			if contract == "" {
+				warnf("empty contract in update message: %s", string(msg))
+				return
+			}
+
+			// Обновления до получения REST снимка буферизуем
+			existing, ok := orderbooks.Get(contract)
+			received := receivedUpdate{update: *update, msgTimeMs: messageTimeMs(*wsMsg), receivedNs: receivedNs}
+			if !ok {
+				bufferUpdate(contract, received)
+				return
+			}
+
+			applyUpdate(contract, existing, received)
+			applyReordered(contract)
+		}
+	}
+}
+
+// Обновление ордербука с временем сервера и локальным временем получения
+type receivedUpdate struct {
+	update     OrderBookUpdate
+	msgTimeMs  int64 // Server time, unix ms; 0 if absent
+	receivedNs int64 // Local receive time, unix ns
+}
+
+// Время сообщения сервера в мс: time_ms, иначе time; 0, если времени нет
+func messageTimeMs(wsMsg WebSocketMessage) int64 {
+	if wsMsg.TimeMs > 0 {
+		return wsMsg.TimeMs
+	}
+	if wsMsg.Time > 0 {
+		return wsMsg.Time * 1000
+	}
+	return 0
+}
+
+// Допустимое расхождение времени сервера с локальным (0 - не проверяется)
+var maxMessageTimeSkew = time.Minute
+
+// Контракты, для которых последнее время сервера было отброшено
+var messageTimeAnomalies = make(map[string]bool)
+
+// Время обновления книги в секундах: время сервера, если оно есть и
+// правдоподобно, иначе локальное время получения
+func updateTimestamp(contract string, msgTimeMs, receivedNs int64) float64 {
+	receivedMs := receivedNs / int64(time.Millisecond)
+	skew := time.Duration(msgTimeMs-receivedMs) * time.Millisecond
+	if skew < 0 {
+		skew = -skew
+	}
+
+	if msgTimeMs > 0 && (maxMessageTimeSkew <= 0 || skew <= maxMessageTimeSkew) {
+		if messageTimeAnomalies[contract] {
+			delete(messageTimeAnomalies, contract)
+			infof("Server time for %s is plausible again", contract)
+		}
+		return float64(msgTimeMs) / 1000
+	}
+
+	metrics.Count("orderbook.time_anomalies."+contract, 1)
+	if !messageTimeAnomalies[contract] {
+		messageTimeAnomalies[contract] = true
+		if msgTimeMs <= 0 {
+			warnf("update for %s has no server time, using local receive time", contract)
+		} else {
+			warnf("server time for %s is off by %s, using local receive time", contract, skew)
+		}
+	}
+	return float64(receivedNs) / 1e9
+}
+
+// Учет принятого обновления: следующее должно начинаться с update.End+1
+func advanceSequence(contract string, update OrderBookUpdate) {
+	if update.End != 0 {
+		lastUpdateIDs[contract] = update.End
+	}
+}
+
+// Применение обновления к ордербуку контракта
+func applyUpdate(contract string, existing OrderBookResponse, received receivedUpdate) {
+	update := received.update
+
+	// Пропускаем уже примененные обновления (дубликаты с резервных соединений)
+	if update.End != 0 {
+		if update.End <= lastUpdateIDs[contract] {
+			debugf("Skipping duplicate update %d for %s", update.End, contract)
+			return
+		}
+		// Пропущены обновления между последним примененным и U: ждем их
+		// reorderWindow, затем считаем, что книга разошлась
+		if last := lastUpdateIDs[contract]; last != 0 && update.U > last+1 {
+			if holdOutOfOrder(contract, received) {
+				return
+			}
+			warnf("sequence gap for %s: expected update %d, got %d-%d",
+				contract, last+1, update.U, update.End)
+			resync(contract, "sequence gap")
+			bufferUpdate(contract, received)
+			return
+		}
+	}
+
+	// Обновление без уровней только продвигает последовательность
+	if len(update.Asks) == 0 && len(update.Bids) == 0 {
+		advanceSequence(contract, update)
+		return
+	}
+
+	// Обновление применяется поверх удержанной книги, если она есть
+	published := existing
+	if priceJumps != nil {
+		existing = priceJumps.Base(contract, existing)
+	}
+	before := existing
+
+	// Обновляем существующие ордера
+	existing.Asks = UpdateOrders(existing.Asks, update.Asks, false)
+	existing.Bids = UpdateOrders(existing.Bids, update.Bids, true)
+	existing.Update = updateTimestamp(contract, received.msgTimeMs, received.receivedNs)
+	if update.End != 0 {
+		existing.ID = update.End
+	}
+	// Время получения строго возрастает в пределах контракта
+	existing.ReceivedNs = received.receivedNs
+	if existing.ReceivedNs <= before.ReceivedNs {
+		existing.ReceivedNs = before.ReceivedNs + 1
+	}
+	// Книга разошлась с биржей, если не совпала присланная контрольная сумма
+	if update.Checksum != nil && !verifyChecksum(contract, existing, *update.Checksum) {
+		resync(contract, "checksum mismatch")
+		return
+	}
+	// Удержанное обновление принимается в последовательность (следующее
+	// применяется поверх него), но публикуется только вместе со следующим:
+	// подписчики и журналы получают одну объединенную дельту
+	if priceJumps != nil {
+		var admitted bool
+		update, admitted = priceJumps.Admit(contract, published, existing, update)
+		if !admitted {
+			advanceSequence(contract, update)
+			return
+		}
+	}
+	// Пересеченная книга разошлась с биржей
+	if crossedBooks.Check(contract, existing) && resyncCrossed {
+		resync(contract, "crossed book")
+		return
+	}
+	advanceSequence(contract, update)
+	orderbooks.Set(contract, existing)
+
+	receivedAt := time.Unix(0, existing.ReceivedNs)
+	if staleBooks != nil {
+		staleBooks.Touch(contract, receivedAt)
+	}
+	metrics.Count("orderbook.updates."+contract, 1)
+	metrics.Gauge("orderbook.asks."+contract, float64(len(existing.Asks)))
+	metrics.Gauge("orderbook.bids."+contract, float64(len(existing.Bids)))
+	if spread, ok := spreadBps(existing); ok {
+		metrics.Gauge("orderbook.spread_bps."+contract, spread)
+	}
+	if interval, ok := updateIntervals.Record(contract, receivedAt); ok {
+		metrics.Timing("orderbook.update_interval."+contract, interval)
+	}
+
+	midPrices.Record(contract, receivedAt, existing)
+	if midEMAs != nil {
+		midEMAs.Update(contract, existing)
+	}
+
+	if bookResilience != nil {
+		bookResilience.Observe(contract, published, existing, update, receivedAt)
+	}
+
+	// Приостановленный контракт не сохраняется и не рассылается
+	paused := pausedContracts.Paused(contract)
+
+	if crossingAlerts != nil {
+		if _, fired := crossingAlerts.Check(contract, existing); fired && crossingAlerts.save && !paused {
+			queueAlertSave(contract, existing)
+		}
+	}
+
+	if depthAlerts != nil {
+		depthAlerts.Check(contract, existing)
+	}
+
+	if dailyRollups != nil {
+		dailyRollups.Observe(contract, existing)
+	}
+
+	if paused {
+		debugf("Updated paused orderbook for contract: %s", contract)
+		return
+	}
+
+	if tcpStream != nil {
+		tcpStream.Publish(contract, update, existing)
+	}
+	publishBookEvent(contract, existing, false)
+
+	if clickhouseUpdates != nil {
+		clickhouseUpdates.Append(contract, existing.ReceivedNs, update)
+	}
+
+	if changeLogs != nil {
+		changeLogs.Append(contract, existing.ReceivedNs, received.msgTimeMs, update, existing)
+	}
+
+	if topOfBookSeries != nil {
+		if err := topOfBookSeries.Append(contract, receivedAt, existing); err != nil {
+			errorf("Error writing top-of-book series for %s: %v", contract, err)
+		}
+	}
+
+	infof("Updated orderbook for contract: %s (asks updates: %d, bids updates: %d)",
+		contract, len(update.Asks), len(update.Bids))
+}
+
+// Обработка сообщения канала сделок
+func handleTradesMessage(wsMsg WebSocketMessage) {
+	if wsMsg.Error != nil {
+		errorf("Trades subscription error: code %d: %s", wsMsg.Error.Code, wsMsg.Error.Message)
+		return
+	}
+	if wsMsg.Event != "update" || cumulativeDeltas == nil {
+		return
+	}
+
+	var trades []Trade
+	err := json.Unmarshal(wsMsg.Result, &trades)
+	if err != nil {
+		errorf("Trades message parse error: %v", err)
+		return
+	}
+	for _, trade := range trades {
+		total := cumulativeDeltas.Add(trade)
+		debugf("Trade %d for %s: size %g, cumulative delta %g", trade.ID, trade.Contract, trade.Size, total)
+	}
+}
+
+// Кадр WebSocket с локальным временем получения
+type wsFrame struct {
+	data       []byte
+	receivedNs int64 // Unix ns, taken right after the frame is read
+}
+
+// WebSocket соединение с сериализованной записью (запись идет из разных горутин)
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *wsConn) WriteJSON(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Conn.WriteJSON(v)
+}
+
+// Сколько ждать ответного close кадра при закрытии соединения
+const wsCloseTimeout = 2 * time.Second
+
+// Закрытие соединения с handshake: отправка close кадра и ограничение
+// времени чтения, чтобы цикл чтения дождался ответа сервера или таймаута
+func (c *wsConn) closeGracefully() {
+	deadline := time.Now().Add(wsCloseTimeout)
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := c.WriteControl(websocket.CloseMessage, msg, deadline); err != nil {
+		debugf("WebSocket close handshake error: %v", err)
+	}
+	c.SetReadDeadline(deadline)
+}
+
+// Параметры переподключения WebSocket
+type ReconnectConfig struct {
+	InitialBackoff time.Duration // Delay before the first reconnect attempt
+	MaxBackoff     time.Duration // Cap for the doubling delay
+	Jitter         float64       // Random +/- fraction applied to each delay
+	FlapThreshold  int           // Drops within FlapWindow that mark a connection as flapping (0 disables)
+	FlapWindow     time.Duration
+}
+
+var reconnectConfig = ReconnectConfig{
+	InitialBackoff: time.Second,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+	FlapThreshold:  5,
+	FlapWindow:     time.Minute,
+}
+
+// Дополнительные шаги удвоения задержки для соединения с drops разрывами
+// в окне: каждый разрыв сверх порога учетверяет задержку
+func (c ReconnectConfig) flapPenalty(drops int) int {
+	if c.FlapThreshold <= 0 || drops < c.FlapThreshold {
+		return 0
+	}
+	return 2 * (drops - c.FlapThreshold + 1)
+}
+
+// Разрывы соединения за последние window
+type flapDetector struct {
+	window time.Duration
+	drops  []time.Time
+}
+
+// Регистрация разрыва в момент t, возвращает число разрывов в окне
+func (d *flapDetector) Record(t time.Time) int {
+	cutoff := t.Add(-d.window)
+	keep := 0
+	for keep < len(d.drops) && !d.drops[keep].After(cutoff) {
+		keep++
+	}
+	d.drops = append(d.drops[keep:], t)
+	return len(d.drops)
+}
+
+// Задержка перед попыткой переподключения attempt (с 0): удвоение до MaxBackoff плюс jitter
+func (c ReconnectConfig) backoff(attempt int) time.Duration {
+	delay := c.InitialBackoff
+	for i := 0; i < attempt && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	if c.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + c.Jitter*(2*rand.Float64()-1)))
+	}
+	return delay
+}
+
+// Хост WebSocket API фьючерсов по умолчанию. Известные адреса Gate.io:
+// fx-ws.gateio.ws (боевой) и fx-ws-testnet.gateio.ws (тестовая сеть).
+const defaultWSHost = "fx-ws.gateio.ws"
+
+// Путь WebSocket API фьючерсов, если в адресе хоста он не указан
+const wsPath = "/v4/ws"
+
+// Базовый адрес WebSocket API фьючерсов; путь дополняется валютой расчетов
+var wsBaseURL = "wss://" + defaultWSHost + wsPath
+
+// Базовый адрес WebSocket API по хосту ("fx-ws.gateio.ws") или адресу
+// ("wss://host[:port][/path]"); допускается только схема wss
+func parseWSHost(host string) (string, error) {
+	if !strings.Contains(host, "://") {
+		host = "wss://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid WebSocket host %q: %v", host, err)
+	}
+	if u.Scheme != "wss" {
+		return "", fmt.Errorf("invalid WebSocket host %q: scheme must be wss", host)
+	}
+	if u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid WebSocket host %q: expected wss://host[:port][/path]", host)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = wsPath
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// Валюта расчетов контрактов по умолчанию
+var settleCurrency = "usdt"
+
+// Валюты расчетов контрактов, заданных с префиксом (например btc:BTC_USD)
+var contractSettles = make(map[string]string)
+
+// Валюта расчетов контракта
+func contractSettle(contract string) string {
+	if settle, ok := contractSettles[contract]; ok {
+		return settle
+	}
+	return settleCurrency
+}
+
+// Разбор элемента списка контрактов: [settle:]CONTRACT
+func splitContractSettle(entry, defaultSettle string) (settle, contract string) {
+	if i := strings.Index(entry, ":"); i >= 0 {
+		return entry[:i], entry[i+1:]
+	}
+	return defaultSettle, entry
+}
+
+// Адрес WebSocket API для валюты расчетов
+func wsURL(settle string) string {
+	return wsBaseURL + "/" + settle
+}
+
+// Одно WebSocket соединение: подключение, подписка на контракты и чтение
+// до ошибки или отмены ctx. После отправки подписок вызывается onSubscribed.
+func runWebSocketConnection(ctx context.Context, group connectionGroup, feed int, messages chan<- wsFrame, onSubscribed func()) error {
+	contracts := group.Contracts
+	ws, _, err := wsDialer.DialContext(ctx, wsURL(group.Settle), nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("dial error: %v", err)
+	}
+	c := &wsConn{Conn: ws}
+	defer c.Close()
+	defer subscriptions.Disconnected(c)
+
+	// При отмене ctx закрываем соединение с handshake
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.closeGracefully()
+		case <-done:
+		}
+	}()
+
+	// Подписываемся на обновления ордербука для каждого контракта отдельно
+	for _, contract := range contracts {
+		err = subscriptions.Subscribe(c, subscription{Contract: contract, Interval: updateInterval})
+		if err != nil {
+			errorf("WebSocket subscription error for %s: %v", contract, err)
+			continue
+		}
+		infof("Subscribed to %s orderbook updates (feed %d)", contract, feed)
+	}
+
+	// Подписываемся на сделки для накопленной дельты
+	if cumulativeDeltas != nil {
+		err = subscribeTrades(c, contracts)
+		if err != nil {
+			errorf("WebSocket trades subscription error: %v", err)
+		} else {
+			infof("Subscribed to trades for %d contracts (feed %d)", len(contracts), feed)
+		}
+	}
+
+	infof("WebSocket feed %d connected and subscribed to all contracts", feed)
+	onSubscribed()
+
+	// Чтение входящих сообщений; после отмены ctx они отбрасываются до ответного close кадра
+	for {
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("read error: %v", err)
+		}
+		select {
+		case messages <- wsFrame{data: message, receivedNs: time.Now().UnixNano()}:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// Подключение к WebSocket с переподключением при любом разрыве.
+// Входящие сообщения передаются в канал messages; после первой подписки
+// в subscribed отправляется сигнал, после каждого переподключения
+// контракты соединения передаются в resyncs для получения свежих снимков.
+// Возвращается после отмены ctx.
+func connectWebSocket(ctx context.Context, group connectionGroup, feed int, messages chan<- wsFrame, subscribed chan<- struct{}, resyncs chan<- string) {
+	contracts := group.Contracts
+	attempt := 0
+	connected := false
+	flaps := flapDetector{window: reconnectConfig.FlapWindow}
+	for {
+		err := runWebSocketConnection(ctx, group, feed, messages, func() {
+			attempt = 0
+			if !connected {
+				connected = true
+				subscribed <- struct{}{}
+				return
+			}
+			// Пока соединения не было, обновления могли быть пропущены
+			for _, contract := range contracts {
+				select {
+				case resyncs <- contract:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+		if ctx.Err() != nil {
+			infof("WebSocket feed %d closed", feed)
+			return
+		}
+
+		// Частые разрывы (в том числе после успешной подписки) ускоряют рост задержки
+		drops := flaps.Record(time.Now())
+		penalty := reconnectConfig.flapPenalty(drops)
+		delay := reconnectConfig.backoff(attempt + penalty)
+		attempt++
+		if penalty > 0 {
+			errorf("WebSocket feed %d is unstable: %d disconnects within %s, backing off harder", feed, drops, reconnectConfig.FlapWindow)
+			metrics.Count("websocket.flapping", 1)
+		}
+		warnf("WebSocket feed %d disconnected (%v), reconnecting in %s", feed, err, delay.Round(time.Millisecond))
+		metrics.Count("websocket.reconnects", 1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			infof("WebSocket feed %d closed", feed)
+			return
+		}
+	}
+}
+
+// Разбор списка контрактов через запятую
+func ParseContractList(s string) []string {
+	var contracts []string
+	for _, contract := range strings.Split(s, ",") {
+		if contract = strings.TrimSpace(contract); contract != "" {
+			contracts = append(contracts, contract)
+		}
+	}
+	return contracts
+}
+
+// Удаление повторяющихся контрактов с сохранением порядка
+func dedupeContracts(contracts []string) []string {
+	seen := make(map[string]bool, len(contracts))
+	unique := make([]string, 0, len(contracts))
+	for _, contract := range contracts {
+		if seen[contract] {
+			warnf("contract %s is listed more than once, tracking it once", contract)
+			continue
+		}
+		seen[contract] = true
+		unique = append(unique, contract)
+	}
+	return unique
+}
+
+// Контракты одного WebSocket соединения с общей валютой расчетов
+type connectionGroup struct {
+	Settle    string
+	Contracts []string
+}
+
+// Разбиение контрактов на группы соединений: общая группа на каждую валюту
+// расчетов и по отдельной группе на каждый изолированный контракт
+func connectionGroups(contracts, isolated []string) []connectionGroup {
+	isIsolated := make(map[string]bool, len(isolated))
+	for _, contract := range isolated {
+		isIsolated[contract] = true
+	}
+
+	var shared, groups []connectionGroup
+	sharedIndex := make(map[string]int)
+	for _, contract := range contracts {
+		settle := contractSettle(contract)
+		if isIsolated[contract] {
+			groups = append(groups, connectionGroup{Settle: settle, Contracts: []string{contract}})
+			continue
+		}
+		i, ok := sharedIndex[settle]
+		if !ok {
+			i = len(shared)
+			sharedIndex[settle] = i
+			shared = append(shared, connectionGroup{Settle: settle})
+		}
+		shared[i].Contracts = append(shared[i].Contracts, contract)
+	}
+	groups = append(shared, groups...)
+
+	tracked := make(map[string]bool, len(contracts))
+	for _, contract := range contracts {
+		tracked[contract] = true
+	}
+	for _, contract := range isolated {
+		if !tracked[contract] {
+			warnf("isolated contract %s is not tracked, ignoring", contract)
+		}
+	}
+	return groups
+}
+
+// Запуск соединений: для каждой группы контрактов feeds параллельных
+// соединений с одними и теми же подписками. Сообщения всех соединений и
+// REST снимки обрабатываются в одной горутине, дубликаты обновлений
+// отбрасываются по id последнего обновления (u). Снимки группы
+// запрашиваются после отправки подписок ее первым соединением, а
+// обновления, пришедшие раньше снимка, буферизуются и сверяются с его id.
+// После отмены ctx возвращается, когда закрыты все соединения.
+func runWebSocketFeeds(ctx context.Context, groups []connectionGroup, feeds int) error {
+	messages := make(chan wsFrame, 1024)
+	snapshots := make(chan contractSnapshot)
+	resyncs := make(chan string)
+	requestSnapshot = func(contract string) {
+		go func() {
+			for !fetchSnapshot(ctx, contract, snapshots) {
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	feed := 0
+	for _, group := range groups {
+		subscribed := make(chan struct{}, feeds)
+		for i := 0; i < feeds; i++ {
+			feed++
+			wg.Add(1)
+			go func(group connectionGroup, feed int) {
+				defer wg.Done()
+				connectWebSocket(ctx, group, feed, messages, subscribed, resyncs)
+			}(group, feed)
+		}
+
+		// Получаем начальные снимки, как только первое соединение группы подписалось
+		go func(contracts []string) {
+			select {
+			case <-subscribed:
+				seedOrderBooks(ctx, contracts, snapshots)
+			case <-ctx.Done():
+			}
+		}(group.Contracts)
+	}
+	go func() {
+		wg.Wait()
+		close(messages)
+	}()
+
+	// Проверка, что все подписки подтверждены: сверх лимита Gate.io
+	// подписки молча не работают
+	var requested []string
+	for _, group := range groups {
+		requested = append(requested, group.Contracts...)
+	}
+	ackDeadline := time.NewTimer(subscribeAckTimeout)
+	defer ackDeadline.Stop()
+
+	// Проверка устаревания книг в том же цикле: пересинхронизация
+	// затрагивает состояние книг
+	var staleTicks <-chan time.Time
+	if staleBooks != nil {
+		ticker := time.NewTicker(staleCheckInterval(staleBooks.threshold))
+		defer ticker.Stop()
+		staleTicks = ticker.C
+	}
+
+	// Проверка удерживаемых обновлений, даже если поток контракта затих
+	var reorderTicks <-chan time.Time
+	if reorderWindow > 0 {
+		ticker := time.NewTicker(reorderWindow / 2)
+		defer ticker.Stop()
+		reorderTicks = ticker.C
+	}
+
+	// Обработка входящих сообщений и снимков
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			handleWebSocketMessageSafely(message.data, message.receivedNs)
+
+			// Повторяем отклоненные подписки на том же соединении
+			for _, retry := range subscriptions.TakeRetries() {
+				err := subscriptions.Subscribe(retry.conn, retry.sub)
+				if err != nil {
+					errorf("WebSocket subscription error for %s: %v", retry.sub.Contract, err)
+				}
+			}
+		case snapshot := <-snapshots:
+			applySnapshot(snapshot.contract, snapshot.orderbook)
+		case contract := <-resyncs:
+			resync(contract, "feed reconnected")
+		case now := <-reorderTicks:
+			expireReorderBuffers(now)
+		case <-staleTicks:
+			for _, contract := range staleBooks.Check() {
+				if staleResync && !resyncing[contract] {
+					resync(contract, "no updates")
+				}
+			}
+		case <-ackDeadline.C:
+			reportSubscriptionShortfall(requested)
+		}
+	}
+}
+
+// Книга, сохраняемая по ценовому алерту
+type alertSave struct {
+	contract  string
+	orderbook OrderBookResponse
+}
+
+// Размер очереди сохранений по алертам
+const alertSaveQueue = 64
+
+// Очередь сохранений по алертам: файлы пишет горутина сохранения,
+// а не цикл чтения WebSocket
+var alertSaves = make(chan alertSave, alertSaveQueue)
+
+// Постановка сохранения книги по алерту в очередь (если сохранение
+// не выключено); при заполненной очереди сохранение пропускается
+func queueAlertSave(contract string, orderbook OrderBookResponse) {
+	if !saverEnabled {
+		return
+	}
+	select {
+	case alertSaves <- alertSave{contract: contract, orderbook: orderbook}:
+	default:
+		warnf("alert save queue is full, not saving %s", contract)
+	}
+}
+
+// Периодическое сохранение ордербуков до отмены ctx; после отмены
+// все книги сохраняются последний раз. Между периодами пишутся книги
+// из очереди сохранений по алертам.
+func startOrderBookSaver(ctx context.Context) {
+	// Случайный сдвиг фазы, чтобы записи разных экземпляров не совпадали по времени
+	if saveJitter > 0 {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(saveJitter)))):
+		case <-ctx.Done():
+		}
+	}
+
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	// При пуассоновской выборке книги сохраняются по своему таймеру,
+	// а тикер выполняет только остальную периодическую работу
+	var samples <-chan time.Time
+	var sampleTimer *time.Timer
+	if saveSampler != nil {
+		sampleTimer = time.NewTimer(saveSampler.Next())
+		defer sampleTimer.Stop()
+		samples = sampleTimer.C
+	}
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if topOfBookSeries != nil {
+				if err := topOfBookSeries.FlushPending(now); err != nil {
+					errorf("Error flushing top-of-book series: %v", err)
+				}
+			}
+			if dailyRollups != nil {
+				dailyRollups.Tick()
+			}
+			saveOrderBooks(true, saveSampler == nil)
+		case <-samples:
+			saveOrderBooks(false, true)
+			sampleTimer.Reset(saveSampler.Next())
+		case s := <-alertSaves:
+			if err := saveOrderBook(s.contract, s.orderbook); err != nil {
+				errorf("Error saving orderbook for %s on price alert: %v", s.contract, err)
+			}
+		case <-ctx.Done():
+			saveOrderBooks(false, true)
+			return
+		}
+	}
+}
+
+// Сохранение всех книг (кроме приостановленных); checkAlerts включает
+// проверку односторонних книг, save - запись файлов
+func saveOrderBooks(checkAlerts, save bool) {
+	saved := make(map[string]OrderBookResponse)
+	var symbols []string
+	for symbol, orderbook := range orderbooks.Snapshot() {
+		if checkAlerts && oneSidedAlerts != nil {
+			oneSidedAlerts.Check(symbol, orderbook)
+		}
+		if !save || !saverEnabled || pausedContracts.Paused(symbol) {
+			continue
+		}
+		saved[symbol] = orderbook
+		symbols = append(symbols, symbol)
+	}
+
+	// Книги сохраняются параллельно пулом saveWorkers
+	saveWorkers.Run(len(symbols), func(i int) {
+		symbol := symbols[i]
+		if err := saveOrderBook(symbol, saved[symbol]); err != nil {
+			errorf("Error saving orderbook for %s: %v", symbol, err)
+		}
+	})
+
+	if spreadMetrics != nil && len(saved) > 0 {
+		if err := spreadMetrics.Append(time.Now(), saved); err != nil {
+			errorf("Error writing spread metrics: %v", err)
+		}
+	}
+}
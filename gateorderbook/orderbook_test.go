@@ -0,0 +1,1396 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+)
+
+// Уровни из строк "цена:объем"
+func levels(specs ...string) []OrderBookItem {
+	items := make([]OrderBookItem, 0, len(specs))
+	for _, spec := range specs {
+		price, size, _ := strings.Cut(spec, ":")
+		items = append(items, OrderBookItem{P: price, S: decimal.RequireFromString(size)})
+	}
+	return items
+}
+
+// Уровни в виде строк "цена:объем" для сравнения
+func levelSpecs(items []OrderBookItem) string {
+	specs := make([]string, len(items))
+	for i, item := range items {
+		specs[i] = item.P + ":" + item.S.String()
+	}
+	return strings.Join(specs, " ")
+}
+
+// Книга с id и уровнями
+func testBook(id int64, asks, bids []OrderBookItem) OrderBookResponse {
+	return OrderBookResponse{ID: id, Current: 1, Update: 1, ReceivedNs: 1, Asks: asks, Bids: bids}
+}
+
+// WebSocket сообщение с обновлением U-u контракта
+func updateMessage(contract string, first, last int64, asks, bids []OrderBookItem) []byte {
+	result, err := json.Marshal(OrderBookUpdate{Contract: contract, U: first, End: last, Asks: asks, Bids: bids})
+	if err != nil {
+		panic(err)
+	}
+	msg, err := json.Marshal(WebSocketMessage{
+		TimeMs:  time.Now().UnixMilli(),
+		Channel: "futures.order_book_update",
+		Event:   "update",
+		Result:  result,
+	})
+	if err != nil {
+		panic(err)
+	}
+	return msg
+}
+
+// Подмена запроса снимка: контракты запрошенных снимков записываются
+func captureSnapshotRequests(t testing.TB) *[]string {
+	t.Helper()
+	prev := requestSnapshot
+	var requested []string
+	requestSnapshot = func(contract string) { requested = append(requested, contract) }
+	t.Cleanup(func() { requestSnapshot = prev })
+	return &requested
+}
+
+func TestUpdateSequence(t *testing.T) {
+	type span struct{ first, last int64 }
+	tests := []struct {
+		name          string
+		window        time.Duration
+		updates       []span
+		wantLast      int64
+		wantBook      bool
+		wantRequests  int
+		wantPending   int
+		wantHeld      int
+		wantReordered bool
+	}{
+		{"in order", 0, []span{{101, 101}, {102, 105}}, 105, true, 0, 0, 0, false},
+		{"overlapping first update", 0, []span{{99, 103}}, 103, true, 0, 0, 0, false},
+		{"duplicate skipped", 0, []span{{101, 103}, {102, 103}, {90, 100}}, 103, true, 0, 0, 0, false},
+		{"gap resyncs without reorder window", 0, []span{{103, 104}}, 0, false, 1, 1, 0, false},
+		{"gap held within reorder window", time.Minute, []span{{103, 104}}, 100, true, 0, 0, 1, false},
+		{"gap filled within reorder window", time.Minute, []span{{103, 104}, {105, 106}, {101, 102}}, 106, true, 0, 0, 0, true},
+		{"updates after resync are buffered", 0, []span{{103, 104}, {105, 106}}, 0, false, 1, 2, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = tt.window })
+			requested := captureSnapshotRequests(t)
+			applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+			for _, u := range tt.updates {
+				handleWebSocketMessage(updateMessage("BTC_USDT", u.first, u.last, levels("101:2"), nil), time.Now().UnixNano())
+			}
+
+			_, ok := orderbooks.Get("BTC_USDT")
+			if ok != tt.wantBook {
+				t.Errorf("book present = %v, want %v", ok, tt.wantBook)
+			}
+			if got := lastUpdateIDs["BTC_USDT"]; got != tt.wantLast {
+				t.Errorf("last update id = %d, want %d", got, tt.wantLast)
+			}
+			if len(*requested) != tt.wantRequests {
+				t.Errorf("snapshot requests = %v, want %d", *requested, tt.wantRequests)
+			}
+			if got := len(pendingUpdates["BTC_USDT"]); got != tt.wantPending {
+				t.Errorf("buffered updates = %d, want %d", got, tt.wantPending)
+			}
+			if got := len(reorderBuffers["BTC_USDT"]); got != tt.wantHeld {
+				t.Errorf("held updates = %d, want %d", got, tt.wantHeld)
+			}
+		})
+	}
+}
+
+func TestUpdateLevels(t *testing.T) {
+	newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1", "102:2", "103:3"), levels("99:1", "98:2")))
+
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101,
+		levels("102:0", "101:5", "104:1"), levels("98.5:7", "99:0")), time.Now().UnixNano())
+
+	book, ok := orderbooks.Get("BTC_USDT")
+	if !ok {
+		t.Fatal("book missing")
+	}
+	if got, want := levelSpecs(book.Asks), "101:5 103:3 104:1"; got != want {
+		t.Errorf("asks = %s, want %s", got, want)
+	}
+	if got, want := levelSpecs(book.Bids), "98.5:7 98:2"; got != want {
+		t.Errorf("bids = %s, want %s", got, want)
+	}
+	if book.ID != 101 {
+		t.Errorf("book id = %d, want 101", book.ID)
+	}
+}
+
+func TestRedundantFeedsApplyEachUpdateOnce(t *testing.T) {
+	tracker := newTestTracker(t, func(cfg *Config) { cfg.RedundantFeeds = 2 })
+	events := tracker.Updates()
+	t.Cleanup(func() { bookEvents = nil })
+	logs := captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	a := map[int64][]byte{
+		101: updateMessage("BTC_USDT", 101, 101, levels("101:2"), nil),
+		102: updateMessage("BTC_USDT", 102, 102, levels("101:3"), nil),
+		103: updateMessage("BTC_USDT", 103, 103, nil, levels("99:5")),
+	}
+	// Второе соединение доставляет те же обновления и еще одно
+	b := map[int64][]byte{
+		101: a[101], 102: a[102], 103: a[103],
+		104: updateMessage("BTC_USDT", 104, 104, nil, levels("98:1")),
+	}
+	// Соединение A теряет 102; дубликаты приходят после более новых обновлений
+	frames := [][]byte{a[101], b[101], b[102], b[103], a[103], a[102], b[104]}
+	for _, frame := range frames {
+		handleWebSocketMessage(frame, time.Now().UnixNano())
+	}
+
+	book, _ := orderbooks.Get("BTC_USDT")
+	if levelSpecs(book.Asks) != "101:3" || levelSpecs(book.Bids) != "99:5 98:1" || book.ID != 104 {
+		t.Errorf("book %d = %s / %s, want 104 = 101:3 / 99:5 98:1", book.ID, levelSpecs(book.Asks), levelSpecs(book.Bids))
+	}
+	if strings.Contains(logs.String(), "sequence gap") {
+		t.Errorf("log = %q, want no gap while the other feed has the update", logs)
+	}
+
+	// Снимок и четыре уникальных обновления: по одному событию на каждое
+	var updates int
+	for len(events) > 0 {
+		if event := <-events; !event.Snapshot {
+			updates++
+		}
+	}
+	if updates != 4 {
+		t.Errorf("applied updates = %d, want 4", updates)
+	}
+}
+
+func TestReceivedNsMonotonic(t *testing.T) {
+	tracker := newTestTracker(t, nil)
+	events := tracker.Updates()
+	t.Cleanup(func() { bookEvents = nil })
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	<-events
+
+	base := time.Now().UnixNano()
+	tests := []struct {
+		receivedNs int64
+		want       int64
+	}{
+		{base, base},
+		{base + 250, base + 250},
+		// Тот же или более ранний момент (часы отведены назад): +1ns к предыдущему
+		{base + 250, base + 251},
+		{base - 1000, base + 252},
+		{base + 1000, base + 1000},
+	}
+	for i, tt := range tests {
+		id := int64(101 + i)
+		handleWebSocketMessage(updateMessage("BTC_USDT", id, id, nil, levels("99:"+strconv.Itoa(i+2))), tt.receivedNs)
+		if got := (<-events).Book.ReceivedNs; got != tt.want {
+			t.Errorf("update %d received_ns = %d, want %d", id, got, tt.want)
+		}
+	}
+
+	// Поле есть в JSON книги и пропускается у книг без метки
+	book, _ := orderbooks.Get("BTC_USDT")
+	data, _ := json.Marshal(book)
+	if want := `"received_ns":` + strconv.FormatInt(base+1000, 10); !strings.Contains(string(data), want) {
+		t.Errorf("book JSON = %s, want %s", data, want)
+	}
+	data, _ = json.Marshal(OrderBookResponse{ID: 1})
+	if strings.Contains(string(data), "received_ns") {
+		t.Errorf("book JSON without a stamp = %s", data)
+	}
+}
+
+func TestConnectionGroups(t *testing.T) {
+	tests := []struct {
+		name        string
+		isolated    []string
+		want        []connectionGroup
+		wantWarning string
+	}{
+		{"shared by settle currency", nil, []connectionGroup{
+			{Settle: "usdt", Contracts: []string{"BTC_USDT", "ETH_USDT", "SOL_USDT"}},
+			{Settle: "btc", Contracts: []string{"BTC_USD"}},
+		}, ""},
+		{"isolated contracts get their own group", []string{"BTC_USDT", "BTC_USD"}, []connectionGroup{
+			{Settle: "usdt", Contracts: []string{"ETH_USDT", "SOL_USDT"}},
+			{Settle: "usdt", Contracts: []string{"BTC_USDT"}},
+			{Settle: "btc", Contracts: []string{"BTC_USD"}},
+		}, ""},
+		{"untracked isolated contract ignored", []string{"XRP_USDT"}, []connectionGroup{
+			{Settle: "usdt", Contracts: []string{"BTC_USDT", "ETH_USDT", "SOL_USDT"}},
+			{Settle: "btc", Contracts: []string{"BTC_USD"}},
+		}, "isolated contract XRP_USDT is not tracked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newTestTracker(t, func(cfg *Config) {
+				cfg.Contracts = []string{"BTC_USDT", "ETH_USDT", "btc:BTC_USD", "SOL_USDT"}
+				cfg.Isolated = tt.isolated
+			})
+			logs := captureLog(t)
+			got := connectionGroups(tracker.contracts, tracker.isolated)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groups = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantWarning != "" && !strings.Contains(logs.String(), tt.wantWarning) {
+				t.Errorf("log = %q, want %q", logs, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestMessageTimeMs(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  WebSocketMessage
+		want int64
+	}{
+		{"time_ms preferred", WebSocketMessage{Time: 1700000000, TimeMs: 1700000000123}, 1700000000123},
+		{"seconds only", WebSocketMessage{Time: 1700000000}, 1700000000000},
+		{"absent", WebSocketMessage{}, 0},
+		{"negative", WebSocketMessage{Time: -1, TimeMs: -1}, 0},
+	}
+	for _, tt := range tests {
+		if got := messageTimeMs(tt.msg); got != tt.want {
+			t.Errorf("%s: time = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateTimeFallsBackToLocalTime(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.MaxTimeSkew = time.Minute })
+	logs := captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	received := time.Unix(1700000000, 500000000)
+	// Кадр с временем сервера msgTimeMs (0 - без поля времени)
+	frame := func(id, msgTimeMs int64) []byte {
+		result, _ := json.Marshal(OrderBookUpdate{Contract: "BTC_USDT", U: id, End: id, Bids: levels("99:" + strconv.FormatInt(id-99, 10))})
+		msg, _ := json.Marshal(WebSocketMessage{TimeMs: msgTimeMs, Channel: "futures.order_book_update", Event: "update", Result: result})
+		return msg
+	}
+
+	tests := []struct {
+		name      string
+		msgTimeMs int64
+		want      float64
+	}{
+		{"server time", received.UnixMilli() - 20, 1700000000.48},
+		{"no time field", 0, 1700000000.5},
+		{"implausible time", received.Add(-time.Hour).UnixMilli(), 1700000000.5},
+		{"plausible again", received.UnixMilli() + 30, 1700000000.53},
+	}
+	for i, tt := range tests {
+		handleWebSocketMessage(frame(int64(101+i), tt.msgTimeMs), received.UnixNano())
+		book, _ := orderbooks.Get("BTC_USDT")
+		if !near(book.Update, tt.want) {
+			t.Errorf("%s: update time = %f, want %f", tt.name, book.Update, tt.want)
+		}
+	}
+
+	// Аномалия логируется один раз до возврата правдоподобного времени
+	out := logs.String()
+	if strings.Count(out, "has no server time")+strings.Count(out, "is off by") != 1 {
+		t.Errorf("log = %q, want one anomaly warning", out)
+	}
+	if !strings.Contains(out, "Server time for BTC_USDT is plausible again") {
+		t.Errorf("log = %q, want the recovery message", out)
+	}
+}
+
+func TestUpdateOrdersKeepsSidesSorted(t *testing.T) {
+	tests := []struct {
+		name    string
+		isBid   bool
+		batches [][]OrderBookItem
+		want    string
+	}{
+		// Сравнение по числу, а не по строке: "9.5" < "10" < "100"
+		{"asks ascend numerically", false, [][]OrderBookItem{
+			levels("100:1", "9.5:1"),
+			levels("10:2", "99.99:1"),
+			levels("9.5:3", "100:0", "1000:1"),
+		}, "9.5:3 10:2 99.99:1 1000:1"},
+		{"bids descend numerically", true, [][]OrderBookItem{
+			levels("9.5:1", "100:1"),
+			levels("10:2", "99.99:1"),
+			levels("100:0", "10:5", "0.5:1"),
+		}, "99.99:1 10:5 9.5:1 0.5:1"},
+		{"level removed and re-added", false, [][]OrderBookItem{
+			levels("101:1", "102:1"),
+			levels("101:0"),
+			levels("101:4"),
+		}, "101:4 102:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var book []OrderBookItem
+			for _, batch := range tt.batches {
+				book = UpdateOrders(book, batch, tt.isBid)
+			}
+			if got := levelSpecs(book); got != tt.want {
+				t.Errorf("levels = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateOrdersMatchesSortedReference(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, isBid := range []bool{false, true} {
+		var book []OrderBookItem
+		reference := make(map[string]int64)
+		for step := 0; step < 200; step++ {
+			var batch []OrderBookItem
+			for i := rng.Intn(5); i >= 0; i-- {
+				price := strconv.FormatFloat(float64(90+rng.Intn(40))/2, 'f', -1, 64)
+				size := int64(rng.Intn(4)) // 0 - удаление
+				batch = append(batch, OrderBookItem{P: price, S: decimal.NewFromInt(size)})
+				if size == 0 {
+					delete(reference, price)
+				} else {
+					reference[price] = size
+				}
+			}
+			book = UpdateOrders(book, batch, isBid)
+		}
+
+		want := make([]OrderBookItem, 0, len(reference))
+		for price, size := range reference {
+			want = append(want, OrderBookItem{P: price, S: decimal.NewFromInt(size)})
+		}
+		sorted := sortOrderBook(OrderBookResponse{Asks: want, Bids: want})
+		wantSide := sorted.Asks
+		if isBid {
+			wantSide = sorted.Bids
+		}
+		if got, want := levelSpecs(book), levelSpecs(wantSide); got != want {
+			t.Errorf("bid side %v:\n got %s\nwant %s", isBid, got, want)
+		}
+	}
+}
+
+func TestDiffBooks(t *testing.T) {
+	tests := []struct {
+		name               string
+		old, new           OrderBookResponse
+		wantAsks, wantBids string
+	}{
+		{"identical",
+			testBook(1, levels("101:1", "102:2"), levels("99:1")),
+			testBook(2, levels("101:1", "102:2"), levels("99:1")),
+			"", ""},
+		{"insert modify delete",
+			testBook(1, levels("101:1", "102:2", "103:3"), levels("99:1", "98:2")),
+			testBook(2, levels("101:5", "103:3", "104:1"), levels("98.5:7", "98:2")),
+			"101:5 104:1 102:0", "98.5:7 99:0"},
+		{"side emptied",
+			testBook(1, levels("101:1"), levels("99:1", "98:2")),
+			testBook(2, levels("101:1"), nil),
+			"", "99:0 98:0"},
+		{"from empty",
+			testBook(1, nil, nil),
+			testBook(2, levels("101:1"), levels("99:1")),
+			"101:1", "99:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffBooks(tt.old, tt.new)
+			if got := levelSpecs(diff.Asks); got != tt.wantAsks {
+				t.Errorf("ask changes = %s, want %s", got, tt.wantAsks)
+			}
+			if got := levelSpecs(diff.Bids); got != tt.wantBids {
+				t.Errorf("bid changes = %s, want %s", got, tt.wantBids)
+			}
+
+			// Применение разницы к old дает new
+			asks := UpdateOrders(cloneOrderBook(tt.old).Asks, diff.Asks, false)
+			bids := UpdateOrders(cloneOrderBook(tt.old).Bids, diff.Bids, true)
+			if got, want := levelSpecs(asks), levelSpecs(tt.new.Asks); got != want {
+				t.Errorf("applied asks = %s, want %s", got, want)
+			}
+			if got, want := levelSpecs(bids), levelSpecs(tt.new.Bids); got != want {
+				t.Errorf("applied bids = %s, want %s", got, want)
+			}
+		})
+	}
+}
+func TestExpiredReorderBufferResyncs(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = time.Second })
+	requested := captureSnapshotRequests(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	handleWebSocketMessage(updateMessage("BTC_USDT", 103, 104, nil, levels("99:2")), time.Now().UnixNano())
+
+	expireReorderBuffers(time.Now())
+	if len(*requested) != 0 {
+		t.Fatalf("resynced before the reorder window passed")
+	}
+	expireReorderBuffers(time.Now().Add(2 * time.Second))
+	if len(*requested) != 1 {
+		t.Fatalf("snapshot requests = %d, want 1", len(*requested))
+	}
+	if _, ok := orderbooks.Get("BTC_USDT"); ok {
+		t.Error("book kept after an unfilled gap")
+	}
+	if got := len(pendingUpdates["BTC_USDT"]); got != 1 {
+		t.Errorf("held update not moved to the snapshot buffer: %d buffered", got)
+	}
+}
+
+// Книга из depth уровней на сторону с шагом цены 0.5
+func benchmarkBook(id int64, depth int) OrderBookResponse {
+	asks := make([]OrderBookItem, depth)
+	bids := make([]OrderBookItem, depth)
+	for i := 0; i < depth; i++ {
+		asks[i] = OrderBookItem{P: strconv.FormatFloat(1000.5+float64(i)/2, 'f', 1, 64), S: decimal.NewFromInt(int64(i + 1))}
+		bids[i] = OrderBookItem{P: strconv.FormatFloat(1000-float64(i)/2, 'f', 1, 64), S: decimal.NewFromInt(int64(i + 1))}
+	}
+	return testBook(id, asks, bids)
+}
+
+// Применение обновления трех уровней (два изменяются, один добавляется) к книге
+// глубины 50: напрямую и с разбором кадра
+func BenchmarkApplyUpdate(b *testing.B) {
+	newTestTracker(b, nil)
+	captureLog(b).Reset()
+	LogLevel.Set(slog.LevelError)
+	asks, bids := levels("1001:7", "1030.25:3"), levels("995:2")
+	msg := updateMessage("BTC_USDT", 101, 101, asks, bids)
+
+	b.Run("apply", func(b *testing.B) {
+		applySnapshot("BTC_USDT", benchmarkBook(100, 50))
+		received := receivedUpdate{
+			update:     OrderBookUpdate{Contract: "BTC_USDT", U: 101, End: 101, Asks: asks, Bids: bids},
+			receivedNs: time.Now().UnixNano(),
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			lastUpdateIDs["BTC_USDT"] = 100
+			existing, _ := orderbooks.Get("BTC_USDT")
+			applyUpdate("BTC_USDT", existing, received)
+		}
+		b.StopTimer()
+		if book, _ := orderbooks.Get("BTC_USDT"); book.ID != 101 || len(book.Asks) != 51 {
+			b.Fatalf("book = %d with %d asks, want 101 with 51", book.ID, len(book.Asks))
+		}
+	})
+
+	b.Run("frame", func(b *testing.B) {
+		applySnapshot("BTC_USDT", benchmarkBook(100, 50))
+		receivedNs := time.Now().UnixNano()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			lastUpdateIDs["BTC_USDT"] = 100
+			handleWebSocketMessage(msg, receivedNs)
+		}
+		b.StopTimer()
+		if book, _ := orderbooks.Get("BTC_USDT"); book.ID != 101 {
+			b.Fatalf("book id = %d, want 101", book.ID)
+		}
+	})
+}
+
+func TestParseContractDepths(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]int
+		wantErr bool
+	}{
+		{"", map[string]int{}, false},
+		{"BTC_USDT=100, ETH_USDT=20", map[string]int{"BTC_USDT": 100, "ETH_USDT": 20}, false},
+		{"BTC_USDT=300", map[string]int{"BTC_USDT": 300}, false},
+		{"BTC_USDT", nil, true},
+		{"=100", nil, true},
+		{"BTC_USDT=deep", nil, true},
+		{"BTC_USDT=0", nil, true},
+		{"BTC_USDT=301", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseContractDepths(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("depths = %v, want %v", got, tt.want)
+			}
+			for contract, limit := range tt.want {
+				if got[contract] != limit {
+					t.Errorf("depths = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotRequestsUsePerContractDepth(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"}
+		cfg.SnapshotDepth = 50
+		cfg.ContractDepths = map[string]int{"BTC_USDT": 200}
+	})
+	limits := make(chan string, 2)
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		limits <- r.URL.Query().Get("contract") + "=" + r.URL.Query().Get("limit")
+		writeSnapshot(w, testBook(100, levels("101:1"), levels("99:1")))
+	})
+
+	for _, contract := range []string{"BTC_USDT", "ETH_USDT"} {
+		if _, err := getFreshSnapshot(context.Background(), contract); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := <-limits + " " + <-limits; got != "BTC_USDT=200 ETH_USDT=50" {
+		t.Errorf("requested limits = %s, want BTC_USDT=200 ETH_USDT=50", got)
+	}
+}
+
+func TestFormatOrderBook(t *testing.T) {
+	newTestTracker(t, nil)
+	tests := []struct {
+		name string
+		book OrderBookResponse
+		want string
+	}{
+		{"empty book", OrderBookResponse{Update: 1700000000.5}, "EMPTY BOOK BTC_USDT 2023-11-14T22:13:20.5Z\n"},
+		{"empty book without update time", OrderBookResponse{Current: 1700000000}, "EMPTY BOOK BTC_USDT 2023-11-14T22:13:20Z\n"},
+		{"asks only", testBook(1, levels("101:1"), nil),
+			"ASK 101.00000000 | 1.00000000\n------------------------\n"},
+		{"bids only", testBook(1, nil, levels("99.5:0.123456789")),
+			"------------------------\nBID 99.50000000 | 0.123456789\n"},
+		{"two-sided book", testBook(1, levels("101:1", "102:2"), levels("99:3")),
+			"ASK 102.00000000 | 2.00000000\nASK 101.00000000 | 1.00000000\n------------------------\nBID 99.00000000 | 3.00000000\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatOrderBook("BTC_USDT", tt.book); got != tt.want {
+				t.Errorf("formatted book:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsMaps(t *testing.T) {
+	tests := []struct {
+		name       string
+		book       OrderBookResponse
+		asks, bids map[string]string
+	}{
+		{"empty book", OrderBookResponse{}, map[string]string{}, map[string]string{}},
+		{"two-sided book", testBook(1, levels("101:1", "102.5:0.25", "103:7"), levels("99:3", "98.1:0.000001")),
+			map[string]string{"101": "1", "102.5": "0.25", "103": "7"},
+			map[string]string{"99": "3", "98.1": "0.000001"}},
+		// Порядок уровней не важен: map его не хранит
+		{"unsorted levels", testBook(1, levels("103:7", "101:1"), levels("98:2", "99:3")),
+			map[string]string{"101": "1", "103": "7"},
+			map[string]string{"98": "2", "99": "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bids, asks := tt.book.AsMaps()
+			for side, got := range map[string]map[string]decimal.Decimal{"asks": asks, "bids": bids} {
+				want := tt.asks
+				if side == "bids" {
+					want = tt.bids
+				}
+				if len(got) != len(want) {
+					t.Errorf("%s = %v, want %v", side, got, want)
+				}
+				for price, size := range want {
+					if s, ok := got[price]; !ok || !s.Equal(decimal.RequireFromString(size)) {
+						t.Errorf("%s[%s] = %v (present %v), want %s", side, price, s, ok, size)
+					}
+				}
+			}
+		})
+	}
+
+	// JSON формата map читается обратно в те же отображения
+	book := testBook(7, levels("101:1", "102:2"), levels("99:3"))
+	var decoded orderBookMaps
+	if err := json.Unmarshal([]byte(formatOrderBookMap("BTC_USDT", book)), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	bids, asks := book.AsMaps()
+	if decoded.Contract != "BTC_USDT" || decoded.ID != 7 || !reflect.DeepEqual(decoded.Bids, bids) || !reflect.DeepEqual(decoded.Asks, asks) {
+		t.Errorf("decoded map output = %+v", decoded)
+	}
+}
+
+func TestDumpAllRoundTrip(t *testing.T) {
+	newTestTracker(t, nil)
+	orderbooks.Set("BTC_USDT", testBook(100, levels("101:1", "102:2.5"), levels("99:1")))
+	orderbooks.Set("ETH_USDT", testBook(7, nil, levels("3000.25:4")))
+
+	before := time.Now().UnixMilli()
+	data, err := DumpAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump OrderBookDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.Time < before || dump.Time > time.Now().UnixMilli() {
+		t.Errorf("dump time = %d, want the time of the dump", dump.Time)
+	}
+	if len(dump.Orderbooks) != 2 {
+		t.Fatalf("dumped books = %d, want 2", len(dump.Orderbooks))
+	}
+	btc, eth := dump.Orderbooks["BTC_USDT"], dump.Orderbooks["ETH_USDT"]
+	if btc.ID != 100 || levelSpecs(btc.Asks) != "101:1 102:2.5" || levelSpecs(btc.Bids) != "99:1" {
+		t.Errorf("BTC_USDT = %d %s / %s", btc.ID, levelSpecs(btc.Asks), levelSpecs(btc.Bids))
+	}
+	if eth.ID != 7 || len(eth.Asks) != 0 || levelSpecs(eth.Bids) != "3000.25:4" {
+		t.Errorf("ETH_USDT = %d %s / %s", eth.ID, levelSpecs(eth.Asks), levelSpecs(eth.Bids))
+	}
+
+	rec := httptest.NewRecorder()
+	handleDump(rec, httptest.NewRequest(http.MethodGet, "/dump", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("/dump = %d %s, want 200 application/json", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rec = httptest.NewRecorder()
+	handleDump(rec, httptest.NewRequest(http.MethodPost, "/dump", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /dump = %d, want 405", rec.Code)
+	}
+}
+
+func TestParseOutputDepths(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"5", []int{5}, false},
+		{"5, 50", []int{5, 50}, false},
+		{"0", nil, true},
+		{"5,x", nil, true},
+		{"-1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseOutputDepths(tt.spec)
+			if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("depths = %v (%v), want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSaveJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		format   string
+		wantFile string
+	}{
+		{"json", "BTC_USDT.json"},
+		{"text", "BTC_USDT.txt"},
+	}
+	book := OrderBookResponse{
+		ID: 123456789, Current: 1700000000.123, Update: 1700000000.1, ReceivedNs: 1700000000123456789,
+		Asks: levels("102:2", "101.5:0.000001", "103:3"),
+		Bids: levels("98:2", "99.25:1", "97:3"),
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			dir := chdirTemp(t)
+			newTestTracker(t, func(cfg *Config) { cfg.OutputFormat = tt.format })
+			if err := saveOrderBook("BTC_USDT", book); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(filepath.Join(dir, "orderbooks"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != tt.wantFile {
+				t.Fatalf("saved files = %v, want only %s", entries, tt.wantFile)
+			}
+			if tt.format != "json" {
+				return
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "orderbooks", tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var saved OrderBookResponse
+			if err := json.Unmarshal(data, &saved); err != nil {
+				t.Fatal(err)
+			}
+			// Книга читается обратно целиком, уровни отсортированы
+			want := sortOrderBook(book)
+			if saved.ID != want.ID || saved.Current != want.Current || saved.Update != want.Update || saved.ReceivedNs != want.ReceivedNs ||
+				levelSpecs(saved.Asks) != levelSpecs(want.Asks) || levelSpecs(saved.Bids) != levelSpecs(want.Bids) {
+				t.Errorf("saved book = %+v, want %+v", saved, want)
+			}
+			if levelSpecs(saved.Asks) != "101.5:0.000001 102:2 103:3" || levelSpecs(saved.Bids) != "99.25:1 98:2 97:3" {
+				t.Errorf("saved levels = %s / %s, want sorted", levelSpecs(saved.Asks), levelSpecs(saved.Bids))
+			}
+		})
+	}
+}
+
+func TestSaveWritesFixedDepths(t *testing.T) {
+	dir := chdirTemp(t)
+	newTestTracker(t, func(cfg *Config) {
+		cfg.OutputFormat = "json"
+		cfg.OutputDepths = []int{1, 2}
+	})
+	// Уровни не отсортированы: срезы берут лучшие цены
+	book := testBook(100, levels("102:2", "101:1", "103:3"), levels("98:2", "99:1", "97:3"))
+	if err := saveOrderBook("BTC_USDT", book); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file     string
+		wantAsks string
+		wantBids string
+	}{
+		{"BTC_USDT.json", "101:1 102:2 103:3", "99:1 98:2 97:3"},
+		{"BTC_USDT.1.json", "101:1", "99:1"},
+		{"BTC_USDT.2.json", "101:1 102:2", "99:1 98:2"},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile(filepath.Join(dir, "orderbooks", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var saved OrderBookResponse
+		if err := json.Unmarshal(data, &saved); err != nil {
+			t.Fatal(err)
+		}
+		if levelSpecs(saved.Asks) != tt.wantAsks || levelSpecs(saved.Bids) != tt.wantBids {
+			t.Errorf("%s = %s / %s, want %s / %s", tt.file, levelSpecs(saved.Asks), levelSpecs(saved.Bids), tt.wantAsks, tt.wantBids)
+		}
+	}
+}
+
+// Приемник сохранений: число записанных книг по контрактам
+type saveCounter struct {
+	mu    sync.Mutex
+	saves map[string]int
+}
+
+func (c *saveCounter) writer(contract string) (io.WriteCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.saves == nil {
+		c.saves = make(map[string]int)
+	}
+	c.saves[contract]++
+	return nopWriteCloser{io.Discard}, nil
+}
+
+func (c *saveCounter) count(contract string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saves[contract]
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestSaveJitterDelaysFirstSave(t *testing.T) {
+	var saves saveCounter
+	newTestTracker(t, func(cfg *Config) {
+		cfg.SaverEnabled = true
+		cfg.Writer = saves.writer
+		cfg.SaveInterval = time.Millisecond
+		cfg.SaveJitter = time.Hour
+	})
+	orderbooks.Set("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		startOrderBookSaver(ctx)
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := saves.count("BTC_USDT"); n != 0 {
+		t.Fatalf("saved %d times during the jitter delay, want 0", n)
+	}
+
+	// Остановка во время задержки не ждет ее конца и сохраняет книги последний раз
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("saver did not stop during the jitter delay")
+	}
+	if n := saves.count("BTC_USDT"); n != 1 {
+		t.Errorf("saves after stop = %d, want the final save", n)
+	}
+}
+
+// WebSocket API на TLS httptest сервере: каждое соединение обрабатывает
+// handler, адрес сервера задается трекеру как WSHost
+func serveWS(t *testing.T, handler func(conn *websocket.Conn)) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handler(conn)
+	}))
+	t.Cleanup(server.Close)
+
+	prev := wsDialer
+	wsDialer.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	t.Cleanup(func() { wsDialer = prev })
+	return strings.Replace(server.URL, "https://", "wss://", 1)
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	c := ReconnectConfig{InitialBackoff: time.Second, MaxBackoff: 30 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{4, 16 * time.Second},
+		{5, 30 * time.Second},
+		{100, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := c.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	c.Jitter = 0.2
+	for i := 0; i < 100; i++ {
+		if got := c.backoff(3); got < 6400*time.Millisecond || got > 9600*time.Millisecond {
+			t.Fatalf("backoff(3) with 20%% jitter = %s, want 8s +/- 20%%", got)
+		}
+	}
+}
+
+func TestWebSocketReconnectsAndResubscribes(t *testing.T) {
+	var mu sync.Mutex
+	var connections []string // Contracts subscribed on each connection
+	host := serveWS(t, func(conn *websocket.Conn) {
+		var subscribed []string
+		for i := 0; i < 2; i++ {
+			var msg struct {
+				Payload []string `json:"payload"`
+			}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			subscribed = append(subscribed, msg.Payload[0])
+		}
+		mu.Lock()
+		connections = append(connections, strings.Join(subscribed, " "))
+		first := len(connections) == 1
+		mu.Unlock()
+		// Первое соединение обрывается сразу после подписки
+		if first {
+			return
+		}
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	newTestTracker(t, func(cfg *Config) {
+		cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"}
+		cfg.WSHost = host
+		cfg.Reconnect = ReconnectConfig{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	})
+	captureLog(t)
+	recordingSubscriptions(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan wsFrame, 16)
+	subscribed := make(chan struct{}, 1)
+	resyncs := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		connectWebSocket(ctx, connectionGroup{Settle: "usdt", Contracts: []string{"BTC_USDT", "ETH_USDT"}}, 1, messages, subscribed, resyncs)
+	}()
+
+	select {
+	case <-subscribed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first connection never subscribed")
+	}
+	// После переподключения книги запрашиваются заново
+	var resynced []string
+	for len(resynced) < 2 {
+		select {
+		case contract := <-resyncs:
+			resynced = append(resynced, contract)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("resyncs after reconnect = %v, want both contracts", resynced)
+		}
+	}
+	cancel()
+	<-done
+
+	if got := strings.Join(resynced, " "); got != "BTC_USDT ETH_USDT" {
+		t.Errorf("resynced = %s, want BTC_USDT ETH_USDT", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(connections) != 2 || connections[0] != "BTC_USDT ETH_USDT" || connections[1] != "BTC_USDT ETH_USDT" {
+		t.Errorf("subscriptions per connection = %q, want both contracts on two connections", connections)
+	}
+}
+
+func TestFlapDetector(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	d := flapDetector{window: time.Minute}
+	steps := []struct {
+		after time.Duration
+		want  int
+	}{
+		{0, 1},
+		{10 * time.Second, 2},
+		{30 * time.Second, 3},
+		// Разрыв в 0s вышел из окна
+		{61 * time.Second, 3},
+		{2 * time.Minute, 2},
+		{5 * time.Minute, 1},
+	}
+	for _, step := range steps {
+		if got := d.Record(start.Add(step.after)); got != step.want {
+			t.Errorf("drops at +%s = %d, want %d", step.after, got, step.want)
+		}
+	}
+
+	c := ReconnectConfig{FlapThreshold: 3}
+	for drops, want := range []int{0, 0, 0, 2, 4, 6} {
+		if got := c.flapPenalty(drops); got != want {
+			t.Errorf("flapPenalty(%d) = %d, want %d", drops, got, want)
+		}
+	}
+	if got := (ReconnectConfig{}).flapPenalty(100); got != 0 {
+		t.Errorf("flapPenalty with detection disabled = %d, want 0", got)
+	}
+}
+
+func TestFlappingConnectionBacksOffHarder(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	allDropped := make(chan struct{})
+	host := serveWS(t, func(conn *websocket.Conn) {
+		// Соединение обрывается сразу после подписки
+		conn.ReadMessage()
+		mu.Lock()
+		defer mu.Unlock()
+		if connections++; connections == 4 {
+			close(allDropped)
+		}
+	})
+	newTestTracker(t, func(cfg *Config) {
+		cfg.WSHost = host
+		cfg.Reconnect = ReconnectConfig{
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     time.Second,
+			FlapThreshold:  2,
+			FlapWindow:     time.Minute,
+		}
+	})
+	logs := captureLog(t)
+	recordingSubscriptions(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		connectWebSocket(ctx, connectionGroup{Settle: "usdt", Contracts: []string{"BTC_USDT"}}, 1,
+			make(chan wsFrame, 16), make(chan struct{}, 1), make(chan string, 16))
+	}()
+	select {
+	case <-allDropped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection did not flap four times")
+	}
+	cancel()
+	<-done
+
+	// Каждая подписка сбрасывает обычный отсчет, но частые разрывы
+	// учетверяют задержку: 1ms, затем 4ms, 16ms
+	out := logs.String()
+	for _, want := range []string{
+		"disconnected (read error: websocket: close 1006 (abnormal closure): unexpected EOF), reconnecting in 1ms",
+		"reconnecting in 4ms",
+		"reconnecting in 16ms",
+		"ERROR WebSocket feed 1 is unstable: 2 disconnects within 1m0s, backing off harder",
+		"ERROR WebSocket feed 1 is unstable: 3 disconnects within 1m0s",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log = %q, want %q", out, want)
+		}
+	}
+}
+
+func TestSettleEndpoints(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.Settle = "btc"
+		cfg.Contracts = []string{"BTC_USD", "usdt:BTC_USDT"}
+	})
+	tests := []struct {
+		contract string
+		wantWS   string
+		wantREST string
+	}{
+		{"BTC_USD", "wss://fx-ws.gateio.ws/v4/ws/btc",
+			"https://api.gateio.ws/api/v4/futures/btc/order_book?contract=BTC_USD&limit=20"},
+		{"BTC_USDT", "wss://fx-ws.gateio.ws/v4/ws/usdt",
+			"https://api.gateio.ws/api/v4/futures/usdt/order_book?contract=BTC_USDT&limit=20"},
+	}
+	for _, tt := range tests {
+		settle := contractSettle(tt.contract)
+		if got := wsURL(settle); got != tt.wantWS {
+			t.Errorf("WebSocket URL of %s = %s, want %s", tt.contract, got, tt.wantWS)
+		}
+		if got := orderBookEndpoint(settle, tt.contract, 20); got != tt.wantREST {
+			t.Errorf("REST endpoint of %s = %s, want %s", tt.contract, got, tt.wantREST)
+		}
+	}
+
+	// Снимок запрашивается по адресу валюты расчетов
+	var requested string
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		writeSnapshot(w, testBook(1, levels("101:1"), levels("99:1")))
+	})
+	if _, err := GetOrderBookSnapshot(context.Background(), "btc", "BTC_USD", 50); err != nil {
+		t.Fatal(err)
+	}
+	if requested != "/api/v4/futures/btc/order_book?contract=BTC_USD&limit=50" {
+		t.Errorf("snapshot request = %s", requested)
+	}
+}
+
+func TestParseWSHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{"fx-ws.gateio.ws", "wss://fx-ws.gateio.ws/v4/ws", false},
+		{"fx-ws-testnet.gateio.ws", "wss://fx-ws-testnet.gateio.ws/v4/ws", false},
+		{"wss://fx-ws.gateio.ws", "wss://fx-ws.gateio.ws/v4/ws", false},
+		{"wss://127.0.0.1:8443/", "wss://127.0.0.1:8443/v4/ws", false},
+		{"wss://proxy.example.com/gate/ws/", "wss://proxy.example.com/gate/ws", false},
+		{"ws://fx-ws.gateio.ws", "", true},
+		{"https://fx-ws.gateio.ws", "", true},
+		{"wss://", "", true},
+		{"wss://fx-ws.gateio.ws/v4/ws?token=1", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseWSHost(tt.host)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseWSHost(%q) = %q (%v), want %q (error %v)", tt.host, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.WSHost = "ws://fx-ws.gateio.ws"
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "scheme must be wss") {
+		t.Errorf("New with a ws:// host = %v", err)
+	}
+}
+
+func TestConfiguredWSHostUsed(t *testing.T) {
+	paths := make(chan string, 1)
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case paths <- r.URL.Path:
+		default:
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	prev := wsDialer
+	wsDialer.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	t.Cleanup(func() { wsDialer = prev })
+
+	newTestTracker(t, func(cfg *Config) {
+		cfg.WSHost = strings.Replace(server.URL, "https://", "wss://", 1) + "/region/ws"
+		cfg.Contracts = []string{"btc:BTC_USD"}
+	})
+	recordingSubscriptions(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		connectWebSocket(ctx, connectionGroup{Settle: "btc", Contracts: []string{"BTC_USD"}}, 1,
+			make(chan wsFrame, 16), make(chan struct{}, 1), make(chan string, 16))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	select {
+	case path := <-paths:
+		if path != "/region/ws/btc" {
+			t.Errorf("WebSocket path = %s, want /region/ws/btc", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tracker did not connect to the configured host")
+	}
+}
+
+func TestSnapshotRequestTimeout(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.HTTPTimeout = 50 * time.Millisecond })
+	release := make(chan struct{})
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		// Ответ зависает дольше таймаута клиента
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	start := time.Now()
+	_, err := GetOrderBookSnapshot(context.Background(), "usdt", "BTC_USDT", 20)
+	if err == nil || !strings.Contains(err.Error(), "Client.Timeout exceeded") {
+		t.Errorf("error = %v, want a client timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %s despite the 50ms timeout", elapsed)
+	}
+
+	// Отмена ctx прерывает запрос до таймаута
+	httpClient.Timeout = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := GetOrderBookSnapshot(ctx, "usdt", "BTC_USDT", 20); err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Errorf("error after cancelling ctx = %v", err)
+	}
+}
+
+func TestHTTPClientUserAgent(t *testing.T) {
+	newTestTracker(t, nil)
+	agents := make(chan string, 2)
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		agents <- r.Header.Get("User-Agent")
+		writeSnapshot(w, testBook(1, levels("101:1"), levels("99:1")))
+	})
+	// Тестовый сервер подменяет транспорт; User-Agent добавляется поверх него, как в рабочем клиенте
+	httpClient.Transport = userAgentTransport{base: httpClient.Transport}
+
+	if _, err := GetOrderBookSnapshot(context.Background(), "usdt", "BTC_USDT", 20); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-agents; got != userAgent {
+		t.Errorf("User-Agent = %q, want %q", got, userAgent)
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://api.gateio.ws/api/v4/futures/usdt/order_book", nil)
+	req.Header.Set("User-Agent", "custom/1.0")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := <-agents; got != "custom/1.0" {
+		t.Errorf("explicit User-Agent replaced with %q", got)
+	}
+
+	// Рабочий транспорт переиспользует keep-alive соединения
+	if httpTransport.DisableKeepAlives || httpTransport.MaxIdleConnsPerHost < 2 {
+		t.Errorf("transport keeps no idle connections: %+v", httpTransport)
+	}
+}
+
+// Буфер приемника сохранений: помнит, был ли закрыт
+type captureWriter struct {
+	buf      bytes.Buffer
+	closed   bool
+	writeErr error
+	closeErr error
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	if w.writeErr != nil {
+		return 0, w.writeErr
+	}
+	return w.buf.Write(p)
+}
+
+func (w *captureWriter) Close() error {
+	w.closed = true
+	return w.closeErr
+}
+
+func TestWriterFactoryCapturesOutput(t *testing.T) {
+	dir := chdirTemp(t)
+	written := make(map[string][]*captureWriter)
+	newTestTracker(t, func(cfg *Config) {
+		cfg.OutputDepths = []int{1}
+		cfg.Writer = func(contract string) (io.WriteCloser, error) {
+			w := &captureWriter{}
+			written[contract] = append(written[contract], w)
+			return w, nil
+		}
+	})
+	book := testBook(100, levels("101:1", "102:2"), levels("99:3"))
+	for i := 0; i < 2; i++ {
+		if err := saveOrderBook("BTC_USDT", book); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"BTC_USDT", formatOrderBook("BTC_USDT", book)},
+		{"BTC_USDT.1", formatOrderBook("BTC_USDT", truncateOrderBook(book, 1))},
+	}
+	for _, tt := range tests {
+		// Новый приемник на каждое сохранение, закрытый после записи
+		if len(written[tt.name]) != 2 {
+			t.Fatalf("writers for %s = %d, want 2", tt.name, len(written[tt.name]))
+		}
+		for _, w := range written[tt.name] {
+			if w.buf.String() != tt.want || !w.closed {
+				t.Errorf("%s received %q (closed %v), want %q", tt.name, w.buf.String(), w.closed, tt.want)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "orderbooks")); !os.IsNotExist(err) {
+		t.Errorf("orderbooks directory created with a custom writer: %v", err)
+	}
+}
+
+func TestWriterFactoryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		open    error
+		write   error
+		close   error
+		wantErr string
+	}{
+		{"open", errors.New("no space"), nil, nil, "failed to open writer for BTC_USDT: no space"},
+		{"write", nil, errors.New("broken pipe"), nil, "failed to write BTC_USDT: broken pipe"},
+		{"close", nil, nil, errors.New("flush failed"), "failed to close writer for BTC_USDT: flush failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w *captureWriter
+			newTestTracker(t, func(cfg *Config) {
+				cfg.Writer = func(contract string) (io.WriteCloser, error) {
+					if tt.open != nil {
+						return nil, tt.open
+					}
+					w = &captureWriter{writeErr: tt.write, closeErr: tt.close}
+					return w, nil
+				}
+			})
+			err := saveOrderBook("BTC_USDT", testBook(1, levels("101:1"), levels("99:1")))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+			// Приемник закрывается и при ошибке записи
+			if w != nil && !w.closed {
+				t.Error("writer left open")
+			}
+		})
+	}
+}
+
+func TestHandlerPanicRecovered(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.ReorderWindow = 0
+		cfg.Prometheus = true
+		cfg.HTTPAddr = "127.0.0.1:0"
+	})
+	t.Cleanup(func() { metrics, promMetrics = nopMetrics{}, nil })
+	logs := captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	// Проверка скачков без карты удерживаемых книг паникует на первом скачке
+	priceJumps = &jumpGuard{maxPct: 1, hold: true}
+
+	asks := make([]string, 100)
+	for i := range asks {
+		asks[i] = strconv.Itoa(200+i) + ":1"
+	}
+	bad := updateMessage("BTC_USDT", 101, 101, levels(asks...), levels("99:0", "50:1"))
+	if len(bad) <= panicMessagePreview {
+		t.Fatalf("message of %d bytes is not truncated", len(bad))
+	}
+	handleWebSocketMessageSafely(bad, time.Now().UnixNano())
+
+	out := logs.String()
+	if !strings.Contains(out, "ERROR Panic while handling WebSocket message: assignment to entry in nil map") ||
+		!strings.Contains(out, fmt.Sprintf("message (%d bytes): %s\n", len(bad), bad[:panicMessagePreview])) {
+		t.Errorf("log = %q, want the panic with a truncated message", out)
+	}
+	if !strings.Contains(out, "handleWebSocketMessage") {
+		t.Errorf("log has no stack trace: %q", out)
+	}
+	if !strings.Contains(scrapeMetrics(t), "gateorderbook_websocket_handler_panics_total 1\n") {
+		t.Error("panic not counted in metrics")
+	}
+
+	// Следующие сообщения обрабатываются; обновление с паникой не принято,
+	// поэтому следующее продолжает последовательность с того же id
+	priceJumps = nil
+	handleWebSocketMessageSafely(updateMessage("BTC_USDT", 101, 101, levels("101:5"), nil), time.Now().UnixNano())
+	if book, _ := orderbooks.Get("BTC_USDT"); book.ID != 101 || levelSpecs(book.Asks) != "101:5" || levelSpecs(book.Bids) != "99:1" {
+		t.Errorf("book after the panic = %d %s / %s, want 101 101:5 / 99:1", book.ID, levelSpecs(book.Asks), levelSpecs(book.Bids))
+	}
+}
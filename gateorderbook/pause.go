@@ -0,0 +1,44 @@
+package gateorderbook
+
+import "sync"
+
+// Контракты, для которых временно приостановлены сохранение и рассылка
+// обновлений; книга при этом продолжает обновляться в памяти
+type pauseSet struct {
+	mu     sync.Mutex
+	paused map[string]bool
+}
+
+func newPauseSet() *pauseSet {
+	return &pauseSet{paused: make(map[string]bool)}
+}
+
+var pausedContracts = newPauseSet()
+
+// Приостановка контракта; false, если он уже приостановлен
+func (p *pauseSet) Pause(contract string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused[contract] {
+		return false
+	}
+	p.paused[contract] = true
+	return true
+}
+
+// Возобновление контракта; false, если он не был приостановлен
+func (p *pauseSet) Resume(contract string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused[contract] {
+		return false
+	}
+	delete(p.paused, contract)
+	return true
+}
+
+func (p *pauseSet) Paused(contract string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused[contract]
+}
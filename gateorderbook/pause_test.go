@@ -0,0 +1,83 @@
+package gateorderbook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPausedContractNotSaved(t *testing.T) {
+	var saves saveCounter
+	tracker := newTestTracker(t, func(cfg *Config) {
+		cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"}
+		cfg.SaverEnabled = true
+		cfg.Writer = saves.writer
+	})
+	events := tracker.Updates()
+	t.Cleanup(func() { bookEvents = nil })
+	captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	applySnapshot("ETH_USDT", testBook(200, levels("3001:1"), levels("2999:1")))
+	handler := newHTTPHandler()
+	post := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		return rec.Code
+	}
+
+	if code := post("/pause/BTC_USDT"); code != http.StatusOK {
+		t.Fatalf("pause status = %d", code)
+	}
+	// Книга приостановленного контракта продолжает обновляться в памяти
+	for len(events) > 0 {
+		<-events
+	}
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, levels("101:5"), nil), time.Now().UnixNano())
+	if len(events) != 0 {
+		t.Errorf("events while paused = %d, want none", len(events))
+	}
+	saveOrderBooks(false, true)
+	if btc, eth := saves.count("BTC_USDT"), saves.count("ETH_USDT"); btc != 0 || eth != 1 {
+		t.Errorf("saves while paused = %d BTC_USDT, %d ETH_USDT, want 0 and 1", btc, eth)
+	}
+	if book, _ := orderbooks.Get("BTC_USDT"); levelSpecs(book.Asks) != "101:5" {
+		t.Errorf("paused book asks = %s, want the update applied", levelSpecs(book.Asks))
+	}
+
+	if code := post("/resume/BTC_USDT"); code != http.StatusOK {
+		t.Fatalf("resume status = %d", code)
+	}
+	saveOrderBooks(false, true)
+	if btc := saves.count("BTC_USDT"); btc != 1 {
+		t.Errorf("saves after resume = %d, want 1", btc)
+	}
+}
+
+func TestPauseEndpointErrors(t *testing.T) {
+	newTestTracker(t, nil)
+	orderbooks.Set("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	handler := newHTTPHandler()
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/pause/BTC_USDT", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/pause/SOL_USDT", http.StatusNotFound},
+		{http.MethodPost, "/resume/SOL_USDT", http.StatusNotFound},
+		// Повторная пауза и возобновление без паузы не ошибка
+		{http.MethodPost, "/resume/BTC_USDT", http.StatusOK},
+		{http.MethodPost, "/pause/BTC_USDT", http.StatusOK},
+		{http.MethodPost, "/pause/BTC_USDT", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+	if !pausedContracts.Paused("BTC_USDT") {
+		t.Error("BTC_USDT not paused")
+	}
+}
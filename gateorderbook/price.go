@@ -0,0 +1,74 @@
+package gateorderbook
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Цены уровней приходят десятичными строками ("65000.1", "0.000000123").
+// Порядок и совпадение уровней определяются точно по строкам цен,
+// float64 используется только в аналитике.
+
+// Целая часть без ведущих нулей и дробная без хвостовых; ok=false, если
+// цена не записана одними цифрами с необязательной точкой
+func splitPrice(p string) (integer, fraction string, ok bool) {
+	integer, fraction, _ = strings.Cut(p, ".")
+	if integer == "" && fraction == "" {
+		return "", "", false
+	}
+	for _, part := range [2]string{integer, fraction} {
+		for i := 0; i < len(part); i++ {
+			if part[i] < '0' || part[i] > '9' {
+				return "", "", false
+			}
+		}
+	}
+	return strings.TrimLeft(integer, "0"), strings.TrimRight(fraction, "0"), true
+}
+
+// Точное сравнение цен: -1, если a < b, 0, если равны ("1.50" и "1.5"), 1, если a > b.
+// Обычные десятичные строки сравниваются без выделения памяти, остальные
+// (экспонента, знак) - через decimal; неразбираемые цены - как строки.
+func comparePrices(a, b string) int {
+	if a == b {
+		return 0
+	}
+	ai, af, aok := splitPrice(a)
+	bi, bf, bok := splitPrice(b)
+	if !aok || !bok {
+		da, errA := decimal.NewFromString(a)
+		db, errB := decimal.NewFromString(b)
+		if errA != nil || errB != nil {
+			return strings.Compare(a, b)
+		}
+		return da.Cmp(db)
+	}
+	if len(ai) != len(bi) {
+		if len(ai) < len(bi) {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(ai, bi); c != 0 {
+		return c
+	}
+	// Дробные части без хвостовых нулей сравниваются посимвольно
+	return strings.Compare(af, bf)
+}
+
+// Разбирается ли строка как цена
+func validPrice(p string) bool {
+	if _, _, ok := splitPrice(p); ok {
+		return true
+	}
+	_, err := decimal.NewFromString(p)
+	return err == nil
+}
+
+// Цена уровня как float64 для аналитики; ok=false, если цена не разбирается
+func levelPrice(level OrderBookItem) (float64, bool) {
+	price, err := strconv.ParseFloat(level.P, 64)
+	return price, err == nil
+}
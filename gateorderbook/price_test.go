@@ -0,0 +1,87 @@
+package gateorderbook
+
+import "testing"
+
+func TestComparePrices(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.5", "1.50", 0},
+		{"01.5", "1.5", 0},
+		{"10", "9.99", 1},
+		{"9.99", "10", -1},
+		{"0.000000123", "0.00000012", 1},
+		{"0.000000123", "0.000000123", 0},
+		{"65000.1", "65000.09", 1},
+		{".5", "0.5", 0},
+		{"1e-7", "0.0000001", 0},
+		{"1e-7", "0.00000011", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := comparePrices(tt.a, tt.b); got != tt.want {
+				t.Errorf("comparePrices(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := comparePrices(tt.b, tt.a); got != -tt.want {
+				t.Errorf("comparePrices(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestValidPrice(t *testing.T) {
+	tests := []struct {
+		price string
+		want  bool
+	}{
+		{"65000.1", true},
+		{"0.000000123", true},
+		{"1e-7", true},
+		{"", false},
+		{".", false},
+		{"abc", false},
+		{"1.2.3", false},
+	}
+	for _, tt := range tests {
+		if got := validPrice(tt.price); got != tt.want {
+			t.Errorf("validPrice(%q) = %v, want %v", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateOrdersMatchesPricesExactly(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []OrderBookItem
+		updates  []OrderBookItem
+		isBid    bool
+		want     string
+	}{
+		{"trailing zero updates level", levels("1.5:1", "1.6:1"), levels("1.50:4"), false, "1.5:4 1.6:1"},
+		{"trailing zero removes level", levels("1.5:1", "1.6:1"), levels("1.50:0"), false, "1.6:1"},
+		{"tiny prices stay distinct", levels("0.00000012:1"), levels("0.000000123:2"), false, "0.00000012:1 0.000000123:2"},
+		{"tiny price round trip", levels("0.000000123:1", "0.00000012:1"), levels("0.000000123:0"), true, "0.00000012:1"},
+		{"bids descend", levels("99:1", "97:1"), levels("98:2", "100:3"), true, "100:3 99:1 98:2 97:1"},
+		{"invalid price skipped", levels("101:1"), levels("bad:1"), false, "101:1"},
+		{"remove missing level", levels("101:1"), levels("102:0"), false, "101:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := levelSpecs(UpdateOrders(tt.existing, tt.updates, tt.isBid)); got != tt.want {
+				t.Errorf("levels = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBestPricesSkipsInvalidLevels(t *testing.T) {
+	ob := testBook(1, levels("bad:1", "101.5:1", "101.25:1"), levels("99:1", "99.75:1", "x:1"))
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	if !hasBid || !hasAsk || bid != 99.75 || ask != 101.25 {
+		t.Errorf("best prices = %v/%v (%v %v), want 99.75/101.25", bid, ask, hasBid, hasAsk)
+	}
+	if _, _, hasBid, hasAsk := bestPrices(testBook(1, levels("bad:1"), nil)); hasBid || hasAsk {
+		t.Error("best prices reported for a book without valid levels")
+	}
+}
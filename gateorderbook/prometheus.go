@@ -0,0 +1,134 @@
+package gateorderbook
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Метрики Prometheus; отдаются встроенным HTTP сервером на /metrics.
+// Приемник переводит имена метрик трекера (orderbook.updates.<contract>)
+// в метрики с меткой contract; остальные имена не экспортируются.
+type prometheusSink struct {
+	registry     *prometheus.Registry
+	updates      *prometheus.CounterVec
+	resyncs      *prometheus.CounterVec
+	reconnects   prometheus.Counter
+	parseErrors  prometheus.Counter
+	panics       prometheus.Counter
+	depth        *prometheus.GaugeVec
+	spreadBps    *prometheus.GaugeVec
+	staleness    *prometheus.GaugeVec
+	nameToMetric map[string]func(contract string, value float64)
+}
+
+// Приемник Prometheus, если включен (nil - отключен)
+var promMetrics *prometheusSink
+
+func newPrometheusSink() *prometheusSink {
+	s := &prometheusSink{
+		registry: prometheus.NewRegistry(),
+		updates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateorderbook_updates_applied_total",
+			Help: "WebSocket updates applied to the book.",
+		}, []string{"contract"}),
+		resyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateorderbook_resyncs_total",
+			Help: "Book resyncs from a REST snapshot after a sequence gap or a failed check.",
+		}, []string{"contract"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gateorderbook_websocket_reconnects_total",
+			Help: "WebSocket reconnect attempts.",
+		}),
+		parseErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gateorderbook_websocket_parse_errors_total",
+			Help: "WebSocket messages that could not be decoded.",
+		}),
+		panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "gateorderbook_websocket_handler_panics_total",
+			Help: "Panics recovered while handling a WebSocket message.",
+		}),
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gateorderbook_book_depth_levels",
+			Help: "Price levels currently in the book.",
+		}, []string{"contract", "side"}),
+		spreadBps: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gateorderbook_spread_bps",
+			Help: "Best ask minus best bid in basis points of mid.",
+		}, []string{"contract"}),
+		staleness: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gateorderbook_staleness_seconds",
+			Help: "Time since the last update or snapshot of the book (with stale book detection enabled).",
+		}, []string{"contract"}),
+	}
+	s.registry.MustRegister(s.updates, s.resyncs, s.reconnects, s.parseErrors, s.panics, s.depth, s.spreadBps, s.staleness)
+	s.registry.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+
+	s.nameToMetric = map[string]func(contract string, value float64){
+		"orderbook.updates.":    func(contract string, v float64) { s.updates.WithLabelValues(contract).Add(v) },
+		"orderbook.resyncs.":    func(contract string, v float64) { s.resyncs.WithLabelValues(contract).Add(v) },
+		"orderbook.asks.":       func(contract string, v float64) { s.depth.WithLabelValues(contract, "ask").Set(v) },
+		"orderbook.bids.":       func(contract string, v float64) { s.depth.WithLabelValues(contract, "bid").Set(v) },
+		"orderbook.spread_bps.": func(contract string, v float64) { s.spreadBps.WithLabelValues(contract).Set(v) },
+		"orderbook.staleness_seconds.": func(contract string, v float64) {
+			s.staleness.WithLabelValues(contract).Set(v)
+		},
+	}
+	return s
+}
+
+// Метрика по имени вида <префикс><contract>
+func (s *prometheusSink) record(name string, value float64) {
+	switch name {
+	case "websocket.reconnects":
+		s.reconnects.Add(value)
+		return
+	case "websocket.parse_errors":
+		s.parseErrors.Add(value)
+		return
+	case "websocket.handler_panics":
+		s.panics.Add(value)
+		return
+	}
+	// Имена контрактов не содержат точек: контракт - последний сегмент имени
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return
+	}
+	if set, ok := s.nameToMetric[name[:dot+1]]; ok {
+		set(name[dot+1:], value)
+	}
+}
+
+func (s *prometheusSink) Count(name string, value int64)   { s.record(name, float64(value)) }
+func (s *prometheusSink) Gauge(name string, value float64) { s.record(name, value) }
+func (s *prometheusSink) Timing(string, time.Duration)     {}
+
+// Обработчик /metrics в формате Prometheus
+func (s *prometheusSink) Handler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+}
+
+// Отправка метрик в несколько приемников
+type multiMetrics []metricsSink
+
+func (m multiMetrics) Count(name string, value int64) {
+	for _, sink := range m {
+		sink.Count(name, value)
+	}
+}
+
+func (m multiMetrics) Gauge(name string, value float64) {
+	for _, sink := range m {
+		sink.Gauge(name, value)
+	}
+}
+
+func (m multiMetrics) Timing(name string, value time.Duration) {
+	for _, sink := range m {
+		sink.Timing(name, value)
+	}
+}
@@ -0,0 +1,110 @@
+package gateorderbook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Ответ /metrics встроенного HTTP сервера
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	newHTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("/metrics status = %d: %s", rec.Code, rec.Body)
+	}
+	return rec.Body.String()
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.Prometheus = true
+		cfg.HTTPAddr = "127.0.0.1:0"
+	})
+	t.Cleanup(func() { metrics, promMetrics = nopMetrics{}, nil })
+	captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	before := scrapeMetrics(t)
+	if strings.Contains(before, `gateorderbook_updates_applied_total{contract="BTC_USDT"}`) {
+		t.Errorf("updates counted before any update:\n%s", before)
+	}
+
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, levels("102:1"), nil), time.Now().UnixNano())
+	handleWebSocketMessage(updateMessage("BTC_USDT", 102, 102, nil, levels("98:1", "97:1")), time.Now().UnixNano())
+	handleWebSocketMessage([]byte(`{"channel":`), time.Now().UnixNano())
+
+	after := scrapeMetrics(t)
+	for _, want := range []string{
+		`gateorderbook_updates_applied_total{contract="BTC_USDT"} 2`,
+		`gateorderbook_book_depth_levels{contract="BTC_USDT",side="ask"} 2`,
+		`gateorderbook_book_depth_levels{contract="BTC_USDT",side="bid"} 3`,
+		`gateorderbook_spread_bps{contract="BTC_USDT"} 200`,
+		`gateorderbook_websocket_parse_errors_total 1`,
+		`go_goroutines `,
+	} {
+		if !strings.Contains(after, want) {
+			t.Errorf("/metrics has no %q:\n%s", want, after)
+		}
+	}
+}
+
+func TestPrometheusCountsReconnects(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	reconnected := make(chan struct{})
+	host := serveWS(t, func(conn *websocket.Conn) {
+		conn.ReadMessage()
+		mu.Lock()
+		defer mu.Unlock()
+		if connections++; connections == 3 {
+			close(reconnected)
+		}
+	})
+	newTestTracker(t, func(cfg *Config) {
+		cfg.WSHost = host
+		cfg.Prometheus = true
+		cfg.HTTPAddr = "127.0.0.1:0"
+		cfg.Reconnect = ReconnectConfig{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	})
+	t.Cleanup(func() { metrics, promMetrics = nopMetrics{}, nil })
+	captureLog(t)
+	recordingSubscriptions(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		connectWebSocket(ctx, connectionGroup{Settle: "usdt", Contracts: []string{"BTC_USDT"}}, 1,
+			make(chan wsFrame, 16), make(chan struct{}, 1), make(chan string, 16))
+	}()
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("feed did not reconnect")
+	}
+	cancel()
+	<-done
+
+	// Два разрыва до третьего соединения; третье может успеть оборваться до отмены
+	out := scrapeMetrics(t)
+	if !strings.Contains(out, "gateorderbook_websocket_reconnects_total 2\n") &&
+		!strings.Contains(out, "gateorderbook_websocket_reconnects_total 3\n") {
+		t.Errorf("/metrics has no 2 or 3 reconnects:\n%s", out)
+	}
+}
+
+func TestPrometheusNeedsHTTPAddr(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Prometheus = true
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "set an HTTP address") {
+		t.Errorf("New with Prometheus and no HTTP address = %v", err)
+	}
+}
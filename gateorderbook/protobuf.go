@@ -0,0 +1,146 @@
+package gateorderbook
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"gateio-perpetual-futures-orderbooks-golang/gateorderbook/pb"
+)
+
+// Уровни в виде protobuf сообщений
+func protoLevels(levels []OrderBookItem) []*pb.Level {
+	out := make([]*pb.Level, len(levels))
+	for i, level := range levels {
+		out[i] = &pb.Level{Price: level.P, Size: level.S.String()}
+	}
+	return out
+}
+
+// Уровни из protobuf сообщений
+func fromProtoLevels(levels []*pb.Level) ([]OrderBookItem, error) {
+	out := make([]OrderBookItem, len(levels))
+	for i, level := range levels {
+		size, err := decimal.NewFromString(level.GetSize())
+		if err != nil {
+			return nil, fmt.Errorf("invalid size %q at price %s: %v", level.GetSize(), level.GetPrice(), err)
+		}
+		out[i] = OrderBookItem{P: level.GetPrice(), S: size}
+	}
+	return out, nil
+}
+
+// Ордербук как protobuf сообщение Snapshot
+func snapshotMessage(symbol string, orderbook OrderBookResponse) *pb.Message {
+	return &pb.Message{Body: &pb.Message_Snapshot{Snapshot: &pb.Snapshot{
+		Contract:   symbol,
+		Id:         orderbook.ID,
+		TimeMs:     int64(orderbook.Update * 1000),
+		ReceivedMs: orderbook.ReceivedNs / int64(time.Millisecond),
+		Asks:       protoLevels(orderbook.Asks),
+		Bids:       protoLevels(orderbook.Bids),
+	}}}
+}
+
+// Строка журнала изменений как protobuf сообщение Snapshot, Update или Gap
+func changeLogMessage(entry changeLogEntry) *pb.Message {
+	if entry.Gap > 0 {
+		return &pb.Message{Body: &pb.Message_Gap{Gap: &pb.Gap{
+			Contract:   entry.Contract,
+			ReceivedMs: entry.Ts,
+			Dropped:    entry.Gap,
+		}}}
+	}
+	if entry.Snapshot {
+		return &pb.Message{Body: &pb.Message_Snapshot{Snapshot: &pb.Snapshot{
+			Contract:   entry.Contract,
+			Id:         entry.End,
+			TimeMs:     entry.TimeMs,
+			ReceivedMs: entry.Ts,
+			Asks:       protoLevels(entry.Asks),
+			Bids:       protoLevels(entry.Bids),
+		}}}
+	}
+	return &pb.Message{Body: &pb.Message_Update{Update: &pb.Update{
+		Contract:   entry.Contract,
+		FirstId:    entry.U,
+		LastId:     entry.End,
+		TimeMs:     entry.TimeMs,
+		ReceivedMs: entry.Ts,
+		Asks:       protoLevels(entry.Asks),
+		Bids:       protoLevels(entry.Bids),
+	}}}
+}
+
+// Строка журнала изменений из protobuf сообщения
+func changeLogEntryFromMessage(msg *pb.Message) (changeLogEntry, error) {
+	var entry changeLogEntry
+	var asks, bids []*pb.Level
+	switch body := msg.GetBody().(type) {
+	case *pb.Message_Snapshot:
+		s := body.Snapshot
+		entry = changeLogEntry{Ts: s.GetReceivedMs(), TimeMs: s.GetTimeMs(), Contract: s.GetContract(), Snapshot: true, End: s.GetId()}
+		asks, bids = s.GetAsks(), s.GetBids()
+	case *pb.Message_Update:
+		u := body.Update
+		entry = changeLogEntry{Ts: u.GetReceivedMs(), TimeMs: u.GetTimeMs(), Contract: u.GetContract(), U: u.GetFirstId(), End: u.GetLastId()}
+		asks, bids = u.GetAsks(), u.GetBids()
+	case *pb.Message_Gap:
+		g := body.Gap
+		return changeLogEntry{Ts: g.GetReceivedMs(), Contract: g.GetContract(), Gap: g.GetDropped()}, nil
+	default:
+		return entry, fmt.Errorf("message has neither a snapshot, an update nor a gap")
+	}
+	var err error
+	if entry.Asks, err = fromProtoLevels(asks); err != nil {
+		return entry, err
+	}
+	if entry.Bids, err = fromProtoLevels(bids); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// Сообщение с префиксом длины (varint), как в parseDelimitedFrom
+func marshalDelimited(msg *pb.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := protodelim.MarshalTo(&buf, msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Форматирование ордербука в protobuf: одно сообщение Snapshot с префиксом длины
+func formatOrderBookProtobuf(symbol string, orderbook OrderBookResponse) string {
+	data, err := marshalDelimited(snapshotMessage(symbol, sortOrderBook(orderbook)))
+	if err != nil {
+		errorf("Failed to encode orderbook for %s: %v", symbol, err)
+		return ""
+	}
+	return string(data)
+}
+
+// Чтение потока сообщений с префиксами длины; fn вызывается на каждое
+// сообщение, пока не вернет ошибку
+func readDelimited(r io.Reader, fn func(msg *pb.Message) error) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	opts := protodelim.UnmarshalOptions{MaxSize: maxReplayLine}
+	for n := 1; ; n++ {
+		msg := &pb.Message{}
+		if err := opts.UnmarshalFrom(br, msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("message %d: %v", n, err)
+		}
+		if err := fn(msg); err != nil {
+			return fmt.Errorf("message %d: %w", n, err)
+		}
+	}
+}
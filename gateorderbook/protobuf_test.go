@@ -0,0 +1,95 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gateio-perpetual-futures-orderbooks-golang/gateorderbook/pb"
+)
+
+// Строка журнала в виде для сравнения
+func entrySpec(e changeLogEntry) string {
+	return strings.Join([]string{e.Contract, levelSpecs(e.Asks), levelSpecs(e.Bids)}, " / ")
+}
+
+func TestProtobufStreamRoundTrip(t *testing.T) {
+	entries := []changeLogEntry{
+		{Ts: 1700000000100, TimeMs: 1700000000090, Contract: "BTC_USDT", Snapshot: true, End: 100,
+			Asks: levels("101:1", "102:2"), Bids: levels("99:3")},
+		{Ts: 1700000000200, TimeMs: 1700000000190, Contract: "BTC_USDT", U: 101, End: 103,
+			Asks: levels("101:0", "101.5:0.000001"), Bids: levels("99:4.25")},
+		{Ts: 1700000000300, Contract: "BTC_USDT", Gap: 7},
+		{Ts: 1700000000400, TimeMs: 1700000000390, Contract: "ETH_USDT", U: 5, End: 5},
+	}
+	var stream bytes.Buffer
+	for _, entry := range entries {
+		data, err := marshalDelimited(changeLogMessage(entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Write(data)
+	}
+
+	var decoded []changeLogEntry
+	err := readDelimited(&stream, func(msg *pb.Message) error {
+		entry, err := changeLogEntryFromMessage(msg)
+		decoded = append(decoded, entry)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(entries) {
+		t.Fatalf("decoded %d messages, want %d", len(decoded), len(entries))
+	}
+	for i, want := range entries {
+		got := decoded[i]
+		if got.Ts != want.Ts || got.TimeMs != want.TimeMs || got.Snapshot != want.Snapshot || got.Gap != want.Gap ||
+			got.U != want.U || got.End != want.End || entrySpec(got) != entrySpec(want) {
+			t.Errorf("message %d = %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestFormatOrderBookProtobuf(t *testing.T) {
+	book := testBook(100, levels("102:2", "101:1"), levels("98:2", "99:1"))
+	book.Update = 1700000000.25
+	book.ReceivedNs = 1700000000300000000
+
+	var snapshots []*pb.Snapshot
+	err := readDelimited(strings.NewReader(formatOrderBookProtobuf("BTC_USDT", book)), func(msg *pb.Message) error {
+		snapshots = append(snapshots, msg.GetSnapshot())
+		return nil
+	})
+	if err != nil || len(snapshots) != 1 || snapshots[0] == nil {
+		t.Fatalf("decoded %v (%v), want one snapshot", snapshots, err)
+	}
+	s := snapshots[0]
+	asks, _ := fromProtoLevels(s.GetAsks())
+	bids, _ := fromProtoLevels(s.GetBids())
+	// Уровни сохраняются отсортированными
+	if s.GetContract() != "BTC_USDT" || s.GetId() != 100 || s.GetTimeMs() != 1700000000250 || s.GetReceivedMs() != 1700000000300 ||
+		levelSpecs(asks) != "101:1 102:2" || levelSpecs(bids) != "99:1 98:2" {
+		t.Errorf("snapshot = %v", s)
+	}
+}
+
+func TestProtobufStreamErrors(t *testing.T) {
+	data, err := marshalDelimited(changeLogMessage(changeLogEntry{Contract: "BTC_USDT", U: 1, End: 1, Asks: levels("101:1")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = readDelimited(bytes.NewReader(data[:len(data)-2]), func(*pb.Message) error { return nil })
+	if err == nil || !strings.HasPrefix(err.Error(), "message 1:") {
+		t.Errorf("truncated stream error = %v", err)
+	}
+
+	msg := &pb.Message{Body: &pb.Message_Update{Update: &pb.Update{Contract: "BTC_USDT", Asks: []*pb.Level{{Price: "101", Size: "lots"}}}}}
+	if _, err := changeLogEntryFromMessage(msg); err == nil || !strings.Contains(err.Error(), `invalid size "lots" at price 101`) {
+		t.Errorf("invalid size error = %v", err)
+	}
+	if _, err := changeLogEntryFromMessage(&pb.Message{}); err == nil {
+		t.Error("empty message accepted")
+	}
+}
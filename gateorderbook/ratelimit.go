@@ -0,0 +1,60 @@
+package gateorderbook
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Сколько раз повторяется REST запрос, отклоненный лимитом запросов (429)
+var rateLimitRetries = 3
+
+// Начальная пауза перед повтором, если сервер не прислал Retry-After;
+// удваивается с каждой попыткой
+var rateLimitBackoff = time.Second
+
+// Верхняя граница паузы из Retry-After
+const maxRetryAfter = time.Minute
+
+// Пауза перед повтором запроса по заголовку Retry-After (секунды или
+// HTTP дата); без заголовка - экспоненциальная пауза по номеру попытки
+func retryAfterDelay(header http.Header, attempt int, now time.Time) time.Duration {
+	delay := rateLimitBackoff << uint(attempt)
+	if value := strings.TrimSpace(header.Get("Retry-After")); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			delay = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			delay = at.Sub(now)
+			if delay < 0 {
+				delay = 0
+			}
+		}
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay
+}
+
+// GET запрос с повтором ответов 429: ответ с другим статусом или
+// последний 429 после rateLimitRetries повторов возвращается как есть
+func httpGetRateLimited(ctx context.Context, url string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := httpGet(ctx, url)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= rateLimitRetries {
+			return resp, err
+		}
+		delay := retryAfterDelay(resp.Header, attempt, time.Now())
+		resp.Body.Close()
+
+		metrics.Count("rest.rate_limited", 1)
+		warnf("rate limited by %s, retrying in %s (%d/%d)", url, delay, attempt+1, rateLimitRetries)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package gateorderbook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Перенаправление REST запросов на тестовый сервер
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return t.base.RoundTrip(req)
+}
+
+// REST API на httptest сервере: запросы клиента идут к handler;
+// возвращается счетчик запросов
+func serveREST(t testing.TB, handler http.HandlerFunc) *atomic.Int32 {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	target, _ := url.Parse(server.URL)
+	prev := httpClient.Transport
+	httpClient.Transport = redirectTransport{target: target, base: http.DefaultTransport}
+	t.Cleanup(func() { httpClient.Transport = prev })
+	return &requests
+}
+
+// Ответ со снимком книги
+func writeSnapshot(w http.ResponseWriter, book OrderBookResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"seconds", "3", 0, 3 * time.Second},
+		{"zero seconds", "0", 2, 0},
+		{"http date", now.Add(5 * time.Second).Format(http.TimeFormat), 0, 5 * time.Second},
+		{"http date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0, 0},
+		{"capped", "3600", 0, maxRetryAfter},
+		{"no header, first attempt", "", 0, time.Second},
+		{"no header, third attempt", "", 2, 4 * time.Second},
+		{"no header, capped", "", 10, maxRetryAfter},
+		{"unparsable header", "soon", 1, 2 * time.Second},
+		{"negative seconds", "-5", 0, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			if got := retryAfterDelay(header, tt.attempt, now); got != tt.want {
+				t.Errorf("delay = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitedSnapshotRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		limited      int32
+		retries      int
+		wantRequests int32
+		wantStatus   int
+	}{
+		{"succeeds after 429s", 2, 3, 3, 0},
+		{"gives up after the retries", 5, 1, 2, http.StatusTooManyRequests},
+		{"no retries", 1, 0, 1, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.RateLimitRetries = tt.retries })
+			logs := captureLog(t)
+			var served atomic.Int32
+			requests := serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+				if served.Add(1) <= tt.limited {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, `{"label":"TOO_MANY_REQUESTS"}`, http.StatusTooManyRequests)
+					return
+				}
+				writeSnapshot(w, testBook(100, levels("101:1"), levels("99:1")))
+			})
+
+			book, err := GetOrderBookSnapshot(context.Background(), "usdt", "BTC_USDT", 50)
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if tt.wantStatus == 0 {
+				if err != nil || book.ID != 100 {
+					t.Fatalf("snapshot = %d (%v), want book 100", book.ID, err)
+				}
+				if !strings.Contains(logs.String(), "Warning: rate limited by ") {
+					t.Errorf("log = %q, want a rate limit warning", logs)
+				}
+				return
+			}
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("error = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
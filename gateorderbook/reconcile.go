@@ -0,0 +1,273 @@
+package gateorderbook
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Максимальное число обновлений, буферизуемых на контракт до получения снимка
+var maxBufferedUpdates = 1000
+
+// Сколько раз подряд перезапрашивается снимок, отстающий от буфера обновлений
+const maxStaleSnapshots = 3
+
+// Обработка снимка с нулевым или отсутствующим id: anchor - книга
+// принимается, началом последовательности становится первое обновление;
+// refetch - снимок перезапрашивается (до maxStaleSnapshots раз), затем anchor
+var zeroSnapshotID = "anchor"
+
+// Проверка политики обработки снимка без id
+func validateZeroSnapshotID(policy string) error {
+	if policy != "anchor" && policy != "refetch" {
+		return fmt.Errorf("unsupported zero snapshot id policy %q, allowed: anchor, refetch", policy)
+	}
+	return nil
+}
+
+// REST снимок ордербука контракта
+type contractSnapshot struct {
+	contract  string
+	orderbook OrderBookResponse
+}
+
+// Обновления, ожидающие REST снимка, по контрактам
+var pendingUpdates = make(map[string][]receivedUpdate)
+
+// Контракты, для которых запрошен снимок после разрыва последовательности
+var resyncing = make(map[string]bool)
+
+// Число отброшенных подряд устаревших снимков по контрактам
+var staleSnapshots = make(map[string]int)
+
+// Максимальный возраст снимка по его полю current относительно локальных
+// часов (0 - не проверяется); более старый снимок, скорее всего, отдан
+// из кэша CDN и перезапрашивается
+var maxSnapshotAge time.Duration
+
+// Сколько раз перезапрашивается устаревший по current снимок
+const snapshotFreshnessRetries = 2
+
+// Пауза перед повторным запросом устаревшего снимка
+const staleSnapshotRetryDelay = 500 * time.Millisecond
+
+// Возраст снимка по времени генерации current (секунды unix)
+func snapshotAge(orderbook OrderBookResponse, now time.Time) time.Duration {
+	generated := time.Unix(0, int64(orderbook.Current*1e9))
+	return now.Sub(generated)
+}
+
+// REST снимок контракта с проверкой свежести: устаревший снимок
+// перезапрашивается; если свежий так и не получен, используется последний
+func getFreshSnapshot(ctx context.Context, contract string) (OrderBookResponse, error) {
+	for attempt := 0; ; attempt++ {
+		orderbook, err := getOrderBookSnapshotWithRetry(ctx, contractSettle(contract), contract, snapshotLimit(contract),
+			snapshotAttempts, snapshotRetryBackoff)
+		if err != nil || maxSnapshotAge <= 0 || orderbook.Current == 0 {
+			return orderbook, err
+		}
+		age := snapshotAge(orderbook, time.Now())
+		if age <= maxSnapshotAge {
+			return orderbook, nil
+		}
+
+		metrics.Count("orderbook.stale_snapshot_time."+contract, 1)
+		if attempt >= snapshotFreshnessRetries {
+			warnf("snapshot for %s is %s old (current=%.3f), using it anyway", contract, age.Round(time.Millisecond), orderbook.Current)
+			return orderbook, nil
+		}
+		warnf("snapshot for %s is %s old (current=%.3f), retrying", contract, age.Round(time.Millisecond), orderbook.Current)
+		select {
+		case <-time.After(staleSnapshotRetryDelay):
+		case <-ctx.Done():
+			return orderbook, ctx.Err()
+		}
+	}
+}
+
+// Асинхронный запрос REST снимка контракта; задается в runWebSocketFeeds
+var requestSnapshot = func(contract string) {
+	warnf("cannot request snapshot for %s: feeds are not running", contract)
+}
+
+// Получение REST снимка контракта с передачей в канал snapshots
+// (снимок отбрасывается, если ctx отменен)
+func fetchSnapshot(ctx context.Context, contract string, snapshots chan<- contractSnapshot) bool {
+	orderbook, err := getFreshSnapshot(ctx, contract)
+	if err != nil {
+		errorf("Failed to get orderbook snapshot for %s: %v", contract, err)
+		return false
+	}
+	orderbook.ReceivedNs = time.Now().UnixNano()
+	select {
+	case snapshots <- contractSnapshot{contract: contract, orderbook: orderbook}:
+	case <-ctx.Done():
+	}
+	return true
+}
+
+// Получение начальных снимков ордербуков пулом processWorkers; снимки
+// передаются в канал snapshots
+func seedOrderBooks(ctx context.Context, contracts []string, snapshots chan<- contractSnapshot) {
+	processWorkers.Run(len(contracts), func(i int) {
+		contract := contracts[i]
+		if ctx.Err() != nil {
+			return
+		}
+		orderbook, err := getFreshSnapshot(ctx, contract)
+		if err != nil {
+			errorf("Failed to get initial orderbook for %s: %v", contract, err)
+			return
+		}
+		orderbook.ReceivedNs = time.Now().UnixNano()
+		select {
+		case snapshots <- contractSnapshot{contract: contract, orderbook: orderbook}:
+		case <-ctx.Done():
+			return
+		}
+		infof("Initial orderbook snapshot received for %s", contract)
+		// Сохраняем начальный снимок
+		if saverEnabled {
+			err = saveOrderBook(contract, orderbook)
+			if err != nil {
+				errorf("Failed to save initial orderbook for %s: %v", contract, err)
+			}
+		}
+	})
+}
+
+// Буферизация обновления для контракта без снимка. Уровни копируются:
+// обновление может ссылаться на переиспользуемый буфер декодирования.
+func bufferUpdate(contract string, received receivedUpdate) {
+	received.update.Asks = append([]OrderBookItem(nil), received.update.Asks...)
+	received.update.Bids = append([]OrderBookItem(nil), received.update.Bids...)
+
+	buffered := pendingUpdates[contract]
+	if len(buffered) >= maxBufferedUpdates {
+		warnf("update buffer for %s is full, dropping oldest update", contract)
+		metrics.Count("orderbook.buffer_dropped."+contract, 1)
+		buffered = buffered[len(buffered)-maxBufferedUpdates+1:]
+	}
+	pendingUpdates[contract] = append(buffered, received)
+	debugf("Buffered update %d-%d for %s until snapshot arrives", received.update.U, received.update.End, contract)
+}
+
+// Пересинхронизация: книга отбрасывается, новые обновления буферизуются
+// до получения свежего снимка
+func resync(contract, reason string) {
+	infof("Resyncing %s from snapshot: %s", contract, reason)
+	metrics.Count("orderbook.resyncs."+contract, 1)
+	resyncCounts.Record(contract, time.Now())
+
+	orderbooks.Delete(contract)
+	delete(lastUpdateIDs, contract)
+	flushReorderBuffer(contract)
+	// TCP подписчики не должны применять дельты к разошедшейся книге
+	if tcpStream != nil {
+		tcpStream.Resync(contract)
+	}
+	if !resyncing[contract] {
+		resyncing[contract] = true
+		requestSnapshot(contract)
+	}
+}
+
+// Изменения обновления уже есть в снимке: u <= id, а у снимка без id -
+// обновление отправлено не позже генерации снимка (current), либо, без
+// времени сервера, получено до снимка
+func coveredBySnapshot(received receivedUpdate, orderbook OrderBookResponse) bool {
+	if orderbook.ID != 0 {
+		return received.update.End != 0 && received.update.End <= orderbook.ID
+	}
+	if orderbook.Current > 0 && received.msgTimeMs > 0 {
+		return received.msgTimeMs <= int64(orderbook.Current*1000)
+	}
+	return received.receivedNs <= orderbook.ReceivedNs
+}
+
+// Установка REST снимка и применение буферизованных обновлений:
+// обновления, целиком предшествующие снимку (см. coveredBySnapshot),
+// отбрасываются, остальные применяются по порядку. Если первое оставшееся обновление
+// начинается позже id+1, снимок устарел и запрашивается заново.
+func applySnapshot(contract string, orderbook OrderBookResponse) {
+	// Запоздавший снимок (например, начальный после пересинхронизации) не откатывает книгу
+	if _, ok := orderbooks.Get(contract); ok && orderbook.ID <= lastUpdateIDs[contract] {
+		debugf("Ignoring snapshot %d for %s: book is already at update %d", orderbook.ID, contract, lastUpdateIDs[contract])
+		return
+	}
+
+	// Снимок без id (новый контракт) не задает начало последовательности:
+	// им становится первое обновление, полученное после снимка
+	if orderbook.ID == 0 {
+		if zeroSnapshotID == "refetch" && staleSnapshots[contract] < maxStaleSnapshots {
+			staleSnapshots[contract]++
+			warnf("snapshot for %s has no id, requesting another one", contract)
+			resyncing[contract] = true
+			requestSnapshot(contract)
+			return
+		}
+		warnf("snapshot for %s has no id, anchoring the sequence on the next update", contract)
+		metrics.Count("orderbook.unanchored_snapshots."+contract, 1)
+	}
+
+	buffered := pendingUpdates[contract]
+	first := 0
+	for first < len(buffered) && coveredBySnapshot(buffered[first], orderbook) {
+		first++
+	}
+	if orderbook.ID != 0 && first < len(buffered) && buffered[first].update.U > orderbook.ID+1 {
+		if staleSnapshots[contract] < maxStaleSnapshots {
+			staleSnapshots[contract]++
+			warnf("snapshot %d for %s is older than buffered update %d, requesting a newer one",
+				orderbook.ID, contract, buffered[first].update.U)
+			resyncing[contract] = true
+			requestSnapshot(contract)
+			return
+		}
+		warnf("gap between snapshot %d and first buffered update %d for %s", orderbook.ID, buffered[first].update.U, contract)
+	}
+
+	delete(pendingUpdates, contract)
+	delete(resyncing, contract)
+	delete(staleSnapshots, contract)
+	// Обновления применяются к отсортированной книге
+	orderbook = sortOrderBook(orderbook)
+	if priceJumps != nil {
+		priceJumps.Reset(contract)
+	}
+	crossedBooks.Reset(contract)
+	// Дельты после снимка не продолжают прежний поток: TCP подписчики
+	// получат новую книгу целиком
+	if tcpStream != nil {
+		tcpStream.Resync(contract)
+	}
+	orderbooks.Set(contract, orderbook)
+	lastUpdateIDs[contract] = orderbook.ID
+	if staleBooks != nil {
+		staleBooks.Touch(contract, time.Unix(0, orderbook.ReceivedNs))
+	}
+	publishBookEvent(contract, orderbook, true)
+	if changeLogs != nil {
+		changeLogs.AppendSnapshot(contract, orderbook)
+	}
+	midPrices.Record(contract, time.Unix(0, orderbook.ReceivedNs), orderbook)
+	if midEMAs != nil {
+		midEMAs.Update(contract, orderbook)
+	}
+
+	for i, b := range buffered[first:] {
+		current, ok := orderbooks.Get(contract)
+		if !ok {
+			// Разрыв внутри буфера - остаток ждет следующего снимка
+			for _, rest := range buffered[first+i:] {
+				bufferUpdate(contract, rest)
+			}
+			break
+		}
+		applyUpdate(contract, current, b)
+		applyReordered(contract)
+	}
+	if len(buffered) > 0 {
+		infof("Applied %d of %d buffered updates for %s after snapshot %d", len(buffered)-first, len(buffered), contract, orderbook.ID)
+	}
+}
@@ -0,0 +1,364 @@
+package gateorderbook
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Обновление U-u, как его буферизует обработчик WebSocket
+func buffered(first, last int64) receivedUpdate {
+	return receivedUpdate{
+		update:     OrderBookUpdate{Contract: "BTC_USDT", U: first, End: last, Bids: levels("99:2")},
+		receivedNs: time.Now().UnixNano(),
+	}
+}
+
+func TestApplySnapshotReplaysBufferedUpdates(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		snapshotID   int64
+		buffered     []receivedUpdate
+		wantBook     bool
+		wantLast     int64
+		wantRequests int
+		wantPending  int
+	}{
+		{"no buffered updates", "anchor", 100, nil, true, 100, 0, 0},
+		{"older updates dropped, rest applied", "anchor", 100,
+			[]receivedUpdate{buffered(95, 99), buffered(96, 100), buffered(100, 101), buffered(102, 103)}, true, 103, 0, 0},
+		{"snapshot older than buffer is refetched", "anchor", 100,
+			[]receivedUpdate{buffered(150, 151)}, false, 0, 1, 1},
+		{"zero id anchors on the next update", "anchor", 0,
+			[]receivedUpdate{buffered(150, 151), buffered(152, 152)}, true, 152, 0, 0},
+		{"zero id refetched", "refetch", 0,
+			[]receivedUpdate{buffered(150, 151)}, false, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.ZeroSnapshotID = tt.policy })
+			requested := captureSnapshotRequests(t)
+			for _, b := range tt.buffered {
+				bufferUpdate("BTC_USDT", b)
+			}
+
+			applySnapshot("BTC_USDT", testBook(tt.snapshotID, levels("101:1"), levels("99:1")))
+
+			if _, ok := orderbooks.Get("BTC_USDT"); ok != tt.wantBook {
+				t.Errorf("book present = %v, want %v", ok, tt.wantBook)
+			}
+			if got := lastUpdateIDs["BTC_USDT"]; got != tt.wantLast {
+				t.Errorf("last update id = %d, want %d", got, tt.wantLast)
+			}
+			if len(*requested) != tt.wantRequests {
+				t.Errorf("snapshot requests = %v, want %d", *requested, tt.wantRequests)
+			}
+			if got := len(pendingUpdates["BTC_USDT"]); got != tt.wantPending {
+				t.Errorf("buffered updates = %d, want %d", got, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestEarlyUpdatesReconciledWithSnapshot(t *testing.T) {
+	newTestTracker(t, nil)
+	captureSnapshotRequests(t)
+	// Обновления приходят до снимка 100: первое целиком старше снимка,
+	// второе перекрывает его, третье следует за ним
+	for _, msg := range [][]byte{
+		updateMessage("BTC_USDT", 98, 100, levels("101:9"), levels("99:9")),
+		updateMessage("BTC_USDT", 100, 101, levels("101:2"), nil),
+		updateMessage("BTC_USDT", 102, 102, nil, levels("99:3")),
+	} {
+		handleWebSocketMessage(msg, time.Now().UnixNano())
+	}
+	if _, ok := orderbooks.Get("BTC_USDT"); ok {
+		t.Fatal("book applied before the snapshot arrived")
+	}
+
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1", "102:1"), levels("99:1")))
+	// Повтор уже примененного обновления после сверки пропускается
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, levels("102:0"), nil), time.Now().UnixNano())
+	handleWebSocketMessage(updateMessage("BTC_USDT", 103, 103, levels("103:1"), nil), time.Now().UnixNano())
+
+	book, _ := orderbooks.Get("BTC_USDT")
+	if got, want := levelSpecs(book.Asks), "101:2 102:1 103:1"; got != want {
+		t.Errorf("asks = %s, want %s", got, want)
+	}
+	if got, want := levelSpecs(book.Bids), "99:3"; got != want {
+		t.Errorf("bids = %s, want %s", got, want)
+	}
+	if lastUpdateIDs["BTC_USDT"] != 103 || len(pendingUpdates["BTC_USDT"]) != 0 {
+		t.Errorf("last update = %d with %d buffered, want 103 with none", lastUpdateIDs["BTC_USDT"], len(pendingUpdates["BTC_USDT"]))
+	}
+}
+
+func TestStaleSnapshotGivesUpAfterRetries(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = 0 })
+	requested := captureSnapshotRequests(t)
+	bufferUpdate("BTC_USDT", buffered(150, 151))
+
+	for i := 0; i < maxStaleSnapshots; i++ {
+		applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	}
+	if len(*requested) != maxStaleSnapshots {
+		t.Fatalf("snapshot requests = %d, want %d", len(*requested), maxStaleSnapshots)
+	}
+	// Следующий устаревший снимок принимается, разрыв уходит в обычную обработку
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	if _, ok := orderbooks.Get("BTC_USDT"); ok {
+		t.Error("book with an unfillable gap kept")
+	}
+	if len(*requested) != maxStaleSnapshots+1 {
+		t.Errorf("snapshot requests = %d, want a resync after giving up", len(*requested))
+	}
+}
+
+func TestLateSnapshotIgnored(t *testing.T) {
+	newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(200, levels("101:1"), levels("99:1")))
+	applySnapshot("BTC_USDT", testBook(150, levels("105:1"), levels("95:1")))
+
+	book, _ := orderbooks.Get("BTC_USDT")
+	if book.ID != 200 || lastUpdateIDs["BTC_USDT"] != 200 {
+		t.Errorf("book rolled back to snapshot %d", book.ID)
+	}
+}
+
+func TestResyncRequestsOneSnapshot(t *testing.T) {
+	newTestTracker(t, nil)
+	requested := captureSnapshotRequests(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	resync("BTC_USDT", "test")
+	resync("BTC_USDT", "test")
+	if len(*requested) != 1 {
+		t.Errorf("snapshot requests = %d, want 1 while a resync is pending", len(*requested))
+	}
+	if _, ok := orderbooks.Get("BTC_USDT"); ok {
+		t.Error("book kept after resync")
+	}
+
+	applySnapshot("BTC_USDT", testBook(300, levels("101:1"), levels("99:1")))
+	resync("BTC_USDT", "test")
+	if len(*requested) != 2 {
+		t.Errorf("snapshot requests = %d, want 2 after the snapshot arrived", len(*requested))
+	}
+}
+
+func TestResyncRestartsTCPStream(t *testing.T) {
+	newTestTracker(t, nil)
+	captureSnapshotRequests(t)
+	hub := newTCPHub()
+	tcpStream = hub
+	t.Cleanup(func() { tcpStream = nil })
+	client := &tcpClient{contract: "BTC_USDT", frames: make(chan []byte, 1), hasSnapshot: true}
+	hub.subscribe(client)
+
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	if client.hasSnapshot {
+		t.Error("client kept its delta stream across a new snapshot")
+	}
+
+	client.hasSnapshot = true
+	resync("BTC_USDT", "test")
+	if client.hasSnapshot {
+		t.Error("client kept its delta stream across a resync")
+	}
+}
+
+func TestUnseededUpdatesBufferBounded(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.MaxBufferedUpdates = 3 })
+	logs := captureLog(t)
+	captureSnapshotRequests(t)
+	// Обновления 101-105 до снимка; в буфере остаются три последних.
+	// Уровни каждого кадра разные: буфер декодирования переиспользуется.
+	for id := int64(101); id <= 105; id++ {
+		size := strconv.FormatInt(id-100, 10)
+		handleWebSocketMessage(updateMessage("BTC_USDT", id, id, levels("101:"+size), levels("9"+size+":1")), time.Now().UnixNano())
+	}
+	if got := len(pendingUpdates["BTC_USDT"]); got != 3 {
+		t.Fatalf("buffered updates = %d, want 3", got)
+	}
+	if got := strings.Count(logs.String(), "update buffer for BTC_USDT is full"); got != 2 {
+		t.Errorf("buffer full warnings = %d, want 2", got)
+	}
+
+	applySnapshot("BTC_USDT", testBook(102, levels("101:1"), levels("90:1")))
+	book, _ := orderbooks.Get("BTC_USDT")
+	// Применены 103, 104, 105 по порядку: размер уровня 101 из последнего
+	if got, want := levelSpecs(book.Asks), "101:5"; got != want {
+		t.Errorf("asks = %s, want %s", got, want)
+	}
+	if got, want := levelSpecs(book.Bids), "95:1 94:1 93:1 90:1"; got != want {
+		t.Errorf("bids = %s, want %s", got, want)
+	}
+	if book.ID != 105 {
+		t.Errorf("book id = %d, want 105", book.ID)
+	}
+}
+
+func TestSnapshotAge(t *testing.T) {
+	now := time.Unix(1700000010, 0)
+	if got := snapshotAge(OrderBookResponse{Current: 1700000007.5}, now); got != 2500*time.Millisecond {
+		t.Errorf("snapshot age = %s, want 2.5s", got)
+	}
+}
+
+func TestStaleSnapshotRefetched(t *testing.T) {
+	stale := float64(time.Now().Add(-time.Hour).Unix())
+	tests := []struct {
+		name         string
+		maxAge       time.Duration
+		currents     []float64 // current of each successive response; 0 means now
+		wantRequests int32
+		wantCurrent  bool // The returned snapshot is the fresh one
+		wantLog      string
+	}{
+		{"fresh", time.Minute, []float64{0}, 1, true, ""},
+		{"stale then fresh", time.Minute, []float64{stale, 0}, 2, true, "s old (current=" + strconv.FormatFloat(stale, 'f', 3, 64) + "), retrying"},
+		{"always stale", time.Minute, []float64{stale, stale, stale}, 3, false, "old (current=" + strconv.FormatFloat(stale, 'f', 3, 64) + "), using it anyway"},
+		{"check disabled", 0, []float64{stale}, 1, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.MaxSnapshotAge = tt.maxAge })
+			logs := captureLog(t)
+			var served int
+			requests := serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+				book := testBook(int64(100+served), levels("101:1"), levels("99:1"))
+				book.Current = tt.currents[served]
+				if book.Current == 0 {
+					book.Current = float64(time.Now().UnixNano()) / 1e9
+				}
+				served++
+				writeSnapshot(w, book)
+			})
+
+			book, err := getFreshSnapshot(context.Background(), "BTC_USDT")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if fresh := book.Current != stale; fresh != tt.wantCurrent || book.ID != int64(99+served) {
+				t.Errorf("returned snapshot %d with current %.3f, want the last one (fresh %v)", book.ID, book.Current, tt.wantCurrent)
+			}
+			if tt.wantLog == "" && strings.Contains(logs.String(), "old (current=") {
+				t.Errorf("log = %q, want no staleness warning", logs)
+			}
+			if tt.wantLog != "" && !strings.Contains(logs.String(), "Warning: snapshot for BTC_USDT is ") {
+				t.Errorf("log = %q, want a staleness warning", logs)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log = %q, want %q", logs, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestZeroSnapshotIDAnchorsOnFirstUpdate(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = 0 })
+	requested := captureSnapshotRequests(t)
+	logs := captureLog(t)
+	// Снимок нового контракта без поля id
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"current":1700000000,"update":1700000000,"asks":[{"p":"101","s":1}],"bids":[{"p":"99","s":1}]}`))
+	})
+	book, err := GetOrderBookSnapshot(context.Background(), "usdt", "BTC_USDT", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applySnapshot("BTC_USDT", book)
+	if !strings.Contains(logs.String(), "snapshot for BTC_USDT has no id, anchoring the sequence on the next update") {
+		t.Errorf("log = %q, want the unanchored snapshot warning", logs)
+	}
+
+	// Первое обновление задает начало последовательности, дальше она проверяется как обычно
+	handleWebSocketMessage(updateMessage("BTC_USDT", 5000, 5001, levels("101:2"), nil), time.Now().UnixNano())
+	handleWebSocketMessage(updateMessage("BTC_USDT", 5002, 5002, nil, levels("99:3")), time.Now().UnixNano())
+	got, _ := orderbooks.Get("BTC_USDT")
+	if got.ID != 5002 || levelSpecs(got.Asks) != "101:2" || levelSpecs(got.Bids) != "99:3" {
+		t.Errorf("book %d = %s / %s, want 5002 = 101:2 / 99:3", got.ID, levelSpecs(got.Asks), levelSpecs(got.Bids))
+	}
+	if len(*requested) != 0 {
+		t.Fatalf("snapshot requests = %v, want none", *requested)
+	}
+	handleWebSocketMessage(updateMessage("BTC_USDT", 5004, 5004, nil, levels("99:4")), time.Now().UnixNano())
+	if len(*requested) != 1 {
+		t.Errorf("snapshot requests after a gap = %v, want 1", *requested)
+	}
+}
+
+func TestZeroSnapshotIDDropsEarlierUpdates(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = 0 })
+	requested := captureSnapshotRequests(t)
+	// Снимок сгенерирован в 1700000000.5; первые два обновления отправлены раньше и уже в нем
+	early := buffered(4000, 4000)
+	early.msgTimeMs = 1700000000400
+	atSnapshot := buffered(4001, 4001)
+	atSnapshot.msgTimeMs = 1700000000500
+	later := receivedUpdate{
+		update:     OrderBookUpdate{Contract: "BTC_USDT", U: 4002, End: 4002, Asks: levels("101:5")},
+		msgTimeMs:  1700000000600,
+		receivedNs: time.Now().UnixNano(),
+	}
+	pendingUpdates["BTC_USDT"] = []receivedUpdate{early, atSnapshot, later}
+	book := testBook(0, levels("101:1"), levels("99:1"))
+	book.Current = 1700000000.5
+	applySnapshot("BTC_USDT", book)
+
+	got, _ := orderbooks.Get("BTC_USDT")
+	if got.ID != 4002 || levelSpecs(got.Asks) != "101:5" || levelSpecs(got.Bids) != "99:1" {
+		t.Errorf("book %d = %s / %s, want 4002 = 101:5 / 99:1", got.ID, levelSpecs(got.Asks), levelSpecs(got.Bids))
+	}
+	handleWebSocketMessage(updateMessage("BTC_USDT", 4003, 4003, nil, levels("99:3")), time.Now().UnixNano())
+	if got, _ := orderbooks.Get("BTC_USDT"); got.ID != 4003 || len(*requested) != 0 {
+		t.Errorf("book %d, snapshot requests %v; want 4003 and none", got.ID, *requested)
+	}
+}
+
+func TestZeroSnapshotIDWithoutServerTimeUsesReceiveTime(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = 0 })
+	early := buffered(4000, 4000)
+	book := testBook(0, levels("101:1"), levels("99:1"))
+	book.ReceivedNs = early.receivedNs + 1
+	later := buffered(4001, 4001)
+	later.receivedNs = book.ReceivedNs + 1
+	later.update.Bids, later.update.Asks = nil, levels("101:7")
+	pendingUpdates["BTC_USDT"] = []receivedUpdate{early, later}
+	applySnapshot("BTC_USDT", book)
+	if got, _ := orderbooks.Get("BTC_USDT"); got.ID != 4001 || levelSpecs(got.Asks) != "101:7" || levelSpecs(got.Bids) != "99:1" {
+		t.Errorf("book %d = %s / %s, want 4001 = 101:7 / 99:1", got.ID, levelSpecs(got.Asks), levelSpecs(got.Bids))
+	}
+}
+
+func TestZeroSnapshotIDRefetchFallsBackToAnchor(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ZeroSnapshotID = "refetch" })
+	requested := captureSnapshotRequests(t)
+	logs := captureLog(t)
+	for i := 0; i < maxStaleSnapshots; i++ {
+		applySnapshot("BTC_USDT", testBook(0, levels("101:1"), levels("99:1")))
+	}
+	if len(*requested) != maxStaleSnapshots {
+		t.Fatalf("snapshot requests = %d, want %d", len(*requested), maxStaleSnapshots)
+	}
+	if _, ok := orderbooks.Get("BTC_USDT"); ok {
+		t.Fatal("snapshot without an id applied while refetching")
+	}
+
+	// Попытки исчерпаны: снимок принимается и последовательность начинается со следующего обновления
+	applySnapshot("BTC_USDT", testBook(0, levels("101:1"), levels("99:1")))
+	handleWebSocketMessage(updateMessage("BTC_USDT", 700, 700, nil, levels("99:2")), time.Now().UnixNano())
+	if got, ok := orderbooks.Get("BTC_USDT"); !ok || got.ID != 700 || levelSpecs(got.Bids) != "99:2" {
+		t.Errorf("book %d = %s (present %v), want 700 = 99:2", got.ID, levelSpecs(got.Bids), ok)
+	}
+	if len(*requested) != maxStaleSnapshots || !strings.Contains(logs.String(), "anchoring the sequence") {
+		t.Errorf("requests %v, log %q", *requested, logs)
+	}
+}
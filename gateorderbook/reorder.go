@@ -0,0 +1,91 @@
+package gateorderbook
+
+import (
+	"sort"
+	"time"
+)
+
+// Сколько обновление, пришедшее раньше предыдущих по последовательности,
+// ждет недостающие до пересинхронизации (0 - пересинхронизация сразу)
+var reorderWindow = 250 * time.Millisecond
+
+// Удерживаемое обновление с моментом постановки в очередь: временем
+// получения, а при воспроизведении - записанным временем
+type heldUpdate struct {
+	received receivedUpdate
+	heldAt   time.Time
+}
+
+// Обновления после разрыва последовательности по контрактам, по возрастанию U
+var reorderBuffers = make(map[string][]heldUpdate)
+
+// Постановка обновления с разрывом в очередь; false, если очередь
+// выключена или переполнена и нужна пересинхронизация
+func holdOutOfOrder(contract string, received receivedUpdate) bool {
+	held := reorderBuffers[contract]
+	if reorderWindow <= 0 || len(held) >= maxBufferedUpdates {
+		return false
+	}
+
+	// Уровни копируются: обновление может ссылаться на переиспользуемый буфер декодирования
+	received.update.Asks = append([]OrderBookItem(nil), received.update.Asks...)
+	received.update.Bids = append([]OrderBookItem(nil), received.update.Bids...)
+
+	i := sort.Search(len(held), func(i int) bool {
+		return held[i].received.update.U >= received.update.U
+	})
+	if i < len(held) && held[i].received.update.U == received.update.U {
+		// Дубликат с резервного соединения
+		return true
+	}
+	held = append(held, heldUpdate{})
+	copy(held[i+1:], held[i:])
+	held[i] = heldUpdate{received: received, heldAt: time.Unix(0, received.receivedNs)}
+	reorderBuffers[contract] = held
+
+	debugf("Holding out-of-order update %d-%d for %s, expecting %d",
+		received.update.U, received.update.End, contract, lastUpdateIDs[contract]+1)
+	return true
+}
+
+// Применение удерживаемых обновлений, которые теперь идут по порядку
+func applyReordered(contract string) {
+	for {
+		held := reorderBuffers[contract]
+		if len(held) == 0 {
+			delete(reorderBuffers, contract)
+			return
+		}
+		next := held[0].received
+		if next.update.U > lastUpdateIDs[contract]+1 {
+			return
+		}
+		existing, ok := orderbooks.Get(contract)
+		if !ok {
+			return
+		}
+		reorderBuffers[contract] = held[1:]
+		applyUpdate(contract, existing, next)
+		metrics.Count("orderbook.reordered."+contract, 1)
+	}
+}
+
+// Пересинхронизация контрактов, разрыв которых не заполнился за reorderWindow
+func expireReorderBuffers(now time.Time) {
+	for contract, held := range reorderBuffers {
+		if len(held) == 0 || now.Sub(held[0].heldAt) < reorderWindow {
+			continue
+		}
+		warnf("sequence gap for %s: expected update %d, got %d-%d",
+			contract, lastUpdateIDs[contract]+1, held[0].received.update.U, held[0].received.update.End)
+		resync(contract, "sequence gap")
+	}
+}
+
+// Перенос удерживаемых обновлений в буфер до снимка (при пересинхронизации)
+func flushReorderBuffer(contract string) {
+	for _, h := range reorderBuffers[contract] {
+		bufferUpdate(contract, h.received)
+	}
+	delete(reorderBuffers, contract)
+}
@@ -0,0 +1,72 @@
+package gateorderbook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReorderAppliesHeldUpdatesInSequence(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = time.Minute })
+	requested := captureSnapshotRequests(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	// Каждое обновление ставит объем ask 101, равный своему U: итоговый
+	// объем показывает, какое обновление применено последним
+	for _, u := range []int64{105, 103, 103, 104, 101, 102} {
+		handleWebSocketMessage(updateMessage("BTC_USDT", u, u, levels("101:"+strconv.FormatInt(u, 10)), nil), time.Now().UnixNano())
+	}
+
+	book, _ := orderbooks.Get("BTC_USDT")
+	if book.ID != 105 || levelSpecs(book.Asks) != "101:105" {
+		t.Errorf("book = %d %s, want 105 101:105", book.ID, levelSpecs(book.Asks))
+	}
+	if len(reorderBuffers["BTC_USDT"]) != 0 || len(*requested) != 0 {
+		t.Errorf("held = %d, snapshot requests = %d, want none", len(reorderBuffers["BTC_USDT"]), len(*requested))
+	}
+}
+
+func TestReorderBufferOverflowResyncs(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.ReorderWindow = time.Minute
+		cfg.MaxBufferedUpdates = 2
+	})
+	requested := captureSnapshotRequests(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	for _, u := range []int64{103, 104} {
+		handleWebSocketMessage(updateMessage("BTC_USDT", u, u, nil, levels("99:2")), time.Now().UnixNano())
+	}
+	if len(*requested) != 0 || len(reorderBuffers["BTC_USDT"]) != 2 {
+		t.Fatalf("held = %d, snapshot requests = %d, want 2 held and no resync",
+			len(reorderBuffers["BTC_USDT"]), len(*requested))
+	}
+	handleWebSocketMessage(updateMessage("BTC_USDT", 105, 105, nil, levels("99:3")), time.Now().UnixNano())
+	if len(*requested) != 1 {
+		t.Errorf("snapshot requests = %d after the reorder buffer filled, want 1", len(*requested))
+	}
+}
+
+func TestHoldOutOfOrderCopiesLevels(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = time.Minute })
+	asks := levels("101:1")
+	holdOutOfOrder("BTC_USDT", receivedUpdate{
+		update:     OrderBookUpdate{Contract: "BTC_USDT", U: 103, End: 103, Asks: asks},
+		receivedNs: time.Now().UnixNano(),
+	})
+	// Буфер декодирования переиспользуется следующим сообщением
+	asks[0] = levels("200:9")[0]
+
+	held := reorderBuffers["BTC_USDT"]
+	if len(held) != 1 || levelSpecs(held[0].received.update.Asks) != "101:1" {
+		t.Errorf("held update = %+v, want asks 101:1", held)
+	}
+}
+
+func TestHoldOutOfOrderDisabled(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ReorderWindow = 0 })
+	held := holdOutOfOrder("BTC_USDT", receivedUpdate{update: OrderBookUpdate{Contract: "BTC_USDT", U: 103, End: 103}})
+	if held || len(reorderBuffers["BTC_USDT"]) != 0 {
+		t.Error("update held with the reorder window disabled")
+	}
+}
@@ -0,0 +1,191 @@
+package gateorderbook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gateio-perpetual-futures-orderbooks-golang/gateorderbook/pb"
+)
+
+// Максимальная длина строки журнала при воспроизведении
+const maxReplayLine = 16 * 1024 * 1024
+
+// Воспроизведение журнала изменений: снимки загружаются как REST снимки,
+// дельты применяются как обновления WebSocket. Дельты контракта до его
+// первого снимка применяются к пустой книге. Файлы *.pb читаются как поток
+// protobuf сообщений, остальные как NDJSON; *.gz и *.zst распаковываются.
+// Разрыв последовательности ждет reorderWindow по времени записи, затем
+// книга ждет следующего снимка из журнала.
+// При validate воспроизведение останавливается на первом разрыве
+// последовательности или несортированной/пересеченной книге (*ReplayViolation).
+func replayChangeLog(ctx context.Context, path string, realtime, validate bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open replay file: %v", err)
+	}
+	defer f.Close()
+	r, name, err := decompressedReader(path, f)
+	if err != nil {
+		return fmt.Errorf("failed to decompress replay file: %v", err)
+	}
+	defer r.Close()
+
+	// Снимки при воспроизведении берутся только из журнала
+	prevRequest := requestSnapshot
+	requestSnapshot = func(contract string) {
+		infof("Replay: %s waits for the next recorded snapshot", contract)
+	}
+	defer func() { requestSnapshot = prevRequest }()
+
+	var validator *replayValidator
+	if validate {
+		validator = newReplayValidator()
+	}
+
+	if strings.HasSuffix(name, ".pb") {
+		return replayProtobuf(ctx, r, path, realtime, validator)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+
+	var prevTs int64
+	lines := 0
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lines++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry changeLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lines, err)
+		}
+
+		if err := replayPause(ctx, realtime, prevTs, entry.Ts); err != nil {
+			return err
+		}
+		prevTs = entry.Ts
+
+		if err := replayChecked(validator, lines, entry); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read replay file: %v", err)
+	}
+	finishReplay(prevTs)
+	infof("Replay of %s finished: %d lines", path, lines)
+	return nil
+}
+
+// Воспроизведение потока protobuf сообщений с префиксом длины
+func replayProtobuf(ctx context.Context, r io.Reader, path string, realtime bool, validator *replayValidator) error {
+	var prevTs int64
+	messages := 0
+	err := readDelimited(r, func(msg *pb.Message) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		messages++
+		entry, err := changeLogEntryFromMessage(msg)
+		if err != nil {
+			return err
+		}
+		if err := replayPause(ctx, realtime, prevTs, entry.Ts); err != nil {
+			return err
+		}
+		prevTs = entry.Ts
+
+		return replayChecked(validator, messages, entry)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	finishReplay(prevTs)
+	infof("Replay of %s finished: %d messages", path, messages)
+	return nil
+}
+
+// Пауза на интервал между записями при воспроизведении в реальном времени
+func replayPause(ctx context.Context, realtime bool, prevTs, ts int64) error {
+	if !realtime || prevTs == 0 || ts <= prevTs {
+		return nil
+	}
+	select {
+	case <-time.After(time.Duration(ts-prevTs) * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Применение одной строки журнала. Часы при воспроизведении не идут,
+// поэтому удерживаемые после разрыва обновления истекают по времени записи.
+func replayEntry(entry changeLogEntry) {
+	receivedNs := entry.Ts * int64(time.Millisecond)
+	defer expireReorderBuffers(time.Unix(0, receivedNs))
+	// Строки потеряны при записи: книга ждет следующего за отметкой снимка
+	if entry.Gap > 0 {
+		resync(entry.Contract, fmt.Sprintf("%d change log entries were dropped while recording", entry.Gap))
+		return
+	}
+	if entry.Snapshot {
+		applySnapshot(entry.Contract, OrderBookResponse{
+			ID:         entry.End,
+			Current:    float64(entry.TimeMs) / 1000,
+			Update:     float64(entry.TimeMs) / 1000,
+			ReceivedNs: receivedNs,
+			Asks:       entry.Asks,
+			Bids:       entry.Bids,
+		})
+		return
+	}
+
+	existing, ok := orderbooks.Get(entry.Contract)
+	if !ok {
+		if pendingUpdates[entry.Contract] != nil || resyncing[entry.Contract] {
+			// Разрыв в записи: ждем следующего снимка из журнала
+			bufferUpdate(entry.Contract, replayUpdate(entry, receivedNs))
+			return
+		}
+		warnf("replay has no snapshot for %s before update %d, starting from an empty book", entry.Contract, entry.U)
+		existing = OrderBookResponse{ID: entry.U - 1}
+		orderbooks.Set(entry.Contract, existing)
+		lastUpdateIDs[entry.Contract] = existing.ID
+	}
+	applyUpdate(entry.Contract, existing, replayUpdate(entry, receivedNs))
+	applyReordered(entry.Contract)
+}
+
+// Конец журнала: незаполненные разрывы больше не дождутся обновлений
+func finishReplay(lastTs int64) {
+	if len(reorderBuffers) > 0 {
+		expireReorderBuffers(time.Unix(0, lastTs*int64(time.Millisecond)).Add(reorderWindow))
+	}
+}
+
+func replayUpdate(entry changeLogEntry, receivedNs int64) receivedUpdate {
+	return receivedUpdate{
+		update: OrderBookUpdate{
+			Contract: entry.Contract,
+			U:        entry.U,
+			End:      entry.End,
+			Asks:     entry.Asks,
+			Bids:     entry.Bids,
+		},
+		msgTimeMs:  entry.TimeMs,
+		receivedNs: receivedNs,
+	}
+}
@@ -0,0 +1,209 @@
+package gateorderbook
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Строки журнала: снимок и дельта
+func snapshotEntry(ts, id int64, asks, bids []OrderBookItem) changeLogEntry {
+	return changeLogEntry{Ts: ts, Contract: "BTC_USDT", Snapshot: true, End: id, Asks: asks, Bids: bids}
+}
+
+func deltaEntry(ts, first, last int64, asks, bids []OrderBookItem) changeLogEntry {
+	if asks == nil {
+		asks = []OrderBookItem{}
+	}
+	if bids == nil {
+		bids = []OrderBookItem{}
+	}
+	return changeLogEntry{Ts: ts, Contract: "BTC_USDT", U: first, End: last, Asks: asks, Bids: bids}
+}
+
+// Запись журнала в файл name временной директории
+func writeChangeLogFile(t testing.TB, name string, encode func(changeLogEntry) ([]byte, error), entries []changeLogEntry) string {
+	t.Helper()
+	var data []byte
+	for _, entry := range entries {
+		line, err := encode(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, line...)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReplayChangeLog(t *testing.T) {
+	entries := []changeLogEntry{
+		snapshotEntry(1000, 100, levels("101:1", "102:1"), levels("99:1")),
+		deltaEntry(1010, 101, 101, levels("101:3"), nil),
+		deltaEntry(1020, 102, 103, nil, levels("99:0", "98:4")),
+	}
+	tests := []struct {
+		name   string
+		file   string
+		encode func(changeLogEntry) ([]byte, error)
+	}{
+		{"ndjson", "BTC_USDT.ndjson", encodeChangeLogJSON},
+		{"protobuf", "BTC_USDT.changes.pb", encodeChangeLogProtobuf},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, nil)
+			path := writeChangeLogFile(t, tt.file, tt.encode, entries)
+			if err := replayChangeLog(context.Background(), path, false, false); err != nil {
+				t.Fatal(err)
+			}
+			book, ok := orderbooks.Get("BTC_USDT")
+			if !ok {
+				t.Fatal("book missing after replay")
+			}
+			if book.ID != 103 {
+				t.Errorf("book id = %d, want 103", book.ID)
+			}
+			if got, want := levelSpecs(book.Asks), "101:3 102:1"; got != want {
+				t.Errorf("asks = %s, want %s", got, want)
+			}
+			if got, want := levelSpecs(book.Bids), "98:4"; got != want {
+				t.Errorf("bids = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestReplayExpiresHeldUpdatesByRecordedTime(t *testing.T) {
+	newTestTracker(t, nil)
+	captureSnapshotRequests(t)
+
+	replayEntry(snapshotEntry(1000, 100, levels("101:1"), levels("99:1")))
+	replayEntry(deltaEntry(1010, 101, 101, nil, levels("99:2")))
+	// Разрыв 102-103: обновление удерживается reorderWindow по времени записи
+	replayEntry(deltaEntry(1020, 104, 105, nil, levels("99:3")))
+	if len(reorderBuffers["BTC_USDT"]) != 1 {
+		t.Fatalf("gap update not held")
+	}
+	replayEntry(deltaEntry(1100, 106, 106, nil, levels("99:4")))
+	if resyncing["BTC_USDT"] {
+		t.Fatal("resynced before the reorder window passed in recorded time")
+	}
+	replayEntry(deltaEntry(2000, 107, 107, nil, levels("99:5")))
+	if !resyncing["BTC_USDT"] || len(reorderBuffers["BTC_USDT"]) != 0 {
+		t.Fatal("held updates did not expire once recorded time passed the reorder window")
+	}
+
+	// Следующий снимок журнала восстанавливает книгу
+	replayEntry(snapshotEntry(2100, 110, levels("101:1"), levels("99:6")))
+	replayEntry(deltaEntry(2110, 111, 111, nil, levels("99:7")))
+	book, ok := orderbooks.Get("BTC_USDT")
+	if !ok || book.ID != 111 || levelSpecs(book.Bids) != "99:7" {
+		t.Errorf("book after the recorded snapshot = %d %s, want 111 99:7", book.ID, levelSpecs(book.Bids))
+	}
+}
+
+func TestReplayReportsGapAtEndOfFile(t *testing.T) {
+	newTestTracker(t, nil)
+	path := writeChangeLogFile(t, "BTC_USDT.ndjson", encodeChangeLogJSON, []changeLogEntry{
+		snapshotEntry(1000, 100, levels("101:1"), levels("99:1")),
+		deltaEntry(1010, 105, 105, nil, levels("99:2")),
+	})
+	if err := replayChangeLog(context.Background(), path, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(reorderBuffers["BTC_USDT"]) != 0 {
+		t.Error("update still held after the end of the file")
+	}
+	if _, ok := orderbooks.Get("BTC_USDT"); ok {
+		t.Error("book with an unfilled gap kept after the end of the file")
+	}
+}
+
+func TestReplayValidate(t *testing.T) {
+	snapshot := snapshotEntry(1000, 100, levels("101:1", "102:1"), levels("99:1", "98:1"))
+	tests := []struct {
+		name     string
+		entries  []changeLogEntry
+		wantLine int
+		wantTs   int64
+	}{
+		{"sound recording", []changeLogEntry{
+			snapshot,
+			deltaEntry(1010, 101, 101, levels("101:0", "100.5:2"), nil),
+			{Ts: 1020, Contract: "BTC_USDT", Gap: 3},
+			snapshotEntry(1030, 110, levels("101:1"), levels("99:1")),
+			deltaEntry(1040, 111, 111, nil, levels("99.5:1")),
+		}, 0, 0},
+		{"sequence gap", []changeLogEntry{
+			snapshot,
+			deltaEntry(1010, 101, 101, levels("101:2"), nil),
+			deltaEntry(1020, 104, 104, levels("101:3"), nil),
+		}, 3, 1020},
+		{"sequence goes back", []changeLogEntry{
+			snapshot,
+			deltaEntry(1010, 101, 102, levels("101:2"), nil),
+			deltaEntry(1020, 102, 102, levels("101:3"), nil),
+		}, 3, 1020},
+		{"unsorted snapshot", []changeLogEntry{
+			snapshotEntry(1000, 100, levels("102:1", "101:1"), levels("99:1")),
+		}, 1, 1000},
+		{"duplicate snapshot level", []changeLogEntry{
+			snapshotEntry(1000, 100, levels("101:1"), levels("99:1", "99.0:2")),
+		}, 1, 1000},
+		{"crossed book", []changeLogEntry{
+			snapshot,
+			deltaEntry(1010, 101, 101, nil, levels("101.5:1")),
+		}, 2, 1010},
+		{"locked book", []changeLogEntry{
+			snapshot,
+			deltaEntry(1010, 101, 101, nil, levels("101:1")),
+		}, 2, 1010},
+	}
+	for _, tt := range tests {
+		for _, format := range []struct {
+			file   string
+			encode func(changeLogEntry) ([]byte, error)
+		}{
+			{"BTC_USDT.ndjson", encodeChangeLogJSON},
+			{"BTC_USDT.changes.pb", encodeChangeLogProtobuf},
+		} {
+			t.Run(tt.name+"/"+format.file, func(t *testing.T) {
+				newTestTracker(t, nil)
+				captureSnapshotRequests(t)
+				path := writeChangeLogFile(t, format.file, format.encode, tt.entries)
+				err := replayChangeLog(context.Background(), path, false, true)
+				if tt.wantLine == 0 {
+					if err != nil {
+						t.Fatalf("replay of a sound recording: %v", err)
+					}
+					return
+				}
+				var violation *ReplayViolation
+				if !errors.As(err, &violation) {
+					t.Fatalf("error = %v, want a replay violation", err)
+				}
+				if violation.Line != tt.wantLine || violation.Ts != tt.wantTs || violation.Contract != "BTC_USDT" {
+					t.Errorf("violation = %+v, want entry %d at ts %d", violation, tt.wantLine, tt.wantTs)
+				}
+			})
+		}
+	}
+}
+
+func TestReplayWithoutValidateIgnoresViolations(t *testing.T) {
+	newTestTracker(t, nil)
+	captureSnapshotRequests(t)
+	path := writeChangeLogFile(t, "BTC_USDT.ndjson", encodeChangeLogJSON, []changeLogEntry{
+		snapshotEntry(1000, 100, levels("102:1", "101:1"), levels("99:1")),
+		deltaEntry(1010, 101, 101, nil, levels("101.5:1")),
+	})
+	if err := replayChangeLog(context.Background(), path, false, false); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"time"
+)
+
+// Первое нарушение инвариантов при воспроизведении с проверкой
+type ReplayViolation struct {
+	Ts       int64 // Local receive time of the entry, unix ms
+	Line     int   // Line (NDJSON) or message (protobuf) number, from 1
+	Contract string
+	Reason   string
+}
+
+func (v *ReplayViolation) Error() string {
+	return fmt.Sprintf("invalid recording at entry %d, ts %d (%s), %s: %s",
+		v.Line, v.Ts, time.UnixMilli(v.Ts).UTC().Format(time.RFC3339Nano), v.Contract, v.Reason)
+}
+
+// Проверка записи при воспроизведении: непрерывность последовательности
+// и сортировка/непересеченность каждой восстановленной книги
+type replayValidator struct {
+	last map[string]int64 // Last update id of each contract
+}
+
+func newReplayValidator() *replayValidator {
+	return &replayValidator{last: make(map[string]int64)}
+}
+
+// Проверка строки до применения; пустая строка - нарушений нет
+func (v *replayValidator) checkEntry(entry changeLogEntry) string {
+	contract := entry.Contract
+	switch {
+	case entry.Gap > 0:
+		// После отметки разрыва последовательность начинается со снимка
+		delete(v.last, contract)
+		return ""
+	case entry.Snapshot:
+		if reason := checkLevels("recorded snapshot asks", entry.Asks, false); reason != "" {
+			return reason
+		}
+		if reason := checkLevels("recorded snapshot bids", entry.Bids, true); reason != "" {
+			return reason
+		}
+		v.last[contract] = entry.End
+		return ""
+	}
+
+	last, ok := v.last[contract]
+	switch {
+	case !ok:
+	case entry.End <= last:
+		return fmt.Sprintf("update %d-%d goes back from update %d", entry.U, entry.End, last)
+	case entry.U > last+1:
+		return fmt.Sprintf("sequence gap: update %d-%d follows update %d", entry.U, entry.End, last)
+	}
+	v.last[contract] = entry.End
+	return ""
+}
+
+// Проверка книги контракта после применения строки
+func (v *replayValidator) checkBook(contract string) string {
+	book, ok := orderbooks.Get(contract)
+	if !ok {
+		return ""
+	}
+	if reason := checkLevels("asks", book.Asks, false); reason != "" {
+		return reason
+	}
+	if reason := checkLevels("bids", book.Bids, true); reason != "" {
+		return reason
+	}
+	if len(book.Bids) > 0 && len(book.Asks) > 0 && comparePrices(book.Bids[0].P, book.Asks[0].P) >= 0 {
+		return fmt.Sprintf("book crossed: best bid %s, best ask %s", book.Bids[0].P, book.Asks[0].P)
+	}
+	return ""
+}
+
+// Уровни строго упорядочены (bids по убыванию, asks по возрастанию)
+// и имеют положительный размер
+func checkLevels(side string, levels []OrderBookItem, isBid bool) string {
+	for i, level := range levels {
+		if !validPrice(level.P) {
+			return fmt.Sprintf("%s have invalid price %q", side, level.P)
+		}
+		if !level.S.IsPositive() {
+			return fmt.Sprintf("%s have level %s with size %s", side, level.P, level.S)
+		}
+		if i == 0 {
+			continue
+		}
+		c := comparePrices(levels[i-1].P, level.P)
+		if c == 0 {
+			return fmt.Sprintf("%s have duplicate level %s", side, level.P)
+		}
+		if (isBid && c < 0) || (!isBid && c > 0) {
+			return fmt.Sprintf("%s not sorted: %s before %s", side, levels[i-1].P, level.P)
+		}
+	}
+	return ""
+}
+
+// Применение строки журнала с проверкой (validator == nil - без проверки)
+func replayChecked(validator *replayValidator, line int, entry changeLogEntry) error {
+	if validator == nil {
+		replayEntry(entry)
+		return nil
+	}
+	reason := validator.checkEntry(entry)
+	if reason == "" {
+		replayEntry(entry)
+		reason = validator.checkBook(entry.Contract)
+	}
+	if reason != "" {
+		return &ReplayViolation{Ts: entry.Ts, Line: line, Contract: entry.Contract, Reason: reason}
+	}
+	return nil
+}
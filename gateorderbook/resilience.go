@@ -0,0 +1,127 @@
+package gateorderbook
+
+import (
+	"sync"
+	"time"
+)
+
+// Истощение глубины у лучшей цены, ожидающее восстановления
+type depletion struct {
+	low, high float64 // Price band around the best price at depletion time
+	baseline  float64 // Depth within the band before the depletion
+	start     time.Time
+}
+
+// Статистика восстановления глубины для стороны ордербука
+type ResilienceStats struct {
+	Recoveries int     `json:"recoveries"`
+	AvgMs      float64 `json:"avg_ms"`
+	LastMs     float64 `json:"last_ms"`
+	Pending    bool    `json:"pending"` // A depletion is waiting to recover
+}
+
+// Измерение времени восстановления глубины у лучшей цены после удаления уровней
+type resilienceTracker struct {
+	mu       sync.Mutex
+	bandBps  float64
+	pending  map[string]*depletion // Keyed by contract + "/" + side
+	total    map[string]time.Duration
+	last     map[string]time.Duration
+	recovery map[string]int
+}
+
+func newResilienceTracker(bandBps float64) *resilienceTracker {
+	return &resilienceTracker{
+		bandBps:  bandBps,
+		pending:  make(map[string]*depletion),
+		total:    make(map[string]time.Duration),
+		last:     make(map[string]time.Duration),
+		recovery: make(map[string]int),
+	}
+}
+
+// Суммарный объем уровней с ценой в диапазоне [low, high]
+func depthInRange(levels []OrderBookItem, low, high float64) float64 {
+	depth := 0.0
+	for _, level := range levels {
+		price, ok := levelPrice(level)
+		if ok && price >= low && price <= high {
+			depth += level.S.InexactFloat64()
+		}
+	}
+	return depth
+}
+
+// Лучшая цена стороны (максимум для bids, минимум для asks)
+func bestLevelPrice(levels []OrderBookItem, isBid bool) (float64, bool) {
+	if isBid {
+		return extremePrice(levels, 1)
+	}
+	return extremePrice(levels, -1)
+}
+
+// Обработка обновления одной стороны ордербука
+func (r *resilienceTracker) observeSide(key string, before, after, updates []OrderBookItem, isBid bool, t time.Time) {
+	if d, ok := r.pending[key]; ok {
+		if depthInRange(after, d.low, d.high) >= d.baseline {
+			elapsed := t.Sub(d.start)
+			r.total[key] += elapsed
+			r.last[key] = elapsed
+			r.recovery[key]++
+			delete(r.pending, key)
+		}
+		return
+	}
+
+	best, ok := bestLevelPrice(before, isBid)
+	if !ok {
+		return
+	}
+	width := best * r.bandBps / 10000
+	low, high := best-width, best
+	if !isBid {
+		low, high = best, best+width
+	}
+
+	// Ищем удаление уровня (size=0) внутри полосы у лучшей цены
+	for _, update := range updates {
+		price, ok := levelPrice(update)
+		if !ok || !update.S.IsZero() || price < low || price > high {
+			continue
+		}
+		baseline := depthInRange(before, low, high)
+		if depthInRange(after, low, high) < baseline {
+			r.pending[key] = &depletion{low: low, high: high, baseline: baseline, start: t}
+		}
+		return
+	}
+}
+
+// Учет обновления контракта: before и after - ордербук до и после применения
+func (r *resilienceTracker) Observe(contract string, before, after OrderBookResponse, update OrderBookUpdate, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observeSide(contract+"/bids", before.Bids, after.Bids, update.Bids, true, t)
+	r.observeSide(contract+"/asks", before.Asks, after.Asks, update.Asks, false, t)
+}
+
+// Статистика восстановления по контрактам и сторонам
+func (r *resilienceTracker) Stats() map[string]ResilienceStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make(map[string]ResilienceStats)
+	for key, count := range r.recovery {
+		stats[key] = ResilienceStats{
+			Recoveries: count,
+			AvgMs:      durationMs(r.total[key] / time.Duration(count)),
+			LastMs:     durationMs(r.last[key]),
+		}
+	}
+	for key := range r.pending {
+		s := stats[key]
+		s.Pending = true
+		stats[key] = s
+	}
+	return stats
+}
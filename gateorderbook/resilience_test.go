@@ -0,0 +1,56 @@
+package gateorderbook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResilienceMeasuresRecovery(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ResilienceBandBps = 10 })
+	applySnapshot("BTC_USDT", testBook(100, levels("100:5", "100.05:5", "101:9"), levels("99.9:5", "99:9")))
+
+	start := time.Unix(1700000000, 0)
+	steps := []struct {
+		after      time.Duration
+		asks, bids []OrderBookItem
+	}{
+		// Лучший ask съеден: объем в полосе 0.1% упал с 10 до 5
+		{0, levels("100:0"), nil},
+		// Изменение за пределами полосы не влияет на восстановление
+		{100 * time.Millisecond, levels("101:20"), nil},
+		{200 * time.Millisecond, levels("100.02:3"), nil},
+		// Объем в полосе снова 10: восстановление за 500ms
+		{500 * time.Millisecond, levels("100.03:2"), nil},
+		// Лучший bid удален и не восстановлен
+		{600 * time.Millisecond, nil, levels("99.9:0")},
+	}
+	for i, step := range steps {
+		id := int64(101 + i)
+		handleWebSocketMessage(updateMessage("BTC_USDT", id, id, step.asks, step.bids), start.Add(step.after).UnixNano())
+	}
+
+	stats := bookResilience.Stats()
+	want := map[string]ResilienceStats{
+		"BTC_USDT/asks": {Recoveries: 1, AvgMs: 500, LastMs: 500},
+		"BTC_USDT/bids": {Pending: true},
+	}
+	if len(stats) != len(want) {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+	for key, w := range want {
+		if stats[key] != w {
+			t.Errorf("%s = %+v, want %+v", key, stats[key], w)
+		}
+	}
+}
+
+func TestResilienceEndpointDisabled(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.ResilienceBandBps = 0 })
+	rec := httptest.NewRecorder()
+	handleResilience(rec, httptest.NewRequest(http.MethodGet, "/resilience", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 with tracking disabled", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package gateorderbook
+
+import (
+	"sync"
+	"time"
+)
+
+// Окно, в котором считается частота пересинхронизаций
+const resyncRateWindow = time.Hour
+
+// Счетчик пересинхронизаций по контрактам. Частые пересинхронизации одного
+// контракта говорят о постоянной проблеме (сеть, протокол): при превышении
+// maxPerHour за последний час выводится предупреждение, повторно - только
+// после того, как частота опустится ниже порога.
+type resyncCounter struct {
+	mu         sync.Mutex
+	maxPerHour int // 0 disables the warning
+	counts     map[string]int64
+	recent     map[string][]time.Time // Resyncs within the last resyncRateWindow
+	alerted    map[string]bool
+}
+
+func newResyncCounter(maxPerHour int) *resyncCounter {
+	return &resyncCounter{
+		maxPerHour: maxPerHour,
+		counts:     make(map[string]int64),
+		recent:     make(map[string][]time.Time),
+		alerted:    make(map[string]bool),
+	}
+}
+
+var resyncCounts = newResyncCounter(0)
+
+// Учет пересинхронизации контракта в момент now
+func (c *resyncCounter) Record(contract string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[contract]++
+	if c.maxPerHour <= 0 {
+		return
+	}
+	recent := c.recent[contract]
+	cutoff := now.Add(-resyncRateWindow)
+	first := 0
+	for first < len(recent) && !recent[first].After(cutoff) {
+		first++
+	}
+	recent = append(recent[first:], now)
+	c.recent[contract] = recent
+
+	if len(recent) <= c.maxPerHour {
+		c.alerted[contract] = false
+		return
+	}
+	if !c.alerted[contract] {
+		c.alerted[contract] = true
+		warnf("%s resynced %d times within the last %s (limit %d), check the network and the feed", contract, len(recent), resyncRateWindow, c.maxPerHour)
+		metrics.Count("orderbook.resync_rate_alerts."+contract, 1)
+	}
+}
+
+// Число пересинхронизаций каждого контракта с запуска
+func (c *resyncCounter) Counts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return copyCounts(c.counts)
+}
@@ -0,0 +1,75 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResyncCounterWarnsAboveRate(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name       string
+		maxPerHour int
+		offsets    []time.Duration // Resync times after start
+		wantWarns  int
+	}{
+		{"disabled", 0, []time.Duration{0, time.Second, 2 * time.Second}, 0},
+		{"at the limit", 3, []time.Duration{0, time.Minute, 2 * time.Minute}, 0},
+		{"above the limit", 2, []time.Duration{0, time.Minute, 2 * time.Minute}, 1},
+		{"warned once while above", 2, []time.Duration{0, 1, 2, 3, 4}, 1},
+		{"old resyncs leave the window", 2, []time.Duration{0, time.Minute, 2 * time.Hour}, 0},
+		{"warns again after recovering", 1, []time.Duration{0, 1, 3 * time.Hour, 3*time.Hour + 1}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, nil)
+			logs := captureLog(t)
+			c := newResyncCounter(tt.maxPerHour)
+			for _, offset := range tt.offsets {
+				c.Record("BTC_USDT", start.Add(offset))
+			}
+			if got := c.Counts()["BTC_USDT"]; got != int64(len(tt.offsets)) {
+				t.Errorf("count = %d, want %d", got, len(tt.offsets))
+			}
+			if got := strings.Count(logs.String(), "resynced"); got != tt.wantWarns {
+				t.Errorf("warnings = %d, want %d:\n%s", got, tt.wantWarns, logs)
+			}
+		})
+	}
+}
+
+func TestSequenceGapsCountResyncs(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.ReorderWindow = 0
+		cfg.MaxResyncsPerHour = 2
+	})
+	logs := captureLog(t)
+	captureSnapshotRequests(t)
+
+	for i := int64(0); i < 3; i++ {
+		id := 100 + i*10
+		applySnapshot("BTC_USDT", testBook(id, levels("101:1"), levels("99:1")))
+		handleWebSocketMessage(updateMessage("BTC_USDT", id+2, id+2, nil, levels("99:2")), time.Now().UnixNano())
+	}
+
+	if got := resyncCounts.Counts()["BTC_USDT"]; got != 3 {
+		t.Errorf("resyncs = %d, want 3", got)
+	}
+	if !strings.Contains(logs.String(), "Warning: BTC_USDT resynced 3 times within the last 1h0m0s (limit 2)") {
+		t.Errorf("no resync rate warning in log:\n%s", logs)
+	}
+
+	rec := httptest.NewRecorder()
+	handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats statsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Resyncs["BTC_USDT"] != 3 {
+		t.Errorf("/stats resyncs = %v, want 3 for BTC_USDT", stats.Resyncs)
+	}
+}
@@ -0,0 +1,163 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Дневная сводка по контракту
+type ContractRollup struct {
+	Open         *float64 `json:"open_mid"`
+	High         *float64 `json:"high_mid"`
+	Low          *float64 `json:"low_mid"`
+	Close        *float64 `json:"close_mid"`
+	AvgSpreadBps *float64 `json:"avg_spread_bps"`
+	MaxDepth     int      `json:"max_depth"` // Bid plus ask levels
+	Updates      int64    `json:"updates"`
+}
+
+// Накопитель статистики контракта за текущие сутки
+type rollupAccumulator struct {
+	hasMid                 bool
+	open, high, low, close float64
+	spreadSum              float64
+	spreads                int
+	maxDepth               int
+	updates                int64
+}
+
+// Дневные сводки; граница суток задается смещением от полуночи UTC
+type dailyRollup struct {
+	mu       sync.Mutex
+	dir      string
+	boundary time.Duration
+	now      func() time.Time
+	next     time.Time // End of the current period, set on the first Tick
+	stats    map[string]*rollupAccumulator
+}
+
+func newDailyRollup(dir string, boundary time.Duration) *dailyRollup {
+	return &dailyRollup{
+		dir:      dir,
+		boundary: boundary,
+		now:      time.Now,
+		stats:    make(map[string]*rollupAccumulator),
+	}
+}
+
+// Разбор границы суток в формате HH:MM (UTC)
+func parseRollupBoundary(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid boundary %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Ближайшая граница суток строго после t
+func nextBoundary(t time.Time, boundary time.Duration) time.Time {
+	t = t.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Add(boundary)
+	for !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Учет обновленного ордербука в статистике контракта
+func (r *dailyRollup) Observe(contract string, ob OrderBookResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	acc := r.stats[contract]
+	if acc == nil {
+		acc = &rollupAccumulator{}
+		r.stats[contract] = acc
+	}
+	acc.updates++
+	if depth := len(ob.Bids) + len(ob.Asks); depth > acc.maxDepth {
+		acc.maxDepth = depth
+	}
+
+	bid, ask, hasBid, hasAsk := bestPrices(ob)
+	if !hasBid || !hasAsk {
+		return
+	}
+	mid := (bid + ask) / 2
+	if !acc.hasMid {
+		acc.hasMid = true
+		acc.open, acc.high, acc.low = mid, mid, mid
+	}
+	if mid > acc.high {
+		acc.high = mid
+	}
+	if mid < acc.low {
+		acc.low = mid
+	}
+	acc.close = mid
+	if spread, ok := spreadBps(ob); ok {
+		acc.spreadSum += spread
+		acc.spreads++
+	}
+}
+
+// Проверка границы суток: при переходе пишет <date>-summary.json и сбрасывает статистику
+func (r *dailyRollup) Tick() {
+	r.mu.Lock()
+	now := r.now()
+	if r.next.IsZero() {
+		r.next = nextBoundary(now, r.boundary)
+	}
+	if now.Before(r.next) {
+		r.mu.Unlock()
+		return
+	}
+	date := r.next.AddDate(0, 0, -1).Format("2006-01-02")
+	summary := make(map[string]ContractRollup, len(r.stats))
+	for contract, acc := range r.stats {
+		summary[contract] = acc.rollup()
+	}
+	r.stats = make(map[string]*rollupAccumulator)
+	r.next = nextBoundary(now, r.boundary)
+	r.mu.Unlock()
+
+	if err := r.write(date, summary); err != nil {
+		errorf("Error writing daily rollup for %s: %v", date, err)
+		return
+	}
+	infof("Daily rollup for %s written (%d contracts)", date, len(summary))
+}
+
+func (acc *rollupAccumulator) rollup() ContractRollup {
+	rollup := ContractRollup{MaxDepth: acc.maxDepth, Updates: acc.updates}
+	if acc.hasMid {
+		rollup.Open = nullableFloat(acc.open)
+		rollup.High = nullableFloat(acc.high)
+		rollup.Low = nullableFloat(acc.low)
+		rollup.Close = nullableFloat(acc.close)
+	}
+	if acc.spreads > 0 {
+		rollup.AvgSpreadBps = nullableFloat(acc.spreadSum / float64(acc.spreads))
+	}
+	return rollup
+}
+
+func (r *dailyRollup) write(date string, summary map[string]ContractRollup) error {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create rollup directory: %v", err)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(r.dir, date+"-summary.json")
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file %s: %v", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRollupBoundary(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"08:30", 8*time.Hour + 30*time.Minute, false},
+		{"23:59", 23*time.Hour + 59*time.Minute, false},
+		{"24:00", 0, true},
+		{"8h", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseRollupBoundary(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("boundary = %v (%v), want %v (error %v)", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNextBoundary(t *testing.T) {
+	tests := []struct {
+		now      time.Time
+		boundary time.Duration
+		want     time.Time
+	}{
+		{time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), 0, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC), 8 * time.Hour, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+		// Ровно на границе - следующая граница
+		{time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), 8 * time.Hour, time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC), 0, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Местное время приводится к UTC
+		{time.Date(2024, 5, 1, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*3600)), 0, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := nextBoundary(tt.now, tt.boundary); !got.Equal(tt.want) {
+			t.Errorf("nextBoundary(%v, %v) = %v, want %v", tt.now, tt.boundary, got, tt.want)
+		}
+	}
+}
+
+func TestDailyRollupAcrossBoundary(t *testing.T) {
+	newTestTracker(t, nil)
+	captureLog(t)
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	rollup := newDailyRollup(dir, 0)
+	rollup.now = func() time.Time { return now }
+	rollup.Tick()
+
+	// Mid 100, 110, 95 при спреде 200 bps; односторонняя книга учитывается
+	// только в числе обновлений и глубине
+	for _, book := range []OrderBookResponse{
+		testBook(1, levels("101:1"), levels("99:1")),
+		testBook(2, levels("111.1:1", "112:1"), levels("108.9:1")),
+		testBook(3, levels("95.95:1"), levels("94.05:1", "94:1", "93:1")),
+		testBook(4, nil, levels("94:1")),
+	} {
+		rollup.Observe("BTC_USDT", book)
+	}
+	rollup.Observe("ETH_USDT", testBook(1, nil, levels("3000:1")))
+
+	now = now.Add(13 * time.Hour)
+	rollup.Tick()
+	path := filepath.Join(dir, "2024-05-01-summary.json")
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("rollup written before the boundary: %v", err)
+	}
+
+	now = time.Date(2024, 5, 2, 0, 0, 1, 0, time.UTC)
+	rollup.Tick()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary map[string]ContractRollup
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+
+	btc := summary["BTC_USDT"]
+	for name, got := range map[string]struct {
+		value *float64
+		want  float64
+	}{
+		"open":       {btc.Open, 100},
+		"high":       {btc.High, 110},
+		"low":        {btc.Low, 95},
+		"close":      {btc.Close, 95},
+		"avg spread": {btc.AvgSpreadBps, 200},
+	} {
+		if got.value == nil || !near(*got.value, got.want) {
+			t.Errorf("BTC_USDT %s = %v, want %v", name, got.value, got.want)
+		}
+	}
+	if btc.MaxDepth != 4 || btc.Updates != 4 {
+		t.Errorf("BTC_USDT depth %d, updates %d, want 4 and 4", btc.MaxDepth, btc.Updates)
+	}
+	// Без двусторонних книг цены сводки пустые
+	if eth := summary["ETH_USDT"]; eth.Open != nil || eth.AvgSpreadBps != nil || eth.Updates != 1 {
+		t.Errorf("ETH_USDT = %+v, want only the update count", eth)
+	}
+
+	// Статистика сброшена: следующие сутки начинаются с нуля
+	now = time.Date(2024, 5, 3, 0, 0, 1, 0, time.UTC)
+	rollup.Tick()
+	data, err = os.ReadFile(filepath.Join(dir, "2024-05-02-summary.json"))
+	if err != nil || string(data) != "{}" {
+		t.Errorf("next day rollup = %s (%v), want {}", data, err)
+	}
+}
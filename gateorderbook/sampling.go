@@ -0,0 +1,44 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Пуассоновский поток моментов сохранения: интервалы распределены
+// экспоненциально со средним mean, что исключает алиасинг при анализе архива
+type poissonSampler struct {
+	rng  *rand.Rand
+	mean time.Duration
+}
+
+// rate - среднее число сохранений в секунду; seed задает последовательность интервалов
+func newPoissonSampler(rate float64, seed int64) *poissonSampler {
+	return &poissonSampler{
+		rng:  rand.New(rand.NewSource(seed)),
+		mean: time.Duration(float64(time.Second) / rate),
+	}
+}
+
+// Интервал до следующего сохранения
+func (s *poissonSampler) Next() time.Duration {
+	return time.Duration(s.rng.ExpFloat64() * float64(s.mean))
+}
+
+// Сохранения по пуассоновскому потоку (nil - на каждом тике сохранения)
+var saveSampler *poissonSampler
+
+// Проверка режима выборки снимков: fixed или poisson
+func validateSampleMode(mode string, rate float64) error {
+	switch mode {
+	case "fixed":
+		return nil
+	case "poisson":
+		if rate <= 0 {
+			return fmt.Errorf("poisson sampling needs a positive rate, got %g", rate)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported sample mode %q, allowed: fixed, poisson", mode)
+}
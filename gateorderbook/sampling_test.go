@@ -0,0 +1,100 @@
+package gateorderbook
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPoissonSamplerIntervals(t *testing.T) {
+	const n = 20000
+	sampler := newPoissonSampler(10, 42)
+	mean := float64(100 * time.Millisecond)
+
+	intervals := make([]float64, n)
+	var sum float64
+	for i := range intervals {
+		interval := sampler.Next()
+		if interval < 0 {
+			t.Fatalf("negative interval %s", interval)
+		}
+		intervals[i] = float64(interval)
+		sum += intervals[i]
+	}
+	gotMean := sum / n
+	var sq float64
+	for _, interval := range intervals {
+		sq += (interval - gotMean) * (interval - gotMean)
+	}
+	stdDev := math.Sqrt(sq / n)
+	if math.Abs(gotMean-mean)/mean > 0.03 {
+		t.Errorf("mean interval = %s, want about %s", time.Duration(gotMean), time.Duration(mean))
+	}
+	// У экспоненциального распределения стандартное отклонение равно среднему
+	if math.Abs(stdDev-mean)/mean > 0.05 {
+		t.Errorf("interval std dev = %s, want about %s", time.Duration(stdDev), time.Duration(mean))
+	}
+	// Доля интервалов длиннее x должна быть близка к exp(-x/mean)
+	for _, x := range []float64{0.1, 0.5, 1, 2, 3} {
+		var longer int
+		for _, interval := range intervals {
+			if interval > x*mean {
+				longer++
+			}
+		}
+		got, want := float64(longer)/n, math.Exp(-x)
+		if math.Abs(got-want) > 0.015 {
+			t.Errorf("share of intervals above %.1f mean = %.3f, want %.3f", x, got, want)
+		}
+	}
+}
+
+func TestPoissonSamplerSeed(t *testing.T) {
+	a, b, c := newPoissonSampler(1, 7), newPoissonSampler(1, 7), newPoissonSampler(1, 8)
+	same, differs := true, false
+	for i := 0; i < 10; i++ {
+		x, y, z := a.Next(), b.Next(), c.Next()
+		same = same && x == y
+		differs = differs || x != z
+	}
+	if !same {
+		t.Error("the same seed produced different intervals")
+	}
+	if !differs {
+		t.Error("different seeds produced the same intervals")
+	}
+}
+
+func TestValidateSampleMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		rate    float64
+		wantErr string
+	}{
+		{"fixed", 0, ""},
+		{"poisson", 0.5, ""},
+		{"poisson", 0, "positive rate"},
+		{"poisson", -1, "positive rate"},
+		{"random", 1, "unsupported sample mode"},
+	}
+	for _, tt := range tests {
+		err := validateSampleMode(tt.mode, tt.rate)
+		if (err == nil) != (tt.wantErr == "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validateSampleMode(%q, %g) = %v, want %q", tt.mode, tt.rate, err, tt.wantErr)
+		}
+	}
+
+	// Без заданного seed трекер выбирает его сам и пишет в лог
+	logs := captureLog(t)
+	newTestTracker(t, func(cfg *Config) {
+		cfg.SampleMode = "poisson"
+		cfg.SampleRate = 2
+	})
+	if saveSampler == nil || saveSampler.mean != 500*time.Millisecond {
+		t.Errorf("sampler = %+v, want a mean gap of 500ms", saveSampler)
+	}
+	if !strings.Contains(logs.String(), "2 saves/s on average (seed ") {
+		t.Errorf("log = %q, want the chosen seed", logs)
+	}
+}
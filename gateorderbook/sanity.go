@@ -0,0 +1,129 @@
+package gateorderbook
+
+import (
+	"math"
+)
+
+// Проверка скачков лучших цен между последовательными обновлениями.
+// Скачок больше maxPct процентов помечается как подозрительный; при hold
+// книга с подозрительным обновлением не публикуется до следующего
+// обновления, которое либо подтверждает новый уровень, либо возвращает цену.
+// Само обновление не отбрасывается: последующие изменения биржи опираются
+// на него, а его дельта публикуется вместе с дельтой следующего.
+type jumpGuard struct {
+	maxPct float64
+	hold   bool
+	held   map[string]heldJump // Books with an unconfirmed jump, not yet published
+}
+
+// Удержанная книга и обновление, которое к ней привело
+type heldJump struct {
+	book   OrderBookResponse
+	update OrderBookUpdate
+}
+
+func newJumpGuard(maxPct float64, hold bool) *jumpGuard {
+	return &jumpGuard{
+		maxPct: maxPct,
+		hold:   hold,
+		held:   make(map[string]heldJump),
+	}
+}
+
+// Проверка лучших цен (nil - отключено)
+var priceJumps *jumpGuard
+
+// Наибольшее изменение лучшей цены (bid или ask) в процентах;
+// ok=false, если у одной из книг нет нужной стороны
+func bestPriceJumpPct(before, after OrderBookResponse) (float64, bool) {
+	bidBefore, askBefore, hasBidBefore, hasAskBefore := bestPrices(before)
+	bidAfter, askAfter, hasBidAfter, hasAskAfter := bestPrices(after)
+
+	jump, ok := 0.0, false
+	if hasBidBefore && hasBidAfter && bidBefore > 0 {
+		jump = math.Abs(bidAfter-bidBefore) / bidBefore * 100
+		ok = true
+	}
+	if hasAskBefore && hasAskAfter && askBefore > 0 {
+		jump = math.Max(jump, math.Abs(askAfter-askBefore)/askBefore*100)
+		ok = true
+	}
+	return jump, ok
+}
+
+// Книга, к которой применяется следующее обновление: удерживаемая, если есть
+func (g *jumpGuard) Base(contract string, published OrderBookResponse) OrderBookResponse {
+	if held, ok := g.held[contract]; ok {
+		return held.book
+	}
+	return published
+}
+
+// Проверка новой книги next, полученной обновлением update, относительно
+// опубликованной. false - книга удержана до подтверждения и не должна
+// публиковаться. При снятии удержания возвращается дельта от опубликованной
+// книги до next: удержанное обновление, объединенное с update.
+func (g *jumpGuard) Admit(contract string, published, next OrderBookResponse, update OrderBookUpdate) (OrderBookUpdate, bool) {
+	jump, ok := bestPriceJumpPct(published, next)
+	suspect := ok && jump > g.maxPct
+
+	if held, ok := g.held[contract]; ok {
+		delete(g.held, contract)
+		if suspect {
+			warnf("best price jump of %.2f%% for %s confirmed by the next update", jump, contract)
+		} else {
+			infof("Best price jump for %s reverted by the next update", contract)
+		}
+		return mergeUpdates(held.update, update), true
+	}
+
+	if !suspect {
+		return update, true
+	}
+	metrics.Count("orderbook.price_jumps."+contract, 1)
+	if g.hold {
+		warnf("best price of %s jumped %.2f%% (limit %.2f%%), holding the book until the next update", contract, jump, g.maxPct)
+		// Уровни копируются: обновление может ссылаться на переиспользуемый буфер декодирования
+		update.Asks = append([]OrderBookItem(nil), update.Asks...)
+		update.Bids = append([]OrderBookItem(nil), update.Bids...)
+		g.held[contract] = heldJump{book: next, update: update}
+		return update, false
+	}
+	warnf("best price of %s jumped %.2f%% (limit %.2f%%)", contract, jump, g.maxPct)
+	return update, true
+}
+
+// Одна дельта из двух последовательных: U первой, u и контрольная сумма
+// второй; уровень, измененный обоими, берется из второй
+func mergeUpdates(first, second OrderBookUpdate) OrderBookUpdate {
+	merged := second
+	if first.U != 0 {
+		merged.U = first.U
+	}
+	merged.Asks = mergeLevels(first.Asks, second.Asks)
+	merged.Bids = mergeLevels(first.Bids, second.Bids)
+	return merged
+}
+
+// Уровни first, не перекрытые second, и затем все уровни second
+func mergeLevels(first, second []OrderBookItem) []OrderBookItem {
+	merged := make([]OrderBookItem, 0, len(first)+len(second))
+	for _, level := range first {
+		overridden := false
+		for _, later := range second {
+			if comparePrices(level.P, later.P) == 0 {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, level)
+		}
+	}
+	return append(merged, second...)
+}
+
+// Сброс удерживаемой книги (после нового снимка)
+func (g *jumpGuard) Reset(contract string) {
+	delete(g.held, contract)
+}
@@ -0,0 +1,149 @@
+package gateorderbook
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBestPriceJumpPct(t *testing.T) {
+	before := testBook(1, levels("101:1"), levels("100:1"))
+	tests := []struct {
+		name   string
+		before OrderBookResponse
+		after  OrderBookResponse
+		want   float64
+		wantOK bool
+	}{
+		{"unchanged", before, before, 0, true},
+		{"bid moves", before, testBook(2, levels("101:1"), levels("99:1")), 1, true},
+		{"larger of both sides", before, testBook(2, levels("111.1:1"), levels("99:1")), 10, true},
+		{"no common side", testBook(1, levels("101:1"), nil), testBook(2, nil, levels("99:1")), 0, false},
+		{"empty book", OrderBookResponse{}, before, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := bestPriceJumpPct(tt.before, tt.after)
+		if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: jump = %v (%v), want %v (%v)", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestPriceJumpFlagged(t *testing.T) {
+	normal := updateMessage("BTC_USDT", 101, 101, levels("101:0", "100.5:1"), nil)
+	// Обе лучшие цены падают в 10 раз
+	absurd := updateMessage("BTC_USDT", 102, 102, levels("100.5:0", "10:1"), levels("99:0", "9:1"))
+	confirm := updateMessage("BTC_USDT", 103, 103, nil, levels("9:2"))
+	revert := updateMessage("BTC_USDT", 103, 103, levels("10:0", "100.5:1"), levels("9:0", "99:1"))
+
+	tests := []struct {
+		name     string
+		hold     bool
+		next     []byte
+		wantHeld string // Published asks after the absurd update
+		wantLast string // Published asks after the next update
+		wantLog  string
+	}{
+		{"flagged without hold", false, confirm, "10:1", "10:1", "best price of BTC_USDT jumped 90.91% (limit 5.00%)"},
+		{"held then confirmed", true, confirm, "100.5:1", "10:1", "jump of 90.91% for BTC_USDT confirmed by the next update"},
+		{"held then reverted", true, revert, "100.5:1", "100.5:1", "Best price jump for BTC_USDT reverted by the next update"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) {
+				cfg.MaxJumpPct = 5
+				cfg.HoldJumps = tt.hold
+			})
+			logs := captureLog(t)
+			applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+			handleWebSocketMessage(normal, time.Now().UnixNano())
+			if strings.Contains(logs.String(), "jump") {
+				t.Fatalf("normal update flagged: %q", logs)
+			}
+			handleWebSocketMessage(absurd, time.Now().UnixNano())
+			if !strings.Contains(logs.String(), "Warning: best price of BTC_USDT jumped 90.91% (limit 5.00%)") {
+				t.Errorf("log = %q, want the jump flagged", logs)
+			}
+			if book, _ := orderbooks.Get("BTC_USDT"); levelSpecs(book.Asks) != tt.wantHeld {
+				t.Errorf("published asks after the jump = %s, want %s", levelSpecs(book.Asks), tt.wantHeld)
+			}
+
+			handleWebSocketMessage(tt.next, time.Now().UnixNano())
+			book, _ := orderbooks.Get("BTC_USDT")
+			if levelSpecs(book.Asks) != tt.wantLast || book.ID != 103 {
+				t.Errorf("published book %d asks = %s, want 103 = %s", book.ID, levelSpecs(book.Asks), tt.wantLast)
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("log = %q, want %q", logs, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestHeldJumpPublishedWithNextUpdate(t *testing.T) {
+	absurd := updateMessage("BTC_USDT", 101, 101, levels("101:0", "10:1"), levels("99:0", "9:1"))
+	tests := []struct {
+		name string
+		next []byte
+	}{
+		{"confirmed", updateMessage("BTC_USDT", 102, 102, levels("10:2"), levels("9:2"))},
+		{"reverted", updateMessage("BTC_USDT", 102, 102, levels("10:0", "101:1"), levels("9:0", "99:1"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chdirTemp(t)
+			captureLog(t)
+			tracker := newTestTracker(t, func(cfg *Config) {
+				cfg.MaxJumpPct = 5
+				cfg.HoldJumps = true
+				cfg.ChangeLog = true
+			})
+			book := testBook(100, levels("101:1"), levels("99:1"))
+			book.ReceivedNs = time.Now().UnixNano()
+			applySnapshot("BTC_USDT", book)
+			handleWebSocketMessage(absurd, time.Now().UnixNano())
+			if lastUpdateIDs["BTC_USDT"] != 101 {
+				t.Errorf("sequence at %d after the held update, want 101", lastUpdateIDs["BTC_USDT"])
+			}
+			handleWebSocketMessage(tt.next, time.Now().UnixNano())
+			live, _ := orderbooks.Get("BTC_USDT")
+			tracker.Close()
+
+			// Удержанная дельта попадает в журнал вместе со следующей одной строкой
+			path := "orderbooks/BTC_USDT.ndjson"
+			lines := readLines(t, path)
+			if len(lines) != 2 || !strings.Contains(lines[1], `"U":101,"u":102`) {
+				t.Fatalf("change log = %q, want the snapshot and one merged delta 101-102", lines)
+			}
+			// Журнал воспроизводится без разрывов в ту же книгу
+			newTestTracker(t, nil)
+			if err := replayChangeLog(context.Background(), path, false, true); err != nil {
+				t.Fatal(err)
+			}
+			replayed, _ := orderbooks.Get("BTC_USDT")
+			if replayed.ID != live.ID || levelSpecs(replayed.Asks) != levelSpecs(live.Asks) || levelSpecs(replayed.Bids) != levelSpecs(live.Bids) {
+				t.Errorf("replayed book %d %s / %s, live %d %s / %s", replayed.ID, levelSpecs(replayed.Asks), levelSpecs(replayed.Bids),
+					live.ID, levelSpecs(live.Asks), levelSpecs(live.Bids))
+			}
+		})
+	}
+}
+
+func TestMergeUpdates(t *testing.T) {
+	first := OrderBookUpdate{U: 101, End: 101, Asks: levels("10:1", "11:1"), Bids: levels("9:1")}
+	second := OrderBookUpdate{U: 102, End: 103, Asks: levels("10.0:0", "12:1")}
+	merged := mergeUpdates(first, second)
+	if merged.U != 101 || merged.End != 103 {
+		t.Errorf("merged ids = %d-%d, want 101-103", merged.U, merged.End)
+	}
+	// Уровень 10 из второй дельты перекрывает первую
+	if got := levelSpecs(merged.Asks); got != "11:1 10.0:0 12:1" {
+		t.Errorf("merged asks = %s", got)
+	}
+	if got := levelSpecs(merged.Bids); got != "9:1" {
+		t.Errorf("merged bids = %s", got)
+	}
+}
@@ -0,0 +1,47 @@
+package gateorderbook
+
+import "sync"
+
+// Объем записи сохранений контракта
+type SaveStats struct {
+	Saves      int64 `json:"saves"`
+	LastBytes  int64 `json:"last_bytes"`  // Bytes written by the latest save (current on-disk size)
+	TotalBytes int64 `json:"total_bytes"` // Bytes written by all saves since start
+}
+
+// Учет байтов, записанных сохранениями, по контрактам
+type saveStatsRecorder struct {
+	mu    sync.Mutex
+	stats map[string]SaveStats
+}
+
+func newSaveStatsRecorder() *saveStatsRecorder {
+	return &saveStatsRecorder{stats: make(map[string]SaveStats)}
+}
+
+var saveSizes = newSaveStatsRecorder()
+
+// Регистрация сохранения контракта размером bytes
+func (r *saveStatsRecorder) Record(contract string, bytes int64) {
+	r.mu.Lock()
+	s := r.stats[contract]
+	s.Saves++
+	s.LastBytes = bytes
+	s.TotalBytes += bytes
+	r.stats[contract] = s
+	r.mu.Unlock()
+
+	metrics.Gauge("orderbook.save_bytes."+contract, float64(bytes))
+	metrics.Count("orderbook.saved_bytes_total."+contract, bytes)
+}
+
+// Статистика сохранений по всем контрактам
+func (r *saveStatsRecorder) Stats() map[string]SaveStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]SaveStats, len(r.stats))
+	for contract, s := range r.stats {
+		stats[contract] = s
+	}
+	return stats
+}
@@ -0,0 +1,81 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Суммарный размер файлов в байтах
+func fileSizes(t *testing.T, paths ...string) int64 {
+	t.Helper()
+	var total int64
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += info.Size()
+	}
+	return total
+}
+
+func TestSaveStatsMatchWrittenFiles(t *testing.T) {
+	dir := chdirTemp(t)
+	newTestTracker(t, func(cfg *Config) {
+		cfg.SaverEnabled = true
+		cfg.OutputDepths = []int{1}
+	})
+	captureLog(t)
+	saveSizes = newSaveStatsRecorder()
+	t.Cleanup(func() { saveSizes = newSaveStatsRecorder() })
+	files := []string{
+		filepath.Join(dir, "orderbooks", "BTC_USDT.txt"),
+		filepath.Join(dir, "orderbooks", "BTC_USDT.1.txt"),
+	}
+
+	if err := saveOrderBook("BTC_USDT", testBook(100, levels("101:1"), levels("99:1"))); err != nil {
+		t.Fatal(err)
+	}
+	first := fileSizes(t, files...)
+	if err := saveOrderBook("BTC_USDT", testBook(101, levels("101:1", "102:2", "103:3"), levels("99:1", "98:2"))); err != nil {
+		t.Fatal(err)
+	}
+	second := fileSizes(t, files...)
+	if second <= first {
+		t.Fatalf("file sizes %d then %d, want the deeper book larger", first, second)
+	}
+
+	rec := httptest.NewRecorder()
+	handleStats(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+	var stats statsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := SaveStats{Saves: 2, LastBytes: second, TotalBytes: first + second}
+	if got := stats.Saves["BTC_USDT"]; got != want {
+		t.Errorf("save stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestSaveStatsCustomWriter(t *testing.T) {
+	var saves saveCounter
+	newTestTracker(t, func(cfg *Config) {
+		cfg.SaverEnabled = true
+		cfg.Writer = saves.writer
+	})
+	saveSizes = newSaveStatsRecorder()
+	t.Cleanup(func() { saveSizes = newSaveStatsRecorder() })
+
+	book := testBook(100, levels("101:1"), levels("99:1"))
+	if err := saveOrderBook("BTC_USDT", book); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(formatOrderBook("BTC_USDT", book)))
+	if got := saveSizes.Stats()["BTC_USDT"]; got != (SaveStats{Saves: 1, LastBytes: size, TotalBytes: size}) {
+		t.Errorf("save stats = %+v, want one save of %d bytes", got, size)
+	}
+}
@@ -0,0 +1,136 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Файл секретов с правами mode во временной директории
+func writeSecretsFile(t *testing.T, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Запись JSON сообщений вместо WebSocket соединения
+type jsonRecorder struct {
+	messages []map[string]interface{}
+}
+
+func (r *jsonRecorder) WriteJSON(v interface{}) error {
+	r.messages = append(r.messages, v.(map[string]interface{}))
+	return nil
+}
+
+func TestSecretsFileAppliedAndNeverLogged(t *testing.T) {
+	const (
+		key       = "test-api-key-4c1f"
+		secret    = "test-api-secret-9e2b"
+		proxyPass = "proxy-pass-77d0"
+	)
+	var proxied *http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r
+		w.Write([]byte(`{}`))
+	}))
+	defer proxy.Close()
+	proxyURL := strings.Replace(proxy.URL, "http://", "http://user:"+proxyPass+"@", 1)
+	path := writeSecretsFile(t, fmt.Sprintf(`{"proxy": %q, "api_key": %q, "api_secret": %q}`, proxyURL, key, secret), 0600)
+
+	logs := captureLog(t)
+	LogLevel.Set(slog.LevelDebug)
+	newTestTracker(t, func(cfg *Config) { cfg.SecretsFile = path })
+	t.Cleanup(func() { newTestTracker(t, nil) })
+
+	// REST запросы идут через прокси и подписываются ключом
+	resp, err := httpClient.Get("http://" + apiHost + "/api/v4/futures/usdt/order_book?contract=BTC_USDT&limit=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied == nil {
+		t.Fatal("request did not go through the proxy")
+	}
+	if proxied.Header.Get("Proxy-Authorization") == "" {
+		t.Error("proxy credentials not sent")
+	}
+	if proxied.Header.Get("KEY") != key || proxied.Header.Get("SIGN") == "" || proxied.Header.Get("Timestamp") == "" {
+		t.Errorf("request not signed: %v", proxied.Header)
+	}
+
+	// Подписки на каналы содержат auth
+	conn := &jsonRecorder{}
+	if err := newSubscriptionTracker().Subscribe(conn, subscription{Contract: "BTC_USDT", Interval: "100ms"}); err != nil {
+		t.Fatal(err)
+	}
+	auth, ok := conn.messages[0]["auth"].(map[string]string)
+	if !ok || auth["KEY"] != key || auth["SIGN"] == "" {
+		t.Errorf("subscribe auth = %v", conn.messages[0]["auth"])
+	}
+
+	secrets, err := loadSecrets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := fmt.Sprintf("%v %+v %#v %s", secrets, secrets, secrets, secrets)
+	for _, value := range []string{key, secret, proxyPass} {
+		if strings.Contains(logs.String(), value) {
+			t.Errorf("log contains secret %q:\n%s", value, logs)
+		}
+		if strings.Contains(formatted, value) {
+			t.Errorf("formatted secrets contain %q: %s", value, formatted)
+		}
+	}
+	if !strings.Contains(logs.String(), "Signing REST requests") {
+		t.Errorf("signing not reported in log:\n%s", logs)
+	}
+}
+
+func TestSecretsFileChecks(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		mode     os.FileMode
+		wantErr  bool
+		wantWarn bool
+	}{
+		{"private file", `{"api_key": "k", "api_secret": "s"}`, 0600, false, false},
+		{"world-readable file", `{"api_key": "k", "api_secret": "s"}`, 0644, false, true},
+		{"key without secret", `{"api_key": "k"}`, 0600, true, false},
+		{"bad proxy", `{"proxy": "::"}`, 0600, true, false},
+		{"bad json", `{"api_key": `, 0600, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, nil)
+			logs := captureLog(t)
+			path := writeSecretsFile(t, tt.content, tt.mode)
+			cfg := DefaultConfig()
+			cfg.SecretsFile = path
+			closeLiveTracker()
+			_, err := New(cfg)
+			t.Cleanup(func() { newTestTracker(t, nil) })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New error = %v, want error %v", err, tt.wantErr)
+			}
+			if warned := strings.Contains(logs.String(), "world-readable"); warned != tt.wantWarn {
+				t.Errorf("world-readable warning = %v, want %v", warned, tt.wantWarn)
+			}
+			if tt.wantErr && apiKeys.enabled() {
+				t.Error("API key applied from a rejected secrets file")
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package gateorderbook
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Заголовок CSV ряда лучших цен
+const seriesHeader = "ts,bestBid,bestAsk,midPrice\n"
+
+// Открытый файл ряда с буфером записи: буфер -> сжатие (если включено) -> файл
+type seriesFile struct {
+	f *os.File
+	z compressWriter // nil without compression
+	w *bufio.Writer
+}
+
+// Сброс буфера и сжатых данных в файл
+func (sf *seriesFile) flush() error {
+	if err := sf.w.Flush(); err != nil {
+		return err
+	}
+	if sf.z != nil {
+		return sf.z.Flush()
+	}
+	return nil
+}
+
+// Политика буферизации ряда. Больший буфер и редкий сброс повышают
+// пропускную способность, но при падении процесса теряются строки,
+// не сброшенные с последнего Flush; fsync дополнительно защищает
+// сброшенные строки от потери при сбое ОС или питания ценой задержки.
+type seriesFlushPolicy struct {
+	BufferSize int  // Per-file buffer in bytes; 0 writes every row through immediately
+	Fsync      bool // fsync files on every Flush
+}
+
+// Запись ряда лучших bid/ask в CSV файл на каждый контракт (<symbol>.tob.csv).
+// При maxPerSec > 0 в секунду пишется не больше maxPerSec строк на контракт:
+// сверх лимита сохраняется только последняя строка, она пишется в начале следующей секунды.
+// Со сжатием файл называется <symbol>.tob.csv.gz или <symbol>.tob.csv.zst.
+type seriesWriter struct {
+	mu        sync.Mutex
+	dir       string
+	files     map[string]*seriesFile
+	policy    seriesFlushPolicy
+	compress  compression
+	maxPerSec int
+	window    map[string]int64  // Current one-second window (unix seconds)
+	count     map[string]int    // Rows written in the current window
+	pending   map[string]string // Latest row held back by the rate limit
+	dropped   map[string]int64
+}
+
+func newSeriesWriter(dir string, maxPerSec int, policy seriesFlushPolicy, compress compression) *seriesWriter {
+	return &seriesWriter{
+		dir:       dir,
+		files:     make(map[string]*seriesFile),
+		policy:    policy,
+		compress:  compress,
+		maxPerSec: maxPerSec,
+		window:    make(map[string]int64),
+		count:     make(map[string]int),
+		pending:   make(map[string]string),
+		dropped:   make(map[string]int64),
+	}
+}
+
+// Открытие (или создание с заголовком) файла ряда для контракта
+func (w *seriesWriter) file(contract string) (*seriesFile, error) {
+	if sf, ok := w.files[contract]; ok {
+		return sf, nil
+	}
+
+	err := os.MkdirAll(w.dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create series directory: %v", err)
+	}
+
+	filename := filepath.Join(w.dir, fmt.Sprintf("%s.tob.csv%s", contract, w.compress.ext()))
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open series file %s: %v", filename, err)
+	}
+	// Второй писатель (другой экземпляр) не должен дописывать в тот же файл
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat series file %s: %v", filename, err)
+	}
+
+	size := w.policy.BufferSize
+	if size <= 0 {
+		size = 4096
+	}
+	sf := &seriesFile{f: f}
+	if sf.z, err = w.compress.writer(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to start compression of series file %s: %v", filename, err)
+	}
+	if sf.z != nil {
+		sf.w = bufio.NewWriterSize(sf.z, size)
+	} else {
+		sf.w = bufio.NewWriterSize(f, size)
+	}
+	if info.Size() == 0 {
+		sf.w.WriteString(seriesHeader)
+		if err := sf.flush(); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to write series header %s: %v", filename, err)
+		}
+	}
+	w.files[contract] = sf
+	return sf, nil
+}
+
+// Открытие и блокировка файлов ряда заранее, чтобы занятый другим
+// экземпляром файл обнаружился при запуске, а не на каждом обновлении
+func (w *seriesWriter) Open(contracts []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, contract := range contracts {
+		if _, err := w.file(contract); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Форматирование строки ряда; пустые поля для отсутствующих сторон
+func formatSeriesRow(ts time.Time, orderbook OrderBookResponse) string {
+	bid, ask, hasBid, hasAsk := bestPrices(orderbook)
+	bidField, askField, midField := "", "", ""
+	if hasBid {
+		bidField = strconv.FormatFloat(bid, 'f', -1, 64)
+	}
+	if hasAsk {
+		askField = strconv.FormatFloat(ask, 'f', -1, 64)
+	}
+	if hasBid && hasAsk {
+		midField = strconv.FormatFloat((bid+ask)/2, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%d,%s,%s,%s\n", ts.UnixMilli(), bidField, askField, midField)
+}
+
+// Запись строки в файл ряда контракта
+func (w *seriesWriter) write(contract, row string) error {
+	sf, err := w.file(contract)
+	if err != nil {
+		return err
+	}
+	_, err = sf.w.WriteString(row)
+	if err == nil && w.policy.BufferSize <= 0 {
+		err = sf.flush()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to append series row for %s: %v", contract, err)
+	}
+	return nil
+}
+
+// Начало нового секундного окна: отложенная строка пишется первой и учитывается в нем
+func (w *seriesWriter) startWindow(contract string, sec int64) error {
+	w.window[contract] = sec
+	w.count[contract] = 0
+	row, ok := w.pending[contract]
+	if !ok {
+		return nil
+	}
+	delete(w.pending, contract)
+	w.count[contract] = 1
+	return w.write(contract, row)
+}
+
+// Добавление строки с лучшими ценами контракта
+func (w *seriesWriter) Append(contract string, ts time.Time, orderbook OrderBookResponse) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	row := formatSeriesRow(ts, orderbook)
+	if w.maxPerSec <= 0 {
+		return w.write(contract, row)
+	}
+
+	if sec := ts.Unix(); w.window[contract] != sec {
+		if err := w.startWindow(contract, sec); err != nil {
+			return err
+		}
+	}
+	if w.count[contract] < w.maxPerSec {
+		w.count[contract]++
+		return w.write(contract, row)
+	}
+
+	// Лимит исчерпан - оставляем только последнюю строку
+	if _, ok := w.pending[contract]; ok {
+		w.dropped[contract]++
+		metrics.Count("series.dropped."+contract, 1)
+	}
+	w.pending[contract] = row
+	return nil
+}
+
+// Запись отложенных строк, чьи секундные окна уже закончились
+func (w *seriesWriter) FlushPending(now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	sec := now.Unix()
+	for contract := range w.pending {
+		if w.window[contract] < sec {
+			if err := w.startWindow(contract, sec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Количество строк, отброшенных лимитом, по контрактам
+func (w *seriesWriter) Dropped() map[string]int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	dropped := make(map[string]int64, len(w.dropped))
+	for contract, n := range w.dropped {
+		dropped[contract] = n
+	}
+	return dropped
+}
+
+// Сброс буферов всех файлов ряда (и fsync, если включен)
+func (w *seriesWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var firstErr error
+	for contract, sf := range w.files {
+		err := sf.flush()
+		if err == nil && w.policy.Fsync {
+			err = sf.f.Sync()
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to flush series for %s: %v", contract, err)
+		}
+	}
+	return firstErr
+}
+
+// Периодический сброс буферов ряда до отмены ctx
+func (w *seriesWriter) runFlusher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Flush(); err != nil {
+				errorf("Error flushing top-of-book series: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Сброс буферов, завершение сжатых потоков и закрытие всех файлов ряда
+func (w *seriesWriter) Close() error {
+	err := w.Flush()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for contract, sf := range w.files {
+		if sf.z != nil {
+			if zerr := sf.z.Close(); zerr != nil && err == nil {
+				err = fmt.Errorf("failed to finish series for %s: %v", contract, zerr)
+			}
+		}
+		sf.f.Close()
+		delete(w.files, contract)
+	}
+	return err
+}
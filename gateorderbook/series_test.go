@@ -0,0 +1,182 @@
+package gateorderbook
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeriesFlusherStopsOnCancel(t *testing.T) {
+	newTestTracker(t, nil)
+	dir := t.TempDir()
+	w := newSeriesWriter(dir, 0, seriesFlushPolicy{BufferSize: 4096}, compression{})
+	defer w.Close()
+	if err := w.Append("BTC_USDT", time.UnixMilli(1000), testBook(1, levels("101:1"), levels("99:1"))); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.runFlusher(ctx, time.Millisecond)
+	}()
+
+	path := filepath.Join(dir, "BTC_USDT.tob.csv")
+	for i := 0; len(readLines(t, path)) < 2; i++ {
+		if i > 500 {
+			t.Fatal("buffered row not flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if lines := readLines(t, path); lines[1] != "1000,99,101,100" {
+		t.Errorf("row = %q, want 1000,99,101,100", lines[1])
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("flusher did not stop on cancel")
+	}
+}
+
+func TestSeriesRows(t *testing.T) {
+	tests := []struct {
+		name string
+		book OrderBookResponse
+		want string
+	}{
+		{"two-sided", testBook(1, levels("101.5:1"), levels("99.25:1")), "1700000000123,99.25,101.5,100.375\n"},
+		{"bids only", testBook(1, nil, levels("99:1")), "1700000000123,99,,\n"},
+		{"asks only", testBook(1, levels("101:1"), nil), "1700000000123,,101,\n"},
+		{"empty", testBook(1, nil, nil), "1700000000123,,,\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatSeriesRow(time.UnixMilli(1700000000123), tt.book); got != tt.want {
+				t.Errorf("row = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeriesAppendsAcrossRestarts(t *testing.T) {
+	newTestTracker(t, nil)
+	dir := t.TempDir()
+	book := testBook(1, levels("101:1"), levels("99:1"))
+	for i, ms := range []int64{1000, 2000} {
+		w := newSeriesWriter(dir, 0, seriesFlushPolicy{}, compression{})
+		if err := w.Append("BTC_USDT", time.UnixMilli(ms), book); err != nil {
+			t.Fatalf("writer %d: %v", i, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := strings.Join(readLines(t, filepath.Join(dir, "BTC_USDT.tob.csv")), "\n")
+	if want := "ts,bestBid,bestAsk,midPrice\n1000,99,101,100\n2000,99,101,100"; got != want {
+		t.Errorf("series file:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSeriesRecordsUpdates(t *testing.T) {
+	dir := chdirTemp(t)
+	tracker := newTestTracker(t, func(cfg *Config) { cfg.TopOfBookSeries = true })
+	t.Cleanup(tracker.Close)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, nil, levels("100:2")), time.UnixMilli(5000).UnixNano())
+
+	lines := readLines(t, filepath.Join(dir, "orderbooks", "BTC_USDT.tob.csv"))
+	if len(lines) != 2 || lines[1] != "5000,100,101,100.5" {
+		t.Errorf("series = %q, want the header and 5000,100,101,100.5", lines)
+	}
+}
+
+func TestSeriesRateLimit(t *testing.T) {
+	newTestTracker(t, nil)
+	dir := t.TempDir()
+	w := newSeriesWriter(dir, 2, seriesFlushPolicy{}, compression{})
+	defer w.Close()
+	book := testBook(1, levels("101:1"), levels("99:1"))
+
+	// 10 обновлений за секунду при лимите 2 строки в секунду
+	for ms := int64(1000); ms < 2000; ms += 100 {
+		if err := w.Append("BTC_USDT", time.UnixMilli(ms), book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Отложенная строка 1900 пишется в начале следующей секунды и занимает место в ней
+	for _, ms := range []int64{2000, 2500} {
+		if err := w.Append("BTC_USDT", time.UnixMilli(ms), book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Строка 2500 сверх лимита пишется по окончании окна
+	if err := w.FlushPending(time.UnixMilli(2900)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.FlushPending(time.UnixMilli(3000)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, line := range readLines(t, filepath.Join(dir, "BTC_USDT.tob.csv"))[1:] {
+		ts, _, _ := strings.Cut(line, ",")
+		got = append(got, ts)
+	}
+	if want := "1000 1100 1900 2000 2500"; strings.Join(got, " ") != want {
+		t.Errorf("written rows = %v, want %s", got, want)
+	}
+	if dropped := w.Dropped(); dropped["BTC_USDT"] != 7 {
+		t.Errorf("dropped = %v, want 7 for BTC_USDT", dropped)
+	}
+}
+
+func TestSeriesFlushPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       seriesFlushPolicy
+		wantBuffered bool // Row is not in the file until Flush or Close
+	}{
+		{"unbuffered", seriesFlushPolicy{}, false},
+		{"buffered", seriesFlushPolicy{BufferSize: 4096}, true},
+		{"buffered with fsync", seriesFlushPolicy{BufferSize: 4096, Fsync: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, nil)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "BTC_USDT.tob.csv")
+			w := newSeriesWriter(dir, 0, tt.policy, compression{})
+			book := testBook(1, levels("101:1"), levels("99:1"))
+			if err := w.Append("BTC_USDT", time.UnixMilli(1000), book); err != nil {
+				t.Fatal(err)
+			}
+			rows := len(readLines(t, path)) - 1
+			if buffered := rows == 0; buffered != tt.wantBuffered {
+				t.Errorf("rows before flush = %d, want buffered %v", rows, tt.wantBuffered)
+			}
+
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if rows := len(readLines(t, path)) - 1; rows != 1 {
+				t.Errorf("rows after flush = %d, want 1", rows)
+			}
+
+			// Остаток буфера сбрасывается при закрытии
+			if err := w.Append("BTC_USDT", time.UnixMilli(2000), book); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if rows := len(readLines(t, path)) - 1; rows != 2 {
+				t.Errorf("rows after close = %d, want 2", rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package gateorderbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Источник поля time в запросах подписки: local - локальные часы,
+// server - локальные часы с поправкой на расхождение с сервером
+// (пока поправка неизвестна, используются локальные часы)
+var subscribeTimeSource = "local"
+
+// Проверка источника времени подписки
+func validateSubscribeTimeSource(source string) error {
+	if source != "local" && source != "server" {
+		return fmt.Errorf("unsupported subscribe time source %q, allowed: local, server", source)
+	}
+	return nil
+}
+
+// REST метод времени сервера
+const serverTimeEndpoint = "https://" + apiHost + "/api/v4/spot/time"
+
+// Расхождение часов сервера с локальными: серверное время = локальное + offset
+type serverClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+	known  bool
+}
+
+var serverTime = &serverClock{}
+
+// Учет времени сервера serverMs, полученного в момент localNs
+func (c *serverClock) Observe(serverMs, localNs int64) {
+	offset := time.Duration(serverMs)*time.Millisecond - time.Duration(localNs)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset, c.known = offset, true
+}
+
+// Поправка к локальным часам; ok=false, если время сервера еще не получено
+func (c *serverClock) Offset() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset, c.known
+}
+
+// Время для поля time подписки, unix секунды
+func subscribeTime(now time.Time) int64 {
+	if subscribeTimeSource == "server" {
+		if offset, ok := serverTime.Offset(); ok {
+			now = now.Add(offset)
+		}
+	}
+	return now.Unix()
+}
+
+// Ответ метода времени сервера
+type serverTimeResponse struct {
+	ServerTime int64 `json:"server_time"` // Unix ms
+}
+
+// Синхронизация с временем сервера по REST: время ответа сопоставляется
+// с серединой интервала запроса
+func syncServerTime(ctx context.Context, endpoint string) error {
+	sent := time.Now()
+	resp, err := httpGetRateLimited(ctx, endpoint)
+	if err != nil {
+		return fmt.Errorf("HTTP request error: %v", err)
+	}
+	defer resp.Body.Close()
+	received := time.Now()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Response read error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		return &apiError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	var parsed serverTimeResponse
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.ServerTime <= 0 {
+		return fmt.Errorf("invalid server time response: %s", string(body))
+	}
+
+	midpoint := sent.Add(received.Sub(sent) / 2)
+	serverTime.Observe(parsed.ServerTime, midpoint.UnixNano())
+	offset, _ := serverTime.Offset()
+	infof("Server clock offset: %s (round trip %s)", offset.Round(time.Millisecond), received.Sub(sent).Round(time.Millisecond))
+	return nil
+}
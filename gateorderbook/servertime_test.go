@@ -0,0 +1,113 @@
+package gateorderbook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Часы сервера без поправки на время теста
+func resetServerClock(t *testing.T) {
+	t.Helper()
+	prev := serverTime
+	serverTime = &serverClock{}
+	t.Cleanup(func() { serverTime = prev })
+}
+
+func TestSubscribeTime(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name   string
+		source string
+		offset time.Duration // Observed server offset; 0 - none observed
+		want   int64
+	}{
+		{"local clock", "local", time.Hour, 1700000000},
+		{"server offset unknown", "server", 0, 1700000000},
+		{"server ahead", "server", 90 * time.Second, 1700000090},
+		{"server behind", "server", -30 * time.Second, 1699999970},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.SubscribeTime = tt.source })
+			resetServerClock(t)
+			if tt.offset != 0 {
+				serverTime.Observe(now.Add(tt.offset).UnixMilli(), now.UnixNano())
+			}
+			if got := subscribeTime(now); got != tt.want {
+				t.Errorf("subscribe time = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeUsesServerTime(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.SubscribeTime = "server" })
+	resetServerClock(t)
+	recordingSubscriptions(t)
+	captureLog(t)
+
+	// Часы сервера отстают на 2 часа: поправка берется из времени кадра
+	serverNow := time.Now().Add(-2 * time.Hour)
+	frame, _ := json.Marshal(WebSocketMessage{TimeMs: serverNow.UnixMilli(), Channel: "futures.order_book_update", Event: "update"})
+	handleWebSocketMessage(frame, time.Now().UnixNano())
+
+	conn := &jsonRecorder{}
+	if err := subscriptions.Subscribe(conn, subscription{Contract: "BTC_USDT", Interval: "100ms"}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := conn.messages[0]["time"].(int64)
+	if diff := got - serverNow.Unix(); diff < -2 || diff > 2 {
+		t.Errorf("subscribe time = %d, want about the server time %d", got, serverNow.Unix())
+	}
+
+	// С локальным источником кадры не сдвигают время подписки
+	newTestTracker(t, func(cfg *Config) { cfg.SubscribeTime = "local" })
+	resetServerClock(t)
+	handleWebSocketMessage(frame, time.Now().UnixNano())
+	if _, known := serverTime.Offset(); known {
+		t.Error("server offset observed with the local time source")
+	}
+}
+
+func TestSyncServerTime(t *testing.T) {
+	newTestTracker(t, nil)
+	resetServerClock(t)
+	captureLog(t)
+	status, body := http.StatusOK, ""
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if body != "" {
+			w.Write([]byte(body))
+			return
+		}
+		fmt.Fprintf(w, `{"server_time":%d}`, time.Now().Add(90*time.Second).UnixMilli())
+	})
+
+	if err := syncServerTime(context.Background(), serverTimeEndpoint); err != nil {
+		t.Fatal(err)
+	}
+	offset, known := serverTime.Offset()
+	if !known || offset < 89*time.Second || offset > 91*time.Second {
+		t.Errorf("offset = %s (known %v), want about 90s", offset, known)
+	}
+
+	for _, tt := range []struct {
+		status  int
+		body    string
+		wantErr string
+	}{
+		{http.StatusOK, `{"server_time":0}`, "invalid server time response"},
+		{http.StatusOK, `not json`, "invalid server time response"},
+		{http.StatusInternalServerError, `{"label":"SERVER_ERROR"}`, "500"},
+	} {
+		status, body = tt.status, tt.body
+		if err := syncServerTime(context.Background(), serverTimeEndpoint); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("response %d %s: error = %v, want %q", tt.status, tt.body, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package gateorderbook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSignRequest(t *testing.T) {
+	keys := apiCredentials{key: "key", secret: "secret"}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		query  string
+		body   string
+		want   string
+	}{
+		{"get with query", "GET", "/api/v4/futures/usdt/order_book", "contract=BTC_USDT&limit=50", "",
+			"18c206aeef7ee77813730d9bc7912e091d54d279bf11338bb01198618f8cfa7431d0aa67a6f49c06283086cc7df0d177b7070eac51baa40f462e3813a2dbdbef"},
+		{"post with body", "POST", "/api/v4/futures/usdt/orders", "settle=usdt", `{"contract":"BTC_USDT"}`,
+			"48279900168059c119d24059815774e4e5f611b857a9933f2982494b1373b195cfbe4ec5c0c4666b3ad468303a2b6bd2f77f59628ae82441a578b4758ded7eb4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keys.signRequest(tt.method, tt.path, tt.query, []byte(tt.body), 1700000000); got != tt.want {
+				t.Errorf("sign = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	want := "3b0ec72fb57d1b5f2503e16b902cb6b3aee334a242e7c23767df0d5e06fb3f6a4fbb22f1b6d8f77f5858b06d40fd6fd924dca5869b20727a9a72ad95c3c0b76e"
+	if got := keys.signChannel("futures.order_book_update", "subscribe", 1700000000); got != want {
+		t.Errorf("channel sign = %s, want %s", got, want)
+	}
+}
+
+func TestSigningTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       apiCredentials
+		otherHost  bool // Запрос не к хосту API
+		body       string
+		wantSigned bool
+	}{
+		{"no key", apiCredentials{}, false, "", false},
+		{"get", apiCredentials{key: "key", secret: "secret"}, false, "", true},
+		{"post keeps body", apiCredentials{key: "key", secret: "secret"}, false, `{"contract":"BTC_USDT"}`, true},
+		{"other host", apiCredentials{key: "key", secret: "secret"}, true, `{"contract":"BTC_USDT"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, nil)
+			apiKeys = tt.keys
+			var got *http.Request
+			var gotBody string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				data, _ := io.ReadAll(r.Body)
+				gotBody = string(data)
+			}))
+			defer server.Close()
+
+			host := strings.TrimPrefix(server.URL, "http://")
+			if tt.otherHost {
+				host = apiHost
+			}
+			client := &http.Client{Transport: signingTransport{base: http.DefaultTransport, host: host}}
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v4/futures/usdt/orders?settle=usdt", strings.NewReader(tt.body))
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if gotBody != tt.body {
+				t.Errorf("body = %q, want %q", gotBody, tt.body)
+			}
+			if signed := got.Header.Get("SIGN") != "" || got.Header.Get("KEY") != ""; signed != tt.wantSigned {
+				t.Fatalf("signed = %v, want %v", signed, tt.wantSigned)
+			}
+			if !tt.wantSigned {
+				return
+			}
+			timestamp, err := strconv.ParseInt(got.Header.Get("Timestamp"), 10, 64)
+			if err != nil {
+				t.Fatalf("timestamp header: %v", err)
+			}
+			want := tt.keys.signRequest("POST", "/api/v4/futures/usdt/orders", "settle=usdt", []byte(tt.body), timestamp)
+			if got.Header.Get("KEY") != tt.keys.key || got.Header.Get("SIGN") != want {
+				t.Errorf("headers KEY=%q SIGN=%q, want %q %q", got.Header.Get("KEY"), got.Header.Get("SIGN"), tt.keys.key, want)
+			}
+		})
+	}
+}
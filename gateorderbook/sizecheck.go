@@ -0,0 +1,109 @@
+package gateorderbook
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Суммарный объем уровней
+func totalSize(levels []OrderBookItem) float64 {
+	total := decimal.Zero
+	for _, level := range levels {
+		total = total.Add(level.S)
+	}
+	return total.InexactFloat64()
+}
+
+// Диапазон цен уровней; ok=false, если уровней нет
+func priceRange(levels []OrderBookItem) (lo, hi float64, ok bool) {
+	for _, level := range levels {
+		price, valid := levelPrice(level)
+		if !valid {
+			continue
+		}
+		if !ok || price < lo {
+			lo = price
+		}
+		if !ok || price > hi {
+			hi = price
+		}
+		ok = true
+	}
+	return lo, hi, ok
+}
+
+// Относительное расхождение суммарного объема стороны с REST снимком.
+// Живая книга может быть глубже снимка, поэтому учитываются только уровни
+// в диапазоне цен снимка.
+func sizeDiscrepancy(live, snapshot []OrderBookItem) float64 {
+	lo, hi, ok := priceRange(snapshot)
+	if !ok {
+		if len(live) == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	expected := totalSize(snapshot)
+	actual := totalSize(filterLevels(live, lo, hi))
+	if expected == 0 {
+		if actual == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Abs(actual-expected) / expected
+}
+
+// Сравнение суммарных объемов живой книги со снимком; возвращает true,
+// если расхождение хотя бы одной стороны превышает tolerance
+func checkSizeTotals(contract string, live, snapshot OrderBookResponse, tolerance float64) bool {
+	drifted := false
+	for _, side := range []struct {
+		name           string
+		live, snapshot []OrderBookItem
+	}{
+		{"asks", live.Asks, snapshot.Asks},
+		{"bids", live.Bids, snapshot.Bids},
+	} {
+		diff := sizeDiscrepancy(side.live, side.snapshot)
+		if diff <= tolerance {
+			continue
+		}
+		drifted = true
+		warnf("%s size total for %s differs from snapshot %d by %.2f%% (live %g, snapshot %g)",
+			side.name, contract, snapshot.ID, diff*100, totalSize(side.live), totalSize(side.snapshot))
+		metrics.Count("orderbook.size_drift."+contract, 1)
+	}
+	return drifted
+}
+
+// Периодическая проверка суммарных объемов книг по свежим REST снимкам до отмены ctx
+func startSizeTotalsCheck(ctx context.Context, contracts []string, interval time.Duration, tolerance float64) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			for _, contract := range contracts {
+				if _, ok := orderbooks.Get(contract); !ok {
+					continue
+				}
+				snapshot, err := GetOrderBookSnapshot(ctx, contractSettle(contract), contract, snapshotLimit(contract))
+				if err != nil {
+					errorf("Size check: failed to get snapshot for %s: %v", contract, err)
+					continue
+				}
+				// Живую книгу берем после получения снимка, чтобы сократить разрыв во времени
+				live, _ := orderbooks.Get(contract)
+				checkSizeTotals(contract, live, snapshot, tolerance)
+			}
+		}
+	}()
+}
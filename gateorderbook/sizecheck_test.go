@@ -0,0 +1,63 @@
+package gateorderbook
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSizeDiscrepancy(t *testing.T) {
+	tests := []struct {
+		name           string
+		live, snapshot []OrderBookItem
+		want           float64
+	}{
+		{"equal", levels("101:1", "102:2"), levels("101:1", "102:2"), 0},
+		{"sizes drifted", levels("101:1", "102:3"), levels("101:1", "102:2"), 1.0 / 3},
+		{"levels outside the snapshot range ignored", levels("101:1", "102:2", "150:40"), levels("101:1", "102:2"), 0},
+		{"missing level", levels("101:1"), levels("101:1", "102:3"), 0.75},
+		{"both empty", nil, nil, 0},
+		{"empty snapshot", levels("101:1"), nil, math.Inf(1)},
+		{"zero snapshot total", levels("101:1"), levels("101:0"), math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sizeDiscrepancy(tt.live, tt.snapshot)
+			if got != tt.want && !near(got, tt.want) {
+				t.Errorf("discrepancy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSizeTotalsFlagsDrift(t *testing.T) {
+	newTestTracker(t, nil)
+	snapshot := testBook(200, levels("101:1", "102:2"), levels("99:4", "98:4"))
+	tests := []struct {
+		name        string
+		live        OrderBookResponse
+		tolerance   float64
+		wantDrifted bool
+		wantLog     string
+	}{
+		{"in sync", testBook(190, levels("101:1", "102:2"), levels("99:4", "98:4")), 0.01, false, ""},
+		{"within tolerance", testBook(190, levels("101:1", "102:2"), levels("99:4", "98:4.5")), 0.1, false, ""},
+		{"bids drifted", testBook(190, levels("101:1", "102:2"), levels("99:4", "98:6")), 0.1,
+			true, "Warning: bids size total for BTC_USDT differs from snapshot 200 by 25.00% (live 10, snapshot 8)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			if drifted := checkSizeTotals("BTC_USDT", tt.live, snapshot, tt.tolerance); drifted != tt.wantDrifted {
+				t.Errorf("drifted = %v, want %v", drifted, tt.wantDrifted)
+			}
+			out := logs.String()
+			if (tt.wantLog == "" && out != "") || !strings.Contains(out, tt.wantLog) {
+				t.Errorf("log = %q, want %q", out, tt.wantLog)
+			}
+			if strings.Contains(out, "asks size total") {
+				t.Errorf("log = %q, asks are in sync", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package gateorderbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Число попыток получения REST снимка
+var snapshotAttempts = 3
+
+// Пауза перед второй попыткой; удваивается с каждой следующей
+var snapshotRetryBackoff = time.Second
+
+// Ответ REST API с кодом, отличным от 200
+type apiError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("API error, status: %d, response: %s", e.StatusCode, e.Body)
+}
+
+// Имеет ли смысл повторять запрос: сетевые ошибки, 429 и 5xx повторяются,
+// остальные ответы API (400, неизвестный контракт) - нет
+func retryableSnapshotError(err error) bool {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return true
+}
+
+// REST снимок с ограниченным числом попыток и экспоненциальной паузой между
+// ними; возвращается ошибка последней попытки
+func getOrderBookSnapshotWithRetry(ctx context.Context, settle, contract string, limit, attempts int, backoff time.Duration) (OrderBookResponse, error) {
+	for attempt := 1; ; attempt++ {
+		orderbook, err := GetOrderBookSnapshot(ctx, settle, contract, limit)
+		if err == nil {
+			return orderbook, nil
+		}
+		if ctx.Err() != nil {
+			return OrderBookResponse{}, ctx.Err()
+		}
+		if attempt >= attempts || !retryableSnapshotError(err) {
+			return OrderBookResponse{}, err
+		}
+
+		metrics.Count("orderbook.snapshot_retries."+contract, 1)
+		warnf("snapshot request for %s failed (attempt %d/%d), retrying in %s: %v", contract, attempt, attempts, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return OrderBookResponse{}, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
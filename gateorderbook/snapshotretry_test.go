@@ -0,0 +1,78 @@
+package gateorderbook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int32
+		status       int
+		attempts     int
+		wantRequests int32
+		wantStatus   int
+	}{
+		{"first attempt succeeds", 0, 0, 3, 1, 0},
+		{"server errors retried", 2, http.StatusBadGateway, 3, 3, 0},
+		{"attempts exhausted", 5, http.StatusServiceUnavailable, 3, 3, http.StatusServiceUnavailable},
+		{"single attempt", 1, http.StatusInternalServerError, 1, 1, http.StatusInternalServerError},
+		{"client error not retried", 1, http.StatusBadRequest, 3, 1, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, nil)
+			captureLog(t)
+			var served atomic.Int32
+			requests := serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+				if served.Add(1) <= tt.failures {
+					http.Error(w, "unavailable", tt.status)
+					return
+				}
+				writeSnapshot(w, testBook(100, levels("101:1"), levels("99:1")))
+			})
+
+			book, err := getOrderBookSnapshotWithRetry(context.Background(), "usdt", "BTC_USDT", 50, tt.attempts, time.Millisecond)
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if tt.wantStatus == 0 {
+				if err != nil || book.ID != 100 {
+					t.Errorf("snapshot = %d (%v), want book 100", book.ID, err)
+				}
+				return
+			}
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("error = %v, want status %d", err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSnapshotRetryStopsOnCancel(t *testing.T) {
+	newTestTracker(t, nil)
+	captureLog(t)
+	requests := serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := getOrderBookSnapshotWithRetry(ctx, "usdt", "BTC_USDT", 50, 5, time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want soon after the cancel", elapsed)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
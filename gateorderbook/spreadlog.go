@@ -0,0 +1,95 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Заголовок сводного CSV спредов
+const spreadLogHeader = "ts,contract,bestBid,bestAsk,spread,spreadBps,mid\n"
+
+// Сводный CSV лучших цен и спредов всех контрактов (metrics.csv):
+// на каждое сохранение по строке на контракт
+type spreadLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// Открытие (или создание с заголовком) файла dir/metrics.csv
+func openSpreadLog(dir string) (*spreadLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create metrics directory: %v", err)
+	}
+	filename := filepath.Join(dir, "metrics.csv")
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metrics file %s: %v", filename, err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat metrics file %s: %v", filename, err)
+	}
+	if info.Size() == 0 {
+		if _, err := f.WriteString(spreadLogHeader); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to write metrics header %s: %v", filename, err)
+		}
+	}
+	return &spreadLog{f: f}, nil
+}
+
+// Форматирование числа для CSV; пустое поле, если значения нет
+func csvFloat(v float64, ok bool) string {
+	if !ok {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// Строка контракта; пустые поля для значений, которые нельзя вычислить
+func formatSpreadRow(ts time.Time, contract string, orderbook OrderBookResponse) string {
+	bid, ask, hasBid, hasAsk := bestPrices(orderbook)
+	both := hasBid && hasAsk
+	bps, hasBps := spreadBps(orderbook)
+	return fmt.Sprintf("%d,%s,%s,%s,%s,%s,%s\n", ts.UnixMilli(), contract,
+		csvFloat(bid, hasBid), csvFloat(ask, hasAsk), csvFloat(ask-bid, both),
+		csvFloat(bps, hasBps), csvFloat((bid+ask)/2, both))
+}
+
+// Запись строк всех контрактов одного сохранения (по алфавиту) одной записью
+func (l *spreadLog) Append(ts time.Time, books map[string]OrderBookResponse) error {
+	contracts := make([]string, 0, len(books))
+	for contract := range books {
+		contracts = append(contracts, contract)
+	}
+	sort.Strings(contracts)
+
+	var sb strings.Builder
+	for _, contract := range contracts {
+		sb.WriteString(formatSpreadRow(ts, contract, books[contract]))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("failed to append metrics rows: %v", err)
+	}
+	return nil
+}
+
+func (l *spreadLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
@@ -0,0 +1,87 @@
+package gateorderbook
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatSpreadRow(t *testing.T) {
+	ts := time.UnixMilli(1700000000123)
+	tests := []struct {
+		name string
+		book OrderBookResponse
+		want string
+	}{
+		{"two-sided book", testBook(1, levels("101:1"), levels("99:1")), "1700000000123,BTC_USDT,99,101,2,200,100\n"},
+		{"bids only", testBook(1, nil, levels("99.5:1")), "1700000000123,BTC_USDT,99.5,,,,\n"},
+		{"empty book", OrderBookResponse{}, "1700000000123,BTC_USDT,,,,,\n"},
+	}
+	for _, tt := range tests {
+		if got := formatSpreadRow(ts, "BTC_USDT", tt.book); got != tt.want {
+			t.Errorf("%s: row = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSpreadMetricsRowsPerSave(t *testing.T) {
+	dir := chdirTemp(t)
+	tracker := newTestTracker(t, func(cfg *Config) {
+		cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"}
+		cfg.SaverEnabled = true
+		cfg.SpreadMetrics = true
+	})
+	orderbooks.Set("ETH_USDT", testBook(1, levels("2001:1"), levels("1999:1")))
+	orderbooks.Set("BTC_USDT", testBook(1, levels("101:1"), levels("99:1")))
+	saveOrderBooks(false, true)
+	orderbooks.Set("BTC_USDT", testBook(2, levels("100.5:1"), levels("99.5:1")))
+	saveOrderBooks(false, true)
+	tracker.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "orderbooks", "metrics.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	// Заголовок и по строке на контракт за каждое сохранение, по алфавиту
+	want := []string{
+		strings.TrimSuffix(spreadLogHeader, "\n"),
+		"BTC_USDT,99,101,2,200,100",
+		"ETH_USDT,1999,2001,2,10,2000",
+		"BTC_USDT,99.5,100.5,1,100,100",
+		"ETH_USDT,1999,2001,2,10,2000",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("metrics.csv:\n%s\nwant %d lines", data, len(want))
+	}
+	for i, line := range lines {
+		if i == 0 {
+			if line != want[0] {
+				t.Errorf("header = %q, want %q", line, want[0])
+			}
+			continue
+		}
+		ts, row, _ := strings.Cut(line, ",")
+		if row != want[i] || ts == "" {
+			t.Errorf("row %d = %q, want <ts>,%s", i, line, want[i])
+		}
+	}
+
+	// Повторное открытие дописывает строки без второго заголовка
+	tracker = newTestTracker(t, func(cfg *Config) {
+		cfg.SaverEnabled = true
+		cfg.SpreadMetrics = true
+	})
+	orderbooks.Set("BTC_USDT", testBook(3, levels("101:1"), levels("99:1")))
+	saveOrderBooks(false, true)
+	tracker.Close()
+	data, err = os.ReadFile(filepath.Join(dir, "orderbooks", "metrics.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "\n"); got != 6 || strings.Count(string(data), "ts,contract") != 1 {
+		t.Errorf("metrics.csv after reopening:\n%s", data)
+	}
+}
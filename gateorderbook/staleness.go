@@ -0,0 +1,102 @@
+package gateorderbook
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Отслеживание контрактов, по которым давно не было обновлений
+// (контракт снят с торгов или подписка молча перестала работать):
+// такая книга устарела, хотя продолжает сохраняться
+type staleMonitor struct {
+	mu         sync.Mutex
+	threshold  time.Duration
+	now        func() time.Time
+	lastUpdate map[string]time.Time // Last applied update or snapshot; start of tracking before the first one
+	stale      map[string]bool
+}
+
+// Монитор устаревания книг (nil - отключен)
+var staleBooks *staleMonitor
+
+// Пересинхронизировать устаревшую книгу по REST снимку
+var staleResync bool
+
+func newStaleMonitor(threshold time.Duration, contracts []string) *staleMonitor {
+	m := &staleMonitor{
+		threshold:  threshold,
+		now:        time.Now,
+		lastUpdate: make(map[string]time.Time, len(contracts)),
+		stale:      make(map[string]bool),
+	}
+	// Контракт без единого обновления устаревает через threshold после запуска
+	started := m.now()
+	for _, contract := range contracts {
+		m.lastUpdate[contract] = started
+	}
+	return m
+}
+
+// Учет обновления контракта в момент t
+func (m *staleMonitor) Touch(contract string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stale[contract] {
+		delete(m.stale, contract)
+		infof("Orderbook for %s is receiving updates again", contract)
+	}
+	if t.After(m.lastUpdate[contract]) {
+		m.lastUpdate[contract] = t
+	}
+}
+
+// Проверка всех контрактов: предупреждение для каждого, по которому
+// обновлений нет дольше порога; возвращает только что устаревшие контракты
+func (m *staleMonitor) Check() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var newlyStale []string
+	for contract, last := range m.lastUpdate {
+		age := now.Sub(last)
+		metrics.Gauge("orderbook.staleness_seconds."+contract, age.Seconds())
+		if age < m.threshold || m.stale[contract] {
+			continue
+		}
+		m.stale[contract] = true
+		newlyStale = append(newlyStale, contract)
+		warnf("no updates for %s for %s, the book is stale", contract, age.Round(time.Second))
+		metrics.Count("orderbook.stale_books."+contract, 1)
+	}
+	sort.Strings(newlyStale)
+	return newlyStale
+}
+
+// Возраст книги и признак устаревания по контракту
+type Staleness struct {
+	AgeSeconds float64 `json:"age_seconds"` // Since the last update or snapshot
+	Stale      bool    `json:"stale"`
+}
+
+// Возраст книг на текущий момент
+func (m *staleMonitor) Ages() map[string]Staleness {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	ages := make(map[string]Staleness, len(m.lastUpdate))
+	for contract, last := range m.lastUpdate {
+		ages[contract] = Staleness{AgeSeconds: now.Sub(last).Seconds(), Stale: m.stale[contract]}
+	}
+	return ages
+}
+
+// Период проверки устаревания: четверть порога, но не чаще раза в секунду
+func staleCheckInterval(threshold time.Duration) time.Duration {
+	interval := threshold / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
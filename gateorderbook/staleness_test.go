@@ -0,0 +1,106 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStaleBookWarning(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"}
+		cfg.StaleAfter = 10 * time.Second
+		cfg.Prometheus = true
+		cfg.HTTPAddr = "127.0.0.1:0"
+	})
+	t.Cleanup(func() { metrics, promMetrics = nopMetrics{}, nil })
+	logs := captureLog(t)
+
+	// Поддельные часы монитора: отсчет от начала отслеживания контрактов
+	start := staleBooks.lastUpdate["BTC_USDT"]
+	clock := start
+	staleBooks.now = func() time.Time { return clock }
+	applySnapshot("ETH_USDT", testBook(500, levels("2001:1"), levels("1999:1")))
+	update := func(contract string, id int64, after time.Duration) {
+		handleWebSocketMessage(updateMessage(contract, id, id, nil, levels("1999:2")), start.Add(after).UnixNano())
+	}
+
+	steps := []struct {
+		at        time.Duration
+		update    string // Contract updated at this moment
+		wantStale []string
+	}{
+		{5 * time.Second, "", nil},
+		{8 * time.Second, "ETH_USDT", nil},
+		{12 * time.Second, "", []string{"BTC_USDT"}},
+		// Уже устаревшая книга не дает повторного предупреждения
+		{13 * time.Second, "", nil},
+		{19 * time.Second, "", []string{"ETH_USDT"}},
+	}
+	id := int64(501)
+	for _, step := range steps {
+		clock = start.Add(step.at)
+		if step.update != "" {
+			update(step.update, id, step.at)
+			id++
+		}
+		if got := staleBooks.Check(); !reflect.DeepEqual(got, step.wantStale) {
+			t.Errorf("at +%s stale = %v, want %v", step.at, got, step.wantStale)
+		}
+	}
+	out := logs.String()
+	for _, want := range []string{
+		"Warning: no updates for BTC_USDT for 12s, the book is stale",
+		"Warning: no updates for ETH_USDT for 11s, the book is stale",
+	} {
+		if strings.Count(out, want) != 1 {
+			t.Errorf("log = %q, want %q once", out, want)
+		}
+	}
+	if !strings.Contains(scrapeMetrics(t), "gateorderbook_staleness_seconds{contract=\"BTC_USDT\"} 19\n") {
+		t.Error("/metrics has no BTC_USDT staleness of 19s")
+	}
+
+	rec := httptest.NewRecorder()
+	handleStaleness(rec, httptest.NewRequest(http.MethodGet, "/staleness", nil))
+	var ages map[string]Staleness
+	if err := json.Unmarshal(rec.Body.Bytes(), &ages); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Staleness{"BTC_USDT": {AgeSeconds: 19, Stale: true}, "ETH_USDT": {AgeSeconds: 11, Stale: true}}
+	if !reflect.DeepEqual(ages, want) {
+		t.Errorf("/staleness = %+v, want %+v", ages, want)
+	}
+
+	// Новое обновление снимает признак устаревания
+	update("ETH_USDT", id, 20*time.Second)
+	clock = start.Add(21 * time.Second)
+	if got := staleBooks.Ages()["ETH_USDT"]; got.Stale || got.AgeSeconds != 1 {
+		t.Errorf("ETH_USDT after an update = %+v, want fresh, 1s old", got)
+	}
+	if !strings.Contains(logs.String(), "Orderbook for ETH_USDT is receiving updates again") {
+		t.Errorf("log = %q, want the recovery message", logs)
+	}
+}
+
+func TestStaleCheckInterval(t *testing.T) {
+	for threshold, want := range map[time.Duration]time.Duration{
+		time.Minute:     15 * time.Second,
+		2 * time.Second: time.Second,
+	} {
+		if got := staleCheckInterval(threshold); got != want {
+			t.Errorf("check interval for %s = %s, want %s", threshold, got, want)
+		}
+	}
+
+	newTestTracker(t, func(cfg *Config) { cfg.StaleAfter = 0 })
+	rec := httptest.NewRecorder()
+	handleStaleness(rec, httptest.NewRequest(http.MethodGet, "/staleness", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/staleness with detection disabled = %d, want 404", rec.Code)
+	}
+}
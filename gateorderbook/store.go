@@ -0,0 +1,50 @@
+package gateorderbook
+
+import "sync"
+
+// Потокобезопасное хранилище ордербуков по контрактам.
+// Слайсы уровней сохраненной книги не изменяются на месте (обновление
+// всегда строит новые слайсы), поэтому Get и Snapshot отдают копии
+// структур, разделяющие с хранилищем только неизменяемые уровни.
+type OrderBookStore struct {
+	mu    sync.RWMutex
+	books map[string]OrderBookResponse
+}
+
+// capacity - ожидаемое число контрактов
+func newOrderBookStore(capacity int) *OrderBookStore {
+	return &OrderBookStore{books: make(map[string]OrderBookResponse, capacity)}
+}
+
+// Ордербук контракта; ok=false, если снимка еще нет
+func (s *OrderBookStore) Get(contract string) (OrderBookResponse, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	orderbook, ok := s.books[contract]
+	return orderbook, ok
+}
+
+// Сохранение ордербука; после вызова его слайсы уровней нельзя изменять
+func (s *OrderBookStore) Set(contract string, orderbook OrderBookResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.books[contract] = orderbook
+}
+
+// Копия всех ордербуков на текущий момент
+func (s *OrderBookStore) Snapshot() map[string]OrderBookResponse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := make(map[string]OrderBookResponse, len(s.books))
+	for contract, orderbook := range s.books {
+		snapshot[contract] = orderbook
+	}
+	return snapshot
+}
+
+// Удаление ордербука контракта
+func (s *OrderBookStore) Delete(contract string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.books, contract)
+}
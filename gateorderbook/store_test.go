@@ -0,0 +1,157 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Снимок REST API глубины depth в JSON
+func snapshotBody(tb testing.TB, depth int) []byte {
+	tb.Helper()
+	body, err := json.Marshal(benchmarkBook(100, depth))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return body
+}
+
+func TestDecodeOrderBookSnapshotPreallocates(t *testing.T) {
+	tests := []struct {
+		name    string
+		depth   int
+		limit   int
+		wantCap int
+	}{
+		{"full depth", 50, 50, 50},
+		{"fewer levels than the limit", 10, 50, 50},
+		{"no limit", 10, 0, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book, err := decodeOrderBookSnapshot(snapshotBody(t, tt.depth), tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(book.Asks) != tt.depth || len(book.Bids) != tt.depth {
+				t.Fatalf("levels = %d/%d, want %d", len(book.Asks), len(book.Bids), tt.depth)
+			}
+			if cap(book.Asks) < tt.wantCap || cap(book.Bids) < tt.wantCap {
+				t.Errorf("capacity = %d/%d, want at least %d", cap(book.Asks), cap(book.Bids), tt.wantCap)
+			}
+		})
+	}
+}
+
+// Заполнение хранилища и последних ID при старте на 2000 контрактов:
+// с выделением под число контрактов и с ростом map по мере заполнения
+func BenchmarkStartupStore(b *testing.B) {
+	contracts := make([]string, 2000)
+	for i := range contracts {
+		contracts[i] = "C" + strconv.Itoa(i) + "_USDT"
+	}
+	book := benchmarkBook(100, 1)
+	for _, bench := range []struct {
+		name     string
+		capacity int
+	}{
+		{"preallocated", len(contracts)},
+		{"grown", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				store := newOrderBookStore(bench.capacity)
+				ids := make(map[string]int64, bench.capacity)
+				for _, contract := range contracts {
+					store.Set(contract, book)
+					ids[contract] = book.ID
+				}
+			}
+		})
+	}
+}
+
+// Разбор снимка глубины 50: стороны выделены заранее и растут при декодировании
+func BenchmarkDecodeOrderBookSnapshot(b *testing.B) {
+	body := snapshotBody(b, 50)
+	for _, bench := range []struct {
+		name  string
+		limit int
+	}{
+		{"preallocated", 50},
+		{"grown", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := decodeOrderBookSnapshot(body, bench.limit); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderBookStore(t *testing.T) {
+	store := newOrderBookStore(2)
+	if _, ok := store.Get("BTC_USDT"); ok {
+		t.Fatal("empty store returned a book")
+	}
+	store.Set("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	store.Set("ETH_USDT", testBook(200, levels("3001:1"), levels("2999:1")))
+
+	snapshot := store.Snapshot()
+	store.Set("BTC_USDT", testBook(101, levels("101:2"), levels("99:1")))
+	store.Delete("ETH_USDT")
+	// Снимок не меняется после записи в хранилище
+	if len(snapshot) != 2 || snapshot["BTC_USDT"].ID != 100 {
+		t.Errorf("snapshot = %v, want both books as of the call", snapshot)
+	}
+	if book, ok := store.Get("BTC_USDT"); !ok || book.ID != 101 {
+		t.Errorf("book = %d (%v), want 101", book.ID, ok)
+	}
+	if _, ok := store.Get("ETH_USDT"); ok {
+		t.Error("deleted book still present")
+	}
+}
+
+// Запуск с -race: обработка обновлений и сохранение идут параллельно
+func TestOrderBookStoreConcurrentUpdatesAndSaves(t *testing.T) {
+	var saves saveCounter
+	newTestTracker(t, func(cfg *Config) {
+		cfg.SaverEnabled = true
+		cfg.Writer = saves.writer
+	})
+	captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	const updates = 500
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for id := int64(101); id < 101+updates; id++ {
+			size := strconv.FormatInt(id, 10)
+			handleWebSocketMessage(updateMessage("BTC_USDT", id, id, levels("101:"+size), levels("99:"+size)), time.Now().UnixNano())
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		saveOrderBooks(false, true)
+		if book, ok := orderbooks.Get("BTC_USDT"); !ok || len(book.Asks) != 1 || len(book.Bids) != 1 {
+			t.Fatalf("book read during updates = %+v", book)
+		}
+	}
+	if book, _ := orderbooks.Get("BTC_USDT"); book.ID != 100+updates {
+		t.Errorf("book id = %d, want %d", book.ID, 100+updates)
+	}
+	if saves.count("BTC_USDT") == 0 {
+		t.Error("book never saved")
+	}
+}
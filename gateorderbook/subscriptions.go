@@ -0,0 +1,221 @@
+package gateorderbook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Допустимые интервалы futures.order_book_update, от более частого к более редкому
+var allowedUpdateIntervals = []string{"20ms", "100ms"}
+
+// Проверка интервала обновлений
+func validateUpdateInterval(interval string) error {
+	for _, allowed := range allowedUpdateIntervals {
+		if interval == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported update interval %q, allowed: %v", interval, allowedUpdateIntervals)
+}
+
+// Следующий, более редкий интервал; ok=false, если интервал уже самый редкий
+func coarserInterval(interval string) (string, bool) {
+	for i, allowed := range allowedUpdateIntervals {
+		if interval == allowed && i+1 < len(allowedUpdateIntervals) {
+			return allowedUpdateIntervals[i+1], true
+		}
+	}
+	return "", false
+}
+
+// Запрос подписки на обновления ордербука контракта
+type subscription struct {
+	Contract string
+	Interval string
+}
+
+// Отправитель JSON сообщений (*websocket.Conn)
+type jsonWriter interface {
+	WriteJSON(v interface{}) error
+}
+
+// Подписка, отправленная через конкретное соединение
+type sentSubscription struct {
+	sub  subscription
+	conn jsonWriter
+}
+
+// Отслеживание отправленных подписок по id запроса и состояния подписки
+// по контрактам. Повторные подтверждения (ретраи, резервные соединения)
+// не вызывают onReady повторно.
+type subscriptionTracker struct {
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]sentSubscription
+	retries []sentSubscription
+	ready   map[string]bool
+	failed  map[string]string // Reason of the final rejection by contract
+	onReady func(contract string)
+}
+
+func newSubscriptionTracker() *subscriptionTracker {
+	return &subscriptionTracker{
+		pending: make(map[int64]sentSubscription),
+		ready:   make(map[string]bool),
+		failed:  make(map[string]string),
+		onReady: func(contract string) {
+			infof("Orderbook updates for %s are ready", contract)
+		},
+	}
+}
+
+// Отправка запроса подписки
+func (t *subscriptionTracker) Subscribe(conn jsonWriter, sub subscription) error {
+	t.mu.Lock()
+	t.nextID++
+	id := t.nextID
+	t.pending[id] = sentSubscription{sub: sub, conn: conn}
+	t.mu.Unlock()
+
+	subscribeMsg := map[string]interface{}{
+		"id":      id,
+		"time":    subscribeTime(time.Now()),
+		"channel": "futures.order_book_update",
+		"event":   "subscribe",
+		"payload": []string{sub.Contract, sub.Interval}, // Добавляем интервал обновления как второй аргумент
+	}
+	addChannelAuth(subscribeMsg)
+	debugf("Subscribe request id=%d for %s: %s", id, sub.Contract, redactedJSON(subscribeMsg))
+	err := conn.WriteJSON(subscribeMsg)
+	if err != nil {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Обработка подтверждения подписки; ok=false для неизвестного или уже
+// подтвержденного id. onReady вызывается только при первом подтверждении контракта.
+func (t *subscriptionTracker) Acked(id int64) (subscription, bool) {
+	t.mu.Lock()
+	sent, ok := t.pending[id]
+	delete(t.pending, id)
+	firstReady := ok && !t.ready[sent.sub.Contract]
+	if firstReady {
+		t.ready[sent.sub.Contract] = true
+		delete(t.failed, sent.sub.Contract)
+	}
+	onReady := t.onReady
+	t.mu.Unlock()
+
+	if firstReady && onReady != nil {
+		onReady(sent.sub.Contract)
+	}
+	return sent.sub, ok
+}
+
+// Обработка отказа в подписке: повтор с более редким интервалом, если он есть
+func (t *subscriptionTracker) Rejected(id int64, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sent, ok := t.pending[id]
+	if !ok {
+		errorf("Subscription request %d rejected: %s", id, reason)
+		return
+	}
+	delete(t.pending, id)
+	sub := sent.sub
+
+	next, ok := coarserInterval(sub.Interval)
+	if !ok {
+		errorf("Subscription to %s with interval %s rejected: %s", sub.Contract, sub.Interval, reason)
+		if !t.ready[sub.Contract] {
+			t.failed[sub.Contract] = "rejected: " + reason
+		}
+		return
+	}
+	warnf("subscription to %s with interval %s rejected (%s), retrying with %s", sub.Contract, sub.Interval, reason, next)
+	t.retries = append(t.retries, sentSubscription{
+		sub:  subscription{Contract: sub.Contract, Interval: next},
+		conn: sent.conn,
+	})
+}
+
+// Соединение закрыто: его неподтвержденные запросы и ожидающие ретраи
+// отбрасываются, новое соединение подписывается заново
+func (t *subscriptionTracker) Disconnected(conn jsonWriter) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, sent := range t.pending {
+		if sent.conn == conn {
+			delete(t.pending, id)
+		}
+	}
+	retries := t.retries[:0]
+	for _, retry := range t.retries {
+		if retry.conn != conn {
+			retries = append(retries, retry)
+		}
+	}
+	t.retries = retries
+}
+
+// Подписки, которые нужно отправить повторно (через то же, еще открытое соединение)
+func (t *subscriptionTracker) TakeRetries() []sentSubscription {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	retries := t.retries
+	t.retries = nil
+	return retries
+}
+
+// Контракты из contracts без подтвержденной подписки с причиной:
+// отказ сервера или отсутствие подтверждения
+func (t *subscriptionTracker) Shortfall(contracts []string) map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	missing := make(map[string]string)
+	for _, contract := range contracts {
+		if t.ready[contract] {
+			continue
+		}
+		reason, ok := t.failed[contract]
+		if !ok {
+			reason = "no acknowledgement, subscription limit may be exceeded"
+		}
+		missing[contract] = reason
+	}
+	return missing
+}
+
+// Время ожидания подтверждений подписок до проверки нехватки
+var subscribeAckTimeout = 15 * time.Second
+
+// Отчет о контрактах, подписка на которые не подтверждена
+func reportSubscriptionShortfall(contracts []string) {
+	missing := subscriptions.Shortfall(contracts)
+	metrics.Gauge("subscriptions.missing", float64(len(missing)))
+	if len(missing) == 0 {
+		infof("All %d subscriptions confirmed", len(contracts))
+		return
+	}
+
+	names := make([]string, 0, len(missing))
+	for contract := range missing {
+		names = append(names, contract)
+	}
+	sort.Strings(names)
+	details := make([]string, 0, len(names))
+	for _, contract := range names {
+		details = append(details, fmt.Sprintf("%s (%s)", contract, missing[contract]))
+	}
+	errorf("Only %d of %d subscriptions confirmed after %s; not receiving updates for: %s",
+		len(contracts)-len(missing), len(contracts), subscribeAckTimeout, strings.Join(details, ", "))
+}
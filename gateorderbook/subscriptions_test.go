@@ -0,0 +1,205 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Подмена трекера подписок трекером, записывающим контракты вызовов onReady
+func recordingSubscriptions(t testing.TB) *[]string {
+	t.Helper()
+	prev := subscriptions
+	var ready []string
+	subscriptions = newSubscriptionTracker()
+	subscriptions.onReady = func(contract string) { ready = append(ready, contract) }
+	t.Cleanup(func() { subscriptions = prev })
+	return &ready
+}
+
+// Ответ сервера на подписку id; отказ, если reason не пустой
+func ackMessage(id int64, reason string) []byte {
+	msg := WebSocketMessage{ID: id, Channel: "futures.order_book_update", Event: "subscribe",
+		Result: json.RawMessage(`{"status":"success"}`)}
+	if reason != "" {
+		msg.Error = &WebSocketError{Code: 2, Message: reason}
+		msg.Result = nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestDuplicateAcksReportReadyOnce(t *testing.T) {
+	newTestTracker(t, nil)
+	ready := recordingSubscriptions(t)
+	conn := &jsonRecorder{}
+	// Та же подписка отправлена дважды: ретрай или резервное соединение
+	for i := 0; i < 2; i++ {
+		if err := subscriptions.Subscribe(conn, subscription{Contract: "BTC_USDT", Interval: "100ms"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(conn.messages) != 2 || conn.messages[0]["id"] == conn.messages[1]["id"] {
+		t.Fatalf("subscribe requests = %v, want two with distinct ids", conn.messages)
+	}
+
+	// Подтверждения обоих запросов, повтор первого и неизвестный id
+	for _, id := range []int64{1, 2, 1, 99} {
+		handleWebSocketMessage(ackMessage(id, ""), time.Now().UnixNano())
+	}
+	if len(*ready) != 1 || (*ready)[0] != "BTC_USDT" {
+		t.Errorf("onReady calls = %v, want one for BTC_USDT", *ready)
+	}
+	if _, ok := subscriptions.Acked(1); ok {
+		t.Error("acknowledged id accepted again")
+	}
+}
+
+func TestRejectedIntervalFallsBack(t *testing.T) {
+	newTestTracker(t, nil)
+	ready := recordingSubscriptions(t)
+	logs := captureLog(t)
+	conn := &jsonRecorder{}
+	subscriptions.Subscribe(conn, subscription{Contract: "BTC_USDT", Interval: "20ms"})
+	handleWebSocketMessage(ackMessage(1, "interval 20ms not allowed"), time.Now().UnixNano())
+
+	want := "Warning: subscription to BTC_USDT with interval 20ms rejected (code 2: interval 20ms not allowed), retrying with 100ms"
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("log = %q, want %q", logs, want)
+	}
+
+	retries := subscriptions.TakeRetries()
+	if len(retries) != 1 || retries[0].sub != (subscription{Contract: "BTC_USDT", Interval: "100ms"}) || retries[0].conn != conn {
+		t.Fatalf("retries = %+v, want BTC_USDT at 100ms on the same connection", retries)
+	}
+	if again := subscriptions.TakeRetries(); len(again) != 0 {
+		t.Errorf("retries taken twice: %+v", again)
+	}
+
+	subscriptions.Subscribe(retries[0].conn, retries[0].sub)
+	if payload := conn.messages[1]["payload"].([]string); payload[1] != "100ms" {
+		t.Errorf("retry payload = %v, want interval 100ms", payload)
+	}
+	handleWebSocketMessage(ackMessage(2, ""), time.Now().UnixNano())
+	if len(*ready) != 1 {
+		t.Errorf("onReady calls = %v, want BTC_USDT after the fallback", *ready)
+	}
+}
+
+func TestDisconnectDropsConnectionSubscriptions(t *testing.T) {
+	newTestTracker(t, nil)
+	ready := recordingSubscriptions(t)
+	closed, live := &jsonRecorder{}, &jsonRecorder{}
+	subscriptions.Subscribe(closed, subscription{Contract: "BTC_USDT", Interval: "20ms"}) // id 1
+	subscriptions.Subscribe(closed, subscription{Contract: "ETH_USDT", Interval: "20ms"}) // id 2
+	subscriptions.Subscribe(live, subscription{Contract: "BTC_USDT", Interval: "20ms"})   // id 3
+	subscriptions.Subscribe(live, subscription{Contract: "ETH_USDT", Interval: "20ms"})   // id 4
+	handleWebSocketMessage(ackMessage(1, "interval 20ms not allowed"), time.Now().UnixNano())
+	handleWebSocketMessage(ackMessage(3, "interval 20ms not allowed"), time.Now().UnixNano())
+
+	subscriptions.Disconnected(closed)
+	retries := subscriptions.TakeRetries()
+	if len(retries) != 1 || retries[0].conn != live {
+		t.Fatalf("retries = %+v, want only the one on the live connection", retries)
+	}
+	// Запоздавшие ответы на запросы закрытого соединения не учитываются
+	handleWebSocketMessage(ackMessage(2, ""), time.Now().UnixNano())
+	if len(*ready) != 0 {
+		t.Errorf("onReady calls = %v, want none for a closed connection", *ready)
+	}
+	if subscriptions.Rejected(2, "late"); len(subscriptions.TakeRetries()) != 0 {
+		t.Error("retry queued for a closed connection")
+	}
+	if _, ok := subscriptions.Acked(4); !ok {
+		t.Error("pending request of the live connection dropped")
+	}
+}
+
+func TestRejectedCoarsestIntervalReported(t *testing.T) {
+	newTestTracker(t, nil)
+	recordingSubscriptions(t)
+	subscriptions.Subscribe(&jsonRecorder{}, subscription{Contract: "BTC_USDT", Interval: "100ms"})
+	handleWebSocketMessage(ackMessage(1, "not allowed"), time.Now().UnixNano())
+
+	if retries := subscriptions.TakeRetries(); len(retries) != 0 {
+		t.Errorf("retries = %+v, want none past the coarsest interval", retries)
+	}
+	missing := subscriptions.Shortfall([]string{"BTC_USDT"})
+	if got, want := missing["BTC_USDT"], "rejected: code 2: not allowed"; got != want {
+		t.Errorf("shortfall reason = %q, want %q", got, want)
+	}
+}
+
+func TestSubscriptionShortfallReported(t *testing.T) {
+	newTestTracker(t, nil)
+	recordingSubscriptions(t)
+	logs := captureLog(t)
+	contracts := []string{"BTC_USDT", "ETH_USDT", "SOL_USDT", "XRP_USDT"}
+	conn := &jsonRecorder{}
+	for _, contract := range contracts {
+		subscriptions.Subscribe(conn, subscription{Contract: contract, Interval: "100ms"})
+	}
+	// Сервер подтверждает только первые две подписки и отклоняет последнюю
+	handleWebSocketMessage(ackMessage(1, ""), time.Now().UnixNano())
+	handleWebSocketMessage(ackMessage(2, ""), time.Now().UnixNano())
+	handleWebSocketMessage(ackMessage(4, "limit exceeded"), time.Now().UnixNano())
+
+	missing := subscriptions.Shortfall(contracts)
+	want := map[string]string{
+		"SOL_USDT": "no acknowledgement, subscription limit may be exceeded",
+		"XRP_USDT": "rejected: code 2: limit exceeded",
+	}
+	if len(missing) != len(want) || missing["SOL_USDT"] != want["SOL_USDT"] || missing["XRP_USDT"] != want["XRP_USDT"] {
+		t.Errorf("shortfall = %v, want %v", missing, want)
+	}
+
+	logs.Reset()
+	reportSubscriptionShortfall(contracts)
+	wantLog := "ERROR Only 2 of 4 subscriptions confirmed after 15s; not receiving updates for: " +
+		"SOL_USDT (no acknowledgement, subscription limit may be exceeded), XRP_USDT (rejected: code 2: limit exceeded)"
+	if !strings.Contains(logs.String(), wantLog) {
+		t.Errorf("log = %q, want %q", logs, wantLog)
+	}
+
+	handleWebSocketMessage(ackMessage(3, ""), time.Now().UnixNano())
+	logs.Reset()
+	reportSubscriptionShortfall(contracts[:3])
+	if !strings.Contains(logs.String(), "All 3 subscriptions confirmed") {
+		t.Errorf("log = %q, want all subscriptions confirmed", logs)
+	}
+}
+
+func TestSubscribeHandshakeDebugLog(t *testing.T) {
+	newTestTracker(t, nil)
+	recordingSubscriptions(t)
+	logs := captureLog(t)
+	LogLevel.Set(slog.LevelDebug)
+	apiKeys = apiCredentials{key: "key", secret: "secret"}
+
+	conn := &jsonRecorder{}
+	if err := subscriptions.Subscribe(conn, subscription{Contract: "BTC_USDT", Interval: "100ms"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := conn.messages[0]["auth"]; !ok {
+		t.Fatalf("subscribe request = %v, want a signed request", conn.messages[0])
+	}
+	handleWebSocketMessage(ackMessage(1, ""), time.Now().UnixNano())
+
+	out := logs.String()
+	for _, want := range []string{
+		`DEBUG Subscribe request id=1 for BTC_USDT: {"auth":"[REDACTED]","channel":"futures.order_book_update","event":"subscribe","id":1,"payload":["BTC_USDT","100ms"]`,
+		`DEBUG Subscribe ack id=1: {`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log = %q, want %q", out, want)
+		}
+	}
+	if strings.Contains(out, "secret") || strings.Contains(out, `"KEY"`) {
+		t.Errorf("log = %q, want auth fields redacted", out)
+	}
+}
@@ -0,0 +1,215 @@
+package gateorderbook
+
+// Потоковая выдача ордербука по TCP.
+//
+// Протокол: клиент подключается и отправляет имя контракта строкой
+// ("BTC_USDT\n"). Сервер отвечает кадрами вида
+//
+//	[4 байта: длина N, big-endian][1 байт: тип кадра][N-1 байт: JSON]
+//
+// Типы кадров: 1 - снимок (OrderBookResponse), 2 - дельта (OrderBookUpdate,
+// размер 0 означает удаление уровня). Первым всегда приходит снимок:
+// текущая книга сразу после подключения (или после появления книги),
+// далее дельты, применяемые к нему по порядку; дельты с u не больше id
+// снимка уже учтены в нем. После пересинхронизации книги снова приходит
+// снимок. Если клиент не успевает читать, соединение закрывается, чтобы
+// он не получил дельты с пропусками.
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Типы кадров TCP потока
+const (
+	frameSnapshot byte = 1
+	frameDelta    byte = 2
+)
+
+// Размер очереди кадров на клиента
+const tcpClientQueue = 256
+
+// Кодирование кадра: длина (тип + payload), тип, payload
+func encodeFrame(frameType byte, v interface{}) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(1+len(payload)))
+	frame[4] = frameType
+	copy(frame[5:], payload)
+	return frame, nil
+}
+
+// Подписчик TCP потока
+type tcpClient struct {
+	contract    string
+	frames      chan []byte
+	hasSnapshot bool
+}
+
+// Рассылка обновлений TCP подписчикам
+type tcpHub struct {
+	mu      sync.Mutex
+	clients map[*tcpClient]struct{}
+}
+
+func newTCPHub() *tcpHub {
+	return &tcpHub{clients: make(map[*tcpClient]struct{})}
+}
+
+// Подписка клиента с отправкой текущей книги: под блокировкой хаба,
+// чтобы между снимком и первой дельтой не вклинилась публикация.
+// Приостановленный контракт получит снимок после возобновления.
+func (h *tcpHub) subscribe(client *tcpClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[client] = struct{}{}
+
+	orderbook, ok := orderbooks.Get(client.contract)
+	if !ok || pausedContracts.Paused(client.contract) {
+		return
+	}
+	frame, err := encodeFrame(frameSnapshot, orderbook)
+	if err != nil {
+		errorf("TCP frame encode error for %s: %v", client.contract, err)
+		return
+	}
+	client.frames <- frame
+	client.hasSnapshot = true
+}
+
+func (h *tcpHub) remove(client *tcpClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.frames)
+	}
+}
+
+// Публикация примененного обновления. Новым подписчикам вместо дельты
+// отправляется снимок книги после обновления.
+func (h *tcpHub) Publish(contract string, update OrderBookUpdate, orderbook OrderBookResponse) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var snapshot, delta []byte
+	for client := range h.clients {
+		if client.contract != contract {
+			continue
+		}
+
+		var frame []byte
+		var err error
+		if !client.hasSnapshot {
+			if snapshot == nil {
+				snapshot, err = encodeFrame(frameSnapshot, orderbook)
+			}
+			frame = snapshot
+		} else {
+			if delta == nil {
+				delta, err = encodeFrame(frameDelta, update)
+			}
+			frame = delta
+		}
+		if err != nil {
+			errorf("TCP frame encode error for %s: %v", contract, err)
+			return
+		}
+
+		select {
+		case client.frames <- frame:
+			client.hasSnapshot = true
+		default:
+			// Клиент не успевает - отключаем, чтобы не отдавать поток с пропусками
+			warnf("TCP stream client for %s is too slow, disconnecting", contract)
+			delete(h.clients, client)
+			close(client.frames)
+		}
+	}
+}
+
+// Сброс потока контракта: следующим подписчики получат снимок, а не дельту
+// (после паузы пропущенные дельты не восстановить)
+func (h *tcpHub) Resync(contract string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		if client.contract == contract {
+			client.hasSnapshot = false
+		}
+	}
+}
+
+// Отключение всех клиентов при остановке сервера
+func (h *tcpHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client.frames)
+	}
+}
+
+// Обслуживание TCP клиента
+func (h *tcpHub) serve(conn net.Conn) {
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		errorf("TCP stream handshake error from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	contract := strings.TrimSpace(line)
+	client := &tcpClient{contract: contract, frames: make(chan []byte, tcpClientQueue)}
+	h.subscribe(client)
+	defer h.remove(client)
+	infof("TCP stream client %s subscribed to %s", conn.RemoteAddr(), contract)
+
+	for frame := range client.frames {
+		if _, err := conn.Write(frame); err != nil {
+			errorf("TCP stream write error to %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// Запуск TCP сервера потока обновлений; при отмене ctx слушающий сокет
+// закрывается и клиенты отключаются
+func startTCPStreamServer(ctx context.Context, addr string, hub *tcpHub) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	infof("TCP stream server listening on %s", listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+		hub.closeAll()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					errorf("TCP stream accept error: %v", err)
+				}
+				return
+			}
+			go hub.serve(conn)
+		}
+	}()
+	return nil
+}
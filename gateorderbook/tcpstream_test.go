@@ -0,0 +1,160 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// Чтение кадра TCP потока: тип и JSON payload
+func readFrame(t testing.TB, r io.Reader) (byte, []byte) {
+	t.Helper()
+	if conn, ok := r.(net.Conn); ok {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	}
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatalf("read frame header: %v", err)
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[:4])-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("read frame payload: %v", err)
+	}
+	return header[4], payload
+}
+
+func TestEncodeFrame(t *testing.T) {
+	tests := []struct {
+		name      string
+		frameType byte
+		value     interface{}
+	}{
+		{"snapshot", frameSnapshot, testBook(7, levels("101:1"), levels("99:2.5"))},
+		{"delta", frameDelta, OrderBookUpdate{Contract: "BTC_USDT", U: 8, End: 9, Asks: levels("101:0")}},
+		{"empty payload", frameDelta, struct{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame, err := encodeFrame(tt.frameType, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := json.Marshal(tt.value)
+			if got := binary.BigEndian.Uint32(frame); int(got) != len(want)+1 {
+				t.Errorf("length = %d, want %d", got, len(want)+1)
+			}
+			frameType, payload := readFrame(t, bytes.NewReader(frame))
+			if frameType != tt.frameType || string(payload) != string(want) {
+				t.Errorf("frame = %d %s, want %d %s", frameType, payload, tt.frameType, want)
+			}
+		})
+	}
+}
+
+// Подключение клиента к хабу через net.Pipe с рукопожатием
+func dialHub(t *testing.T, hub *tcpHub, contract string) net.Conn {
+	t.Helper()
+	server, client := net.Pipe()
+	go hub.serve(server)
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.Write([]byte(contract + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestTCPStreamSendsSnapshotOnHandshake(t *testing.T) {
+	newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	hub := newTCPHub()
+
+	conn := dialHub(t, hub, "BTC_USDT")
+	frameType, payload := readFrame(t, conn)
+	if frameType != frameSnapshot {
+		t.Fatalf("first frame type = %d, want snapshot", frameType)
+	}
+	var book OrderBookResponse
+	if err := json.Unmarshal(payload, &book); err != nil || book.ID != 100 {
+		t.Fatalf("snapshot = %s (%v), want book 100", payload, err)
+	}
+
+	update := OrderBookUpdate{Contract: "BTC_USDT", U: 101, End: 101, Bids: levels("99:3")}
+	hub.Publish("BTC_USDT", update, testBook(101, levels("101:1"), levels("99:3")))
+	if frameType, _ := readFrame(t, conn); frameType != frameDelta {
+		t.Errorf("second frame type = %d, want delta", frameType)
+	}
+}
+
+func TestTCPStreamWaitsForBook(t *testing.T) {
+	newTestTracker(t, nil)
+	hub := newTCPHub()
+	conn := dialHub(t, hub, "BTC_USDT")
+
+	// Рукопожатие обработано, когда клиент появился в хабе
+	for i := 0; ; i++ {
+		hub.mu.Lock()
+		n := len(hub.clients)
+		hub.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if i > 500 {
+			t.Fatal("client not subscribed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	update := OrderBookUpdate{Contract: "BTC_USDT", U: 101, End: 101}
+	go hub.Publish("BTC_USDT", update, testBook(101, levels("101:1"), levels("99:3")))
+	if frameType, _ := readFrame(t, conn); frameType != frameSnapshot {
+		t.Errorf("first frame type = %d, want snapshot", frameType)
+	}
+}
+
+func TestTCPStreamServerStopsOnCancel(t *testing.T) {
+	newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := probe.Addr().String()
+	probe.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := startTCPStreamServer(ctx, addr, newTCPHub()); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("BTC_USDT\n"))
+	readFrame(t, conn)
+
+	cancel()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Errorf("client read after cancel: %v, want EOF", err)
+	}
+	for i := 0; ; i++ {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		c.Close()
+		if i > 100 {
+			t.Fatal("listener still accepting after cancel")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,683 @@
+package gateorderbook
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Настройки трекера
+type Config struct {
+	Contracts          []string       // Contracts to track, e.g. BTC_USDT or btc:BTC_USD with its own settle currency
+	Settle             string         // Default settle currency of the contracts: usdt, btc
+	WSHost             string         // WebSocket API host or wss:// URL, e.g. fx-ws-testnet.gateio.ws
+	Isolated           []string       // Contracts that get their own WebSocket connection
+	RedundantFeeds     int            // Independent connections per group; duplicate updates are dropped
+	UpdateInterval     string         // futures.order_book_update interval: 20ms or 100ms
+	SnapshotDepth      int            // Default REST snapshot limit
+	ContractDepths     map[string]int // Per-contract snapshot limit overrides
+	MaxBufferedUpdates int            // Updates kept per contract while waiting for its snapshot
+	ZeroSnapshotID     string         // Snapshot without an id: "anchor" on the next update or "refetch" it first
+	MaxSnapshotAge     time.Duration  // REST snapshots generated longer ago than this are re-fetched (0 disables)
+	HTTPTimeout        time.Duration  // Limit of a whole REST request including reading the body
+	RateLimitRetries   int            // Retries of a REST request answered with 429, waiting for Retry-After
+	SnapshotAttempts   int            // Attempts to fetch a snapshot on network errors and 5xx responses
+	SnapshotBackoff    time.Duration  // Pause before the second snapshot attempt, doubled for each next one
+	ReorderWindow      time.Duration  // How long an update arriving ahead of a sequence gap waits for the gap to fill (0 resyncs at once)
+	MaxTimeSkew        time.Duration  // Server times further from the local clock are replaced (0 accepts any)
+	SubscribeTime      string         // Time field of subscribe requests: "local" clock or "server" (local corrected by the server offset)
+	Reconnect          ReconnectConfig
+	LogLevel           slog.Level
+
+	SaverEnabled  bool          // Periodically save books to ./orderbooks
+	SaveInterval  time.Duration // Period of the saver
+	SaveJitter    time.Duration // Random delay before the first periodic save
+	SampleMode    string        // fixed (every SaveInterval) or poisson (exponential gaps with mean 1/SampleRate)
+	SampleRate    float64       // Mean saves per second in poisson mode
+	SampleSeed    int64         // Seed of the poisson sampler (0 picks one and logs it)
+	OutputDepths  []int         // Extra fixed-depth views, <symbol>.<depth>.txt
+	OutputFormat  string        // text, json, map (JSON price -> size maps in <symbol>.json) or protobuf (<symbol>.pb)
+	PricesAsTicks bool          // Add the price in ticks as a third column
+	Writer        WriterFactory // Receives each saved book instead of ./orderbooks files (nil writes files)
+
+	HTTPAddr     string // HTTP API address (disabled if empty)
+	HTTPTLS      HTTPTLSOptions
+	MinSpreadBps float64 // Spread filter for /summary
+	TCPAddr      string  // TCP stream address (disabled if empty)
+	StatsdAddr   string  // StatsD host:port (disabled if empty)
+	StatsdPrefix string
+	Prometheus   bool          // Serve Prometheus metrics on /metrics of the HTTP API
+	DNSCacheTTL  time.Duration // 0 disables the DNS cache
+	SecretsFile  string        // JSON file with secrets: proxy URL, api_key and api_secret
+
+	OneSidedAlert     time.Duration      // 0 disables
+	StaleAfter        time.Duration      // Warn when a contract gets no update for this long (0 disables)
+	StaleResync       bool               // Also resync a stale book from a REST snapshot
+	MaxResyncsPerHour int                // Warn when a contract resyncs more often than this within an hour (0 disables)
+	PriceAlerts       map[string]float64 // Per-contract alert levels
+	AlertWebhook      string
+	AlertSave         bool
+	LiquidityAlerts   map[string]float64 // Per-contract bid+ask size thresholds within LiquidityBandBps of mid
+	LiquidityBandBps  float64
+	LiquidityHyst     float64 // Fraction above the threshold depth must recover to before re-arming
+	ResilienceBandBps float64 // 0 disables
+	MaxJumpPct        float64 // Flag best bid/ask moves larger than this between updates (0 disables)
+	HoldJumps         bool    // Hold a book with a flagged jump until the next update confirms or reverts it
+	ResyncCrossed     bool    // Refetch the snapshot when a book becomes crossed
+
+	TopOfBookSeries     bool
+	SeriesBuffer        int
+	SeriesFlushInterval time.Duration
+	SeriesFsync         bool
+	MaxRecordsPerSec    int
+
+	ChangeLog           bool   // Append every applied delta to <symbol>.ndjson (<symbol>.changes.pb with the protobuf format)
+	ChangeLogRotateSize int64  // Rotate change logs at this size in bytes (0 rotates daily, UTC)
+	Compress            string // Compress change logs and series: "gzip" or "zstd" ("" writes plain files)
+	CompressLevel       int    // Codec level: gzip 1-9, zstd 1-22 (0 uses the codec default)
+	ReplayValidate      bool   // Stop a replay at the first unsorted or crossed book or sequence gap
+	SpreadMetrics       bool   // Append best bid/ask, spread and mid of every contract to metrics.csv on each save
+
+	SizeCheckInterval  time.Duration // 0 disables
+	SizeCheckTolerance float64
+
+	ClickHouseURL           string // Disabled if empty
+	ClickHouseTable         string
+	ClickHouseBatch         int
+	ClickHouseFlushInterval time.Duration
+
+	Trades     bool          // Subscribe to trades for cumulative volume delta
+	DeltaReset time.Duration // 0 never resets
+
+	IntervalWindow int
+	RollupBoundary string            // HH:MM UTC (disabled if empty)
+	MidHistory     time.Duration     // Mid price retention for TWAP
+	MidEMAAlpha    float64           // Mid price EMA smoothing factor in (0, 1] (disabled with MidEMAPeriod if 0)
+	MidEMAPeriod   int               // Mid price EMA period in updates, alpha = 2/(N+1)
+	DumpOnExit     string            // File for the final dump written by Close
+	DumpGroupBy    string            // Group books of dumps (/dump, DumpOnExit): "" keeps {contract: book}, "base" groups by base asset, "tag" by DumpGroups
+	DumpGroups     map[string]string // Contract -> group for DumpGroupBy "tag"; contracts without one go to "other"
+	EventBuffer    int               // Capacity of the Updates channel; the oldest events are dropped when it is full
+	MaxCPU         int               // Size of the save and snapshot processing worker pools (0 uses GOMAXPROCS)
+}
+
+// Настройки по умолчанию
+func DefaultConfig() Config {
+	return Config{
+		Contracts:               []string{"BTC_USDT", "ETH_USDT", "LTC_USDT"},
+		Settle:                  "usdt",
+		WSHost:                  defaultWSHost,
+		RedundantFeeds:          1,
+		UpdateInterval:          "100ms",
+		SnapshotDepth:           50,
+		MaxBufferedUpdates:      1000,
+		ReorderWindow:           250 * time.Millisecond,
+		HTTPTimeout:             defaultHTTPTimeout,
+		RateLimitRetries:        3,
+		SnapshotAttempts:        3,
+		SnapshotBackoff:         time.Second,
+		ZeroSnapshotID:          "anchor",
+		MaxTimeSkew:             time.Minute,
+		SubscribeTime:           "local",
+		Reconnect:               reconnectConfig,
+		LogLevel:                slog.LevelInfo,
+		SaverEnabled:            true,
+		SaveInterval:            50 * time.Millisecond,
+		OutputFormat:            "text",
+		SampleMode:              "fixed",
+		SampleRate:              1,
+		StatsdPrefix:            "gateio",
+		DNSCacheTTL:             5 * time.Minute,
+		OneSidedAlert:           30 * time.Second,
+		AlertSave:               true,
+		LiquidityBandBps:        50,
+		LiquidityHyst:           0.1,
+		SeriesFlushInterval:     time.Second,
+		SizeCheckTolerance:      0.05,
+		ClickHouseTable:         "orderbook_updates",
+		ClickHouseBatch:         1000,
+		ClickHouseFlushInterval: time.Second,
+		IntervalWindow:          1000,
+		MidHistory:              time.Hour,
+		EventBuffer:             defaultEventBuffer,
+	}
+}
+
+// Трекер ордербуков. Состояние хранится на уровне пакета,
+// поэтому в процессе может работать только один Tracker: New
+// отказывает, пока предыдущий не закрыт Close.
+type Tracker struct {
+	cfg       Config
+	contracts []string
+	isolated  []string
+}
+
+// Работающий трекер: создан New и еще не закрыт
+var (
+	liveTrackerMu sync.Mutex
+	liveTracker   *Tracker
+)
+
+// Проверенные и разобранные настройки, из которых New заполняет состояние пакета
+type trackerSetup struct {
+	baseURL   string
+	settles   map[string]string
+	contracts []string
+	boundary  time.Duration // Rollup boundary, valid if RollupBoundary is set
+	emaAlpha  float64       // 0 disables the mid-price EMA
+	secrets   *Secrets
+}
+
+// Проверка всех настроек до изменения состояния пакета: при ошибке
+// трекер предыдущего New остается нетронутым
+func validateConfig(cfg Config) (trackerSetup, error) {
+	var setup trackerSetup
+	if err := validateSettle(cfg.Settle); err != nil {
+		return setup, err
+	}
+	baseURL, err := parseWSHost(cfg.WSHost)
+	if err != nil {
+		return setup, err
+	}
+	setup.baseURL = baseURL
+	// Контракты с префиксом валюты расчетов идут отдельными соединениями
+	setup.settles = make(map[string]string)
+	var names []string
+	for _, entry := range cfg.Contracts {
+		settle, contract := splitContractSettle(entry, cfg.Settle)
+		if err := validateSettle(settle); err != nil {
+			return setup, fmt.Errorf("invalid contract %q: %v", entry, err)
+		}
+		if prev, ok := setup.settles[contract]; ok && prev != settle {
+			return setup, fmt.Errorf("contract %s is listed with settle currencies %s and %s", contract, prev, settle)
+		}
+		setup.settles[contract] = settle
+		names = append(names, contract)
+	}
+	setup.contracts = dedupeContracts(names)
+	if len(setup.contracts) == 0 {
+		return setup, fmt.Errorf("no contracts given")
+	}
+	if err := validateContracts(setup.contracts); err != nil {
+		return setup, err
+	}
+	if err := validateContracts(cfg.Isolated); err != nil {
+		return setup, fmt.Errorf("invalid isolated contracts: %v", err)
+	}
+	if err := validateDumpGrouping(cfg.DumpGroupBy, cfg.DumpGroups); err != nil {
+		return setup, err
+	}
+	if err := validateOutputFormat(cfg.OutputFormat); err != nil {
+		return setup, err
+	}
+	if err := validateSampleMode(cfg.SampleMode, cfg.SampleRate); err != nil {
+		return setup, err
+	}
+	if cfg.SaveInterval <= 0 {
+		return setup, fmt.Errorf("save interval must be positive")
+	}
+	if err := validateSnapshotLimit(cfg.SnapshotDepth); err != nil {
+		return setup, fmt.Errorf("invalid snapshot depth: %v", err)
+	}
+	for contract, limit := range cfg.ContractDepths {
+		if err := validateSnapshotLimit(limit); err != nil {
+			return setup, fmt.Errorf("invalid snapshot depth for %s: %v", contract, err)
+		}
+	}
+	if err := validateUpdateInterval(cfg.UpdateInterval); err != nil {
+		return setup, err
+	}
+	if cfg.RedundantFeeds < 1 {
+		return setup, fmt.Errorf("redundant feeds must be at least 1")
+	}
+	if cfg.MaxBufferedUpdates < 1 {
+		return setup, fmt.Errorf("max buffered updates must be at least 1")
+	}
+	if err := validateZeroSnapshotID(cfg.ZeroSnapshotID); err != nil {
+		return setup, err
+	}
+	if err := validateSubscribeTimeSource(cfg.SubscribeTime); err != nil {
+		return setup, err
+	}
+	if cfg.MaxSnapshotAge < 0 {
+		return setup, fmt.Errorf("max snapshot age must not be negative")
+	}
+	if cfg.ReorderWindow < 0 {
+		return setup, fmt.Errorf("reorder window must not be negative")
+	}
+	if cfg.MaxCPU < 0 {
+		return setup, fmt.Errorf("max cpu must not be negative")
+	}
+	if cfg.MaxResyncsPerHour < 0 {
+		return setup, fmt.Errorf("max resyncs per hour must not be negative")
+	}
+	if cfg.HTTPTimeout <= 0 {
+		return setup, fmt.Errorf("http timeout must be positive")
+	}
+	if cfg.RateLimitRetries < 0 {
+		return setup, fmt.Errorf("rate limit retries must not be negative")
+	}
+	if cfg.SnapshotAttempts < 1 || cfg.SnapshotBackoff < 0 {
+		return setup, fmt.Errorf("invalid snapshot retries: need at least one attempt and a non-negative backoff")
+	}
+	if cfg.Reconnect.InitialBackoff <= 0 || cfg.Reconnect.MaxBackoff < cfg.Reconnect.InitialBackoff {
+		return setup, fmt.Errorf("invalid reconnect backoff: need 0 < initial <= max")
+	}
+	if cfg.Reconnect.FlapThreshold < 0 || (cfg.Reconnect.FlapThreshold > 0 && cfg.Reconnect.FlapWindow <= 0) {
+		return setup, fmt.Errorf("invalid flap detection: need a non-negative threshold and a positive window")
+	}
+	if len(cfg.LiquidityAlerts) > 0 {
+		if err := validateLiquidityAlerts(cfg.LiquidityBandBps, cfg.LiquidityHyst); err != nil {
+			return setup, err
+		}
+	}
+	if cfg.MaxJumpPct < 0 {
+		return setup, fmt.Errorf("max jump percentage must not be negative")
+	}
+	if cfg.StaleAfter < 0 {
+		return setup, fmt.Errorf("stale threshold must not be negative")
+	}
+	if cfg.RollupBoundary != "" {
+		setup.boundary, err = parseRollupBoundary(cfg.RollupBoundary)
+		if err != nil {
+			return setup, fmt.Errorf("invalid rollup boundary: %v", err)
+		}
+	}
+	if cfg.MidEMAAlpha != 0 || cfg.MidEMAPeriod != 0 {
+		setup.emaAlpha, err = emaAlpha(cfg.MidEMAAlpha, cfg.MidEMAPeriod)
+		if err != nil {
+			return setup, fmt.Errorf("invalid mid-price EMA: %v", err)
+		}
+	}
+	if cfg.Prometheus && cfg.HTTPAddr == "" {
+		return setup, fmt.Errorf("prometheus metrics are served by the HTTP API, set an HTTP address")
+	}
+	if cfg.SecretsFile != "" {
+		secrets, err := loadSecrets(cfg.SecretsFile)
+		if err != nil {
+			return setup, fmt.Errorf("failed to load secrets: %v", err)
+		}
+		if err := secrets.validate(); err != nil {
+			return setup, fmt.Errorf("failed to apply secrets: %v", err)
+		}
+		setup.secrets = &secrets
+	}
+	if cfg.TopOfBookSeries && (cfg.SeriesBuffer > 0 || cfg.SeriesFsync) && cfg.SeriesFlushInterval <= 0 {
+		return setup, fmt.Errorf("series flush interval must be positive")
+	}
+	if cfg.ChangeLog && cfg.ChangeLogRotateSize < 0 {
+		return setup, fmt.Errorf("change log rotate size must not be negative")
+	}
+	if err := validateCompression(compression{codec: cfg.Compress, level: cfg.CompressLevel}); err != nil {
+		return setup, err
+	}
+	return setup, nil
+}
+
+// Файлы и сокеты трекера, открываемые в New
+type trackerOutputs struct {
+	statsd    *statsdSink
+	series    *seriesWriter
+	changeLog *changeLog
+	spreadLog *spreadLog
+}
+
+// Закрытие открытых выводов, если New не удался
+func (o trackerOutputs) close() {
+	if o.statsd != nil {
+		o.statsd.conn.Close()
+	}
+	if o.series != nil {
+		o.series.Close()
+	}
+	if o.changeLog != nil {
+		o.changeLog.Close()
+	}
+	if o.spreadLog != nil {
+		o.spreadLog.Close()
+	}
+}
+
+// Открытие выводов; при ошибке уже открытые закрываются
+func openOutputs(cfg Config, contracts []string) (trackerOutputs, error) {
+	var out trackerOutputs
+	var err error
+	compress := compression{codec: cfg.Compress, level: cfg.CompressLevel}
+	if cfg.StatsdAddr != "" {
+		out.statsd, err = newStatsdSink(cfg.StatsdAddr, cfg.StatsdPrefix)
+		if err != nil {
+			return out, fmt.Errorf("failed to set up StatsD: %v", err)
+		}
+	}
+	if cfg.TopOfBookSeries {
+		out.series = newSeriesWriter("./orderbooks", cfg.MaxRecordsPerSec, seriesFlushPolicy{
+			BufferSize: cfg.SeriesBuffer,
+			Fsync:      cfg.SeriesFsync,
+		}, compress)
+		if err := out.series.Open(contracts); err != nil {
+			out.close()
+			return out, fmt.Errorf("failed to open top-of-book series: %v", err)
+		}
+	}
+	if cfg.ChangeLog {
+		out.changeLog, err = newChangeLog("./orderbooks", cfg.OutputFormat, compress, cfg.ChangeLogRotateSize, time.Second)
+		if err != nil {
+			out.close()
+			return out, err
+		}
+	}
+	if cfg.SpreadMetrics && cfg.SaverEnabled {
+		out.spreadLog, err = openSpreadLog("./orderbooks")
+		if err != nil {
+			out.close()
+			return out, fmt.Errorf("failed to open spread metrics: %v", err)
+		}
+	}
+	return out, nil
+}
+
+// Создание трекера: проверка настроек и подготовка компонентов (без сетевых запросов).
+// Состояние пакета меняется, только если все настройки верны, все файлы открылись
+// и другой трекер не работает (иначе его книги и клиенты были бы перезаписаны).
+func New(cfg Config) (*Tracker, error) {
+	setup, err := validateConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	liveTrackerMu.Lock()
+	defer liveTrackerMu.Unlock()
+	if liveTracker != nil {
+		return nil, fmt.Errorf("another tracker is running in this process, close it before creating a new one")
+	}
+	outputs, err := openOutputs(cfg, setup.contracts)
+	if err != nil {
+		return nil, err
+	}
+	contracts := setup.contracts
+
+	LogLevel.Set(cfg.LogLevel)
+	// Состояние по контрактам выделяется сразу на весь список
+	orderbooks = newOrderBookStore(len(contracts))
+	lastUpdateIDs = make(map[string]int64, len(contracts))
+	pendingUpdates = make(map[string][]receivedUpdate, len(contracts))
+	resyncing = make(map[string]bool)
+	staleSnapshots = make(map[string]int)
+	reorderBuffers = make(map[string][]heldUpdate)
+	messageTimeAnomalies = make(map[string]bool)
+	lastChecksums = newChecksumRecorder()
+	crossedBooks = newCrossedBookDetector()
+	resyncCounts = newResyncCounter(cfg.MaxResyncsPerHour)
+	saveWorkers = newWorkerPool(workerCount(cfg.MaxCPU))
+	processWorkers = newWorkerPool(workerCount(cfg.MaxCPU))
+	pausedContracts = newPauseSet()
+	alertSaves = make(chan alertSave, alertSaveQueue)
+	snapshotDepth = cfg.SnapshotDepth
+	contractDepths = make(map[string]int, len(cfg.ContractDepths))
+	for contract, limit := range cfg.ContractDepths {
+		contractDepths[contract] = limit
+	}
+	outputDepths = cfg.OutputDepths
+	outputFormat = cfg.OutputFormat
+	dumpGroupBy = cfg.DumpGroupBy
+	dumpGroups = make(map[string]string, len(cfg.DumpGroups))
+	for contract, group := range cfg.DumpGroups {
+		dumpGroups[contract] = group
+	}
+	outputWriter = cfg.Writer
+	updateInterval = cfg.UpdateInterval
+	updateIntervals = newIntervalRecorder(cfg.IntervalWindow)
+	midPrices = newMidHistory(cfg.MidHistory)
+	summaryMinSpreadBps = cfg.MinSpreadBps
+	settleCurrency = cfg.Settle
+	wsBaseURL = setup.baseURL
+	contractSettles = setup.settles
+	saveInterval = cfg.SaveInterval
+	saveJitter = cfg.SaveJitter
+	saverEnabled = cfg.SaverEnabled
+	pricesAsTicks = cfg.PricesAsTicks
+	maxMessageTimeSkew = cfg.MaxTimeSkew
+	subscribeTimeSource = cfg.SubscribeTime
+	maxBufferedUpdates = cfg.MaxBufferedUpdates
+	reorderWindow = cfg.ReorderWindow
+	maxSnapshotAge = cfg.MaxSnapshotAge
+	httpClient.Timeout = cfg.HTTPTimeout
+	webhookClient.Timeout = cfg.HTTPTimeout
+	rateLimitRetries = cfg.RateLimitRetries
+	snapshotAttempts = cfg.SnapshotAttempts
+	snapshotRetryBackoff = cfg.SnapshotBackoff
+	zeroSnapshotID = cfg.ZeroSnapshotID
+	reconnectConfig = cfg.Reconnect
+	resyncCrossed = cfg.ResyncCrossed
+	staleResync = cfg.StaleResync
+
+	// Необязательные компоненты: выключенные сбрасываются, чтобы не остались от прошлого New
+	saveSampler = nil
+	if cfg.SampleMode == "poisson" {
+		seed := cfg.SampleSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		saveSampler = newPoissonSampler(cfg.SampleRate, seed)
+		infof("Saving orderbooks at Poisson intervals, %g saves/s on average (seed %d)", cfg.SampleRate, seed)
+	}
+	depthAlerts = nil
+	if len(cfg.LiquidityAlerts) > 0 {
+		depthAlerts = newLiquidityAlerts(cfg.LiquidityAlerts, cfg.LiquidityBandBps, cfg.LiquidityHyst, cfg.AlertWebhook)
+	}
+	crossingAlerts = nil
+	if len(cfg.PriceAlerts) > 0 {
+		crossingAlerts = newPriceAlerts(cfg.PriceAlerts, cfg.AlertWebhook, cfg.AlertSave)
+	}
+	priceJumps = nil
+	if cfg.MaxJumpPct > 0 {
+		priceJumps = newJumpGuard(cfg.MaxJumpPct, cfg.HoldJumps)
+	}
+	bookResilience = nil
+	if cfg.ResilienceBandBps > 0 {
+		bookResilience = newResilienceTracker(cfg.ResilienceBandBps)
+	}
+	staleBooks = nil
+	if cfg.StaleAfter > 0 {
+		staleBooks = newStaleMonitor(cfg.StaleAfter, contracts)
+	}
+	oneSidedAlerts = nil
+	if cfg.OneSidedAlert > 0 {
+		oneSidedAlerts = newOneSidedMonitor(cfg.OneSidedAlert)
+	}
+	dailyRollups = nil
+	if cfg.RollupBoundary != "" {
+		dailyRollups = newDailyRollup("./orderbooks", setup.boundary)
+	}
+	cumulativeDeltas = nil
+	if cfg.Trades {
+		cumulativeDeltas = newCumulativeDelta(cfg.DeltaReset)
+	}
+	midEMAs = nil
+	if setup.emaAlpha != 0 {
+		midEMAs = newMidEMA(setup.emaAlpha)
+	}
+
+	metrics = nopMetrics{}
+	if outputs.statsd != nil {
+		metrics = outputs.statsd
+		infof("Sending StatsD metrics to %s", cfg.StatsdAddr)
+	}
+	promMetrics = nil
+	if cfg.Prometheus {
+		promMetrics = newPrometheusSink()
+		if _, ok := metrics.(nopMetrics); ok {
+			metrics = promMetrics
+		} else {
+			metrics = multiMetrics{metrics, promMetrics}
+		}
+	}
+	applyDNSCache(cfg.DNSCacheTTL)
+	var secrets Secrets
+	if setup.secrets != nil {
+		secrets = *setup.secrets
+	}
+	applySecrets(secrets)
+
+	topOfBookSeries = outputs.series
+	changeLogs = outputs.changeLog
+	spreadMetrics = outputs.spreadLog
+	clickhouseUpdates = nil
+	if cfg.ClickHouseURL != "" {
+		clickhouseUpdates = newClickhouseSink(strings.TrimSuffix(cfg.ClickHouseURL, "/"), cfg.ClickHouseTable, cfg.ClickHouseBatch, cfg.ClickHouseFlushInterval)
+	}
+
+	liveTracker = &Tracker{
+		cfg:       cfg,
+		contracts: contracts,
+		isolated:  dedupeContracts(cfg.Isolated),
+	}
+	return liveTracker, nil
+}
+
+// Запуск трекера: HTTP/TCP серверы, сохранение и WebSocket потоки.
+// При отмене ctx закрывает соединения, сохраняет все книги и возвращает ctx.Err().
+func (t *Tracker) Run(ctx context.Context) error {
+	return t.run(ctx, func(ctx context.Context) error {
+		// До первых кадров поправка к часам берется из REST
+		if subscribeTimeSource == "server" {
+			if err := syncServerTime(ctx, serverTimeEndpoint); err != nil {
+				warnf("failed to get server time, subscribing with the local clock until frames arrive: %v", err)
+			}
+		}
+		return runWebSocketFeeds(ctx, connectionGroups(t.contracts, t.isolated), t.cfg.RedundantFeeds)
+	})
+}
+
+// Воспроизведение записанного журнала изменений (-changelog) вместо
+// WebSocket потоков: книги восстанавливаются по снимкам и дельтам файла,
+// сохраняются, отдаются по HTTP/TCP и в Updates, как в обычном режиме.
+// При realtime строки применяются с исходными интервалами, иначе сразу.
+// Возвращает nil по окончании файла; с ReplayValidate - *ReplayViolation
+// на первом нарушении инвариантов книги или последовательности.
+func (t *Tracker) Replay(ctx context.Context, path string, realtime bool) error {
+	return t.run(ctx, func(ctx context.Context) error {
+		return replayChangeLog(ctx, path, realtime, t.cfg.ReplayValidate)
+	})
+}
+
+// Общий запуск: подготовка вывода и серверов, затем источник обновлений feed
+func (t *Tracker) run(ctx context.Context, feed func(ctx context.Context) error) error {
+	// Создаем директорию для ордербуков если её нет
+	if saverEnabled {
+		if err := os.MkdirAll("./orderbooks", 0755); err != nil {
+			return fmt.Errorf("failed to create orderbooks directory: %v", err)
+		}
+	}
+
+	// Загружаем размеры тиков для вывода цен в тиках
+	if pricesAsTicks {
+		for _, contract := range t.contracts {
+			info, err := getContractInfo(ctx, contractSettle(contract), contract)
+			if err != nil {
+				errorf("Failed to get contract info for %s: %v", contract, err)
+				continue
+			}
+			tickSize, err := info.TickSize()
+			if err != nil {
+				warnf("prices for %s will not be shown in ticks: %v", contract, err)
+				continue
+			}
+			tickSizes[contract] = tickSize
+		}
+	}
+
+	// Запускаем периодическое сохранение; оно останавливается с последним
+	// сохранением после закрытия WebSocket потоков
+	saverCtx, stopSaver := context.WithCancel(context.Background())
+	saverDone := make(chan struct{})
+	go func() {
+		defer close(saverDone)
+		startOrderBookSaver(saverCtx)
+	}()
+	defer func() {
+		stopSaver()
+		<-saverDone
+	}()
+
+	// Запускаем HTTP API
+	if t.cfg.HTTPAddr != "" {
+		if err := startHTTPServer(ctx, t.cfg.HTTPAddr, t.cfg.HTTPTLS); err != nil {
+			return fmt.Errorf("failed to start HTTP server: %v", err)
+		}
+	}
+
+	// Запускаем TCP поток обновлений
+	if t.cfg.TCPAddr != "" {
+		tcpStream = newTCPHub()
+		if err := startTCPStreamServer(ctx, t.cfg.TCPAddr, tcpStream); err != nil {
+			return fmt.Errorf("failed to start TCP stream server: %v", err)
+		}
+	}
+
+	// Запускаем сброс буферов ряда лучших цен (Close сбрасывает остаток)
+	if topOfBookSeries != nil && (t.cfg.SeriesBuffer > 0 || t.cfg.SeriesFsync) {
+		go topOfBookSeries.runFlusher(ctx, t.cfg.SeriesFlushInterval)
+	}
+
+	// Запускаем проверку суммарных объемов
+	if t.cfg.SizeCheckInterval > 0 {
+		startSizeTotalsCheck(ctx, t.contracts, t.cfg.SizeCheckInterval, t.cfg.SizeCheckTolerance)
+	}
+
+	return feed(ctx)
+}
+
+// Канал изменений ордербуков: событие публикуется после каждого примененного
+// обновления и загруженного снимка (обновления приостановленных контрактов
+// не публикуются).
+// Вызывать до Run. Обработка WebSocket не ждет читателя: при заполненном
+// буфере (Config.EventBuffer) отбрасываются самые старые события.
+func (t *Tracker) Updates() <-chan BookEvent {
+	if bookEvents == nil {
+		size := t.cfg.EventBuffer
+		if size < 1 {
+			size = defaultEventBuffer
+		}
+		bookEvents = newEventQueue(size)
+	}
+	return bookEvents.events
+}
+
+// Завершение: сброс рядов и ClickHouse, выгрузка книг в DumpOnExit.
+// После Close можно создать новый трекер; повторный Close ничего не делает.
+func (t *Tracker) Close() {
+	liveTrackerMu.Lock()
+	defer liveTrackerMu.Unlock()
+	if liveTracker != t {
+		return
+	}
+	liveTracker = nil
+
+	if t.cfg.DumpOnExit != "" {
+		if err := writeDumpFile(t.cfg.DumpOnExit); err != nil {
+			errorf("Error writing dump on exit: %v", err)
+		} else {
+			infof("Orderbooks dumped to %s", t.cfg.DumpOnExit)
+		}
+	}
+	if clickhouseUpdates != nil {
+		clickhouseUpdates.Close()
+	}
+	if changeLogs != nil {
+		changeLogs.Close()
+	}
+	if spreadMetrics != nil {
+		if err := spreadMetrics.Close(); err != nil {
+			errorf("Error closing spread metrics: %v", err)
+		}
+	}
+	if topOfBookSeries != nil {
+		if err := topOfBookSeries.Close(); err != nil {
+			errorf("Error closing top-of-book series: %v", err)
+		}
+	}
+}
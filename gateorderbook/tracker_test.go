@@ -0,0 +1,390 @@
+package gateorderbook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Трекер для тестов: настройки по умолчанию без сохранения на диск,
+// измененные mutate; состояние пакета сбрасывается New. Трекер прошлого
+// вызова закрывается, новый закрывается в конце теста.
+func newTestTracker(t testing.TB, mutate func(cfg *Config)) *Tracker {
+	t.Helper()
+	closeLiveTracker()
+	cfg := DefaultConfig()
+	cfg.Contracts = []string{"BTC_USDT"}
+	cfg.SaverEnabled = false
+	cfg.OneSidedAlert = 0
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	tracker, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(tracker.Close)
+	return tracker
+}
+
+// Закрытие работающего трекера, чтобы New мог создать следующий
+func closeLiveTracker() {
+	liveTrackerMu.Lock()
+	live := liveTracker
+	liveTrackerMu.Unlock()
+	if live != nil {
+		live.Close()
+	}
+}
+
+// Переход во временную директорию на время теста (файлы пишутся в ./orderbooks)
+func chdirTemp(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestNewRejectsInvalidConfigWithoutTouchingState(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.SnapshotDepth = 100
+		cfg.MaxJumpPct = 5
+	})
+	guard := priceJumps
+
+	tests := []struct {
+		name   string
+		mutate func(cfg *Config)
+	}{
+		{"negative max jump", func(cfg *Config) { cfg.MaxJumpPct = -1 }},
+		{"negative stale threshold", func(cfg *Config) { cfg.StaleAfter = -time.Second }},
+		{"prometheus without http", func(cfg *Config) { cfg.Prometheus = true }},
+		{"bad rollup boundary", func(cfg *Config) { cfg.RollupBoundary = "25:00" }},
+		{"bad ema", func(cfg *Config) { cfg.MidEMAAlpha = 2 }},
+		{"bad liquidity band", func(cfg *Config) {
+			cfg.LiquidityAlerts = map[string]float64{"BTC_USDT": 1}
+			cfg.LiquidityBandBps = -1
+		}},
+		{"series without flush interval", func(cfg *Config) {
+			cfg.TopOfBookSeries = true
+			cfg.SeriesBuffer = 4096
+			cfg.SeriesFlushInterval = 0
+		}},
+		{"negative change log rotate size", func(cfg *Config) {
+			cfg.ChangeLog = true
+			cfg.ChangeLogRotateSize = -1
+		}},
+		{"missing secrets file", func(cfg *Config) { cfg.SecretsFile = "/nonexistent/secrets.json" }},
+		{"negative max resyncs", func(cfg *Config) { cfg.MaxResyncsPerHour = -1 }},
+		{"unknown dump grouping", func(cfg *Config) { cfg.DumpGroupBy = "quote" }},
+		{"dump grouping by tag without groups", func(cfg *Config) { cfg.DumpGroupBy = "tag" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.SnapshotDepth = 20
+			tt.mutate(&cfg)
+			if _, err := New(cfg); err == nil {
+				t.Fatal("New accepted an invalid config")
+			}
+			if snapshotDepth != 100 {
+				t.Errorf("snapshotDepth = %d after failed New, want 100", snapshotDepth)
+			}
+			if priceJumps != guard {
+				t.Error("priceJumps replaced by a failed New")
+			}
+		})
+	}
+}
+
+func TestNewResetsDisabledComponents(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) {
+		cfg.MaxJumpPct = 5
+		cfg.StaleAfter = time.Minute
+		cfg.ResilienceBandBps = 10
+	})
+	if priceJumps == nil || staleBooks == nil || bookResilience == nil {
+		t.Fatal("components not created")
+	}
+	if wsDialer.NetDialContext == nil {
+		t.Fatal("DNS cache not installed")
+	}
+	lastUpdateIDs["BTC_USDT"] = 42
+	resyncing["BTC_USDT"] = true
+
+	newTestTracker(t, func(cfg *Config) { cfg.DNSCacheTTL = 0 })
+	if priceJumps != nil || staleBooks != nil || bookResilience != nil {
+		t.Error("disabled components left over from the previous New")
+	}
+	if wsDialer.NetDialContext != nil {
+		t.Error("DNS cache left over from the previous New")
+	}
+	if len(lastUpdateIDs) != 0 || len(resyncing) != 0 {
+		t.Error("per-contract state left over from the previous New")
+	}
+}
+
+func TestNewRefusesWhileTrackerRunning(t *testing.T) {
+	first := newTestTracker(t, nil)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+
+	cfg := DefaultConfig()
+	cfg.Contracts = []string{"ETH_USDT"}
+	cfg.SaverEnabled = false
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "another tracker is running") {
+		t.Fatalf("New with a running tracker: %v", err)
+	}
+	// Книги работающего трекера не тронуты
+	if _, ok := orderbooks.Get("BTC_USDT"); !ok || lastUpdateIDs["BTC_USDT"] != 100 {
+		t.Error("running tracker state was reset by the refused New")
+	}
+
+	first.Close()
+	first.Close()
+	second, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New after Close: %v", err)
+	}
+	second.Close()
+}
+
+func TestSaverDisabledKeepsHTTPAPI(t *testing.T) {
+	tests := []struct {
+		name      string
+		saver     bool
+		wantFiles bool
+	}{
+		{"saver disabled", false, false},
+		{"saver enabled", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := chdirTemp(t)
+			captureLog(t)
+			addr := freeAddr(t)
+			tracker := newTestTracker(t, func(cfg *Config) {
+				cfg.SaverEnabled = tt.saver
+				cfg.SaveInterval = time.Millisecond
+				cfg.HTTPAddr = addr
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var status int
+			err := tracker.run(ctx, func(ctx context.Context) error {
+				applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+				resp, err := http.Get("http://" + addr + "/orderbook/BTC_USDT")
+				if err != nil {
+					return err
+				}
+				resp.Body.Close()
+				status = resp.StatusCode
+				// Несколько тактов сохранения
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != http.StatusOK {
+				t.Errorf("/orderbook/BTC_USDT status = %d, want 200", status)
+			}
+
+			entries, _ := os.ReadDir(dir)
+			if wrote := len(entries) > 0; wrote != tt.wantFiles {
+				t.Errorf("files in the working directory = %v, want files %v", entries, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	chdirTemp(t)
+	captureLog(t)
+	recordingSubscriptions(t)
+	host := serveWS(t, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	serveREST(t, func(w http.ResponseWriter, r *http.Request) {
+		writeSnapshot(w, testBook(100, levels("101:1"), levels("99:1")))
+	})
+	tracker := newTestTracker(t, func(cfg *Config) {
+		cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"}
+		cfg.Isolated = []string{"ETH_USDT"}
+		cfg.RedundantFeeds = 2
+		cfg.WSHost = host
+		cfg.SaverEnabled = true
+		cfg.HTTPAddr = freeAddr(t)
+		cfg.TCPAddr = freeAddr(t)
+		cfg.TopOfBookSeries = true
+		cfg.SeriesBuffer = 4096
+		cfg.SizeCheckInterval = time.Millisecond
+		cfg.StaleAfter = time.Minute
+		cfg.DNSCacheTTL = 0
+	})
+	idle := http.DefaultTransport.(*http.Transport)
+	idle.CloseIdleConnections()
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tracker.Run(ctx) }()
+
+	// Трекер подключился и получил снимки обоих контрактов
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, btc := orderbooks.Get("BTC_USDT")
+		_, eth := orderbooks.Get("ETH_USDT")
+		if btc && eth {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshots not loaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run returned %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	// Все горутины трекера завершились (кроме соединений, закрываемых сервером)
+	var running int
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		idle.CloseIdleConnections()
+		if running = runtime.NumGoroutine(); running <= baseline || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if running > baseline {
+		buf := make([]byte, 1<<20)
+		t.Errorf("goroutines after Run = %d, baseline %d:\n%s", running, baseline, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestDuplicateContractsTrackedOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		contracts []string
+		want      string
+		wantErr   bool
+	}{
+		{"unique", []string{"BTC_USDT", "ETH_USDT"}, "BTC_USDT ETH_USDT", false},
+		{"duplicates keep the first position", []string{"ETH_USDT", "BTC_USDT", "ETH_USDT", "BTC_USDT"}, "ETH_USDT BTC_USDT", false},
+		{"same settle prefix", []string{"BTC_USDT", "usdt:BTC_USDT"}, "BTC_USDT", false},
+		{"conflicting settle", []string{"BTC_USDT", "btc:BTC_USDT"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestTracker(t, nil)
+			logs := captureLog(t)
+			cfg := DefaultConfig()
+			cfg.Contracts = tt.contracts
+			cfg.SaverEnabled = false
+			closeLiveTracker()
+			tracker, err := New(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := strings.Join(tracker.contracts, " "); got != tt.want {
+				t.Errorf("contracts = %s, want %s", got, tt.want)
+			}
+			duplicates := len(tt.contracts) - len(tracker.contracts)
+			if got := strings.Count(logs.String(), "is listed more than once"); got != duplicates {
+				t.Errorf("duplicate warnings = %d, want %d", got, duplicates)
+			}
+
+			// Каждый контракт подписывается в одном соединении
+			var subscribed []string
+			for _, group := range connectionGroups(tracker.contracts, tracker.isolated) {
+				subscribed = append(subscribed, group.Contracts...)
+			}
+			if got := strings.Join(subscribed, " "); got != tt.want {
+				t.Errorf("subscribed contracts = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloseWritesDumpOnExit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dump.json")
+	tracker := newTestTracker(t, func(cfg *Config) {
+		cfg.Contracts = []string{"BTC_USDT", "ETH_USDT"}
+		cfg.DumpOnExit = path
+	})
+	logs := captureLog(t)
+	applySnapshot("BTC_USDT", testBook(100, levels("101:1"), levels("99:1")))
+	applySnapshot("ETH_USDT", testBook(200, levels("3001:1"), levels("2999:1")))
+	handleWebSocketMessage(updateMessage("BTC_USDT", 101, 101, levels("101:3"), nil), time.Now().UnixNano())
+	live := orderbooks.Snapshot()
+
+	tracker.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump OrderBookDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatal(err)
+	}
+	if len(dump.Orderbooks) != 2 {
+		t.Fatalf("dumped contracts = %d, want 2", len(dump.Orderbooks))
+	}
+	// Последовательность и метки времени сохраняются вместе с уровнями
+	for contract, want := range live {
+		got := dump.Orderbooks[contract]
+		if got.ID != want.ID || got.Update != want.Update || got.ReceivedNs != want.ReceivedNs ||
+			levelSpecs(got.Asks) != levelSpecs(want.Asks) || levelSpecs(got.Bids) != levelSpecs(want.Bids) {
+			t.Errorf("%s dumped as %+v, want %+v", contract, got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary dump file left behind: %v", err)
+	}
+	if !strings.Contains(logs.String(), "Orderbooks dumped to "+path) {
+		t.Errorf("log = %q, want the dump message", logs)
+	}
+}
+
+func TestCloseReportsDumpError(t *testing.T) {
+	tracker := newTestTracker(t, func(cfg *Config) {
+		cfg.DumpOnExit = filepath.Join(t.TempDir(), "missing", "dump.json")
+	})
+	logs := captureLog(t)
+	tracker.Close()
+	if !strings.Contains(logs.String(), "ERROR Error writing dump on exit") {
+		t.Errorf("log = %q, want the dump error", logs)
+	}
+}
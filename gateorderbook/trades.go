@@ -0,0 +1,98 @@
+package gateorderbook
+
+import (
+	"sync"
+	"time"
+)
+
+// Сделка из канала futures.trades; положительный size - агрессивная покупка,
+// отрицательный - агрессивная продажа
+type Trade struct {
+	ID           int64   `json:"id"`
+	Contract     string  `json:"contract"`
+	Size         float64 `json:"size"`
+	Price        string  `json:"price"`
+	CreateTimeMs int64   `json:"create_time_ms"`
+}
+
+// Отправка подписки на сделки контрактов
+func subscribeTrades(conn jsonWriter, contracts []string) error {
+	msg := map[string]interface{}{
+		"time":    subscribeTime(time.Now()),
+		"channel": "futures.trades",
+		"event":   "subscribe",
+		"payload": contracts,
+	}
+	addChannelAuth(msg)
+	return conn.WriteJSON(msg)
+}
+
+// Накопленная дельта объема (покупки минус продажи) по контрактам.
+// При reset > 0 все суммы обнуляются каждые reset.
+type cumulativeDelta struct {
+	mu        sync.Mutex
+	reset     time.Duration
+	now       func() time.Time
+	nextReset time.Time
+	totals    map[string]float64
+	lastID    map[string]int64 // Dedupes trades from redundant feeds
+}
+
+func newCumulativeDelta(reset time.Duration) *cumulativeDelta {
+	return &cumulativeDelta{
+		reset:  reset,
+		now:    time.Now,
+		totals: make(map[string]float64),
+		lastID: make(map[string]int64),
+	}
+}
+
+// Обнуление сумм, если наступило время сброса (вызывается под mu)
+func (d *cumulativeDelta) resetIfDue() {
+	if d.reset <= 0 {
+		return
+	}
+	now := d.now()
+	if d.nextReset.IsZero() {
+		d.nextReset = now.Add(d.reset)
+		return
+	}
+	if now.Before(d.nextReset) {
+		return
+	}
+	d.totals = make(map[string]float64)
+	for !d.nextReset.After(now) {
+		d.nextReset = d.nextReset.Add(d.reset)
+	}
+}
+
+// Учет сделки; возвращает накопленную дельту контракта
+func (d *cumulativeDelta) Add(trade Trade) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.resetIfDue()
+	if trade.ID != 0 {
+		if trade.ID <= d.lastID[trade.Contract] {
+			return d.totals[trade.Contract]
+		}
+		d.lastID[trade.Contract] = trade.ID
+	}
+	d.totals[trade.Contract] += trade.Size
+	total := d.totals[trade.Contract]
+	metrics.Gauge("orderbook.cumulative_delta."+trade.Contract, total)
+	return total
+}
+
+// Накопленная дельта по всем контрактам
+func (d *cumulativeDelta) Totals() map[string]float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.resetIfDue()
+	totals := make(map[string]float64, len(d.totals))
+	for contract, total := range d.totals {
+		totals[contract] = total
+	}
+	return totals
+}
@@ -0,0 +1,87 @@
+package gateorderbook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Сообщение канала futures.trades со сделками
+func tradesMessage(trades ...Trade) []byte {
+	result, err := json.Marshal(trades)
+	if err != nil {
+		panic(err)
+	}
+	msg, err := json.Marshal(WebSocketMessage{Channel: "futures.trades", Event: "update", Result: result})
+	if err != nil {
+		panic(err)
+	}
+	return msg
+}
+
+func TestCumulativeDelta(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.Trades = true })
+	for _, msg := range [][]byte{
+		tradesMessage(Trade{ID: 1, Contract: "BTC_USDT", Size: 10}, Trade{ID: 2, Contract: "BTC_USDT", Size: -4}),
+		tradesMessage(Trade{ID: 1, Contract: "ETH_USDT", Size: -7}),
+		// Повтор с резервного соединения не учитывается
+		tradesMessage(Trade{ID: 2, Contract: "BTC_USDT", Size: -4}),
+		tradesMessage(Trade{ID: 3, Contract: "BTC_USDT", Size: 1.5}),
+	} {
+		handleWebSocketMessage(msg, time.Now().UnixNano())
+	}
+
+	rec := httptest.NewRecorder()
+	handleDelta(rec, httptest.NewRequest(http.MethodGet, "/delta", nil))
+	var totals map[string]float64
+	if err := json.Unmarshal(rec.Body.Bytes(), &totals); err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 2 || totals["BTC_USDT"] != 7.5 || totals["ETH_USDT"] != -7 {
+		t.Errorf("totals = %v, want BTC_USDT 7.5 and ETH_USDT -7", totals)
+	}
+}
+
+func TestCumulativeDeltaReset(t *testing.T) {
+	newTestTracker(t, nil)
+	start := time.Unix(1700000000, 0)
+	now := start
+	delta := newCumulativeDelta(time.Hour)
+	delta.now = func() time.Time { return now }
+
+	steps := []struct {
+		after time.Duration
+		size  float64
+		want  float64
+	}{
+		{0, 5, 5},
+		{30 * time.Minute, -2, 3},
+		// Сброс по расписанию: отсчет от первой сделки
+		{time.Hour, 1, 1},
+		{90 * time.Minute, 1, 2},
+		// Пропущено несколько периодов
+		{5*time.Hour + time.Minute, -3, -3},
+	}
+	for i, step := range steps {
+		now = start.Add(step.after)
+		if got := delta.Add(Trade{ID: int64(i + 1), Contract: "BTC_USDT", Size: step.size}); got != step.want {
+			t.Errorf("delta at +%s = %v, want %v", step.after, got, step.want)
+		}
+	}
+	now = start.Add(6 * time.Hour)
+	if totals := delta.Totals(); len(totals) != 0 {
+		t.Errorf("totals after the reset = %v, want none", totals)
+	}
+}
+
+func TestDeltaEndpointDisabled(t *testing.T) {
+	newTestTracker(t, func(cfg *Config) { cfg.Trades = false })
+	handleWebSocketMessage(tradesMessage(Trade{ID: 1, Contract: "BTC_USDT", Size: 1}), time.Now().UnixNano())
+	rec := httptest.NewRecorder()
+	handleDelta(rec, httptest.NewRequest(http.MethodGet, "/delta", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 with trades disabled", rec.Code)
+	}
+}
@@ -0,0 +1,70 @@
+package gateorderbook
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Ограниченный пул горутин: не больше size заданий выполняются одновременно
+type workerPool struct {
+	size int
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{size: size}
+}
+
+// Число рабочих горутин
+func (p *workerPool) Size() int {
+	return p.size
+}
+
+// Выполнение fn(0..n-1) не более чем в size горутинах; возврат после
+// завершения всех заданий
+func (p *workerPool) Run(n int, fn func(i int)) {
+	workers := p.size
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Число рабочих горутин по ограничению CPU (0 - GOMAXPROCS)
+func workerCount(maxCPU int) int {
+	if maxCPU > 0 {
+		return maxCPU
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// Пулы сохранения книг и обработки начальных снимков (загрузка, разбор,
+// сохранение); размер задается Config.MaxCPU
+var (
+	saveWorkers    = newWorkerPool(workerCount(0))
+	processWorkers = newWorkerPool(workerCount(0))
+)
@@ -0,0 +1,120 @@
+package gateorderbook
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolsFollowMaxCPU(t *testing.T) {
+	tests := []struct {
+		maxCPU int
+		want   int
+	}{
+		{0, runtime.GOMAXPROCS(0)},
+		{1, 1},
+		{3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.maxCPU), func(t *testing.T) {
+			newTestTracker(t, func(cfg *Config) { cfg.MaxCPU = tt.maxCPU })
+			if saveWorkers.Size() != tt.want || processWorkers.Size() != tt.want {
+				t.Errorf("pools = %d save, %d processing, want %d", saveWorkers.Size(), processWorkers.Size(), tt.want)
+			}
+		})
+	}
+}
+
+// Максимальное число одновременно выполнявшихся заданий
+type concurrencyProbe struct {
+	running, peak atomic.Int32
+}
+
+func (p *concurrencyProbe) enter() {
+	n := p.running.Add(1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+}
+
+func (p *concurrencyProbe) leave() {
+	p.running.Add(-1)
+}
+
+func TestWorkerPoolRun(t *testing.T) {
+	tests := []struct {
+		size, jobs int
+	}{
+		{1, 5},
+		{3, 20},
+		{8, 2},
+		{4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d workers %d jobs", tt.size, tt.jobs), func(t *testing.T) {
+			var probe concurrencyProbe
+			done := make([]bool, tt.jobs)
+			newWorkerPool(tt.size).Run(tt.jobs, func(i int) {
+				probe.enter()
+				defer probe.leave()
+				done[i] = true
+			})
+			for i, ok := range done {
+				if !ok {
+					t.Errorf("job %d not run", i)
+				}
+			}
+			if peak := int(probe.peak.Load()); peak > tt.size {
+				t.Errorf("%d jobs ran at once, limit %d", peak, tt.size)
+			}
+		})
+	}
+}
+
+// Приемник, учитывающий одновременные сохранения
+type probeWriter struct {
+	bytes.Buffer
+	probe *concurrencyProbe
+}
+
+func (w *probeWriter) Close() error {
+	w.probe.leave()
+	return nil
+}
+
+func TestSaveOrderBooksUsesSaveWorkers(t *testing.T) {
+	var probe concurrencyProbe
+	var mu sync.Mutex
+	saved := make(map[string]bool)
+	newTestTracker(t, func(cfg *Config) {
+		cfg.MaxCPU = 2
+		cfg.SaverEnabled = true
+		cfg.Writer = func(contract string) (io.WriteCloser, error) {
+			mu.Lock()
+			saved[contract] = true
+			mu.Unlock()
+			probe.enter()
+			return &probeWriter{probe: &probe}, nil
+		}
+	})
+	for i := 0; i < 10; i++ {
+		orderbooks.Set(fmt.Sprintf("C%d_USDT", i), testBook(1, levels("101:1"), levels("99:1")))
+	}
+
+	saveOrderBooks(false, true)
+	if len(saved) != 10 {
+		t.Errorf("saved %d books, want 10", len(saved))
+	}
+	if peak := probe.peak.Load(); peak > 2 {
+		t.Errorf("%d books saved at once, limit 2", peak)
+	}
+}
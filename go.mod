@@ -1,5 +1,24 @@
 module gateio-perpetual-futures-orderbooks-golang
 
-go 1.21.6
+go 1.22
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/shopspring/decimal v1.4.0
+
+require google.golang.org/protobuf v1.36.5
+
+require github.com/prometheus/client_golang v1.19.1
+
+require github.com/klauspost/compress v1.18.0
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+)
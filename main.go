@@ -1,315 +1,361 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
-	"path/filepath"
-	"strconv"
+	"os/signal"
+	"runtime"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/websocket"
+	"gateio-perpetual-futures-orderbooks-golang/gateorderbook"
 )
 
-// Структуры для REST API
-type OrderBookItem struct {
-	P string  `json:"p"` // Price
-	S float64 `json:"s"` // Size as float64
+// Перечитывание -config по SIGHUP: применяется уровень логирования из файла
+// (с тем же приоритетом, что и при запуске: явный -log-level важнее файла)
+func watchLogLevelSignal(fs *flag.FlagSet, configPath string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := reloadLogLevel(fs, configPath); err != nil {
+				log.Printf("ERROR Failed to reload log level (SIGHUP): %v", err)
+			}
+		}
+	}()
 }
 
-type OrderBookResponse struct {
-	ID      int64           `json:"id"`      // Orderbook ID
-	Current float64         `json:"current"` // Data generation time
-	Update  float64         `json:"update"`  // Last update time
-	Asks    []OrderBookItem `json:"asks"`    // Ask orders
-	Bids    []OrderBookItem `json:"bids"`    // Bid orders
+// Уровень логирования из заново прочитанного файла конфигурации и флагов
+func reloadLogLevel(fs *flag.FlagSet, configPath string) error {
+	cfg := gateorderbook.DefaultConfig()
+	if err := applyConfig(&cfg, fs, configPath, nil); err != nil {
+		return err
+	}
+	gateorderbook.LogLevel.Set(cfg.LogLevel)
+	log.Printf("Log level set to %s (SIGHUP)", cfg.LogLevel)
+	return nil
 }
 
-// Структура для WebSocket сообщений
-type WebSocketMessage struct {
-	Time    int64           `json:"time"`
-	Channel string          `json:"channel"`
-	Event   string          `json:"event"`
-	Result  json.RawMessage `json:"result"` // Changed to RawMessage for flexible parsing
-}
+// Повторяемый флаг со списком значений
+type stringList []string
 
-// Структура для обновления ордербука
-type OrderBookUpdate struct {
-	Contract string          `json:"s"` // Contract name in update messages
-	Asks     []OrderBookItem `json:"a"` // Ask orders
-	Bids     []OrderBookItem `json:"b"` // Bid orders
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
 }
 
-// Структура для подтверждения подписки
-type SubscriptionResponse struct {
-	Status string `json:"status"`
+func (l *stringList) Set(value string) error {
+	*l = append(*l, gateorderbook.ParseContractList(value)...)
+	return nil
 }
 
-// Глобальные переменные для хранения ордербуков
-var orderbooks = make(map[string]OrderBookResponse)
-
-// Получение REST снимка ордербука
-func getOrderBookSnapshot(settle, contract string, limit int) (OrderBookResponse, error) {
-	host := "https://api.gateio.ws"
-	prefix := "/api/v4"
-	endpoint := fmt.Sprintf("%s%s/futures/%s/order_book?contract=%s&limit=%d", host, prefix, settle, contract, limit)
+// Определение флагов, которые можно задать и в файле конфигурации: main
+// и тесты applyConfig используют один набор с одинаковыми именами и значениями
+// по умолчанию. Возвращает путь к файлу (-config) и список -contract.
+func defineConfigFlags(fs *flag.FlagSet, cfg gateorderbook.Config) (*string, *stringList) {
+	configPath := fs.String("config", "", "JSON or YAML (.yaml/.yml) file with contracts, settle, depth, interval, save_interval, format, dump_group_by, dump_groups and log_level; flags given on the command line override it; the file is reread on SIGHUP to apply its log_level")
+	contracts := new(stringList)
+	fs.Var(contracts, "contract", "contract to track, optionally prefixed with its settle currency (btc:BTC_USD); may be repeated, adds to -contracts")
+	fs.String("contracts", strings.Join(cfg.Contracts, ","), "comma-separated contracts to track; prefix a contract with its settle currency to track it on that settle, e.g. btc:BTC_USD")
+	fs.String("settle", cfg.Settle, "default settle currency of the tracked contracts, e.g. usdt or btc")
+	fs.Int("depth", cfg.SnapshotDepth, "default REST snapshot depth (limit)")
+	fs.String("interval", cfg.UpdateInterval, "orderbook update interval to subscribe with (20ms or 100ms); falls back to a coarser one if rejected")
+	fs.Duration("save-interval", cfg.SaveInterval, "how often orderbooks are saved to ./orderbooks")
+	fs.String("format", cfg.OutputFormat, "format of saved orderbooks: text (<symbol>.txt), json (<symbol>.json with the full book, levels sorted), map (<symbol>.json with unordered price -> size maps per side) or protobuf (<symbol>.pb, length-delimited messages of proto/orderbook.proto; also switches -changelog to <symbol>.changes.pb)")
+	fs.String("dump-group-by", cfg.DumpGroupBy, "group books of /dump and -dump-on-exit as {group: {contract: book}}: base (base asset, BTC for BTC_USDT) or tag (groups from -dump-groups); empty keeps {contract: book}")
+	fs.String("dump-groups", "", "contract groups for -dump-group-by tag, e.g. BTC_USDT=majors,ETH_USDT=majors; untagged contracts go to \"other\"")
+	fs.String("log-level", strings.ToLower(cfg.LogLevel.String()), "log level: debug, info, warn (warnings and errors only) or error (errors only); overrides log_level of -config, so SIGHUP cannot change it")
+	return configPath, contracts
+}
 
-	resp, err := http.Get(endpoint)
-	if err != nil {
-		return OrderBookResponse{}, fmt.Errorf("HTTP request error: %v", err)
+// Приоритет: значения по умолчанию, затем файл конфигурации, затем явно заданные флаги
+func applyConfig(cfg *gateorderbook.Config, fs *flag.FlagSet, configPath string, contracts []string) error {
+	if configPath != "" {
+		fileConfig, err := gateorderbook.ReadConfigFile(configPath)
+		if err != nil {
+			return fmt.Errorf("Invalid -config: %v", err)
+		}
+		if err := fileConfig.Apply(cfg); err != nil {
+			return fmt.Errorf("Invalid -config: %v", err)
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return OrderBookResponse{}, fmt.Errorf("Response read error: %v", err)
+	setFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+	value := func(name string) interface{} {
+		return fs.Lookup(name).Value.(flag.Getter).Get()
 	}
-
-	if resp.StatusCode != 200 {
-		return OrderBookResponse{}, fmt.Errorf("API error, status: %d, response: %s", resp.StatusCode, string(body))
+	if setFlags["contracts"] || len(contracts) > 0 {
+		cfg.Contracts = nil
+		if setFlags["contracts"] {
+			cfg.Contracts = gateorderbook.ParseContractList(value("contracts").(string))
+		}
+		cfg.Contracts = append(cfg.Contracts, contracts...)
 	}
-
-	var orderbook OrderBookResponse
-	err = json.Unmarshal(body, &orderbook)
-	if err != nil {
-		return OrderBookResponse{}, fmt.Errorf("JSON parse error: %v", err)
+	if setFlags["settle"] {
+		cfg.Settle = value("settle").(string)
 	}
-
-	return orderbook, nil
-}
-
-// Форматирование ордербука в текстовый формат
-func formatOrderBook(orderbook OrderBookResponse) string {
-	var sb strings.Builder
-
-	// Форматируем asks (в обратном порядке)
-	for i := len(orderbook.Asks) - 1; i >= 0; i-- {
-		ask := orderbook.Asks[i]
-		price, _ := strconv.ParseFloat(ask.P, 64)
-		size := ask.S
-		sb.WriteString(fmt.Sprintf("ASK %.8f | %.8f\n", price, size))
+	if setFlags["depth"] {
+		cfg.SnapshotDepth = value("depth").(int)
 	}
-
-	// Разделительная линия
-	sb.WriteString("------------------------\n")
-
-	// Форматируем bids
-	for _, bid := range orderbook.Bids {
-		price, _ := strconv.ParseFloat(bid.P, 64)
-		size := bid.S
-		sb.WriteString(fmt.Sprintf("BID %.8f | %.8f\n", price, size))
+	if setFlags["interval"] {
+		cfg.UpdateInterval = value("interval").(string)
 	}
-
-	return sb.String()
-}
-
-// Сохранение ордербука в файл
-func saveOrderBook(symbol string, orderbook OrderBookResponse) error {
-	// Проверяем, что символ не пустой
-	if symbol == "" {
-		return fmt.Errorf("empty symbol provided")
+	if setFlags["save-interval"] {
+		cfg.SaveInterval = value("save-interval").(time.Duration)
 	}
-
-	// Создаем директорию если её нет
-	orderbookDir := "./orderbooks"
-	err := os.MkdirAll(orderbookDir, 0755)
-	if err != nil {
-		return fmt.Errorf("failed to create orderbooks directory: %v", err)
+	if setFlags["format"] {
+		cfg.OutputFormat = value("format").(string)
 	}
-
-	// Форматируем ордербук в текстовый вид
-	formattedOrderbook := formatOrderBook(orderbook)
-
-	filename := filepath.Join(orderbookDir, fmt.Sprintf("%s.txt", symbol))
-	err = ioutil.WriteFile(filename, []byte(formattedOrderbook), 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write file %s: %v", filename, err)
+	if setFlags["dump-group-by"] {
+		cfg.DumpGroupBy = value("dump-group-by").(string)
+	}
+	if setFlags["log-level"] {
+		level, err := gateorderbook.ParseLogLevel(value("log-level").(string))
+		if err != nil {
+			return fmt.Errorf("Invalid -log-level: %v", err)
+		}
+		cfg.LogLevel = level
+	}
+	if setFlags["dump-groups"] {
+		groups, err := gateorderbook.ParseContractGroups(value("dump-groups").(string))
+		if err != nil {
+			return fmt.Errorf("Invalid -dump-groups: %v", err)
+		}
+		cfg.DumpGroups = groups
 	}
-
-	log.Printf("Orderbook saved to %s", filename)
 	return nil
 }
 
-// Обновление списка ордеров
-func updateOrders(existing []OrderBookItem, updates []OrderBookItem) []OrderBookItem {
-	// Создаем карту существующих ордеров для быстрого доступа
-	ordersMap := make(map[string]float64)
-	for _, order := range existing {
-		ordersMap[order.P] = order.S
-	}
+func main() {
+	cfg := gateorderbook.DefaultConfig()
+
+	configPath, contractFlags := defineConfigFlags(flag.CommandLine, cfg)
+	perContractDepth := flag.String("contract-depth", "", "per-contract snapshot depth overrides, e.g. BTC_USDT=100,LTC_USDT=20")
+	httpAddr := flag.String("http-addr", "", "address of the HTTP API, e.g. :8080 (disabled if empty)")
+	httpTLSCert := flag.String("http-tls-cert", "", "TLS certificate file for the HTTP API (enables HTTPS)")
+	httpTLSKey := flag.String("http-tls-key", "", "TLS private key file for the HTTP API")
+	httpClientCA := flag.String("http-client-ca", "", "CA file for verifying HTTP API client certificates (enables mutual TLS)")
+	maxCPU := flag.Int("max-cpu", runtime.GOMAXPROCS(0), "maximum number of CPUs used by the tracker: sets GOMAXPROCS and the number of save workers and initial snapshot workers (defaults to the current GOMAXPROCS)")
+	statsdAddr := flag.String("statsd-addr", "", "StatsD host:port to send metrics to over UDP (disabled if empty)")
+	prometheusFlag := flag.Bool("prometheus", false, "serve Prometheus metrics (updates, resyncs, reconnects, parse errors, depth and spread per contract) on /metrics of the HTTP API; requires -http-addr")
+	statsdPrefix := flag.String("statsd-prefix", cfg.StatsdPrefix, "prefix for StatsD metric names")
+	dnsCacheTTL := flag.Duration("dns-cache-ttl", cfg.DNSCacheTTL, "how long resolved Gate.io addresses are cached; the last good address is reused if DNS fails (0 disables)")
+	secretsFile := flag.String("secrets-file", "", "path to a JSON file with secrets kept out of ps: proxy (URL, may contain credentials), api_key and api_secret; with a key, REST requests and subscriptions are signed; keep it chmod 600")
+	minSpreadBps := flag.Float64("min-spread-bps", 0, "exclude contracts with a spread below this (bps) from aggregate stats; crossed/locked books are always excluded")
+	outputDepth := flag.String("output-depth", "", "also save fixed-depth views of each book, e.g. 5,50 writes <symbol>.5.txt and <symbol>.50.txt")
+	staleAfter := flag.Duration("stale-after", cfg.StaleAfter, "warn when a contract receives no update for this long; ages are exported as metrics and on /staleness of the HTTP API (0 disables)")
+	staleResyncFlag := flag.Bool("stale-resync", false, "also resync a stale book from a fresh REST snapshot (requires -stale-after)")
+	maxResyncs := flag.Int("max-resyncs-per-hour", 0, "warn when a contract resyncs more than this many times within an hour; resync counts are always exported as metrics and on /stats (0 disables the warning)")
+	oneSidedAfter := flag.Duration("one-sided-alert", cfg.OneSidedAlert, "alert when a book has no bids or no asks for longer than this (0 disables)")
+	alertLevels := flag.String("price-alerts", "", "per-contract price levels, e.g. BTC_USDT=65000; alert when best bid rises above or best ask falls below")
+	alertWebhook := flag.String("alert-webhook", "", "URL to POST price and liquidity alerts to as JSON")
+	liquidityAlerts := flag.String("liquidity-alerts", "", "per-contract depth thresholds, e.g. BTC_USDT=50000; alert when bid+ask size within -liquidity-band-bps of mid falls below the threshold and when it recovers")
+	liquidityBand := flag.Float64("liquidity-band-bps", cfg.LiquidityBandBps, "distance from mid in bps within which depth is summed for -liquidity-alerts")
+	liquidityHyst := flag.Float64("liquidity-hysteresis", cfg.LiquidityHyst, "fraction above the threshold depth must recover to before a liquidity alert re-arms, e.g. 0.1 = 10%")
+	alertSave := flag.Bool("alert-save", cfg.AlertSave, "save the contract's orderbook when its price alert fires (unless saving is disabled or the contract is paused)")
+	tcpAddr := flag.String("tcp-addr", "", "address of the TCP stream server with length-prefixed snapshot/delta frames (disabled if empty)")
+	sizeCheckInterval := flag.Duration("size-check-interval", 0, "periodically compare per-side size totals of the live book with a fresh REST snapshot (0 disables)")
+	sizeCheckTolerance := flag.Float64("size-check-tolerance", cfg.SizeCheckTolerance, "relative size total difference (0.05 = 5%) above which a book is flagged as drifted")
+	clickhouseURL := flag.String("clickhouse-url", "", "ClickHouse HTTP endpoint to insert level updates into, e.g. http://localhost:8123 (disabled if empty)")
+	clickhouseTable := flag.String("clickhouse-table", cfg.ClickHouseTable, "ClickHouse table for level updates")
+	clickhouseBatch := flag.Int("clickhouse-batch", cfg.ClickHouseBatch, "rows per ClickHouse insert")
+	clickhouseFlush := flag.Duration("clickhouse-flush-interval", cfg.ClickHouseFlushInterval, "how often partial ClickHouse batches are inserted")
+	trackTrades := flag.Bool("trades", false, "subscribe to trades and track cumulative volume delta (aggressive buys minus sells) per contract")
+	deltaReset := flag.Duration("delta-reset", 0, "reset cumulative volume delta every this often (0 never resets)")
+	maxTimeSkew := flag.Duration("max-time-skew", cfg.MaxTimeSkew, "server update times further than this from the local clock are replaced by the local receive time (0 accepts any non-zero time)")
+	reconnectInitial := flag.Duration("reconnect-initial", cfg.Reconnect.InitialBackoff, "delay before the first WebSocket reconnect attempt; doubles on each failure")
+	reconnectMax := flag.Duration("reconnect-max", cfg.Reconnect.MaxBackoff, "maximum delay between WebSocket reconnect attempts")
+	flapThreshold := flag.Int("flap-threshold", cfg.Reconnect.FlapThreshold, "disconnects of one WebSocket feed within -flap-window that mark it as flapping; each further disconnect quadruples the reconnect delay (0 disables)")
+	flapWindow := flag.Duration("flap-window", cfg.Reconnect.FlapWindow, "window for counting WebSocket disconnects for flap detection")
+	maxBuffered := flag.Int("max-buffered-updates", cfg.MaxBufferedUpdates, "updates kept per contract while waiting for its REST snapshot; the oldest are dropped beyond this")
+	subscribeTimeFlag := flag.String("subscribe-time", cfg.SubscribeTime, "time field of subscribe requests: local (local clock) or server (local clock corrected by the offset to Gate.io server time, from the REST time endpoint and the time of received frames)")
+	zeroSnapshotID := flag.String("zero-snapshot-id", cfg.ZeroSnapshotID, "handling of REST snapshots with a zero or missing id (new contracts): anchor (accept it and start the sequence at the next update) or refetch (request another snapshot up to 3 times, then anchor)")
+	maxSnapshotAgeFlag := flag.Duration("max-snapshot-age", cfg.MaxSnapshotAge, "re-fetch REST snapshots whose generation time (current) is older than this relative to the local clock, e.g. when served from a stale cache (0 disables)")
+	httpTimeoutFlag := flag.Duration("http-timeout", cfg.HTTPTimeout, "timeout of a REST request to the Gate.io API, including reading the response")
+	rateLimitRetriesFlag := flag.Int("rate-limit-retries", cfg.RateLimitRetries, "how many times a REST request rejected with HTTP 429 is retried after its Retry-After delay (exponential backoff without the header)")
+	snapshotAttemptsFlag := flag.Int("snapshot-attempts", cfg.SnapshotAttempts, "attempts to fetch a REST snapshot when the request fails with a network error or a 5xx response")
+	snapshotBackoffFlag := flag.Duration("snapshot-backoff", cfg.SnapshotBackoff, "pause before retrying a failed REST snapshot request, doubled after each attempt")
+	reorderWindowFlag := flag.Duration("reorder-window", cfg.ReorderWindow, "how long updates arriving after a sequence gap are held for the missing ones before the book is resynced (0 resyncs immediately)")
+	wsHost := flag.String("ws-host", cfg.WSHost, "Gate.io futures WebSocket host or wss:// URL (path defaults to /v4/ws); known hosts: fx-ws.gateio.ws (live), fx-ws-testnet.gateio.ws (testnet)")
+	dumpOnExit := flag.String("dump-on-exit", "", "write all books (with update times and last update ids) as one JSON document to this file on graceful shutdown")
+	isolate := flag.String("isolate", "", "comma-separated contracts that get their own dedicated WebSocket connection")
+	redundantFeeds := flag.Int("redundant-feeds", cfg.RedundantFeeds, "number of independent WebSocket connections carrying the same subscriptions; duplicate updates are dropped")
+	enableSaver := flag.Bool("enable-saver", cfg.SaverEnabled, "periodically save orderbooks to ./orderbooks (set false to keep books in memory only)")
+	sampleMode := flag.String("sample", cfg.SampleMode, "when orderbooks are saved: fixed (every -save-interval) or poisson (exponentially distributed gaps, avoids aliasing in archives)")
+	sampleRate := flag.Float64("sample-rate", cfg.SampleRate, "mean saves per second in -sample poisson mode")
+	sampleSeed := flag.Int64("sample-seed", 0, "random seed for -sample poisson; the same seed reproduces the same gaps (0 picks a seed and logs it)")
+	jitter := flag.Duration("save-jitter", 0, "random delay up to this duration before the first periodic save, to spread I/O across instances")
+	maxJump := flag.Float64("max-jump-pct", 0, "warn when the best bid or ask moves more than this percentage between consecutive updates (0 disables)")
+	holdJumps := flag.Bool("hold-jumps", false, "with -max-jump-pct, hold a book after a suspect jump until the next update confirms or reverts it")
+	resyncCrossedBooks := flag.Bool("resync-crossed", false, "refetch the REST snapshot when a book becomes crossed (best bid above best ask); crossings are always logged and counted in /stats")
+	resilienceBand := flag.Float64("resilience-band-bps", 0, "track how fast depth within this band (bps) of the best price recovers after levels are removed (0 disables)")
+	priceAsTicks := flag.Bool("price-as-ticks", false, "add the price in integer ticks (from contract tick size) as a third column of the text output")
+	replayFile := flag.String("replay", "", "rebuild books from a recorded -changelog file (NDJSON, or protobuf if it ends in .pb; .gz and .zst files are decompressed) instead of connecting to Gate.io; saving, HTTP and TCP work as in live mode")
+	replayRealtime := flag.Bool("replay-realtime", false, "replay at the recorded pace instead of as fast as possible")
+	replayValidate := flag.Bool("replay-validate", false, "with -replay, check that every rebuilt book is sorted and not crossed and that update ids are continuous; stop at the first violation and report its timestamp")
+	changeLogFlag := flag.Bool("changelog", false, "append every applied update (timestamp, contract, asks/bids delta) as a JSON line to orderbooks/<symbol>.ndjson")
+	changeLogRotate := flag.Int64("changelog-rotate-size", 0, "rotate change logs when they reach this many bytes; 0 rotates daily (UTC)")
+	compress := flag.String("compress", "", "compress change logs and top-of-book series with gzip or zstd, adding .gz or .zst to the file names (empty writes plain files)")
+	compressLevel := flag.Int("compress-level", 0, "compression level for -compress: gzip 1-9, zstd 1-22 (0 uses the codec default)")
+	spreadMetricsFlag := flag.Bool("metrics-csv", false, "append a ts,contract,bestBid,bestAsk,spread,spreadBps,mid row per contract to orderbooks/metrics.csv on every save")
+	tobSeries := flag.Bool("tob-series", false, "append a ts,bestBid,bestAsk,midPrice row per update to <symbol>.tob.csv")
+	seriesBuffer := flag.Int("series-buffer", 0, "top-of-book series buffer size in bytes per file; larger is faster but loses unflushed rows on a crash (0 writes each row through)")
+	seriesFlushInterval := flag.Duration("series-flush-interval", cfg.SeriesFlushInterval, "how often buffered top-of-book series rows are flushed")
+	seriesFsync := flag.Bool("series-fsync", false, "fsync top-of-book series files on every flush for durability against OS crashes")
+	maxRecordsPerSec := flag.Int("max-records-per-sec", 0, "cap top-of-book series rows per contract per second, keeping the latest row when exceeded (0 = unlimited)")
+	pidFile := flag.String("pidfile", "", "write the process PID to this file and remove it on shutdown")
+	intervalWindow := flag.Int("interval-window", cfg.IntervalWindow, "number of inter-update intervals kept per contract")
+	rollupBoundary := flag.String("rollup-boundary", "", "write a daily <date>-summary.json per contract at this UTC time of day, e.g. 00:00 (disabled if empty)")
+	midRetention := flag.Duration("mid-history", cfg.MidHistory, "how long mid prices are kept per contract for TWAP")
+	midEMAAlpha := flag.Float64("mid-ema-alpha", 0, "smoothing factor in (0, 1] for a per-contract EMA of the mid price, updated on every book update (0 disables)")
+	midEMAPeriod := flag.Int("mid-ema-period", 0, "mid price EMA period in updates, alpha = 2/(N+1); alternative to -mid-ema-alpha (0 disables)")
+	flag.Parse()
 
-	// Обновляем или удаляем ордера
-	for _, update := range updates {
-		if update.S == 0 {
-			// Если размер 0, удаляем ордер
-			delete(ordersMap, update.P)
-		} else {
-			// Иначе обновляем или добавляем
-			ordersMap[update.P] = update.S
-		}
-	}
+	fmt.Println("Gate.io Perpetual Futures Orderbook Tracker")
+	fmt.Println("Version: 1.0.0")
+	fmt.Println("---")
 
-	// Преобразуем обратно в слайс
-	var result []OrderBookItem
-	for price, size := range ordersMap {
-		result = append(result, OrderBookItem{P: price, S: size})
+	if *maxCPU < 1 {
+		log.Fatal("Invalid -max-cpu: must be at least 1")
 	}
+	runtime.GOMAXPROCS(*maxCPU)
 
-	return result
-}
-
-// Обработка WebSocket сообщений
-func handleWebSocketMessage(msg []byte) {
-	var wsMsg WebSocketMessage
-	err := json.Unmarshal(msg, &wsMsg)
+	var err error
+	cfg.ContractDepths, err = gateorderbook.ParseContractDepths(*perContractDepth)
 	if err != nil {
-		log.Printf("WebSocket message parse error: %v", err)
-		return
+		log.Fatal("Invalid -contract-depth:", err)
 	}
-
-	// Проверяем, что это сообщение с обновлением ордербука
-	if wsMsg.Channel == "futures.order_book_update" {
-		if wsMsg.Event == "subscribe" {
-			// Обрабатываем подтверждение подписки
-			var subResp SubscriptionResponse
-			err = json.Unmarshal(wsMsg.Result, &subResp)
-			if err != nil {
-				log.Printf("Subscription response parse error: %v", err)
-			} else {
-				log.Printf("Subscription status: %s", subResp.Status)
-			}
-			return
-		}
-
-		if wsMsg.Event == "update" {
-			// Обрабатываем обновление ордербука
-			var update OrderBookUpdate
-			err = json.Unmarshal(wsMsg.Result, &update)
-			if err != nil {
-				log.Printf("Update message parse error: %v", err)
-				return
-			}
-
-			contract := update.Contract
-			if contract == "" {
-				log.Printf("Warning: Empty contract in update message: %s", string(msg))
-				return
-			}
-
-			// Получаем существующий ордербук
-			existing, ok := orderbooks[contract]
-			if !ok {
-				log.Printf("Warning: No existing orderbook for contract %s", contract)
-				return
-			}
-
-			// Обновляем asks и bids
-			if len(update.Asks) > 0 || len(update.Bids) > 0 {
-				// Обновляем существующие ордера
-				existing.Asks = updateOrders(existing.Asks, update.Asks)
-				existing.Bids = updateOrders(existing.Bids, update.Bids)
-				existing.Update = float64(wsMsg.Time) / 1000
-				orderbooks[contract] = existing
-
-				log.Printf("Updated orderbook for contract: %s (asks updates: %d, bids updates: %d)",
-					contract, len(update.Asks), len(update.Bids))
-			}
-		}
+	cfg.OutputDepths, err = gateorderbook.ParseOutputDepths(*outputDepth)
+	if err != nil {
+		log.Fatal("Invalid -output-depth:", err)
 	}
-}
-
-// Подключение к WebSocket
-func connectWebSocket(contracts []string) {
-	url := "wss://fx-ws.gateio.ws/v4/ws/usdt"
-
-	c, _, err := websocket.DefaultDialer.Dial(url, nil)
+	cfg.PriceAlerts, err = gateorderbook.ParsePriceLevels(*alertLevels)
 	if err != nil {
-		log.Fatal("WebSocket connection error:", err)
+		log.Fatal("Invalid -price-alerts:", err)
+	}
+	cfg.LiquidityAlerts, err = gateorderbook.ParseLiquidityThresholds(*liquidityAlerts)
+	if err != nil {
+		log.Fatal("Invalid -liquidity-alerts:", err)
 	}
-	defer c.Close()
-
-	// Подписываемся на обновления ордербука для каждого контракта отдельно
-	for _, contract := range contracts {
-		subscribeMsg := map[string]interface{}{
-			"time":    time.Now().Unix(),
-			"channel": "futures.order_book_update",
-			"event":   "subscribe",
-			"payload": []string{contract, "100ms"}, // Добавляем интервал обновления как второй аргумент
-		}
 
-		err = c.WriteJSON(subscribeMsg)
-		if err != nil {
-			log.Printf("WebSocket subscription error for %s: %v", contract, err)
-			continue
-		}
-		log.Printf("Subscribed to %s orderbook updates", contract)
+	if err := applyConfig(&cfg, flag.CommandLine, *configPath, *contractFlags); err != nil {
+		log.Fatal(err)
+	}
+	gateorderbook.LogLevel.Set(cfg.LogLevel)
+	watchLogLevelSignal(flag.CommandLine, *configPath)
+
+	cfg.WSHost = *wsHost
+	cfg.Isolated = gateorderbook.ParseContractList(*isolate)
+	cfg.RedundantFeeds = *redundantFeeds
+	cfg.MaxBufferedUpdates = *maxBuffered
+	cfg.ReorderWindow = *reorderWindowFlag
+	cfg.MaxSnapshotAge = *maxSnapshotAgeFlag
+	cfg.HTTPTimeout = *httpTimeoutFlag
+	cfg.RateLimitRetries = *rateLimitRetriesFlag
+	cfg.SnapshotAttempts = *snapshotAttemptsFlag
+	cfg.SnapshotBackoff = *snapshotBackoffFlag
+	cfg.ZeroSnapshotID = *zeroSnapshotID
+	cfg.SubscribeTime = *subscribeTimeFlag
+	cfg.MaxTimeSkew = *maxTimeSkew
+	cfg.Reconnect.InitialBackoff = *reconnectInitial
+	cfg.Reconnect.MaxBackoff = *reconnectMax
+	cfg.Reconnect.FlapThreshold = *flapThreshold
+	cfg.Reconnect.FlapWindow = *flapWindow
+	cfg.SaverEnabled = *enableSaver
+	cfg.SaveJitter = *jitter
+	cfg.SampleMode = *sampleMode
+	cfg.SampleRate = *sampleRate
+	cfg.SampleSeed = *sampleSeed
+	cfg.PricesAsTicks = *priceAsTicks
+	cfg.HTTPAddr = *httpAddr
+	cfg.HTTPTLS = gateorderbook.HTTPTLSOptions{
+		CertFile:     *httpTLSCert,
+		KeyFile:      *httpTLSKey,
+		ClientCAFile: *httpClientCA,
+	}
+	cfg.MinSpreadBps = *minSpreadBps
+	cfg.TCPAddr = *tcpAddr
+	cfg.StatsdAddr = *statsdAddr
+	cfg.StatsdPrefix = *statsdPrefix
+	cfg.Prometheus = *prometheusFlag
+	cfg.DNSCacheTTL = *dnsCacheTTL
+	cfg.SecretsFile = *secretsFile
+	cfg.OneSidedAlert = *oneSidedAfter
+	cfg.StaleAfter = *staleAfter
+	cfg.StaleResync = *staleResyncFlag
+	cfg.MaxResyncsPerHour = *maxResyncs
+	cfg.AlertWebhook = *alertWebhook
+	cfg.AlertSave = *alertSave
+	cfg.LiquidityBandBps = *liquidityBand
+	cfg.LiquidityHyst = *liquidityHyst
+	cfg.ResilienceBandBps = *resilienceBand
+	cfg.MaxJumpPct = *maxJump
+	cfg.HoldJumps = *holdJumps
+	cfg.ResyncCrossed = *resyncCrossedBooks
+	cfg.TopOfBookSeries = *tobSeries
+	cfg.SpreadMetrics = *spreadMetricsFlag
+	cfg.ChangeLog = *changeLogFlag
+	cfg.ChangeLogRotateSize = *changeLogRotate
+	cfg.Compress = *compress
+	cfg.CompressLevel = *compressLevel
+	cfg.ReplayValidate = *replayValidate
+	cfg.SeriesBuffer = *seriesBuffer
+	cfg.SeriesFlushInterval = *seriesFlushInterval
+	cfg.SeriesFsync = *seriesFsync
+	cfg.MaxRecordsPerSec = *maxRecordsPerSec
+	cfg.SizeCheckInterval = *sizeCheckInterval
+	cfg.SizeCheckTolerance = *sizeCheckTolerance
+	cfg.ClickHouseURL = *clickhouseURL
+	cfg.ClickHouseTable = *clickhouseTable
+	cfg.ClickHouseBatch = *clickhouseBatch
+	cfg.ClickHouseFlushInterval = *clickhouseFlush
+	cfg.Trades = *trackTrades
+	cfg.DeltaReset = *deltaReset
+	cfg.IntervalWindow = *intervalWindow
+	cfg.RollupBoundary = *rollupBoundary
+	cfg.MidHistory = *midRetention
+	cfg.MidEMAAlpha = *midEMAAlpha
+	cfg.MidEMAPeriod = *midEMAPeriod
+	cfg.DumpOnExit = *dumpOnExit
+	cfg.MaxCPU = *maxCPU
+
+	if !cfg.SaverEnabled && cfg.HTTPAddr == "" {
+		log.Println("Warning: saver and HTTP API are both disabled, orderbooks are only kept in memory")
 	}
 
-	log.Println("WebSocket connected and subscribed to all contracts")
+	tracker, err := gateorderbook.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	onShutdown(tracker.Close)
 
-	// Обработка входящих сообщений
-	for {
-		_, message, err := c.ReadMessage()
-		if err != nil {
-			log.Println("WebSocket read error:", err)
-			return
+	if *pidFile != "" {
+		if err := writePIDFile(*pidFile); err != nil {
+			fatalAfterShutdown(err)
 		}
-		handleWebSocketMessage(message)
+		onShutdown(func() { removePIDFile(*pidFile) })
 	}
-}
 
-// Запуск периодического сохранения ордербуков
-func startOrderBookSaver() {
-	ticker := time.NewTicker(50 * time.Millisecond)
+	// Завершение по SIGINT/SIGTERM; повторный сигнал прерывает процесс сразу
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	go func() {
-		for range ticker.C {
-			for symbol, orderbook := range orderbooks {
-				err := saveOrderBook(symbol, orderbook)
-				if err != nil {
-					log.Printf("Error saving orderbook for %s: %v", symbol, err)
-				}
-			}
-		}
+		<-ctx.Done()
+		stop()
 	}()
-}
 
-func main() {
-	fmt.Println("Gate.io Perpetual Futures Orderbook Tracker")
-	fmt.Println("Version: 1.0.0")
-	fmt.Println("---")
-
-	// Создаем директорию для ордербуков если её нет
-	err := os.MkdirAll("./orderbooks", 0755)
-	if err != nil {
-		log.Fatal("Failed to create orderbooks directory:", err)
+	if *replayFile != "" {
+		err = tracker.Replay(ctx, *replayFile, *replayRealtime)
+	} else {
+		err = tracker.Run(ctx)
 	}
-
-	// Список контрактов для отслеживания
-	contracts := []string{"BTC_USDT", "ETH_USDT", "LTC_USDT"}
-
-	// Получаем начальные снимки ордербуков
-	for _, contract := range contracts {
-		orderbook, err := getOrderBookSnapshot("usdt", contract, 50)
-		if err != nil {
-			log.Printf("Failed to get initial orderbook for %s: %v", contract, err)
-			continue
-		}
-		orderbooks[contract] = orderbook
-		log.Printf("Initial orderbook snapshot received for %s", contract)
-		// Сохраняем начальный снимок
-		err = saveOrderBook(contract, orderbook)
-		if err != nil {
-			log.Printf("Failed to save initial orderbook for %s: %v", contract, err)
-		}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fatalAfterShutdown(err)
 	}
-
-	// Запускаем периодическое сохранение
-	go startOrderBookSaver()
-
-	// Подключаемся к WebSocket
-	connectWebSocket(contracts)
+	log.Println("Shutting down")
+	runShutdownHooks()
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"gateio-perpetual-futures-orderbooks-golang/gateorderbook"
+)
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := "contracts: [SOL_USDT, XRP_USDT]\nsettle: btc\ndepth: 50\nsave_interval: 2s\n"
+	if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defaults := gateorderbook.DefaultConfig()
+
+	withFile := func(args ...string) []string { return append([]string{"-config=" + path}, args...) }
+	tests := []struct {
+		name         string
+		args         []string
+		wantContract []string
+		wantSettle   string
+		wantDepth    int
+		wantSave     time.Duration
+	}{
+		{"defaults", nil, defaults.Contracts, defaults.Settle, defaults.SnapshotDepth, defaults.SaveInterval},
+		{"file", withFile(), []string{"SOL_USDT", "XRP_USDT"}, "btc", 50, 2 * time.Second},
+		{"flags over file", withFile("-settle=usdt", "-depth=10"), []string{"SOL_USDT", "XRP_USDT"}, "usdt", 10, 2 * time.Second},
+		{"flags without file", []string{"-save-interval=5s"}, defaults.Contracts, defaults.Settle, defaults.SnapshotDepth, 5 * time.Second},
+		// Флаг со значением по умолчанию, заданный явно, тоже перекрывает файл
+		{"explicit default flag", withFile("-depth=100", "-settle="+defaults.Settle), []string{"SOL_USDT", "XRP_USDT"}, defaults.Settle, 100, 2 * time.Second},
+		{"contracts flag", withFile("-contracts=BTC_USDT"), []string{"BTC_USDT"}, "btc", 50, 2 * time.Second},
+		{"repeated contract flag", withFile("-contract=ETH_USDT", "-contract=LTC_USDT"), []string{"ETH_USDT", "LTC_USDT"}, "btc", 50, 2 * time.Second},
+		{"contracts and contract flags", []string{"-contracts=BTC_USDT", "-contract=ETH_USDT"}, []string{"BTC_USDT", "ETH_USDT"}, defaults.Settle, defaults.SnapshotDepth, defaults.SaveInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := gateorderbook.DefaultConfig()
+			fs, configPath, contracts := configFlags(t, cfg, tt.args)
+			if err := applyConfig(&cfg, fs, configPath, contracts); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.Contracts, tt.wantContract) || cfg.Settle != tt.wantSettle ||
+				cfg.SnapshotDepth != tt.wantDepth || cfg.SaveInterval != tt.wantSave {
+				t.Errorf("contracts %v, settle %q, depth %d, save interval %s; want %v, %q, %d, %s",
+					cfg.Contracts, cfg.Settle, cfg.SnapshotDepth, cfg.SaveInterval,
+					tt.wantContract, tt.wantSettle, tt.wantDepth, tt.wantSave)
+			}
+		})
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	badFile := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(badFile, []byte(`{"save_interval":"soon"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"missing file", []string{"-config=" + filepath.Join(dir, "missing.json")}, "Invalid -config"},
+		{"bad file value", []string{"-config=" + badFile}, "Invalid -config: invalid save_interval"},
+		{"bad dump groups", []string{"-dump-groups=BTC_USDT"}, "Invalid -dump-groups"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := gateorderbook.DefaultConfig()
+			fs, configPath, contracts := configFlags(t, cfg, tt.args)
+			err := applyConfig(&cfg, fs, configPath, contracts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Разбор args флагами конфигурации main
+func configFlags(t *testing.T, cfg gateorderbook.Config, args []string) (*flag.FlagSet, string, stringList) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	configPath, contracts := defineConfigFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs, *configPath, *contracts
+}
+
+func TestReloadLogLevel(t *testing.T) {
+	prev := gateorderbook.LogLevel.Level()
+	t.Cleanup(func() { gateorderbook.LogLevel.Set(prev) })
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	tests := []struct {
+		name    string
+		file    string
+		args    []string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"level from file", "log_level: debug\n", nil, slog.LevelDebug, false},
+		{"file without level", "settle: usdt\n", nil, slog.LevelInfo, false},
+		{"flag over file", "log_level: debug\n", []string{"-log-level=warn"}, slog.LevelWarn, false},
+		{"bad level in file", "log_level: loud\n", nil, slog.LevelError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// Уровень до перечитывания остается при ошибке
+			gateorderbook.LogLevel.Set(slog.LevelError)
+			fs, _, _ := configFlags(t, gateorderbook.DefaultConfig(), append([]string{"-config=" + path}, tt.args...))
+			err := reloadLogLevel(fs, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reload error = %v, want error %v", err, tt.wantErr)
+			}
+			if got := gateorderbook.LogLevel.Level(); got != tt.want {
+				t.Errorf("log level = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSIGHUPRereadsConfig(t *testing.T) {
+	prev := gateorderbook.LogLevel.Level()
+	t.Cleanup(func() { gateorderbook.LogLevel.Set(prev) })
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"log_level":"info"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs, configPath, _ := configFlags(t, gateorderbook.DefaultConfig(), []string{"-config=" + path})
+	gateorderbook.LogLevel.Set(slog.LevelInfo)
+	watchLogLevelSignal(fs, configPath)
+
+	// Оператор меняет уровень в файле и отправляет SIGHUP
+	if err := os.WriteFile(path, []byte(`{"log_level":"debug"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for gateorderbook.LogLevel.Level() != slog.LevelDebug {
+		if time.Now().After(deadline) {
+			t.Fatalf("log level = %s after SIGHUP, want DEBUG", gateorderbook.LogLevel.Level())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Проверка, что процесс с указанным PID жив
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// Запись PID файла; отказ, если файл принадлежит живому процессу
+func writePIDFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		pid, parseErr := strconv.Atoi(strings.TrimSpace(string(data)))
+		if parseErr == nil && pid != os.Getpid() && processAlive(pid) {
+			return fmt.Errorf("pid file %s is held by running process %d", path, pid)
+		}
+		log.Printf("Overwriting stale pid file %s", path)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read pid file %s: %v", path, err)
+	}
+
+	err = ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write pid file %s: %v", path, err)
+	}
+	return nil
+}
+
+// Удаление PID файла при завершении
+func removePIDFile(path string) {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove pid file %s: %v", path, err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// PID завершившегося процесса
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestWritePIDFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string // Contents before the write; "-" for no file
+		wantErr  bool
+	}{
+		{"no file", "-", false},
+		{"stale pid", strconv.Itoa(deadPID(t)) + "\n", false},
+		{"own pid", strconv.Itoa(os.Getpid()), false},
+		{"garbage", "not a pid", false},
+		{"running process", strconv.Itoa(os.Getppid()) + "\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tracker.pid")
+			if tt.existing != "-" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := writePIDFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			data, _ := os.ReadFile(path)
+			want := fmt.Sprintf("%d\n", os.Getpid())
+			if tt.wantErr {
+				want = tt.existing
+				if !strings.Contains(err.Error(), "held by running process") {
+					t.Errorf("error = %v, want a running process error", err)
+				}
+			}
+			if string(data) != want {
+				t.Errorf("pid file = %q, want %q", data, want)
+			}
+		})
+	}
+}
+
+func TestRemovePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tracker.pid")
+	if err := writePIDFile(path); err != nil {
+		t.Fatal(err)
+	}
+	removePIDFile(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("pid file still present: %v", err)
+	}
+	// Повторное удаление (файл уже удален) не ошибка
+	removePIDFile(path)
+}
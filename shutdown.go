@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// Действия при завершении (выполняются в обратном порядке)
+var (
+	shutdownMu    sync.Mutex
+	shutdownHooks []func()
+)
+
+// Регистрация действия при завершении
+func onShutdown(hook func()) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	shutdownHooks = append(shutdownHooks, hook)
+}
+
+// Выполнение действий при завершении
+func runShutdownHooks() {
+	shutdownMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	shutdownMu.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
+// Завершение с ошибкой: log.Fatal не выполнил бы действия при завершении
+// (удаление pid файла, выгрузку книг)
+func fatalAfterShutdown(err error) {
+	log.Print(err)
+	runShutdownHooks()
+	os.Exit(1)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShutdownHooksRunInReverseOnce(t *testing.T) {
+	var ran []string
+	for _, name := range []string{"pid file", "dump", "series"} {
+		name := name
+		onShutdown(func() { ran = append(ran, name) })
+	}
+	runShutdownHooks()
+	// Повторный вызов (например, после fatalAfterShutdown) ничего не делает
+	runShutdownHooks()
+	if want := []string{"series", "dump", "pid file"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("hooks ran as %v, want %v", ran, want)
+	}
+}
+
+func TestFatalAfterShutdownRunsHooks(t *testing.T) {
+	// Дочерний процесс теста завершается через fatalAfterShutdown
+	if os.Getenv("SHUTDOWN_TEST_FATAL") == "1" {
+		onShutdown(func() { fmt.Println("removed pid file") })
+		onShutdown(func() { fmt.Println("wrote dump") })
+		fatalAfterShutdown(errors.New("tracker failed"))
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFatalAfterShutdownRunsHooks$")
+	cmd.Env = append(os.Environ(), "SHUTDOWN_TEST_FATAL=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+		t.Fatalf("child exited with %v, want status 1:\n%s", err, out)
+	}
+	failed := strings.Index(string(out), "tracker failed")
+	dump := strings.Index(string(out), "wrote dump")
+	pid := strings.Index(string(out), "removed pid file")
+	if failed < 0 || dump < failed || pid < dump {
+		t.Errorf("output = %q, want the error, then the dump, then the pid file", out)
+	}
+}